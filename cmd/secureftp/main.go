@@ -6,9 +6,15 @@ import (
 	"os"
 
 	"secure-ftp/internal/app"
+	"secure-ftp/internal/cli"
 )
 
 func main() {
+	// Headless subcommands never initialize the UI
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	application, err := app.New()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize application: %v\n", err)
@@ -0,0 +1,156 @@
+// Package cli provides the headless command-line interface.
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK       = 0 // Command succeeded
+	ExitFailure  = 1 // Remote operation failed
+	ExitUsage    = 2 // Invalid command line
+	ExitConnect  = 3 // Connection or authentication failed
+	ExitTransfer = 4 // One or more transfers failed
+	ExitConfig   = 5 // Configuration or profile could not be loaded
+	ExitConflict = 6 // Sync left conflicts unresolved
+)
+
+// command describes a CLI subcommand.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(c *Context, args []string) int
+}
+
+var commands = map[string]*command{
+	"ls":     {name: "ls", usage: "ls [options] <remote-dir>", summary: "List a remote directory", run: runList},
+	"get":    {name: "get", usage: "get [options] <remote-file> [local-path]", summary: "Download a file", run: runGet},
+	"put":    {name: "put", usage: "put [options] <local-file> [remote-path]", summary: "Upload a file", run: runPut},
+	"mkdir":  {name: "mkdir", usage: "mkdir [options] <remote-dir>", summary: "Create a remote directory", run: runMkdir},
+	"rm":     {name: "rm", usage: "rm [options] [-d] <remote-path>", summary: "Remove a remote file or empty directory", run: runRemove},
+	"mv":     {name: "mv", usage: "mv [options] <old-path> <new-path>", summary: "Rename or move a remote path", run: runMove},
+	"sync":   {name: "sync", usage: "sync [options] <local-dir> <remote-dir>", summary: "Synchronize a local and a remote directory", run: runSync},
+	"ignore": {name: "ignore", usage: "ignore [options] <local-dir> <path>...", summary: "Show which sync rule excludes each path", run: runIgnore},
+}
+
+// IsCommand returns true if name is a known CLI subcommand.
+func IsCommand(name string) bool {
+	if name == "help" || name == "-h" || name == "--help" {
+		return true
+	}
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes the subcommand in args[0] and returns the process exit code.
+func Run(args []string) int {
+	return run(args, os.Stdout, os.Stderr)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOK
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command: %s\n\n", args[0])
+		printUsage(stderr)
+		return ExitUsage
+	}
+
+	// Interrupting the process cancels the running operation
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := newContext(ctx, cmd, stdout, stderr)
+	return cmd.run(c, args[1:])
+}
+
+// printUsage prints the list of available subcommands.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: secureftp <command> [options] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without a command, the graphical interface is started.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-6s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'secureftp <command> -h' for command options.")
+}
+
+// newFlagSet creates a flag set for a subcommand with the common connection flags.
+func (c *Context) newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.cmd.name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: secureftp %s\n\nOptions:\n", c.cmd.usage)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&c.opts.ConfigPath, "config", defaultConfigPath(), "path to config.json")
+	fs.StringVar(&c.opts.Profile, "profile", "", "connection profile name or ID")
+	fs.StringVar(&c.opts.Protocol, "protocol", "", "protocol: sftp, ftps or ftp (overrides profile)")
+	fs.StringVar(&c.opts.Host, "host", "", "server host name (overrides profile)")
+	fs.IntVar(&c.opts.Port, "port", 0, "server port (overrides profile)")
+	fs.StringVar(&c.opts.Username, "user", "", "user name (overrides profile)")
+	fs.StringVar(&c.opts.PrivateKeyPath, "key", "", "SSH private key file (overrides profile; passphrase from $"+KeyPassphraseEnvVar+" or prompted)")
+	fs.BoolVar(&c.opts.TLSImplicit, "tls-implicit", false, "use implicit FTPS")
+	fs.StringVar(&c.opts.Proxy, "proxy", "", "proxy URL: socks5://[user[:password]@]host:port, http://host:port or direct (overrides config)")
+	fs.BoolVar(&c.opts.AcceptNewHost, "accept-new-host", false, "trust and record unknown SSH host keys")
+	fs.BoolVar(&c.opts.PasswordStdin, "password-stdin", false, "read the password from the first line of stdin (default: $"+PasswordEnvVar+" or stored password)")
+	fs.BoolVar(&c.opts.JSON, "json", false, "write machine-readable JSON output")
+	fs.BoolVar(&c.opts.Quiet, "q", false, "suppress informational output")
+
+	return fs
+}
+
+// parseFlags parses args and checks the number of positional arguments.
+// When ok is false the command must return code immediately.
+func (c *Context) parseFlags(fs *flag.FlagSet, args []string, minArgs, maxArgs int) (rest []string, code int, ok bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, ExitOK, false
+		}
+		return nil, ExitUsage, false
+	}
+
+	rest = fs.Args()
+	if len(rest) < minArgs || (maxArgs >= 0 && len(rest) > maxArgs) {
+		fs.Usage()
+		return nil, ExitUsage, false
+	}
+
+	return rest, ExitOK, true
+}
+
+// joinRemote joins a remote directory and a name using forward slashes.
+func joinRemote(dir, name string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"secure-ftp/internal/config"
+)
+
+// newTestContext returns a context for the named command writing to buffers.
+func newTestContext(t *testing.T, name string) (*Context, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c := newContext(context.Background(), commands[name], &stdout, &stderr)
+	return c, &stdout, &stderr
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"no command", nil, ExitUsage, "Usage: secureftp"},
+		{"help", []string{"help"}, ExitOK, "Commands:"},
+		{"help flag", []string{"--help"}, ExitOK, "Commands:"},
+		{"unknown command", []string{"cp"}, ExitUsage, "unknown command: cp"},
+		{"missing argument", []string{"mkdir"}, ExitUsage, "Usage: secureftp mkdir"},
+		{"extra argument", []string{"rm", "/a", "/b"}, ExitUsage, "Usage: secureftp rm"},
+		{"command help", []string{"ls", "-h"}, ExitOK, "-profile"},
+		{"unknown flag", []string{"ls", "-nope", "/"}, ExitUsage, "flag provided but not defined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("run(%q) = %d, want %d", tt.args, code, tt.code)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("run(%q) stderr = %q, want it to contain %q", tt.args, stderr.String(), tt.stderr)
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("run(%q) wrote %q on stdout", tt.args, stdout.String())
+			}
+		})
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	for _, name := range []string{"ls", "get", "put", "mkdir", "rm", "mv", "sync", "help", "-h"} {
+		if !IsCommand(name) {
+			t.Errorf("IsCommand(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"", "-psn_0_1", "cp", "LS"} {
+		if IsCommand(name) {
+			t.Errorf("IsCommand(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	saved := config.ConnectionProfile{
+		ID:       "p1",
+		Name:     "work",
+		Protocol: "ftps",
+		Host:     "ftp.example.com",
+		Port:     2121,
+		Username: "alice",
+	}
+
+	tests := []struct {
+		name    string
+		opts    options
+		want    config.ConnectionProfile
+		wantErr string
+	}{
+		{
+			name: "flags only default to SFTP",
+			opts: options{Host: "example.com", Username: "bob"},
+			want: config.ConnectionProfile{Protocol: "sftp", Host: "example.com", Port: 22, Username: "bob"},
+		},
+		{
+			name: "explicit FTPS port",
+			opts: options{Protocol: "FTPS", Host: "example.com", Username: "bob"},
+			want: config.ConnectionProfile{Protocol: "ftps", Host: "example.com", Port: 21, Username: "bob"},
+		},
+		{
+			name: "implicit FTPS port",
+			opts: options{Protocol: "ftps", TLSImplicit: true, Host: "example.com", Username: "bob"},
+			want: config.ConnectionProfile{Protocol: "ftps", Host: "example.com", Port: 990, Username: "bob", TLSImplicit: true},
+		},
+		{
+			name: "profile by name",
+			opts: options{Profile: "work"},
+			want: saved,
+		},
+		{
+			name: "profile by ID with overrides",
+			opts: options{Profile: "p1", Port: 990, Username: "carol", TLSImplicit: true},
+			want: config.ConnectionProfile{ID: "p1", Name: "work", Protocol: "ftps", Host: "ftp.example.com", Port: 990, Username: "carol", TLSImplicit: true},
+		},
+		{
+			name: "proxy flag",
+			opts: options{Profile: "work", Proxy: "socks5://dave@proxy.example.com:1081"},
+			want: config.ConnectionProfile{ID: "p1", Name: "work", Protocol: "ftps", Host: "ftp.example.com", Port: 2121, Username: "alice",
+				Proxy: &config.ProxySettings{Type: config.ProxySOCKS5, Host: "proxy.example.com", Port: 1081, Username: "dave"}},
+		},
+		{
+			name:    "invalid proxy flag",
+			opts:    options{Profile: "work", Proxy: "ftp://proxy.example.com"},
+			wantErr: "unsupported proxy type",
+		},
+		{
+			name:    "unknown profile",
+			opts:    options{Profile: "home"},
+			wantErr: "profile not found: home",
+		},
+		{
+			name:    "unsupported protocol",
+			opts:    options{Protocol: "scp", Host: "example.com", Username: "bob"},
+			wantErr: "unsupported protocol: scp",
+		},
+		{
+			name:    "missing host",
+			opts:    options{Username: "bob"},
+			wantErr: "no host given",
+		},
+		{
+			name:    "missing user",
+			opts:    options{Host: "example.com"},
+			wantErr: "no user name given",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configMgr, err := config.NewConfigManager(filepath.Join(t.TempDir(), "config.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := configMgr.AddProfile(saved); err != nil {
+				t.Fatal(err)
+			}
+
+			c, _, _ := newTestContext(t, "ls")
+			c.configMgr = configMgr
+			c.opts = tt.opts
+
+			profile, err := c.resolveProfile()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveProfile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveProfile() error = %v", err)
+			}
+			if !reflect.DeepEqual(*profile, tt.want) {
+				t.Errorf("resolveProfile() = %+v, want %+v", *profile, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordStdin(t *testing.T) {
+	c, _, _ := newTestContext(t, "ls")
+	c.opts.PasswordStdin = true
+	c.stdin = strings.NewReader("s3cret\r\nignored\n")
+
+	password, err := c.password(&config.ConnectionProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "s3cret" {
+		t.Errorf("password() = %q, want %q", password, "s3cret")
+	}
+}
+
+func TestResult(t *testing.T) {
+	t.Run("JSON error", func(t *testing.T) {
+		c, stdout, stderr := newTestContext(t, "mv")
+		c.opts.JSON = true
+
+		code := c.result(operationResult{Path: "/a", NewPath: "/b"}, errors.New("permission denied"))
+		if code != ExitFailure {
+			t.Errorf("result() = %d, want %d", code, ExitFailure)
+		}
+
+		var res operationResult
+		if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+			t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+		}
+		want := operationResult{Command: "mv", Status: "error", Path: "/a", NewPath: "/b", Error: "permission denied"}
+		if res != want {
+			t.Errorf("result() wrote %+v, want %+v", res, want)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("result() wrote %q on stderr", stderr.String())
+		}
+	})
+
+	t.Run("text success", func(t *testing.T) {
+		c, stdout, stderr := newTestContext(t, "mkdir")
+
+		if code := c.result(operationResult{Path: "/a"}, nil); code != ExitOK {
+			t.Errorf("result() = %d, want %d", code, ExitOK)
+		}
+		if stdout.Len() != 0 || stderr.Len() != 0 {
+			t.Errorf("result() wrote %q, %q", stdout.String(), stderr.String())
+		}
+	})
+}
+
+func TestJoinRemote(t *testing.T) {
+	tests := []struct {
+		dir, name, want string
+	}{
+		{"/", "a.txt", "/a.txt"},
+		{"/home/user", "a.txt", "/home/user/a.txt"},
+		{"/home/user/", "a.txt", "/home/user/a.txt"},
+		{"", "a.txt", "/a.txt"},
+	}
+	for _, tt := range tests {
+		if got := joinRemote(tt.dir, tt.name); got != tt.want {
+			t.Errorf("joinRemote(%q, %q) = %q, want %q", tt.dir, tt.name, got, tt.want)
+		}
+	}
+}
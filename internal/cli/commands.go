@@ -0,0 +1,662 @@
+// Package cli provides the implementation of the headless subcommands.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"secure-ftp/internal/protocol"
+	ftpsync "secure-ftp/internal/sync"
+	"secure-ftp/internal/transfer"
+)
+
+// runList implements "ls".
+func runList(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	long := fs.Bool("l", false, "long listing with permissions, size and modification time")
+	all := fs.Bool("a", false, "include hidden files")
+	rest, code, ok := c.parseFlags(fs, args, 0, 1)
+	if !ok {
+		return code
+	}
+
+	if code := c.connect(); code != ExitOK {
+		return code
+	}
+	defer c.close()
+
+	dir := "."
+	if len(rest) == 1 {
+		dir = rest[0]
+	} else if c.profile.RemoteDir != "" {
+		dir = c.profile.RemoteDir
+	}
+
+	entries, err := c.client.List(c.ctx, dir)
+	if err != nil {
+		return c.result(operationResult{Path: dir}, err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	if c.opts.JSON {
+		files := make([]fileEntry, 0, len(entries))
+		for _, entry := range entries {
+			if !*all && strings.HasPrefix(entry.Name, ".") {
+				continue
+			}
+			files = append(files, newFileEntry(dir, entry))
+		}
+		c.writeJSON(files)
+		return ExitOK
+	}
+
+	for _, entry := range entries {
+		if !*all && strings.HasPrefix(entry.Name, ".") {
+			continue
+		}
+		name := entry.Name
+		if entry.IsDir {
+			name += "/"
+		}
+		if *long {
+			if entry.LinkTarget != "" {
+				name += " -> " + entry.LinkTarget
+			}
+			fmt.Fprintf(c.stdout, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				orDash(entry.Permissions), orDash(entry.Owner), orDash(entry.Group),
+				entry.Size, entry.ModTime.Format(time.RFC3339), name)
+		} else {
+			fmt.Fprintln(c.stdout, name)
+		}
+	}
+
+	return ExitOK
+}
+
+// runGet implements "get".
+func runGet(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	verify := fs.Bool("verify", false, "compare checksums after the transfer")
+	fs.BoolVar(&c.preserve, "p", false, "preserve the modification time and permissions")
+	rest, code, ok := c.parseFlags(fs, args, 1, 2)
+	if !ok {
+		return code
+	}
+
+	if code := c.connect(); code != ExitOK {
+		return code
+	}
+	defer c.close()
+
+	remotePath := rest[0]
+	localPath := path.Base(remotePath)
+	if len(rest) == 2 {
+		localPath = rest[1]
+		if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+			localPath = filepath.Join(localPath, path.Base(remotePath))
+		}
+	}
+
+	return c.transfer(transfer.DirectionDownload, localPath, remotePath, *verify)
+}
+
+// runPut implements "put".
+func runPut(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	verify := fs.Bool("verify", false, "compare checksums after the transfer")
+	fs.BoolVar(&c.preserve, "p", false, "preserve the modification time and permissions")
+	fs.BoolVar(&c.atomic, "atomic", false, "upload to a temporary name and rename it once complete")
+	rest, code, ok := c.parseFlags(fs, args, 1, 2)
+	if !ok {
+		return code
+	}
+
+	localPath := rest[0]
+	info, err := os.Stat(localPath)
+	if err != nil {
+		c.fail(err)
+		return ExitUsage
+	}
+	if info.IsDir() {
+		c.fail(fmt.Errorf("%s is a directory", localPath))
+		return ExitUsage
+	}
+
+	if code := c.connect(); code != ExitOK {
+		return code
+	}
+	defer c.close()
+
+	remotePath := filepath.Base(localPath)
+	if c.profile.RemoteDir != "" {
+		remotePath = joinRemote(c.profile.RemoteDir, remotePath)
+	}
+	if len(rest) == 2 {
+		remotePath = rest[1]
+		if info, err := c.client.Stat(c.ctx, remotePath); err == nil && info.IsDir {
+			remotePath = joinRemote(remotePath, filepath.Base(localPath))
+		}
+	}
+
+	return c.transfer(transfer.DirectionUpload, localPath, remotePath, *verify)
+}
+
+// transfer runs a single upload or download through the transfer manager.
+// Checksums are compared afterwards if verify or the configuration asks for it.
+func (c *Context) transfer(direction transfer.TransferDirection, localPath, remotePath string, verify bool) int {
+	manager := c.newTransferManager(verify)
+	defer manager.Stop()
+
+	done := make(chan *transfer.TransferItem, 1)
+	manager.SetCompleteCallback(func(item *transfer.TransferItem) {
+		done <- item
+	})
+
+	var item *transfer.TransferItem
+	if direction == transfer.DirectionUpload {
+		c.info("Uploading %s to %s", localPath, remotePath)
+		item = manager.AddUpload(localPath, remotePath, 0)
+	} else {
+		c.info("Downloading %s to %s", remotePath, localPath)
+		item = manager.AddDownload(remotePath, localPath, 0)
+	}
+
+	select {
+	case <-done:
+	case <-c.ctx.Done():
+		// Stop returns once the worker has let go of the item, whether or
+		// not the transfer had started
+		manager.Stop()
+	}
+
+	res := operationResult{
+		Local:    localPath,
+		Remote:   remotePath,
+		Bytes:    item.TotalBytes,
+		Duration: item.EndTime.Sub(item.StartTime).Round(time.Millisecond).String(),
+	}
+
+	var err error
+	switch item.Status {
+	case transfer.StatusCompleted:
+	case transfer.StatusCancelled:
+		err = fmt.Errorf("transfer cancelled")
+	default:
+		err = item.Error
+		if err == nil {
+			err = fmt.Errorf("transfer %s", strings.ToLower(item.Status.String()))
+		}
+	}
+
+	if c.result(res, err) != ExitOK {
+		return ExitTransfer
+	}
+	return ExitOK
+}
+
+// newTransferManager returns a transfer manager for the session, set up as
+// in the GUI. Checksums are compared if verify or the configuration asks for it.
+func (c *Context) newTransferManager(verify bool) *transfer.TransferManager {
+	cfg := c.configMgr.Get()
+	manager := transfer.NewTransferManager(c.client, cfg.MaxParallelTransfers)
+	manager.SetVerify(verify || cfg.VerifyTransfers)
+	manager.SetAtomicUploads(c.atomic || c.profile.AtomicUploads)
+	manager.SetRetryPolicy(transfer.NewRetryPolicy(cfg.TransferRetries))
+	return manager
+}
+
+// runMkdir implements "mkdir".
+func runMkdir(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	parents := fs.Bool("p", false, "create parent directories as needed")
+	rest, code, ok := c.parseFlags(fs, args, 1, 1)
+	if !ok {
+		return code
+	}
+
+	if code := c.connect(); code != ExitOK {
+		return code
+	}
+	defer c.close()
+
+	dir := rest[0]
+	var err error
+	if *parents {
+		err = c.mkdirAll(dir)
+	} else {
+		err = c.client.Mkdir(c.ctx, dir)
+	}
+
+	return c.result(operationResult{Path: dir}, err)
+}
+
+// mkdirAll creates a remote directory and any missing parents.
+func (c *Context) mkdirAll(dir string) error {
+	if info, err := c.client.Stat(c.ctx, dir); err == nil {
+		if !info.IsDir {
+			return fmt.Errorf("%s exists and is not a directory", dir)
+		}
+		return nil
+	}
+
+	parent := path.Dir(dir)
+	if parent != dir && parent != "." && parent != "/" {
+		if err := c.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+
+	return c.client.Mkdir(c.ctx, dir)
+}
+
+// runRemove implements "rm".
+func runRemove(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	isDir := fs.Bool("d", false, "remove an empty directory")
+	rest, code, ok := c.parseFlags(fs, args, 1, 1)
+	if !ok {
+		return code
+	}
+
+	if code := c.connect(); code != ExitOK {
+		return code
+	}
+	defer c.close()
+
+	target := rest[0]
+	var err error
+	if *isDir {
+		err = c.client.RemoveDir(c.ctx, target)
+	} else {
+		err = c.client.Remove(c.ctx, target)
+	}
+
+	return c.result(operationResult{Path: target}, err)
+}
+
+// runMove implements "mv".
+func runMove(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	rest, code, ok := c.parseFlags(fs, args, 2, 2)
+	if !ok {
+		return code
+	}
+
+	if code := c.connect(); code != ExitOK {
+		return code
+	}
+	defer c.close()
+
+	err := c.client.Rename(c.ctx, rest[0], rest[1])
+	return c.result(operationResult{Path: rest[0], NewPath: rest[1]}, err)
+}
+
+// syncSummary is the JSON representation of a sync run.
+type syncSummary struct {
+	Command    string               `json:"command"`
+	Status     string               `json:"status"`
+	DryRun     bool                 `json:"dry_run"`
+	Uploaded   int                  `json:"uploaded"`
+	Downloaded int                  `json:"downloaded"`
+	Deleted    int                  `json:"deleted"`
+	Skipped    int                  `json:"skipped"`
+	Conflicts  []ftpsync.Conflict   `json:"conflicts,omitempty"`
+	Bytes      int64                `json:"bytes"`
+	Duration   string               `json:"duration"`
+	Actions    []ftpsync.SyncAction `json:"actions,omitempty"`
+	Errors     []string             `json:"errors,omitempty"`
+}
+
+// runSync implements "sync".
+func runSync(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	mode := fs.String("mode", "upload", "sync mode: upload, download, mirror or bidirectional")
+	compare := fs.String("compare", "size-time", "comparison: size-time, size, time or hash")
+	deleteExtra := fs.Bool("delete", false, "delete files on the destination that are missing on the source")
+	dryRun := fs.Bool("dry-run", false, "only report what would be done")
+	filters := addFilterFlags(fs)
+	conflict := fs.String("conflict", "ask", "bidirectional conflicts: ask, keep-both, local, remote or larger")
+	watch := fs.Bool("watch", false, "keep running and sync local changes as they happen")
+	atomic := fs.Bool("atomic", false, "upload to a temporary name and rename it once complete")
+	poll := fs.Duration("poll", ftpsync.DefaultWatchPollInterval, "remote polling interval in watch mode (bidirectional and download)")
+	rest, code, ok := c.parseFlags(fs, args, 2, 2)
+	if !ok {
+		return code
+	}
+
+	options := ftpsync.SyncOptions{
+		DeleteExtra: *deleteExtra,
+		DryRun:      *dryRun,
+	}
+	if err := filters.apply(&options); err != nil {
+		c.fail(err)
+		return ExitUsage
+	}
+
+	switch *mode {
+	case "upload":
+		options.Mode = ftpsync.ModeUpload
+	case "download":
+		options.Mode = ftpsync.ModeDownload
+	case "mirror":
+		options.Mode = ftpsync.ModeMirror
+	case "bidirectional":
+		options.Mode = ftpsync.ModeBidirectional
+	default:
+		c.fail(fmt.Errorf("invalid sync mode: %s", *mode))
+		return ExitUsage
+	}
+
+	switch *compare {
+	case "size-time":
+		options.CompareMethod = ftpsync.CompareBySizeAndTime
+	case "size":
+		options.CompareMethod = ftpsync.CompareBySize
+	case "time":
+		options.CompareMethod = ftpsync.CompareByModTime
+	case "hash":
+		options.CompareMethod = ftpsync.CompareByHash
+	default:
+		c.fail(fmt.Errorf("invalid comparison method: %s", *compare))
+		return ExitUsage
+	}
+
+	switch *conflict {
+	case "ask":
+		options.ConflictPolicy = ftpsync.ConflictAsk
+	case "keep-both":
+		options.ConflictPolicy = ftpsync.ConflictKeepBoth
+	case "local":
+		options.ConflictPolicy = ftpsync.ConflictPreferLocal
+	case "remote":
+		options.ConflictPolicy = ftpsync.ConflictPreferRemote
+	case "larger":
+		options.ConflictPolicy = ftpsync.ConflictPreferLarger
+	default:
+		c.fail(fmt.Errorf("invalid conflict policy: %s", *conflict))
+		return ExitUsage
+	}
+
+	if *watch && *dryRun {
+		c.fail(fmt.Errorf("-watch cannot be combined with -dry-run"))
+		return ExitUsage
+	}
+
+	localDir, remoteDir := rest[0], rest[1]
+	if info, err := os.Stat(localDir); err != nil || !info.IsDir() {
+		c.fail(fmt.Errorf("not a local directory: %s", localDir))
+		return ExitUsage
+	}
+
+	if code := c.connect(); code != ExitOK {
+		return code
+	}
+	defer c.close()
+
+	cfg := c.configMgr.Get()
+	options.ClockPath = ftpsync.ClockPath(cfg.SyncStateDir, c.profile.SyncServerKey())
+	options.AtomicUploads = *atomic || c.profile.AtomicUploads
+	if options.Mode == ftpsync.ModeBidirectional {
+		options.StatePath = ftpsync.StatePath(cfg.SyncStateDir, c.profile.SyncServerKey(), localDir, remoteDir)
+		options.RemoteHost = c.profile.Host
+	}
+
+	if *watch {
+		// Local changes are uploaded through the transfer queue; FTP needs
+		// its own connections for them, as in the GUI
+		manager := c.newTransferManager(false)
+		if c.profile.Protocol != "sftp" {
+			manager.SetConnectionPool(protocol.NewFTPSConnectionPool(c.connConfig, c.configMgr.Get().MaxParallelTransfers))
+		}
+		defer manager.Stop()
+
+		syncer := ftpsync.NewSyncer(c.client, manager, options)
+		err := syncer.Watch(c.ctx, localDir, remoteDir, ftpsync.WatchOptions{
+			PollInterval: *poll,
+			OnSync: func(result *ftpsync.SyncResult) {
+				summary := newSyncSummary(c.cmd.name, result)
+				if summary.Uploaded+summary.Downloaded+summary.Deleted+len(summary.Conflicts)+len(summary.Errors) > 0 {
+					c.printSyncSummary(summary)
+				}
+			},
+		})
+		if err != nil {
+			return c.result(operationResult{Local: localDir, Remote: remoteDir}, err)
+		}
+		return ExitOK
+	}
+
+	syncer := ftpsync.NewSyncer(c.client, nil, options)
+	var summary syncSummary
+	if *dryRun {
+		summary = syncSummary{Command: c.cmd.name, Status: "ok", DryRun: true}
+		startTime := time.Now()
+		actions, err := syncer.Analyze(c.ctx, localDir, remoteDir)
+		if err != nil {
+			return c.result(operationResult{Local: localDir, Remote: remoteDir}, err)
+		}
+		for _, action := range actions {
+			if action.Conflict != nil {
+				summary.Conflicts = append(summary.Conflicts, *action.Conflict)
+			}
+			switch action.Type {
+			case "upload":
+				summary.Uploaded++
+			case "download":
+				summary.Downloaded++
+			case "keep_both":
+				summary.Uploaded++
+				summary.Downloaded++
+			case "delete_local", "delete_remote":
+				summary.Deleted++
+			case "skip":
+				summary.Skipped++
+			}
+			if action.Type != "skip" {
+				summary.Actions = append(summary.Actions, action)
+			}
+		}
+		summary.Duration = time.Since(startTime).Round(time.Millisecond).String()
+		summary.setStatus()
+	} else {
+		result, err := syncer.Execute(c.ctx, localDir, remoteDir)
+		if err != nil {
+			return c.result(operationResult{Local: localDir, Remote: remoteDir}, err)
+		}
+		summary = newSyncSummary(c.cmd.name, result)
+	}
+
+	c.printSyncSummary(summary)
+
+	switch summary.Status {
+	case "error":
+		return ExitTransfer
+	case "conflict":
+		return ExitConflict
+	}
+	return ExitOK
+}
+
+// newSyncSummary converts the result of a sync run.
+func newSyncSummary(command string, result *ftpsync.SyncResult) syncSummary {
+	summary := syncSummary{
+		Command:    command,
+		Uploaded:   result.FilesUploaded,
+		Downloaded: result.FilesDownloaded,
+		Deleted:    result.FilesDeleted,
+		Skipped:    result.FilesSkipped,
+		Conflicts:  result.Conflicts,
+		Bytes:      result.BytesTransferred,
+		Duration:   result.Duration.Round(time.Millisecond).String(),
+	}
+	for _, err := range result.Errors {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+	summary.setStatus()
+	return summary
+}
+
+// setStatus derives the status from errors and unresolved conflicts.
+func (s *syncSummary) setStatus() {
+	s.Status = "ok"
+	if len(s.Errors) > 0 {
+		s.Status = "error"
+		return
+	}
+	for _, conflict := range s.Conflicts {
+		if conflict.Resolution == ftpsync.ConflictAsk {
+			s.Status = "conflict"
+			return
+		}
+	}
+}
+
+// printSyncSummary writes a sync summary as JSON or text.
+func (c *Context) printSyncSummary(summary syncSummary) {
+	if c.opts.JSON {
+		c.writeJSON(summary)
+		return
+	}
+
+	for _, action := range summary.Actions {
+		target := action.RemotePath
+		if action.Type == "download" || action.Type == "delete_local" {
+			target = action.LocalPath
+		}
+		fmt.Fprintf(c.stdout, "%s\t%s\t%s\n", action.Type, target, action.Reason)
+	}
+	fmt.Fprintf(c.stdout, "uploaded=%d downloaded=%d deleted=%d skipped=%d conflicts=%d bytes=%d duration=%s\n",
+		summary.Uploaded, summary.Downloaded, summary.Deleted, summary.Skipped, len(summary.Conflicts), summary.Bytes, summary.Duration)
+	for _, conflict := range summary.Conflicts {
+		if conflict.Resolution == ftpsync.ConflictAsk {
+			fmt.Fprintf(c.stderr, "secureftp sync: unresolved conflict: %s: %s\n", conflict.Path, conflict.Reason)
+		}
+	}
+	for _, msg := range summary.Errors {
+		fmt.Fprintf(c.stderr, "secureftp sync: %s\n", msg)
+	}
+}
+
+// filterFlags are the flags selecting which files are synchronized.
+type filterFlags struct {
+	ignoreHidden *bool
+	exclude      *string
+	include      *string
+	maxSize      *string
+	maxAge       *string
+}
+
+// addFilterFlags defines the filter flags on fs.
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	return &filterFlags{
+		ignoreHidden: fs.Bool("ignore-hidden", false, "skip hidden files and directories"),
+		exclude:      fs.String("exclude", "", "comma-separated .gitignore-style patterns to exclude"),
+		include:      fs.String("include", "", "comma-separated patterns to include"),
+		maxSize:      fs.String("max-size", "", "skip files larger than this size (e.g. 2G)"),
+		maxAge:       fs.String("max-age", "", "skip files not modified for this long (e.g. 90d)"),
+	}
+}
+
+// apply stores the parsed filter flags in options.
+func (f *filterFlags) apply(options *ftpsync.SyncOptions) error {
+	options.IgnoreHidden = *f.ignoreHidden
+	options.ExcludePatterns = splitList(*f.exclude)
+	options.IncludePatterns = splitList(*f.include)
+
+	if *f.maxSize != "" {
+		size, err := ftpsync.ParseSize(*f.maxSize)
+		if err != nil {
+			return err
+		}
+		options.MaxFileSize = size
+	}
+	if *f.maxAge != "" {
+		age, err := ftpsync.ParseAge(*f.maxAge)
+		if err != nil {
+			return err
+		}
+		options.MaxFileAge = age
+	}
+	return nil
+}
+
+// ignoreResult is the JSON representation of a filter check.
+type ignoreResult struct {
+	Path     string `json:"path"`
+	Excluded bool   `json:"excluded"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// runIgnore implements "ignore".
+func runIgnore(c *Context, args []string) int {
+	fs := c.newFlagSet()
+	filters := addFilterFlags(fs)
+	rest, code, ok := c.parseFlags(fs, args, 2, -1)
+	if !ok {
+		return code
+	}
+
+	var options ftpsync.SyncOptions
+	if err := filters.apply(&options); err != nil {
+		c.fail(err)
+		return ExitUsage
+	}
+
+	localDir := rest[0]
+	syncer := ftpsync.NewSyncer(nil, nil, options)
+	results := make([]ignoreResult, 0, len(rest)-1)
+	for _, relPath := range rest[1:] {
+		excluded, reason, err := syncer.Explain(localDir, relPath)
+		if err != nil {
+			c.fail(err)
+			return ExitConfig
+		}
+		results = append(results, ignoreResult{Path: relPath, Excluded: excluded, Reason: reason})
+	}
+
+	if c.opts.JSON {
+		c.writeJSON(results)
+		return ExitOK
+	}
+
+	for _, r := range results {
+		status := "included"
+		if r.Excluded {
+			status = "excluded"
+		}
+		if r.Reason != "" {
+			fmt.Fprintf(c.stdout, "%s\t%s\t%s\n", status, r.Path, r.Reason)
+		} else {
+			fmt.Fprintf(c.stdout, "%s\t%s\n", status, r.Path)
+		}
+	}
+	return ExitOK
+}
+
+// splitList splits a comma-separated list and drops empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// orDash returns s, or "-" if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
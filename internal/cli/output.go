@@ -0,0 +1,124 @@
+// Package cli provides text and JSON output for headless commands.
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"secure-ftp/internal/protocol"
+)
+
+// fileEntry is the JSON representation of a remote file.
+type fileEntry struct {
+	Name        string     `json:"name"`
+	Path        string     `json:"path"`
+	Size        int64      `json:"size"`
+	IsDir       bool       `json:"is_dir"`
+	ModTime     time.Time  `json:"mod_time"`
+	Permissions string     `json:"permissions"`
+	Mode        string     `json:"mode,omitempty"` // Octal, such as "0644"
+	UID         *int       `json:"uid,omitempty"`
+	GID         *int       `json:"gid,omitempty"`
+	Owner       string     `json:"owner,omitempty"`
+	Group       string     `json:"group,omitempty"`
+	IsSymlink   bool       `json:"is_symlink,omitempty"`
+	LinkTarget  string     `json:"link_target,omitempty"`
+	AccessTime  *time.Time `json:"access_time,omitempty"`
+}
+
+// newFileEntry converts a protocol.FileInfo to its JSON representation.
+func newFileEntry(dir string, info protocol.FileInfo) fileEntry {
+	entry := fileEntry{
+		Name:        info.Name,
+		Path:        joinRemote(dir, info.Name),
+		Size:        info.Size,
+		IsDir:       info.IsDir,
+		ModTime:     info.ModTime,
+		Permissions: info.Permissions,
+		Owner:       info.Owner,
+		Group:       info.Group,
+		IsSymlink:   info.IsSymlink,
+		LinkTarget:  info.LinkTarget,
+	}
+
+	// Permissions are partly unknown ('?') with the perm fact of FTP servers
+	if info.Permissions != "" && !strings.Contains(info.Permissions, "?") {
+		entry.Mode = fmt.Sprintf("%04o", protocol.UnixPermissions(info.Mode))
+	}
+	if info.UID >= 0 {
+		entry.UID = &info.UID
+	}
+	if info.GID >= 0 {
+		entry.GID = &info.GID
+	}
+	if !info.AccessTime.IsZero() {
+		entry.AccessTime = &info.AccessTime
+	}
+	return entry
+}
+
+// operationResult is the JSON representation of a single remote operation.
+type operationResult struct {
+	Command  string `json:"command"`
+	Status   string `json:"status"`
+	Path     string `json:"path,omitempty"`
+	NewPath  string `json:"new_path,omitempty"`
+	Local    string `json:"local_path,omitempty"`
+	Remote   string `json:"remote_path,omitempty"`
+	Bytes    int64  `json:"bytes,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// writeJSON writes v as a single JSON document on stdout.
+func (c *Context) writeJSON(v interface{}) {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// info prints an informational message on stderr unless quiet or JSON output is enabled.
+func (c *Context) info(format string, args ...interface{}) {
+	if c.opts.Quiet || c.opts.JSON {
+		return
+	}
+	fmt.Fprintf(c.stderr, format+"\n", args...)
+}
+
+// fail reports an error on stderr, as JSON when requested.
+func (c *Context) fail(err error) {
+	if c.opts.JSON {
+		enc := json.NewEncoder(c.stderr)
+		enc.Encode(map[string]string{
+			"command": c.cmd.name,
+			"status":  "error",
+			"error":   err.Error(),
+		})
+		return
+	}
+	fmt.Fprintf(c.stderr, "secureftp %s: %v\n", c.cmd.name, err)
+}
+
+// result reports the outcome of a simple remote operation and returns its exit code.
+func (c *Context) result(res operationResult, err error) int {
+	res.Command = c.cmd.name
+	if err != nil {
+		res.Status = "error"
+		res.Error = err.Error()
+	} else {
+		res.Status = "ok"
+	}
+
+	if c.opts.JSON {
+		c.writeJSON(res)
+	} else if err != nil {
+		fmt.Fprintf(c.stderr, "secureftp %s: %v\n", c.cmd.name, err)
+	}
+
+	if err != nil {
+		return ExitFailure
+	}
+	return ExitOK
+}
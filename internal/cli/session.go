@@ -0,0 +1,361 @@
+// Package cli provides connection setup for headless commands.
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"secure-ftp/internal/config"
+	"secure-ftp/internal/protocol"
+	"secure-ftp/internal/transfer"
+	"secure-ftp/pkg/logger"
+)
+
+// PasswordEnvVar is the environment variable holding the connection password.
+const PasswordEnvVar = "SECUREFTP_PASSWORD"
+
+// KeyPassphraseEnvVar is the environment variable holding the passphrase of
+// encrypted private keys.
+const KeyPassphraseEnvVar = "SECUREFTP_KEY_PASSPHRASE"
+
+// options holds the connection flags shared by all subcommands.
+type options struct {
+	ConfigPath     string
+	Profile        string
+	Protocol       string
+	Host           string
+	Port           int
+	Username       string
+	PrivateKeyPath string
+	TLSImplicit    bool
+	Proxy          string
+	AcceptNewHost  bool
+	PasswordStdin  bool
+	JSON           bool
+	Quiet          bool
+}
+
+// Context carries the state of a single CLI invocation.
+type Context struct {
+	ctx    context.Context
+	cmd    *command
+	opts   options
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+
+	configMgr  *config.ConfigManager
+	profile    *config.ConnectionProfile
+	client     protocol.Protocol
+	connConfig *protocol.ConnectionConfig // Used to connect client
+	log        *logger.Logger
+
+	proxyPassword string // From the -proxy URL
+
+	// Preserve modification times and permissions, as asked by -p
+	preserve bool
+	// Upload to a temporary name, then rename, as asked by -atomic
+	atomic bool
+}
+
+func newContext(ctx context.Context, cmd *command, stdout, stderr io.Writer) *Context {
+	return &Context{
+		ctx:    ctx,
+		cmd:    cmd,
+		stdout: stdout,
+		stderr: stderr,
+		stdin:  os.Stdin,
+		log:    logger.GetInstance(),
+	}
+}
+
+// defaultConfigPath returns the path used by the GUI for config.json.
+func defaultConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = "."
+	}
+	return filepath.Join(homeDir, ".config", "secure-ftp", "config.json")
+}
+
+// configDir returns the directory holding config.json, credentials and known_hosts.
+func (c *Context) configDir() string {
+	return filepath.Dir(c.opts.ConfigPath)
+}
+
+// loadConfig loads the configuration and initializes file logging.
+func (c *Context) loadConfig() error {
+	configMgr, err := config.NewConfigManager(c.opts.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	c.configMgr = configMgr
+
+	// Log to file only: stdout and stderr are reserved for command output
+	cfg := configMgr.Get()
+	c.log.Initialize(logger.Config{
+		LogPath: cfg.LogPath,
+		Level:   cfg.LogLevel,
+		Console: false,
+	})
+
+	return nil
+}
+
+// resolveProfile builds the connection profile from the selected profile and flags.
+func (c *Context) resolveProfile() (*config.ConnectionProfile, error) {
+	profile := &config.ConnectionProfile{}
+
+	if c.opts.Profile != "" {
+		found := c.configMgr.GetProfile(c.opts.Profile)
+		if found == nil {
+			for _, p := range c.configMgr.GetProfiles() {
+				if p.Name == c.opts.Profile {
+					p := p
+					found = &p
+					break
+				}
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("profile not found: %s", c.opts.Profile)
+		}
+		profile = found
+	}
+
+	// Command line flags override profile values
+	if c.opts.Protocol != "" {
+		profile.Protocol = strings.ToLower(c.opts.Protocol)
+	}
+	if c.opts.Host != "" {
+		profile.Host = c.opts.Host
+	}
+	if c.opts.Port != 0 {
+		profile.Port = c.opts.Port
+	}
+	if c.opts.Username != "" {
+		profile.Username = c.opts.Username
+	}
+	if c.opts.PrivateKeyPath != "" {
+		profile.PrivateKeyPath = c.opts.PrivateKeyPath
+	}
+	if c.opts.TLSImplicit {
+		profile.TLSImplicit = true
+	}
+	if c.opts.Proxy != "" {
+		proxy, password, err := config.ParseProxyURL(c.opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		profile.Proxy, c.proxyPassword = proxy, password
+	}
+
+	if profile.Protocol == "" {
+		profile.Protocol = "sftp"
+	}
+	switch profile.Protocol {
+	case "sftp", "ftps", "ftp":
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", profile.Protocol)
+	}
+
+	if profile.Port == 0 {
+		switch {
+		case profile.Protocol == "sftp":
+			profile.Port = 22
+		case profile.TLSImplicit:
+			profile.Port = 990
+		default:
+			profile.Port = 21
+		}
+	}
+
+	if profile.Host == "" {
+		return nil, fmt.Errorf("no host given: use -profile or -host")
+	}
+	if profile.Username == "" {
+		return nil, fmt.Errorf("no user name given: use -profile or -user")
+	}
+
+	return profile, nil
+}
+
+// password returns the password from stdin, the environment or the credentials store.
+func (c *Context) password(profile *config.ConnectionProfile) (string, error) {
+	if c.opts.PasswordStdin {
+		line, err := bufio.NewReader(c.stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	if password := os.Getenv(PasswordEnvVar); password != "" {
+		return password, nil
+	}
+
+	if profile.ID == "" {
+		return "", nil
+	}
+
+	credsMgr, err := c.credentials()
+	if err != nil || credsMgr == nil {
+		return "", err
+	}
+	return credsMgr.GetPassword(profile.ID)
+}
+
+// credentials opens the credentials store of the GUI, or returns nil if
+// there is none.
+func (c *Context) credentials() (*config.CredentialsManager, error) {
+	if !config.CredentialsFileExists(c.configDir()) {
+		return nil, nil
+	}
+
+	// Same master password as the GUI
+	credsMgr, err := config.NewCredentialsManager(c.configDir(), "secure-ftp-master")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credentials store: %w", err)
+	}
+	return credsMgr, nil
+}
+
+// keyPassphrase returns the passphrase of an encrypted private key from the
+// environment, the passphrases saved by the GUI or a terminal prompt.
+func (c *Context) keyPassphrase(keyPath string, retry bool) ([]byte, error) {
+	if !retry {
+		if passphrase := os.Getenv(KeyPassphraseEnvVar); passphrase != "" {
+			return []byte(passphrase), nil
+		}
+		if credsMgr, err := c.credentials(); err == nil && credsMgr != nil {
+			if passphrase, err := credsMgr.GetKeyPassphrase(keyPath); err == nil && passphrase != "" {
+				return []byte(passphrase), nil
+			}
+		}
+	}
+
+	prompt := fmt.Sprintf("Enter passphrase for key '%s': ", keyPath)
+	if retry {
+		prompt = "Bad passphrase, try again: "
+	}
+	passphrase, err := promptTerminal(prompt, false)
+	if err == errNoTerminal {
+		return nil, fmt.Errorf("private key %s is encrypted: set $%s or load it in ssh-agent", keyPath, KeyPassphraseEnvVar)
+	}
+	return []byte(passphrase), err
+}
+
+// challenge answers the questions of the server, such as a one-time code, or
+// asks for a missing password on the terminal.
+func (c *Context) challenge(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	header := ""
+	for _, line := range []string{name, instruction} {
+		if line = strings.TrimSpace(line); line != "" {
+			header += line + "\n"
+		}
+	}
+
+	answers := make([]string, len(questions))
+	for i, question := range questions {
+		answer, err := promptTerminal(header+question, echos[i])
+		if err == errNoTerminal {
+			return nil, fmt.Errorf("the server asks %q: run in a terminal or use another authentication method", strings.TrimSpace(question))
+		}
+		if err != nil {
+			return nil, err
+		}
+		answers[i] = answer
+		header = ""
+	}
+	return answers, nil
+}
+
+// connect loads the configuration and connects to the selected server.
+// It returns an exit code other than ExitOK on failure.
+func (c *Context) connect() int {
+	if err := c.loadConfig(); err != nil {
+		c.fail(err)
+		return ExitConfig
+	}
+
+	profile, err := c.resolveProfile()
+	if err != nil {
+		c.fail(err)
+		return ExitConfig
+	}
+	c.profile = profile
+
+	password, err := c.password(profile)
+	if err != nil {
+		c.fail(err)
+		return ExitConfig
+	}
+
+	// Jump host and proxy passwords come from the credentials store, or are
+	// asked on the terminal
+	env := config.ConnectEnv{Password: password, ProxyPassword: c.proxyPassword, Passphrase: c.keyPassphrase, Challenge: c.challenge}
+	env.Credentials, _ = c.credentials()
+	if profile.Protocol == "sftp" {
+		knownHosts, err := config.NewKnownHostsManager(c.configDir())
+		if err != nil {
+			c.fail(err)
+			return ExitConfig
+		}
+
+		// Unknown hosts are rejected unless explicitly accepted; changed keys always are
+		if c.opts.AcceptNewHost {
+			knownHosts.SetCallbacks(func(host, fingerprint string) bool {
+				c.info("Adding host %s (SHA256:%s) to known hosts", host, fingerprint)
+				return true
+			}, nil)
+		}
+		env.KnownHosts = knownHosts
+	}
+
+	connConfig, err := c.configMgr.ConnectionConfig(profile, env)
+	if err != nil {
+		c.fail(err)
+		return ExitConfig
+	}
+
+	// Same bandwidth limits as the GUI
+	cfg := c.configMgr.Get()
+	connConfig.Throttle = transfer.NewBandwidthLimiter(cfg.RateLimits(profile))
+	connConfig.PreserveModTime = connConfig.PreserveModTime || c.preserve
+	connConfig.PreservePermissions = connConfig.PreservePermissions || c.preserve
+
+	var client protocol.Protocol
+	if profile.Protocol == "sftp" {
+		client = protocol.NewSFTPClient()
+	} else {
+		client = protocol.NewFTPSClient()
+	}
+
+	err = client.Connect(c.ctx, connConfig)
+	c.log.LogConnection(profile.Protocol, profile.Host, profile.Port, err == nil, err)
+	if err != nil {
+		c.fail(fmt.Errorf("connection to %s failed: %w", profile.Host, err))
+		return ExitConnect
+	}
+
+	c.client, c.connConfig = client, connConfig
+	if profile.ID != "" {
+		c.configMgr.UpdateLastUsed(profile.ID)
+	}
+
+	return ExitOK
+}
+
+// close disconnects from the server and flushes the log.
+func (c *Context) close() {
+	if c.client != nil {
+		c.client.Disconnect()
+		c.client = nil
+	}
+	c.log.Close()
+}
@@ -0,0 +1,45 @@
+// Package cli provides prompts on the controlling terminal.
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errNoTerminal is returned by promptTerminal when the command does not run
+// in a terminal, e.g. from cron or a CI job.
+var errNoTerminal = errors.New("no terminal to prompt on")
+
+// promptTerminal prints prompt on the controlling terminal and reads a line
+// from it, hiding the input unless echo is set. It works when stdin and
+// stdout are redirected.
+func promptTerminal(prompt string, echo bool) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errNoTerminal
+	}
+	defer tty.Close()
+
+	if !echo {
+		restore, err := disableEcho(int(tty.Fd()))
+		if err != nil {
+			return "", fmt.Errorf("failed to hide input: %w", err)
+		}
+		defer restore()
+	}
+
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if !echo {
+		fmt.Fprintln(tty)
+	}
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read from terminal: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package cli
+
+import "errors"
+
+// disableEcho is not supported on this platform.
+func disableEcho(fd int) (func(), error) {
+	return nil, errors.New("hidden input is not supported on this platform")
+}
@@ -0,0 +1,159 @@
+// Package config builds the protocol settings of a connection from a profile.
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"secure-ftp/internal/protocol"
+	"secure-ftp/pkg/logger"
+)
+
+// ConnectEnv supplies what connecting to a profile needs beyond the saved
+// settings: secrets and answers, which the GUI and the CLI obtain from the
+// user differently.
+type ConnectEnv struct {
+	Password      string                      // Password of the profile
+	ProxyPassword string                      // Password of the proxy, if not stored
+	Credentials   *CredentialsManager         // Passwords of the jump hosts and proxy (optional)
+	KnownHosts    *KnownHostsManager          // Verifies SSH host keys; nil accepts any key
+	Passphrase    protocol.PassphraseCallback // Asked for encrypted private keys
+	Challenge     protocol.ChallengeCallback  // Asked for server prompts and missing passwords
+}
+
+// ConnectionConfig returns the settings to connect to profile. The bandwidth
+// limiter is left to the caller.
+func (cm *ConfigManager) ConnectionConfig(profile *ConnectionProfile, env ConnectEnv) (*protocol.ConnectionConfig, error) {
+	connConfig := &protocol.ConnectionConfig{
+		Protocol:    profile.Protocol,
+		Host:        profile.Host,
+		Port:        profile.Port,
+		Username:    profile.Username,
+		Password:    env.Password,
+		TLSImplicit: profile.TLSImplicit,
+	}
+	if profile.Timeout > 0 {
+		connConfig.Timeout = time.Duration(profile.Timeout) * time.Second
+	}
+
+	// Attributes copied along with transferred files
+	cfg := cm.Get()
+	connConfig.PreserveModTime = cfg.PreserveTimestamps
+	connConfig.PreservePermissions = cfg.PreservePermissions
+
+	// Proxy for the SSH connection or the FTP control and data connections
+	proxy, err := cm.proxyConfig(profile, env)
+	if err != nil {
+		return nil, err
+	}
+	connConfig.Proxy = proxy
+
+	// Host key verification, authentication and jump hosts for SFTP
+	if profile.Protocol == "sftp" {
+		applySSHSettings(connConfig, profile, env)
+
+		jumpHosts, err := cm.jumpHostConfigs(profile, env)
+		if err != nil {
+			return nil, err
+		}
+		connConfig.JumpHosts = jumpHosts
+	}
+
+	return connConfig, nil
+}
+
+// jumpHostConfigs returns the connection settings of the jump hosts of
+// profile, each with its own stored password and keys.
+func (cm *ConfigManager) jumpHostConfigs(profile *ConnectionProfile, env ConnectEnv) ([]*protocol.ConnectionConfig, error) {
+	chain, err := cm.JumpChain(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []*protocol.ConnectionConfig
+	for i := range chain {
+		jump := &chain[i]
+
+		var password string
+		if env.Credentials != nil {
+			password, _ = env.Credentials.GetPassword(jump.ID)
+		}
+
+		port := jump.Port
+		if port == 0 {
+			port = 22
+		}
+
+		hop := &protocol.ConnectionConfig{
+			Protocol: jump.Protocol,
+			Host:     jump.Host,
+			Port:     port,
+			Username: jump.Username,
+			Password: password,
+		}
+		if jump.Timeout > 0 {
+			hop.Timeout = time.Duration(jump.Timeout) * time.Second
+		}
+		applySSHSettings(hop, jump, env)
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// proxyConfig returns the protocol settings of the proxy that applies to
+// profile, or nil for a direct connection.
+func (cm *ConfigManager) proxyConfig(profile *ConnectionProfile, env ConnectEnv) (*protocol.ProxyConfig, error) {
+	cfg := cm.Get()
+	proxy := cfg.ProxyFor(profile)
+	if proxy == nil {
+		return nil, nil
+	}
+	if proxy.Host == "" || proxy.Port < 1 || proxy.Port > 65535 {
+		return nil, fmt.Errorf("invalid %s proxy: host and port are required", proxy.Type)
+	}
+
+	password := env.ProxyPassword
+	if password == "" && proxy.Username != "" && env.Credentials != nil {
+		password, _ = env.Credentials.GetProxyPassword(proxy.URL())
+	}
+
+	return &protocol.ProxyConfig{
+		Type:     proxy.Type,
+		Host:     proxy.Host,
+		Port:     proxy.Port,
+		Username: proxy.Username,
+		Password: password,
+	}, nil
+}
+
+// applySSHSettings sets the host key verification and the authentication of
+// connConfig from the SFTP profile.
+func applySSHSettings(connConfig *protocol.ConnectionConfig, profile *ConnectionProfile, env ConnectEnv) {
+	if env.KnownHosts != nil {
+		connConfig.HostKeyCallback = protocol.HostKeyCallback(env.KnownHosts.GetHostKeyCallback())
+		connConfig.HostKeysCallback = env.KnownHosts.GetHostKeysCallback()
+
+		// Ask for a key type already known, the server may hold several
+		port := connConfig.Port
+		if port == 0 {
+			port = 22
+		}
+		connConfig.HostKeyAlgorithms = env.KnownHosts.HostKeyAlgorithms(connConfig.Host, port)
+	} else {
+		// Fallback: accept all host keys (less secure but allows connection)
+		connConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			logger.GetInstance().Warnf("Host key verification disabled - accepting key for %s", hostname)
+			return nil
+		}
+	}
+
+	// Private keys, SSH agent and the order of the authentication methods
+	connConfig.IdentityFiles = profile.KeyFiles()
+	connConfig.IdentitiesOnly = profile.IdentitiesOnly
+	connConfig.AuthMethods = profile.AuthMethods
+	connConfig.Passphrase = env.Passphrase
+	connConfig.Challenge = env.Challenge
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestConfigManager returns a ConfigManager in a temporary directory
+// holding profiles.
+func newTestConfigManager(t *testing.T, profiles ...ConnectionProfile) *ConfigManager {
+	t.Helper()
+	cm, err := NewConfigManager(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range profiles {
+		if err := cm.AddProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cm
+}
+
+func TestConnectionConfig(t *testing.T) {
+	profile := &ConnectionProfile{
+		ID:             "p1",
+		Protocol:       "sftp",
+		Host:           "example.com",
+		Port:           2222,
+		Username:       "alice",
+		PrivateKeyPath: "/keys/id_ed25519",
+		AuthMethods:    []string{"publickey", "password"},
+		Timeout:        15,
+	}
+	cm := newTestConfigManager(t)
+
+	connConfig, err := cm.ConnectionConfig(profile, ConnectEnv{Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if connConfig.Host != "example.com" || connConfig.Port != 2222 || connConfig.Username != "alice" || connConfig.Password != "s3cret" {
+		t.Errorf("ConnectionConfig() = %s@%s:%d (password %q), want alice@example.com:2222 (password %q)",
+			connConfig.Username, connConfig.Host, connConfig.Port, connConfig.Password, "s3cret")
+	}
+	if connConfig.Timeout != 15*time.Second {
+		t.Errorf("Timeout = %v, want 15s", connConfig.Timeout)
+	}
+	if want := []string{"/keys/id_ed25519"}; !reflect.DeepEqual(connConfig.IdentityFiles, want) {
+		t.Errorf("IdentityFiles = %q, want %q", connConfig.IdentityFiles, want)
+	}
+	if !reflect.DeepEqual(connConfig.AuthMethods, profile.AuthMethods) {
+		t.Errorf("AuthMethods = %q, want %q", connConfig.AuthMethods, profile.AuthMethods)
+	}
+	if connConfig.HostKeyCallback == nil {
+		t.Errorf("HostKeyCallback not set for an SFTP profile")
+	}
+}
+
+func TestConnectionConfigJumpHosts(t *testing.T) {
+	bastion := ConnectionProfile{ID: "j1", Name: "bastion", Protocol: "sftp", Host: "bastion.example.com", Username: "bob", Timeout: 5}
+	inner := ConnectionProfile{ID: "j2", Name: "inner", Protocol: "sftp", Host: "inner.example.com", Port: 2200, Username: "carol", JumpProfiles: []string{"bastion"}}
+	target := &ConnectionProfile{ID: "p1", Protocol: "sftp", Host: "example.com", Port: 22, Username: "alice", JumpProfiles: []string{"j2"}}
+	cm := newTestConfigManager(t, bastion, inner)
+
+	credsMgr, err := NewCredentialsManager(t.TempDir(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := credsMgr.SetPassword("j1", "bastion-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	connConfig, err := cm.ConnectionConfig(target, ConnectEnv{Credentials: credsMgr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type hop struct {
+		host     string
+		port     int
+		username string
+		password string
+		timeout  time.Duration
+	}
+	var got []hop
+	for _, jump := range connConfig.JumpHosts {
+		got = append(got, hop{jump.Host, jump.Port, jump.Username, jump.Password, jump.Timeout})
+		if jump.HostKeyCallback == nil {
+			t.Errorf("jump host %s has no HostKeyCallback", jump.Host)
+		}
+	}
+	want := []hop{
+		{"bastion.example.com", 22, "bob", "bastion-password", 5 * time.Second},
+		{"inner.example.com", 2200, "carol", "", 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JumpHosts = %+v, want %+v", got, want)
+	}
+
+	// A missing jump profile fails the connection rather than skipping the hop
+	target.JumpProfiles = []string{"gateway"}
+	if _, err := cm.ConnectionConfig(target, ConnectEnv{}); err == nil {
+		t.Errorf("ConnectionConfig() with an unknown jump profile succeeded")
+	}
+}
+
+func TestConnectionConfigProxy(t *testing.T) {
+	global := &ProxySettings{Type: ProxySOCKS5, Host: "proxy.example.com", Port: 1080, Username: "dave"}
+	tests := []struct {
+		name          string
+		profileProxy  *ProxySettings
+		proxyPassword string
+		wantHost      string // Empty for a direct connection
+		wantPassword  string
+		wantErr       bool
+	}{
+		{name: "global proxy with stored password", wantHost: "proxy.example.com", wantPassword: "stored"},
+		{name: "password given", proxyPassword: "given", wantHost: "proxy.example.com", wantPassword: "given"},
+		{name: "profile proxy", profileProxy: &ProxySettings{Type: ProxyHTTP, Host: "web.example.com", Port: 3128}, wantHost: "web.example.com"},
+		{name: "profile connects directly", profileProxy: &ProxySettings{Type: ProxyDirect}},
+		{name: "proxy without host", profileProxy: &ProxySettings{Type: ProxyHTTP, Port: 3128}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := newTestConfigManager(t)
+			cfg := cm.Get()
+			cfg.Proxy = global
+			if err := cm.Set(&cfg); err != nil {
+				t.Fatal(err)
+			}
+			credsMgr, err := NewCredentialsManager(t.TempDir(), "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := credsMgr.SetProxyPassword(global.URL(), "stored"); err != nil {
+				t.Fatal(err)
+			}
+
+			profile := &ConnectionProfile{Protocol: "ftps", Host: "example.com", Port: 21, Username: "alice", Proxy: tt.profileProxy}
+			connConfig, err := cm.ConnectionConfig(profile, ConnectEnv{ProxyPassword: tt.proxyPassword, Credentials: credsMgr})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ConnectionConfig() succeeded with proxy %+v", tt.profileProxy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantHost == "" {
+				if connConfig.Proxy != nil {
+					t.Errorf("Proxy = %+v, want a direct connection", connConfig.Proxy)
+				}
+				return
+			}
+			if connConfig.Proxy == nil {
+				t.Fatalf("Proxy = nil, want %s", tt.wantHost)
+			}
+			if connConfig.Proxy.Host != tt.wantHost || connConfig.Proxy.Password != tt.wantPassword {
+				t.Errorf("Proxy = %s (password %q), want %s (password %q)", connConfig.Proxy.Host, connConfig.Proxy.Password, tt.wantHost, tt.wantPassword)
+			}
+		})
+	}
+}
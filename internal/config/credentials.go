@@ -215,6 +215,46 @@ func (cm *CredentialsManager) GetPassword(profileID string) (string, error) {
 	return cm.decrypt(encrypted)
 }
 
+// keyPassphrasePrefix distinguishes private key passphrases, stored by key
+// file path, from profile passwords.
+const keyPassphrasePrefix = "key:"
+
+// SetKeyPassphrase stores an encrypted passphrase for the private key at keyPath.
+func (cm *CredentialsManager) SetKeyPassphrase(keyPath, passphrase string) error {
+	return cm.SetPassword(keyPassphrasePrefix+keyPath, passphrase)
+}
+
+// GetKeyPassphrase retrieves the passphrase of the private key at keyPath,
+// or an empty string if none is stored.
+func (cm *CredentialsManager) GetKeyPassphrase(keyPath string) (string, error) {
+	return cm.GetPassword(keyPassphrasePrefix + keyPath)
+}
+
+// DeleteKeyPassphrase removes the stored passphrase of the private key at keyPath.
+func (cm *CredentialsManager) DeleteKeyPassphrase(keyPath string) error {
+	return cm.DeletePassword(keyPassphrasePrefix + keyPath)
+}
+
+// proxyPasswordPrefix distinguishes proxy passwords, stored by proxy URL.
+const proxyPasswordPrefix = "proxy:"
+
+// SetProxyPassword stores an encrypted password for the proxy with the given
+// ProxySettings.URL.
+func (cm *CredentialsManager) SetProxyPassword(proxyURL, password string) error {
+	return cm.SetPassword(proxyPasswordPrefix+proxyURL, password)
+}
+
+// GetProxyPassword retrieves the password of the proxy with the given URL,
+// or an empty string if none is stored.
+func (cm *CredentialsManager) GetProxyPassword(proxyURL string) (string, error) {
+	return cm.GetPassword(proxyPasswordPrefix + proxyURL)
+}
+
+// DeleteProxyPassword removes the stored password of the proxy with the given URL.
+func (cm *CredentialsManager) DeleteProxyPassword(proxyURL string) error {
+	return cm.DeletePassword(proxyPasswordPrefix + proxyURL)
+}
+
 // DeletePassword removes the stored password for a profile.
 func (cm *CredentialsManager) DeletePassword(profileID string) error {
 	cm.mu.Lock()
@@ -3,16 +3,21 @@ package config
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // HostKeyStatus represents the status of a host key verification.
@@ -25,15 +30,45 @@ const (
 	HostKeyValid
 	// HostKeyChanged indicates the host key has changed (possible attack).
 	HostKeyChanged
+	// HostKeyRevoked indicates the host key is marked @revoked.
+	HostKeyRevoked
 )
 
-// KnownHostsManager manages SSH known hosts.
+// Markers of known_hosts lines
+const (
+	markerCertAuthority = "@cert-authority"
+	markerRevoked       = "@revoked"
+)
+
+// legacyPrefix starts the lines keeping the fingerprints recorded by former
+// versions, which did not store full keys. They are checked until the host is
+// seen again and its key replaces them. OpenSSH ignores them as comments.
+const legacyPrefix = "# secure-ftp fingerprint "
+
+// knownHostLine is a line of a known_hosts file.
+type knownHostLine struct {
+	text    string        // The line as read, written back unchanged
+	marker  string        // "", markerCertAuthority or markerRevoked
+	hosts   string        // Comma separated host patterns, possibly hashed
+	key     ssh.PublicKey // nil for comments, blank and invalid lines
+	comment string        // Text following the key
+	source  string        // File the line was read from
+
+	// Fingerprint of a legacy line, and the host it belongs to
+	legacyHost string
+	legacyFP   string
+}
+
+// KnownHostsManager manages SSH known hosts in the OpenSSH known_hosts
+// format. Keys are recorded in its own file; those of the user's and the
+// system's OpenSSH known_hosts files are trusted too.
 type KnownHostsManager struct {
-	filePath   string
-	hosts      map[string]string // host:port -> fingerprint
-	mu         sync.RWMutex
-	onNewHost  func(host string, fingerprint string) bool // Returns true to accept
-	onChanged  func(host string, oldFP, newFP string) bool // Returns true to accept (dangerous)
+	filePath    string
+	lines       []*knownHostLine // Own file, in order
+	systemLines []*knownHostLine // OpenSSH files, read-only
+	mu          sync.RWMutex
+	onNewHost   func(host string, fingerprint string) bool  // Returns true to accept
+	onChanged   func(host string, oldFP, newFP string) bool // Returns true to accept (dangerous)
 }
 
 // NewKnownHostsManager creates a new known hosts manager.
@@ -42,7 +77,6 @@ func NewKnownHostsManager(configDir string) (*KnownHostsManager, error) {
 
 	mgr := &KnownHostsManager{
 		filePath: filePath,
-		hosts:    make(map[string]string),
 	}
 
 	// Load existing known hosts
@@ -50,9 +84,26 @@ func NewKnownHostsManager(configDir string) (*KnownHostsManager, error) {
 		return nil, fmt.Errorf("failed to load known_hosts: %w", err)
 	}
 
+	// Trust OpenSSH's known hosts as well; unreadable files are skipped
+	for _, path := range SystemKnownHostsFiles() {
+		if lines, err := readKnownHostsFile(path); err == nil {
+			mgr.systemLines = append(mgr.systemLines, lines...)
+		}
+	}
+
 	return mgr, nil
 }
 
+// SystemKnownHostsFiles returns the known_hosts files of OpenSSH: the user's
+// and the system-wide one.
+func SystemKnownHostsFiles() []string {
+	var files []string
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(homeDir, ".ssh", "known_hosts"))
+	}
+	return append(files, "/etc/ssh/ssh_known_hosts")
+}
+
 // SetCallbacks sets the callback functions for host key verification.
 func (m *KnownHostsManager) SetCallbacks(onNewHost func(string, string) bool, onChanged func(string, string, string) bool) {
 	m.mu.Lock()
@@ -63,26 +114,96 @@ func (m *KnownHostsManager) SetCallbacks(onNewHost func(string, string) bool, on
 
 // load reads the known_hosts file.
 func (m *KnownHostsManager) load() error {
-	file, err := os.Open(m.filePath)
+	lines, err := readKnownHostsFile(m.filePath)
 	if err != nil {
 		return err
 	}
+	m.lines = lines
+	return nil
+}
+
+// readKnownHostsFile reads and parses a known_hosts file.
+func readKnownHostsFile(path string) ([]*knownHostLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
+	var lines []*knownHostLine
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+		line := parseKnownHostLine(scanner.Text())
+		line.source = path
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseKnownHostLine parses a line of a known_hosts file. Lines of the
+// former "[host]:port fingerprint" format are converted to legacy lines.
+func parseKnownHostLine(text string) *knownHostLine {
+	line := &knownHostLine{text: text}
+
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, legacyPrefix) {
+		if fields := strings.Fields(strings.TrimPrefix(trimmed, legacyPrefix)); len(fields) == 2 {
+			line.legacyHost, line.legacyFP = fields[0], fields[1]
 		}
+		return line
+	}
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return line
+	}
 
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) == 2 {
-			m.hosts[parts[0]] = parts[1]
+	fields := strings.Fields(trimmed)
+	if len(fields) == 2 {
+		if legacy := parseLegacyLine(fields[0], fields[1]); legacy != nil {
+			return legacy
 		}
 	}
 
-	return scanner.Err()
+	if strings.HasPrefix(fields[0], "@") {
+		line.marker = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) < 3 {
+		return line
+	}
+
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[1:], " ")))
+	if err != nil {
+		return line
+	}
+	line.hosts = fields[0]
+	line.key = key
+	line.comment = comment
+	return line
+}
+
+// parseLegacyLine converts a line of the former format, which recorded
+// "[host:port]:port" for the host name given with its port, to a legacy line.
+func parseLegacyLine(hostField, fingerprint string) *knownHostLine {
+	if hash, err := base64.StdEncoding.DecodeString(fingerprint); err != nil || len(hash) != sha256.Size {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(hostField)
+	if err != nil {
+		return nil
+	}
+	if innerHost, innerPort, err := net.SplitHostPort(host); err == nil && innerPort == port {
+		host = innerHost
+	}
+
+	address := knownhosts.Normalize(net.JoinHostPort(host, port))
+	return &knownHostLine{
+		text:       legacyPrefix + address + " " + fingerprint,
+		legacyHost: address,
+		legacyFP:   fingerprint,
+	}
 }
 
 // save writes the known_hosts file.
@@ -99,11 +220,12 @@ func (m *KnownHostsManager) save() error {
 	}
 	defer file.Close()
 
-	for host, fingerprint := range m.hosts {
-		fmt.Fprintf(file, "%s %s\n", host, fingerprint)
+	w := bufio.NewWriter(file)
+	for _, line := range m.lines {
+		fmt.Fprintln(w, line.text)
 	}
 
-	return nil
+	return w.Flush()
 }
 
 // GetFingerprint computes the SHA256 fingerprint of a public key.
@@ -112,28 +234,178 @@ func GetFingerprint(key ssh.PublicKey) string {
 	return base64.StdEncoding.EncodeToString(hash[:])
 }
 
+// hostAddress returns host and port as written in known_hosts files:
+// "host" for port 22, "[host]:port" otherwise.
+func hostAddress(host string, port int) string {
+	return knownhosts.Normalize(net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
 // VerifyHostKey verifies a host's public key.
 func (m *KnownHostsManager) VerifyHostKey(host string, port int, key ssh.PublicKey) (HostKeyStatus, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, _, err := m.verify(host, hostAddress(host, port), key)
+	return status, err
+}
+
+// verify checks key against the known hosts. For a changed key, it also
+// returns the fingerprint of the known one. The caller must hold m.mu.
+func (m *KnownHostsManager) verify(host, address string, key ssh.PublicKey) (HostKeyStatus, string, error) {
+	lines := append(append([]*knownHostLine(nil), m.lines...), m.systemLines...)
+
+	// Revoked keys are refused whatever else is known
+	for _, line := range lines {
+		if line.marker == markerRevoked && matchHost(line.hosts, address) && revokes(line.key, key) {
+			return HostKeyRevoked, "", nil
+		}
+	}
+
+	// Certificates signed by a trusted authority are valid for the hosts
+	// they name; others are checked as plain keys, as OpenSSH does
+	if cert, ok := key.(*ssh.Certificate); ok {
+		for _, line := range lines {
+			if line.marker == markerCertAuthority && matchHost(line.hosts, address) && keysEqual(line.key, cert.SignatureKey) {
+				if err := checkHostCertificate(host, cert); err != nil {
+					return HostKeyChanged, "", fmt.Errorf("invalid host certificate for %s: %w", address, err)
+				}
+				return HostKeyValid, "", nil
+			}
+		}
+		key = cert.Key
+	}
+
+	var known ssh.PublicKey
+	for _, line := range lines {
+		if line.marker != "" || line.key == nil || !matchHost(line.hosts, address) {
+			continue
+		}
+		if keysEqual(line.key, key) {
+			return HostKeyValid, "", nil
+		}
+		// Other key types are additional keys of the host, not a change
+		if known == nil && line.key.Type() == key.Type() {
+			known = line.key
+		}
+	}
+	if known != nil {
+		// Key has changed - possible MITM attack!
+		return HostKeyChanged, GetFingerprint(known), nil
+	}
+
+	for _, line := range m.lines {
+		if line.legacyHost == address {
+			if line.legacyFP == GetFingerprint(key) {
+				return HostKeyValid, "", nil
+			}
+			return HostKeyChanged, line.legacyFP, nil
+		}
+	}
+
+	// New host
+	return HostKeyNew, "", nil
+}
+
+// checkHostCertificate checks that cert, signed by a trusted authority, is a
+// valid host certificate for host.
+func checkHostCertificate(host string, cert *ssh.Certificate) error {
+	if cert.CertType != ssh.HostCert {
+		return fmt.Errorf("not a host certificate")
+	}
+	checker := &ssh.CertChecker{}
+	return checker.CheckCert(host, cert)
+}
+
+// revokes reports whether a @revoked key revokes key, or the authority or
+// the key of a certificate.
+func revokes(revoked, key ssh.PublicKey) bool {
+	if keysEqual(revoked, key) {
+		return true
+	}
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return keysEqual(revoked, cert.SignatureKey) || keysEqual(revoked, cert.Key)
+	}
+	return false
+}
 
-	hostKey := fmt.Sprintf("[%s]:%d", host, port)
-	fingerprint := GetFingerprint(key)
+// keysEqual reports whether a and b are the same key.
+func keysEqual(a, b ssh.PublicKey) bool {
+	return a != nil && b != nil && bytes.Equal(a.Marshal(), b.Marshal())
+}
 
-	storedFP, exists := m.hosts[hostKey]
+// matchHost reports whether the comma separated host patterns of a line
+// match address, as returned by hostAddress. Patterns may be hashed, contain
+// * and ? wildcards, or be negated with !.
+func matchHost(patterns, address string) bool {
+	address = strings.ToLower(address)
+
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		var ok bool
+		if strings.HasPrefix(pattern, "|1|") {
+			ok = matchHashedHost(pattern, address)
+		} else {
+			ok = matchWildcard(strings.ToLower(pattern), address)
+		}
 
-	if !exists {
-		// New host
-		return HostKeyNew, nil
+		if ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
 	}
+	return matched
+}
 
-	if storedFP == fingerprint {
-		// Valid, key matches
-		return HostKeyValid, nil
+// matchHashedHost reports whether a hashed host name, "|1|salt|hash" as
+// written with HashKnownHosts, is address.
+func matchHashedHost(pattern, address string) bool {
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
 	}
 
-	// Key has changed - possible MITM attack!
-	return HostKeyChanged, nil
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// matchWildcard reports whether s matches pattern, where * matches any
+// sequence and ? any single character.
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
 }
 
 // AddHost adds a new host to known_hosts.
@@ -141,49 +413,197 @@ func (m *KnownHostsManager) AddHost(host string, port int, key ssh.PublicKey) er
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	hostKey := fmt.Sprintf("[%s]:%d", host, port)
-	fingerprint := GetFingerprint(key)
-
-	m.hosts[hostKey] = fingerprint
+	address := hostAddress(host, port)
+	m.removeLines(func(line *knownHostLine) bool {
+		return line.legacyHost == address
+	})
+	m.addKey(address, key)
 
 	return m.save()
 }
 
-// UpdateHost updates an existing host's key (use with caution).
+// addKey appends a line for the key of address. The caller must hold m.mu.
+func (m *KnownHostsManager) addKey(address string, key ssh.PublicKey) {
+	// The certified key is recorded, as certificates expire
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+
+	line := parseKnownHostLine(knownhosts.Line([]string{address}, key))
+	line.source = m.filePath
+	m.lines = append(m.lines, line)
+}
+
+// removeLines removes the lines of the own file for which remove returns
+// true. The caller must hold m.mu.
+func (m *KnownHostsManager) removeLines(remove func(line *knownHostLine) bool) int {
+	kept := m.lines[:0]
+	for _, line := range m.lines {
+		if !remove(line) {
+			kept = append(kept, line)
+		}
+	}
+	removed := len(m.lines) - len(kept)
+	m.lines = kept
+	return removed
+}
+
+// UpdateHost replaces the key of the same type of an existing host (use with caution).
 func (m *KnownHostsManager) UpdateHost(host string, port int, key ssh.PublicKey) error {
-	return m.AddHost(host, port, key)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+
+	address := hostAddress(host, port)
+	m.removeLines(func(line *knownHostLine) bool {
+		if line.legacyHost == address {
+			return true
+		}
+		return line.marker == "" && line.key != nil && line.key.Type() == key.Type() && matchHost(line.hosts, address)
+	})
+	m.addKey(address, key)
+
+	return m.save()
 }
 
-// RemoveHost removes a host from known_hosts.
+// RemoveHost removes the keys of a host from known_hosts. Lines naming
+// several hosts are removed as a whole. Keys in OpenSSH's files are kept.
 func (m *KnownHostsManager) RemoveHost(host string, port int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	hostKey := fmt.Sprintf("[%s]:%d", host, port)
-	delete(m.hosts, hostKey)
+	address := hostAddress(host, port)
+	m.removeLines(func(line *knownHostLine) bool {
+		return line.legacyHost == address || (line.marker == "" && line.key != nil && matchHost(line.hosts, address))
+	})
 
 	return m.save()
 }
 
-// GetHostKeyCallback returns an ssh.HostKeyCallback for use with ssh.ClientConfig.
-func (m *KnownHostsManager) GetHostKeyCallback() ssh.HostKeyCallback {
-	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		// Parse host and port from remote address
-		host, portStr, err := net.SplitHostPort(remote.String())
-		if err != nil {
-			host = hostname
-			portStr = "22"
+// upgradeLegacy replaces the legacy fingerprint of address by key, once the
+// key has been verified against it.
+func (m *KnownHostsManager) upgradeLegacy(address string, key ssh.PublicKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := m.removeLines(func(line *knownHostLine) bool {
+		return line.legacyHost == address && line.legacyFP == GetFingerprint(key)
+	})
+	if removed == 0 {
+		return nil
+	}
+	m.addKey(address, key)
+	return m.save()
+}
+
+// Import adds the keys of an OpenSSH known_hosts file that are not known yet,
+// markers and hashed host names included. It returns how many were added.
+func (m *KnownHostsManager) Import(path string) (int, error) {
+	lines, err := readKnownHostsFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	added := 0
+	for _, line := range lines {
+		if line.key != nil && !containsLine(m.lines, line) {
+			line.source = m.filePath
+			m.lines = append(m.lines, line)
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, m.save()
+}
+
+// Export appends the known keys missing from an OpenSSH known_hosts file,
+// such as ~/.ssh/known_hosts, creating it if needed. Legacy fingerprints are
+// not exported. It returns how many keys were added.
+func (m *KnownHostsManager) Export(path string) (int, error) {
+	existing, err := readKnownHostsFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	var missing []*knownHostLine
+	for _, line := range m.lines {
+		if line.key != nil && !containsLine(existing, line) {
+			missing = append(missing, line)
 		}
+	}
+	m.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return 0, nil
+	}
 
-		port := 22
-		fmt.Sscanf(portStr, "%d", &port)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return 0, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
 
-		// Use hostname if host is IP
-		if hostname != "" && host != hostname {
-			host = hostname
+	w := bufio.NewWriter(file)
+	if info, err := file.Stat(); err == nil && info.Size() > 0 && !endsWithNewline(path, info.Size()) {
+		fmt.Fprintln(w)
+	}
+	for _, line := range missing {
+		fmt.Fprintln(w, line.text)
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return len(missing), nil
+}
+
+// endsWithNewline reports whether the file at path, of the given size, ends
+// with a line break.
+func endsWithNewline(path string, size int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, size-1); err != nil {
+		return true
+	}
+	return last[0] == '\n'
+}
+
+// containsLine reports whether lines has a line with the marker, host
+// patterns and key of line.
+func containsLine(lines []*knownHostLine, line *knownHostLine) bool {
+	for _, l := range lines {
+		if l.marker == line.marker && l.hosts == line.hosts && keysEqual(l.key, line.key) {
+			return true
 		}
+	}
+	return false
+}
+
+// GetHostKeyCallback returns an ssh.HostKeyCallback for use with ssh.ClientConfig.
+func (m *KnownHostsManager) GetHostKeyCallback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host, port := splitHostname(hostname, remote)
+		address := hostAddress(host, port)
 
-		status, err := m.VerifyHostKey(host, port, key)
+		m.mu.RLock()
+		status, storedFP, err := m.verify(host, address, key)
+		m.mu.RUnlock()
 		if err != nil {
 			return err
 		}
@@ -192,7 +612,10 @@ func (m *KnownHostsManager) GetHostKeyCallback() ssh.HostKeyCallback {
 
 		switch status {
 		case HostKeyValid:
-			return nil
+			return m.upgradeLegacy(address, key)
+
+		case HostKeyRevoked:
+			return fmt.Errorf("host key for %s is revoked (SHA256:%s)", address, fingerprint)
 
 		case HostKeyNew:
 			m.mu.RLock()
@@ -200,30 +623,297 @@ func (m *KnownHostsManager) GetHostKeyCallback() ssh.HostKeyCallback {
 			m.mu.RUnlock()
 
 			if callback != nil {
-				if callback(host, fingerprint) {
+				if callback(address, fingerprint) {
 					// User accepted, add to known hosts
 					return m.AddHost(host, port, key)
 				}
-				return fmt.Errorf("host key rejected by user for %s", host)
+				return fmt.Errorf("host key rejected by user for %s", address)
 			}
 			// No callback, reject by default for security
-			return fmt.Errorf("unknown host %s with fingerprint %s", host, fingerprint)
+			return fmt.Errorf("unknown host %s with fingerprint %s", address, fingerprint)
 
 		case HostKeyChanged:
 			m.mu.RLock()
 			callback := m.onChanged
-			storedFP := m.hosts[fmt.Sprintf("[%s]:%d", host, port)]
 			m.mu.RUnlock()
 
 			if callback != nil {
-				if callback(host, storedFP, fingerprint) {
+				if callback(address, storedFP, fingerprint) {
 					// User accepted the risk, update host
 					return m.UpdateHost(host, port, key)
 				}
 			}
-			return fmt.Errorf("WARNING: HOST KEY HAS CHANGED for %s! Possible man-in-the-middle attack", host)
+			return fmt.Errorf("WARNING: HOST KEY HAS CHANGED for %s! Possible man-in-the-middle attack", address)
 		}
 
 		return fmt.Errorf("unknown host key status")
 	}
 }
+
+// splitHostname returns the host and port of the host name given to SSH
+// callbacks, falling back to the remote address.
+func splitHostname(hostname string, remote net.Addr) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host, portStr, err = net.SplitHostPort(remote.String())
+		if err != nil {
+			host = hostname
+			portStr = "22"
+		}
+	}
+
+	port := 22
+	fmt.Sscanf(portStr, "%d", &port)
+	return host, port
+}
+
+// GetHostKeysCallback returns the function recording the host keys a server
+// proved to hold after authentication, for use with
+// protocol.ConnectionConfig.HostKeysCallback.
+func (m *KnownHostsManager) GetHostKeysCallback() func(hostname string, remote net.Addr, keys []ssh.PublicKey) error {
+	return func(hostname string, remote net.Addr, keys []ssh.PublicKey) error {
+		host, port := splitHostname(hostname, remote)
+		_, _, err := m.UpdateHostKeys(host, port, keys)
+		return err
+	}
+}
+
+// UpdateHostKeys records the host keys of a server, as sent with OpenSSH's
+// hostkeys-00@openssh.com extension once their possession is proved: keys
+// recorded for the host alone that the server no longer holds are removed,
+// and the new ones added. Nothing changes unless one of keys is already
+// trusted, or if one is revoked. It returns how many keys were added and
+// removed.
+func (m *KnownHostsManager) UpdateHostKeys(host string, port int, keys []ssh.PublicKey) (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	address := hostAddress(host, port)
+	trusted := false
+	for _, key := range keys {
+		status, _, err := m.verify(host, address, key)
+		if err != nil || status == HostKeyRevoked {
+			return 0, 0, err
+		}
+		if status == HostKeyValid {
+			trusted = true
+		}
+	}
+	if !trusted {
+		return 0, 0, nil
+	}
+
+	// Keys shared with other hosts, or matched by patterns, are left alone
+	removed := m.removeLines(func(line *knownHostLine) bool {
+		if line.marker != "" || line.key == nil || !strings.EqualFold(line.hosts, address) {
+			return false
+		}
+		for _, key := range keys {
+			if keysEqual(line.key, key) {
+				return false
+			}
+		}
+		return true
+	})
+
+	added := 0
+	for _, key := range keys {
+		if _, ok := key.(*ssh.Certificate); ok {
+			continue
+		}
+		// Keys conflicting with the OpenSSH files are not recorded
+		if status, _, _ := m.verify(host, address, key); status == HostKeyNew {
+			m.addKey(address, key)
+			added++
+		}
+	}
+
+	if added == 0 && removed == 0 {
+		return 0, 0, nil
+	}
+	return added, removed, m.save()
+}
+
+// defaultHostKeyAlgorithms are the host key algorithms of the SSH client, in
+// its order of preference.
+var defaultHostKeyAlgorithms = []string{
+	ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+
+	ssh.KeyAlgoED25519,
+}
+
+// certAlgorithms are the host certificate algorithms, preferred for hosts
+// with a trusted certificate authority.
+var certAlgorithms = []string{
+	ssh.CertAlgoED25519v01, ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01,
+	ssh.CertAlgoECDSA521v01, ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01,
+}
+
+// HostKeyAlgorithms returns the host key algorithms to offer to a host, the
+// types of its known keys first, as OpenSSH does: a server holding several
+// keys then presents one that can be verified. It returns nil when no key
+// type of the host is known, to keep the client's default order.
+func (m *KnownHostsManager) HostKeyAlgorithms(host string, port int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	address := hostAddress(host, port)
+	for _, line := range m.lines {
+		// The type of the key behind a legacy fingerprint is unknown
+		if line.legacyHost == address {
+			return nil
+		}
+	}
+
+	var preferred []string
+	for _, line := range append(append([]*knownHostLine(nil), m.lines...), m.systemLines...) {
+		if line.key == nil || line.marker == markerRevoked || !matchHost(line.hosts, address) {
+			continue
+		}
+		if line.marker == markerCertAuthority {
+			preferred = append(preferred, certAlgorithms...)
+		} else {
+			preferred = append(preferred, keyAlgorithms(line.key.Type())...)
+		}
+	}
+	if len(preferred) == 0 {
+		return nil
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, algorithm := range append(preferred, defaultHostKeyAlgorithms...) {
+		if !seen[algorithm] && containsString(defaultHostKeyAlgorithms, algorithm) {
+			seen[algorithm] = true
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	return algorithms
+}
+
+// keyAlgorithms returns the signature algorithms of a key type.
+func keyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// KnownHostEntry describes a trusted or revoked host key, as listed by Entries.
+type KnownHostEntry struct {
+	Marker      string // "", "@cert-authority" or "@revoked"
+	Hosts       string // Host patterns as written; hashed names stay hashed
+	KeyType     string // Empty for a fingerprint recorded by a former version
+	Fingerprint string // SHA256, base64 encoded
+	Comment     string
+	Source      string // File the key is recorded in
+	ReadOnly    bool   // Recorded in an OpenSSH file, which is not modified
+
+	line *knownHostLine
+}
+
+// Entries returns the keys of the known_hosts file, then those of the
+// OpenSSH files.
+func (m *KnownHostsManager) Entries() []KnownHostEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []KnownHostEntry
+	for _, line := range m.lines {
+		switch {
+		case line.key != nil:
+			entries = append(entries, newKnownHostEntry(line, false))
+		case line.legacyHost != "":
+			entries = append(entries, KnownHostEntry{
+				Hosts:       line.legacyHost,
+				Fingerprint: line.legacyFP,
+				Source:      m.filePath,
+				line:        line,
+			})
+		}
+	}
+	for _, line := range m.systemLines {
+		if line.key != nil {
+			entries = append(entries, newKnownHostEntry(line, true))
+		}
+	}
+	return entries
+}
+
+// newKnownHostEntry returns the entry of a line with a key.
+func newKnownHostEntry(line *knownHostLine, readOnly bool) KnownHostEntry {
+	return KnownHostEntry{
+		Marker:      line.marker,
+		Hosts:       line.hosts,
+		KeyType:     line.key.Type(),
+		Fingerprint: GetFingerprint(line.key),
+		Comment:     line.comment,
+		Source:      line.source,
+		ReadOnly:    readOnly,
+		line:        line,
+	}
+}
+
+// RemoveEntry removes a key listed by Entries from the known_hosts file.
+func (m *KnownHostsManager) RemoveEntry(entry KnownHostEntry) error {
+	if entry.ReadOnly {
+		return fmt.Errorf("%s is not managed by secure-ftp", entry.Source)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.removeLines(func(line *knownHostLine) bool { return line == entry.line }) == 0 {
+		return fmt.Errorf("host key no longer in known_hosts")
+	}
+	return m.save()
+}
+
+// SetComment replaces the comment following a key listed by Entries, which
+// annotates it in the known_hosts file.
+func (m *KnownHostsManager) SetComment(entry KnownHostEntry, comment string) error {
+	if entry.ReadOnly {
+		return fmt.Errorf("%s is not managed by secure-ftp", entry.Source)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, line := range m.lines {
+		if line != entry.line {
+			continue
+		}
+		if line.key == nil {
+			return fmt.Errorf("fingerprints recorded by former versions cannot be annotated")
+		}
+
+		line.comment = strings.Join(strings.Fields(comment), " ")
+		fields := []string{line.hosts, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(line.key)))}
+		if line.marker != "" {
+			fields = append([]string{line.marker}, fields...)
+		}
+		if line.comment != "" {
+			fields = append(fields, line.comment)
+		}
+		line.text = strings.Join(fields, " ")
+		return m.save()
+	}
+	return fmt.Errorf("host key no longer in known_hosts")
+}
@@ -0,0 +1,463 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newTestKey returns a new ed25519 public key and its signer.
+func newTestKey(t *testing.T) (ssh.PublicKey, ssh.Signer) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.PublicKey(), signer
+}
+
+// newTestECDSAKey returns a new ECDSA P-256 public key.
+func newTestECDSAKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestKnownHosts returns a KnownHostsManager reading a known_hosts file
+// of the given lines. OpenSSH's own files are ignored.
+func newTestKnownHosts(t *testing.T, lines ...string) *KnownHostsManager {
+	t.Helper()
+	dir := t.TempDir()
+	if len(lines) > 0 {
+		content := strings.Join(lines, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "known_hosts"), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &KnownHostsManager{filePath: filepath.Join(dir, "known_hosts")}
+	if err := m.load(); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// authorizedKey returns key as written in known_hosts lines.
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestKnownHostsVerify(t *testing.T) {
+	plain, _ := newTestKey(t)
+	ported, _ := newTestKey(t)
+	hashed, _ := newTestKey(t)
+	wildcard, _ := newTestKey(t)
+	revoked, _ := newTestKey(t)
+	legacy, _ := newTestKey(t)
+	other, _ := newTestKey(t)
+	caKey, ca := newTestKey(t)
+
+	hostKey, _ := newTestKey(t)
+	cert := &ssh.Certificate{
+		Key:             hostKey,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"node1.example.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestKnownHosts(t,
+		"# comment",
+		"plain.example.com,10.0.0.1 "+authorizedKey(plain),
+		"[ported.example.com]:2222 "+authorizedKey(ported),
+		knownhosts.HashHostname("hashed.example.com")+" "+authorizedKey(hashed),
+		"*.wild.example.com,!bad.wild.example.com "+authorizedKey(wildcard),
+		"@revoked * "+authorizedKey(revoked),
+		"@cert-authority *.example.com "+authorizedKey(caKey),
+		"[legacy.example.com]:22 "+GetFingerprint(legacy),
+	)
+
+	tests := []struct {
+		name string
+		host string
+		port int
+		key  ssh.PublicKey
+		want HostKeyStatus
+	}{
+		{"known host", "plain.example.com", 22, plain, HostKeyValid},
+		{"second name of a line", "10.0.0.1", 22, plain, HostKeyValid},
+		{"host names ignore case", "PLAIN.example.com", 22, plain, HostKeyValid},
+		{"key of another host", "plain.example.com", 22, other, HostKeyChanged},
+		{"other port", "plain.example.com", 2222, plain, HostKeyNew},
+		{"non-standard port", "ported.example.com", 2222, ported, HostKeyValid},
+		{"hashed host name", "hashed.example.com", 22, hashed, HostKeyValid},
+		{"wildcard", "a.wild.example.com", 22, wildcard, HostKeyValid},
+		{"negated pattern", "bad.wild.example.com", 22, wildcard, HostKeyNew},
+		{"revoked key", "plain.example.com", 22, revoked, HostKeyRevoked},
+		{"certificate of a trusted authority", "node1.example.com", 22, cert, HostKeyValid},
+		{"certificate for another host", "node2.example.com", 22, cert, HostKeyChanged},
+		{"legacy fingerprint", "legacy.example.com", 22, legacy, HostKeyValid},
+		{"legacy fingerprint of another key", "legacy.example.com", 22, other, HostKeyChanged},
+		{"unknown host", "new.example.com", 22, other, HostKeyNew},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := m.VerifyHostKey(tt.host, tt.port, tt.key)
+			if status != tt.want {
+				t.Errorf("VerifyHostKey(%s, %d) = %v, want %v", tt.host, tt.port, status, tt.want)
+			}
+		})
+	}
+}
+
+func TestKnownHostsWrite(t *testing.T) {
+	kept, _ := newTestKey(t)
+	first, _ := newTestKey(t)
+	second, _ := newTestKey(t)
+
+	keptLine := "|1|c2FsdA==|aGFzaA== " + authorizedKey(kept)
+	m := newTestKnownHosts(t, "# kept comment", keptLine)
+
+	if err := m.AddHost("example.com", 2222, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddHost("example.com", 22, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveHost("example.com", 22); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines it did not write are kept unchanged, and OpenSSH can read the others
+	data, err := os.ReadFile(m.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# kept comment\n" + keptLine + "\n" + knownhosts.Line([]string{"[example.com]:2222"}, first) + "\n"
+	if string(data) != want {
+		t.Errorf("known_hosts =\n%s\nwant\n%s", data, want)
+	}
+
+	callback, err := knownhosts.New(m.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+	if err := callback("example.com:2222", addr, first); err != nil {
+		t.Errorf("OpenSSH known_hosts check of the added key: %v", err)
+	}
+
+	// A new manager reads back what was written
+	reread := &KnownHostsManager{filePath: m.filePath}
+	if err := reread.load(); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := reread.VerifyHostKey("example.com", 2222, first); status != HostKeyValid {
+		t.Errorf("VerifyHostKey after reload = %v, want %v", status, HostKeyValid)
+	}
+	if status, _ := reread.VerifyHostKey("example.com", 22, second); status != HostKeyNew {
+		t.Errorf("VerifyHostKey of a removed host = %v, want %v", status, HostKeyNew)
+	}
+}
+
+func TestKnownHostsCallback(t *testing.T) {
+	key, _ := newTestKey(t)
+	changed, _ := newTestKey(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+
+	t.Run("unknown host rejected without callback", func(t *testing.T) {
+		m := newTestKnownHosts(t)
+		if err := m.GetHostKeyCallback()("example.com:2222", addr, key); err == nil {
+			t.Errorf("unknown host accepted")
+		}
+	})
+
+	t.Run("unknown host accepted and recorded", func(t *testing.T) {
+		m := newTestKnownHosts(t)
+		var asked string
+		m.SetCallbacks(func(host, fingerprint string) bool {
+			asked = host
+			return true
+		}, nil)
+
+		if err := m.GetHostKeyCallback()("example.com:2222", addr, key); err != nil {
+			t.Fatal(err)
+		}
+		if asked != "[example.com]:2222" {
+			t.Errorf("asked about %q, want [example.com]:2222", asked)
+		}
+		if status, _ := m.VerifyHostKey("example.com", 2222, key); status != HostKeyValid {
+			t.Errorf("accepted key status = %v, want %v", status, HostKeyValid)
+		}
+	})
+
+	t.Run("legacy fingerprint upgraded", func(t *testing.T) {
+		m := newTestKnownHosts(t, "[example.com]:2222 "+GetFingerprint(key))
+		if err := m.GetHostKeyCallback()("example.com:2222", addr, key); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(m.filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := knownhosts.Line([]string{"[example.com]:2222"}, key) + "\n"; string(data) != want {
+			t.Errorf("known_hosts = %q, want %q", data, want)
+		}
+	})
+
+	t.Run("changed key refused", func(t *testing.T) {
+		m := newTestKnownHosts(t, knownhosts.Line([]string{"[example.com]:2222"}, key))
+		m.SetCallbacks(nil, func(host, oldFP, newFP string) bool {
+			return false
+		})
+		if err := m.GetHostKeyCallback()("example.com:2222", addr, changed); err == nil {
+			t.Errorf("changed key accepted")
+		}
+	})
+}
+
+func TestKnownHostsImportExport(t *testing.T) {
+	known, _ := newTestKey(t)
+	imported, _ := newTestKey(t)
+	revoked, _ := newTestKey(t)
+
+	m := newTestKnownHosts(t, knownhosts.Line([]string{"known.example.com"}, known))
+
+	dir := t.TempDir()
+	openSSHFile := filepath.Join(dir, "ssh_known_hosts")
+	lines := []string{
+		knownhosts.Line([]string{"known.example.com"}, known),
+		knownhosts.Line([]string{knownhosts.HashHostname("imported.example.com")}, imported),
+		"@revoked * " + authorizedKey(revoked),
+		"# not a key",
+	}
+	if err := os.WriteFile(openSSHFile, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := m.Import(openSSHFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 {
+		t.Errorf("Import() added %d keys, want 2", added)
+	}
+	if status, _ := m.VerifyHostKey("imported.example.com", 22, imported); status != HostKeyValid {
+		t.Errorf("imported key status = %v, want %v", status, HostKeyValid)
+	}
+	if status, _ := m.VerifyHostKey("known.example.com", 22, revoked); status != HostKeyRevoked {
+		t.Errorf("imported revocation status = %v, want %v", status, HostKeyRevoked)
+	}
+
+	// Exporting to a file without a final line break adds the missing keys only
+	exportFile := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(exportFile, []byte(lines[0]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := m.Export(exportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported != 2 {
+		t.Errorf("Export() added %d keys, want 2", exported)
+	}
+	data, err := os.ReadFile(exportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(lines[:3], "\n") + "\n"; string(data) != want {
+		t.Errorf("exported file =\n%s\nwant\n%s", data, want)
+	}
+
+	if exported, err := m.Export(exportFile); err != nil || exported != 0 {
+		t.Errorf("second Export() = %d, %v, want 0, nil", exported, err)
+	}
+}
+
+func TestKnownHostsSeveralKeys(t *testing.T) {
+	ed, _ := newTestKey(t)
+	ec := newTestECDSAKey(t)
+	otherEd, _ := newTestKey(t)
+	otherEc := newTestECDSAKey(t)
+
+	m := newTestKnownHosts(t,
+		knownhosts.Line([]string{"example.com"}, ed),
+		knownhosts.Line([]string{"example.com"}, ec),
+	)
+
+	tests := []struct {
+		name string
+		key  ssh.PublicKey
+		want HostKeyStatus
+	}{
+		{"first key", ed, HostKeyValid},
+		{"second key", ec, HostKeyValid},
+		{"other key of a known type", otherEd, HostKeyChanged},
+		{"other key of the second type", otherEc, HostKeyChanged},
+	}
+	for _, tt := range tests {
+		if status, _ := m.VerifyHostKey("example.com", 22, tt.key); status != tt.want {
+			t.Errorf("%s: VerifyHostKey() = %v, want %v", tt.name, status, tt.want)
+		}
+	}
+
+	// A key of a type not known yet is an additional key, not a change
+	single := newTestKnownHosts(t, knownhosts.Line([]string{"example.com"}, ed))
+	if status, _ := single.VerifyHostKey("example.com", 22, ec); status != HostKeyNew {
+		t.Errorf("VerifyHostKey() of a new key type = %v, want %v", status, HostKeyNew)
+	}
+
+	// Updating a key replaces the key of its type only
+	if err := m.UpdateHost("example.com", 22, otherEd); err != nil {
+		t.Fatal(err)
+	}
+	updated := []struct {
+		name string
+		key  ssh.PublicKey
+		want HostKeyStatus
+	}{
+		{"replaced key", ed, HostKeyChanged},
+		{"new key", otherEd, HostKeyValid},
+		{"key of the other type", ec, HostKeyValid},
+	}
+	for _, tt := range updated {
+		if status, _ := m.VerifyHostKey("example.com", 22, tt.key); status != tt.want {
+			t.Errorf("after UpdateHost, %s status = %v, want %v", tt.name, status, tt.want)
+		}
+	}
+}
+
+func TestKnownHostsAlgorithms(t *testing.T) {
+	ed, _ := newTestKey(t)
+	ec := newTestECDSAKey(t)
+
+	m := newTestKnownHosts(t,
+		knownhosts.Line([]string{"example.com"}, ec),
+		knownhosts.Line([]string{"[example.com]:2222"}, ed),
+		"[legacy.example.com]:22 "+GetFingerprint(ed),
+	)
+
+	if got := m.HostKeyAlgorithms("example.com", 22)[0]; got != ssh.KeyAlgoECDSA256 {
+		t.Errorf("first algorithm = %s, want %s", got, ssh.KeyAlgoECDSA256)
+	}
+	if got := m.HostKeyAlgorithms("example.com", 2222)[0]; got != ssh.KeyAlgoED25519 {
+		t.Errorf("first algorithm on port 2222 = %s, want %s", got, ssh.KeyAlgoED25519)
+	}
+	if got := m.HostKeyAlgorithms("legacy.example.com", 22); got != nil {
+		t.Errorf("algorithms of a legacy fingerprint = %q, want the default order", got)
+	}
+	if got := m.HostKeyAlgorithms("new.example.com", 22); got != nil {
+		t.Errorf("algorithms of an unknown host = %q, want the default order", got)
+	}
+
+	// Every default algorithm is still offered, once
+	algorithms := m.HostKeyAlgorithms("example.com", 22)
+	if len(algorithms) != len(defaultHostKeyAlgorithms) {
+		t.Errorf("HostKeyAlgorithms() = %q, want a reordering of %q", algorithms, defaultHostKeyAlgorithms)
+	}
+}
+
+func TestKnownHostsRotation(t *testing.T) {
+	kept, _ := newTestKey(t)
+	retired := newTestECDSAKey(t)
+	added := newTestECDSAKey(t)
+	shared, _ := newTestKey(t)
+	revoked, _ := newTestKey(t)
+
+	tests := []struct {
+		name        string
+		lines       []string
+		keys        []ssh.PublicKey
+		wantAdded   int
+		wantRemoved int
+		wantValid   []ssh.PublicKey
+	}{
+		{
+			name:        "retired key replaced",
+			lines:       []string{knownhosts.Line([]string{"example.com"}, kept), knownhosts.Line([]string{"example.com"}, retired)},
+			keys:        []ssh.PublicKey{kept, added},
+			wantAdded:   1,
+			wantRemoved: 1,
+			wantValid:   []ssh.PublicKey{kept, added},
+		},
+		{
+			name:      "no key trusted",
+			lines:     []string{knownhosts.Line([]string{"example.com"}, retired)},
+			keys:      []ssh.PublicKey{kept, added},
+			wantValid: []ssh.PublicKey{retired},
+		},
+		{
+			name:      "revoked key announced",
+			lines:     []string{knownhosts.Line([]string{"example.com"}, kept), "@revoked * " + authorizedKey(revoked)},
+			keys:      []ssh.PublicKey{kept, revoked},
+			wantValid: []ssh.PublicKey{kept},
+		},
+		{
+			name:      "key shared with another host kept",
+			lines:     []string{knownhosts.Line([]string{"example.com"}, kept), knownhosts.Line([]string{"example.com", "other.example.com"}, shared)},
+			keys:      []ssh.PublicKey{kept},
+			wantValid: []ssh.PublicKey{kept, shared},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestKnownHosts(t, tt.lines...)
+			before, err := os.ReadFile(m.filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotAdded, gotRemoved, err := m.UpdateHostKeys("example.com", 22, tt.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotAdded != tt.wantAdded || gotRemoved != tt.wantRemoved {
+				t.Errorf("UpdateHostKeys() = %d added, %d removed, want %d, %d", gotAdded, gotRemoved, tt.wantAdded, tt.wantRemoved)
+			}
+
+			var valid []ssh.PublicKey
+			for _, key := range []ssh.PublicKey{kept, retired, added, shared} {
+				if status, _ := m.VerifyHostKey("example.com", 22, key); status == HostKeyValid {
+					valid = append(valid, key)
+				}
+			}
+			if !reflect.DeepEqual(valid, tt.wantValid) {
+				t.Errorf("%d keys valid after UpdateHostKeys(), want %d", len(valid), len(tt.wantValid))
+			}
+
+			// The file is only written when keys change
+			after, err := os.ReadFile(m.filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := string(after) != string(before); changed != (tt.wantAdded+tt.wantRemoved > 0) {
+				t.Errorf("known_hosts changed = %v, want %v", changed, !changed)
+			}
+		})
+	}
+}
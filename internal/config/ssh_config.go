@@ -0,0 +1,394 @@
+// Package config provides the import of OpenSSH client configuration hosts
+// as connection profiles.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth bounds nested Include directives, as OpenSSH does.
+const maxIncludeDepth = 16
+
+// sshConfigBlock is a Host block of an ssh_config file, with its options in
+// file order. Options before the first Host line belong to a "*" block.
+type sshConfigBlock struct {
+	patterns []string
+	options  []sshConfigOption
+}
+
+// sshConfigOption is a keyword, lowercased, and its arguments.
+type sshConfigOption struct {
+	keyword string
+	args    []string
+}
+
+// DefaultSSHConfigPath returns the path of the user's OpenSSH client
+// configuration, ~/.ssh/config.
+func DefaultSSHConfigPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".ssh", "config")
+}
+
+// ParseSSHConfig reads an OpenSSH client configuration file and returns an
+// SFTP profile for each host alias of its Host blocks. Wildcard blocks apply
+// to the aliases they match, the first value of an option winning as in
+// OpenSSH. ProxyJump hops that are not aliases themselves are returned as
+// additional profiles, which jump profiles refer to by name.
+func ParseSSHConfig(path string) ([]ConnectionProfile, error) {
+	blocks := []*sshConfigBlock{{patterns: []string{"*"}}}
+	if err := readSSHConfig(path, &blocks, 0); err != nil {
+		return nil, err
+	}
+
+	var aliases []string
+	seen := make(map[string]bool)
+	for _, block := range blocks {
+		for _, pattern := range block.patterns {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			aliases = append(aliases, pattern)
+		}
+	}
+
+	var profiles []ConnectionProfile
+	hops := make(map[string]bool)
+	for _, alias := range aliases {
+		profile, jumps, err := sshConfigProfile(blocks, alias)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+
+		for _, jump := range jumps {
+			if seen[jump.Name] || hops[jump.Name] {
+				continue
+			}
+			hops[jump.Name] = true
+			profiles = append(profiles, jump)
+		}
+	}
+
+	return profiles, nil
+}
+
+// readSSHConfig appends the Host blocks of the file at path to blocks,
+// following Include directives.
+func readSSHConfig(path string, blocks *[]*sshConfigBlock, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: too many nested Include directives", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		keyword, args, err := parseSSHConfigLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+
+		switch keyword {
+		case "":
+			// Blank line or comment
+		case "host":
+			*blocks = append(*blocks, &sshConfigBlock{patterns: args})
+		case "match":
+			// Match conditions are not evaluated: its options never apply
+			*blocks = append(*blocks, &sshConfigBlock{})
+		case "include":
+			for _, pattern := range args {
+				if err := includeSSHConfig(pattern, blocks, depth); err != nil {
+					return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+				}
+			}
+		default:
+			block := (*blocks)[len(*blocks)-1]
+			block.options = append(block.options, sshConfigOption{keyword: keyword, args: args})
+		}
+	}
+
+	return scanner.Err()
+}
+
+// includeSSHConfig reads the files matching an Include pattern, relative to
+// ~/.ssh unless absolute.
+func includeSSHConfig(pattern string, blocks *[]*sshConfigBlock, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(DefaultSSHConfigPath()), pattern)
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := readSSHConfig(path, blocks, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSSHConfigLine splits a line into its lowercased keyword and its
+// arguments. Keywords may be followed by spaces or "=", and arguments may
+// be double-quoted. It returns an empty keyword for blank lines and comments.
+func parseSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return "", nil, fmt.Errorf("missing argument for %s", line)
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var args []string
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			arg, rest = rest[1:closing+1], rest[closing+2:]
+		} else if end := strings.IndexAny(rest, " \t"); end >= 0 {
+			arg, rest = rest[:end], rest[end:]
+		} else {
+			arg, rest = rest, ""
+		}
+		if strings.HasPrefix(arg, "#") {
+			break
+		}
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("missing argument for %s", keyword)
+	}
+	return keyword, args, nil
+}
+
+// sshConfigProfile returns the profile of alias, and the profiles of its
+// ProxyJump hops that are not aliases.
+func sshConfigProfile(blocks []*sshConfigBlock, alias string) (ConnectionProfile, []ConnectionProfile, error) {
+	options := make(map[string][]string)
+	var identityFiles []string
+	for _, block := range blocks {
+		if !matchHost(strings.Join(block.patterns, ","), alias) {
+			continue
+		}
+		for _, option := range block.options {
+			if option.keyword == "identityfile" {
+				identityFiles = append(identityFiles, option.args[0])
+			} else if _, ok := options[option.keyword]; !ok {
+				options[option.keyword] = option.args
+			}
+		}
+	}
+
+	first := func(keyword string) string {
+		if args := options[keyword]; len(args) > 0 {
+			return args[0]
+		}
+		return ""
+	}
+
+	profile := ConnectionProfile{
+		Name:     alias,
+		Protocol: "sftp",
+		Host:     alias,
+		Port:     22,
+		Username: localUsername(),
+	}
+	if hostName := first("hostname"); hostName != "" {
+		profile.Host = strings.ReplaceAll(hostName, "%h", alias)
+	}
+	if portStr := first("port"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return profile, nil, fmt.Errorf("host %s: invalid port: %s", alias, portStr)
+		}
+		profile.Port = port
+	}
+	if username := first("user"); username != "" {
+		profile.Username = username
+	}
+	if timeout, err := strconv.Atoi(first("connecttimeout")); err == nil {
+		profile.Timeout = timeout
+	}
+
+	for _, path := range identityFiles {
+		if strings.EqualFold(path, "none") {
+			continue
+		}
+		profile.IdentityFiles = append(profile.IdentityFiles, expandSSHTokens(path, &profile))
+	}
+	profile.IdentitiesOnly = strings.EqualFold(first("identitiesonly"), "yes")
+	profile.AuthMethods = sshAuthMethods(first("preferredauthentications"))
+
+	var jumps []ConnectionProfile
+	if proxyJump := first("proxyjump"); proxyJump != "" && !strings.EqualFold(proxyJump, "none") {
+		for _, hop := range strings.Split(proxyJump, ",") {
+			jump, isAlias, err := sshJumpProfile(blocks, hop)
+			if err != nil {
+				return profile, nil, fmt.Errorf("host %s: %w", alias, err)
+			}
+			profile.JumpProfiles = append(profile.JumpProfiles, jump.Name)
+			if !isAlias {
+				jumps = append(jumps, jump)
+			}
+		}
+	}
+
+	return profile, jumps, nil
+}
+
+// sshJumpProfile returns the profile of a ProxyJump hop, [user@]host[:port],
+// and whether it is one of the configuration's aliases.
+func sshJumpProfile(blocks []*sshConfigBlock, hop string) (ConnectionProfile, bool, error) {
+	hop = strings.TrimPrefix(strings.TrimSpace(hop), "ssh://")
+	for _, block := range blocks {
+		for _, pattern := range block.patterns {
+			if pattern == hop && !strings.ContainsAny(pattern, "*?!") {
+				return ConnectionProfile{Name: hop}, true, nil
+			}
+		}
+	}
+
+	profile := ConnectionProfile{
+		Name:     hop,
+		Protocol: "sftp",
+		Host:     hop,
+		Port:     22,
+		Username: localUsername(),
+	}
+	if at := strings.LastIndex(hop, "@"); at >= 0 {
+		profile.Username, profile.Host = hop[:at], hop[at+1:]
+	}
+	if host, portStr, err := net.SplitHostPort(profile.Host); err == nil {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return profile, false, fmt.Errorf("invalid ProxyJump port: %s", portStr)
+		}
+		profile.Host, profile.Port = host, port
+	}
+	if profile.Host == "" {
+		return profile, false, fmt.Errorf("invalid ProxyJump host: %s", hop)
+	}
+	return profile, false, nil
+}
+
+// sshAuthMethods converts PreferredAuthentications to profile authentication
+// methods. OpenSSH's publickey covers the agent's keys too.
+func sshAuthMethods(preferred string) []string {
+	if preferred == "" {
+		return nil
+	}
+
+	var methods []string
+	for _, method := range strings.Split(preferred, ",") {
+		switch strings.TrimSpace(method) {
+		case "publickey":
+			methods = append(methods, "publickey", "agent")
+		case "keyboard-interactive":
+			methods = append(methods, "keyboard-interactive")
+		case "password":
+			methods = append(methods, "password")
+		}
+	}
+	return methods
+}
+
+// expandSSHTokens expands the tokens of an IdentityFile path: %d (home
+// directory), %u (local user), %h (host name), %r (remote user) and %%.
+func expandSSHTokens(path string, profile *ConnectionProfile) string {
+	homeDir, _ := os.UserHomeDir()
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%d", homeDir,
+		"%u", localUsername(),
+		"%h", profile.Host,
+		"%r", profile.Username,
+	)
+	return replacer.Replace(path)
+}
+
+// expandHome replaces a leading ~ of path by the home directory.
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[1:])
+		}
+	}
+	return path
+}
+
+// localUsername returns the name of the local user, OpenSSH's default user.
+func localUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// ImportSSHConfig adds a profile for each host of an OpenSSH client
+// configuration file, as returned by ParseSSHConfig. Hosts with the name of
+// an existing profile are skipped. It returns how many profiles were added.
+func (cm *ConfigManager) ImportSSHConfig(path string) (int, error) {
+	profiles, err := ParseSSHConfig(path)
+	if err != nil {
+		return 0, err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	added := make(map[string]bool)
+	for _, profile := range profiles {
+		if cm.findProfile(profile.Name) != nil {
+			continue
+		}
+		profile.ID = generateProfileID()
+		cm.config.Profiles = append(cm.config.Profiles, profile)
+		added[profile.ID] = true
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	// Jump profiles were named after the aliases: refer to them by ID
+	for i := range cm.config.Profiles {
+		profile := &cm.config.Profiles[i]
+		if !added[profile.ID] {
+			continue
+		}
+		for j, ref := range profile.JumpProfiles {
+			if jump := cm.findProfile(ref); jump != nil {
+				profile.JumpProfiles[j] = jump.ID
+			}
+		}
+	}
+
+	return len(added), cm.save()
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSSHConfig writes an ssh_config file in dir and returns its path.
+func writeSSHConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseSSHConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeSSHConfig(t, dir, "included.conf", `
+Host db
+    HostName 10.0.0.5
+    ProxyJump bastion
+`)
+	path := writeSSHConfig(t, dir, "config", `
+# Global options apply to every host, after their own
+IdentitiesOnly yes
+
+Host web web-alias
+    HostName %h.example.com
+    User deploy
+    Port 2222
+    IdentityFile /keys/web
+    PreferredAuthentications publickey,password
+
+Host bastion
+    HostName bastion.example.com
+    User = "jump user"
+    ConnectTimeout 15
+
+Host *.internal !skip.internal
+    User internal
+
+Host app.internal
+    ProxyJump admin@gw.example.com:2200,bastion
+
+Include `+filepath.Join(dir, "*.conf")+`
+
+Host *
+    User fallback
+    IdentityFile /keys/default
+`)
+
+	profiles, err := ParseSSHConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string]ConnectionProfile)
+	var names []string
+	for _, profile := range profiles {
+		byName[profile.Name] = profile
+		names = append(names, profile.Name)
+	}
+	wantNames := []string{"web", "web-alias", "bastion", "app.internal", "admin@gw.example.com:2200", "db"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("profiles = %q, want %q", names, wantNames)
+	}
+
+	tests := []ConnectionProfile{
+		{
+			Name: "web", Protocol: "sftp", Host: "web.example.com", Port: 2222, Username: "deploy",
+			IdentityFiles: []string{"/keys/web", "/keys/default"}, IdentitiesOnly: true,
+			AuthMethods: []string{"publickey", "agent", "password"},
+		},
+		{
+			Name: "web-alias", Protocol: "sftp", Host: "web-alias.example.com", Port: 2222, Username: "deploy",
+			IdentityFiles: []string{"/keys/web", "/keys/default"}, IdentitiesOnly: true,
+			AuthMethods: []string{"publickey", "agent", "password"},
+		},
+		{
+			Name: "bastion", Protocol: "sftp", Host: "bastion.example.com", Port: 22, Username: "jump user",
+			IdentityFiles: []string{"/keys/default"}, IdentitiesOnly: true, Timeout: 15,
+		},
+		{
+			Name: "app.internal", Protocol: "sftp", Host: "app.internal", Port: 22, Username: "internal",
+			IdentityFiles: []string{"/keys/default"}, IdentitiesOnly: true,
+			JumpProfiles: []string{"admin@gw.example.com:2200", "bastion"},
+		},
+		{
+			Name: "admin@gw.example.com:2200", Protocol: "sftp", Host: "gw.example.com", Port: 2200, Username: "admin",
+		},
+		{
+			Name: "db", Protocol: "sftp", Host: "10.0.0.5", Port: 22, Username: "fallback",
+			IdentityFiles: []string{"/keys/default"}, IdentitiesOnly: true,
+			JumpProfiles: []string{"bastion"},
+		},
+	}
+	for _, want := range tests {
+		if got := byName[want.Name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("profile %s =\n%+v\nwant\n%+v", want.Name, got, want)
+		}
+	}
+}
+
+func TestParseSSHConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"invalid port", "Host a\n    Port ssh\n"},
+		{"missing argument", "Host a\n    HostName\n"},
+		{"unterminated quote", "Host a\n    User \"admin\n"},
+		{"invalid jump port", "Host a\n    ProxyJump gw:99999\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeSSHConfig(t, t.TempDir(), "config", tt.content)
+			if _, err := ParseSSHConfig(path); err == nil {
+				t.Errorf("ParseSSHConfig(%q) succeeded", tt.content)
+			}
+		})
+	}
+}
+
+func TestImportSSHConfig(t *testing.T) {
+	existing := ConnectionProfile{ID: "p1", Name: "bastion", Protocol: "sftp", Host: "old.example.com", Port: 22, Username: "old"}
+	cm := newTestConfigManager(t, existing)
+
+	path := writeSSHConfig(t, t.TempDir(), "config", `
+Host bastion
+    HostName bastion.example.com
+
+Host app
+    ProxyJump bastion
+`)
+
+	added, err := cm.ImportSSHConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Errorf("ImportSSHConfig() added %d profiles, want 1", added)
+	}
+
+	var app *ConnectionProfile
+	for _, profile := range cm.GetProfiles() {
+		if profile.Name == "bastion" && profile.Host != "old.example.com" {
+			t.Errorf("existing profile bastion was replaced")
+		}
+		if profile.Name == "app" {
+			profile := profile
+			app = &profile
+		}
+	}
+	if app == nil {
+		t.Fatal("profile app not imported")
+	}
+	if app.ID == "" {
+		t.Errorf("imported profile has no ID")
+	}
+	// Jump profiles refer to the existing profile by ID
+	if want := []string{"p1"}; !reflect.DeepEqual(app.JumpProfiles, want) {
+		t.Errorf("JumpProfiles = %q, want %q", app.JumpProfiles, want)
+	}
+
+	if added, err := cm.ImportSSHConfig(path); err != nil || added != 0 {
+		t.Errorf("second ImportSSHConfig() = %d, %v, want 0, nil", added, err)
+	}
+}
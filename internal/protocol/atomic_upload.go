@@ -0,0 +1,157 @@
+// Package protocol provides atomic uploads through a temporary name.
+package protocol
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when the local and remote copies of a
+// transferred file differ.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// partialUploadMarker separates the name of an atomic upload's target from
+// the id of its temporary file.
+const partialUploadMarker = ".partial-"
+
+// Replacer is an optional capability of a Protocol that renames a file over
+// an existing one in a single step, such as SFTP's posix-rename@openssh.com.
+type Replacer interface {
+	// Replace renames oldPath to newPath, replacing newPath if it exists.
+	// It returns ErrNotSupported if the server cannot.
+	Replace(ctx context.Context, oldPath, newPath string) error
+}
+
+// configured is implemented by clients that keep their ConnectionConfig.
+type configured interface {
+	connectionConfig() *ConnectionConfig
+}
+
+// PartialUploadPath returns the temporary file an atomic upload of a local
+// file to remotePath is written to: .name.partial-<id> in the same
+// directory. The id depends on the local file, so that an interrupted upload
+// of the same file resumes while a newer version starts afresh.
+func PartialUploadPath(remotePath string, local os.FileInfo) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", local.Name(), local.Size(), local.ModTime().UnixNano())))
+	name := "." + path.Base(remotePath) + partialUploadMarker + hex.EncodeToString(sum[:4])
+	return path.Join(path.Dir(remotePath), name)
+}
+
+// IsPartialUpload reports whether name is the temporary file of an atomic
+// upload.
+func IsPartialUpload(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, partialUploadMarker)
+}
+
+// UploadAtomic uploads localPath to a temporary name next to remotePath, then
+// renames it to remotePath once its size, and its checksum if verify is set,
+// match the local file. Until then remotePath keeps its previous content. An
+// interrupted upload leaves the temporary file, which resume continues; one
+// that proved corrupt or could not be renamed is removed. A replaced file
+// keeps its permissions, unless the client preserves those of local files.
+func UploadAtomic(ctx context.Context, client Protocol, localPath, remotePath string, resume, verify bool, progressFn func(TransferProgress)) error {
+	localInfo, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+
+	existing, err := client.Stat(ctx, remotePath)
+	if err != nil {
+		existing = nil
+	}
+	if existing != nil && existing.IsDir {
+		return fmt.Errorf("cannot replace directory: %s", remotePath)
+	}
+
+	partialPath := PartialUploadPath(remotePath, localInfo)
+	if err := client.Upload(ctx, localPath, partialPath, resume, progressFn); err != nil {
+		return err
+	}
+
+	if err := checkPartialUpload(ctx, client, localPath, partialPath, localInfo.Size(), verify); err != nil {
+		client.Remove(ctx, partialPath)
+		return err
+	}
+
+	if existing != nil && !preservesPermissions(client) && existing.Permissions != "" &&
+		!strings.Contains(existing.Permissions, "?") {
+		err := client.Chmod(ctx, partialPath, existing.Mode&preservedModeBits)
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return fmt.Errorf("failed to keep permissions: %w", err)
+		}
+	}
+
+	if err := replaceFile(ctx, client, partialPath, remotePath, existing != nil); err != nil {
+		client.Remove(ctx, partialPath)
+		return fmt.Errorf("failed to rename %s: %w", path.Base(partialPath), err)
+	}
+	return nil
+}
+
+// checkPartialUpload verifies that the temporary file of an atomic upload is
+// complete and, if verify is set, identical to the local file.
+func checkPartialUpload(ctx context.Context, client Protocol, localPath, partialPath string, size int64, verify bool) error {
+	info, err := client.Stat(ctx, partialPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat uploaded file: %w", err)
+	}
+	if info.Size != size {
+		return fmt.Errorf("upload incomplete: %d of %d bytes", info.Size, size)
+	}
+	if !verify {
+		return nil
+	}
+
+	algo := PreferredHashAlgorithm(ctx, client)
+	localSum, err := HashLocalFile(localPath, algo)
+	if err != nil {
+		return fmt.Errorf("failed to hash local file: %w", err)
+	}
+	remoteSum, err := RemoteChecksum(ctx, client, partialPath, algo)
+	if err != nil {
+		return fmt.Errorf("failed to hash remote file: %w", err)
+	}
+	if localSum != remoteSum {
+		return fmt.Errorf("%w: local %s %s, remote %s", ErrChecksumMismatch, algo, localSum, remoteSum)
+	}
+	return nil
+}
+
+// replaceFile renames oldPath to newPath in a single step when the server
+// can. Otherwise an existing newPath is removed first if the rename fails,
+// leaving it missing for a moment.
+func replaceFile(ctx context.Context, client Protocol, oldPath, newPath string, exists bool) error {
+	if replacer, ok := client.(Replacer); ok {
+		err := replacer.Replace(ctx, oldPath, newPath)
+		if !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+	}
+
+	// FTP servers usually replace the target, SFTP v3 servers refuse
+	err := client.Rename(ctx, oldPath, newPath)
+	if err == nil || !exists {
+		return err
+	}
+	if err := client.Remove(ctx, newPath); err != nil {
+		return err
+	}
+	return client.Rename(ctx, oldPath, newPath)
+}
+
+// preservesPermissions reports whether uploads of client already give files
+// the permissions of the local ones.
+func preservesPermissions(client Protocol) bool {
+	c, ok := client.(configured)
+	if !ok {
+		return false
+	}
+	config := c.connectionConfig()
+	return config != nil && config.PreservePermissions
+}
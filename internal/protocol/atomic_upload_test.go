@@ -0,0 +1,209 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirServer is a Protocol storing its files in a local directory. Uploads can
+// be cut short or corrupted, and renames over an existing file refused, as by
+// SFTP v3 servers. Methods other than those used by UploadAtomic are not
+// implemented.
+type dirServer struct {
+	Protocol
+	root      string
+	truncate  bool // Uploads stop one byte short
+	corrupt   bool // Uploads flip the first byte
+	noReplace bool // Rename fails if the target exists
+}
+
+func (d *dirServer) local(path string) string {
+	return filepath.Join(d.root, filepath.FromSlash(path))
+}
+
+func (d *dirServer) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	info, err := os.Stat(d.local(path))
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{Name: info.Name(), Size: info.Size(), IsDir: info.IsDir(), ModTime: info.ModTime()}, nil
+}
+
+func (d *dirServer) Upload(ctx context.Context, localPath, remotePath string, resume bool, progressFn func(TransferProgress)) error {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	if d.truncate && len(data) > 0 {
+		data = data[:len(data)-1]
+	}
+	if d.corrupt && len(data) > 0 {
+		data = append([]byte{data[0] ^ 0xff}, data[1:]...)
+	}
+	return os.WriteFile(d.local(remotePath), data, 0644)
+}
+
+func (d *dirServer) GetReader(ctx context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(d.local(path))
+}
+
+func (d *dirServer) Remove(ctx context.Context, path string) error {
+	return os.Remove(d.local(path))
+}
+
+func (d *dirServer) Rename(ctx context.Context, oldPath, newPath string) error {
+	if d.noReplace {
+		if _, err := os.Stat(d.local(newPath)); err == nil {
+			return errors.New("failure")
+		}
+	}
+	return os.Rename(d.local(oldPath), d.local(newPath))
+}
+
+// replacingServer is a dirServer that replaces files in a single step.
+type replacingServer struct {
+	*dirServer
+	replaced int
+}
+
+func (r *replacingServer) Replace(ctx context.Context, oldPath, newPath string) error {
+	r.replaced++
+	return os.Rename(r.local(oldPath), r.local(newPath))
+}
+
+func TestUploadAtomic(t *testing.T) {
+	tests := []struct {
+		name         string
+		server       dirServer
+		replacer     bool
+		existing     string // Previous content of the target, if any
+		verify       bool
+		wantErr      error  // Expected error, errAny for any error
+		wantFile     string // Content of the target afterwards
+		wantReplaced int    // Calls to Replace
+	}{
+		{name: "new file", wantFile: "new content"},
+		{name: "replace by rename", existing: "old", wantFile: "new content"},
+		{
+			name:     "rename over existing file refused",
+			server:   dirServer{noReplace: true},
+			existing: "old",
+			wantFile: "new content",
+		},
+		{
+			name:         "replace in a single step",
+			server:       dirServer{noReplace: true},
+			replacer:     true,
+			existing:     "old",
+			wantFile:     "new content",
+			wantReplaced: 1,
+		},
+		{name: "verified", existing: "old", verify: true, wantFile: "new content"},
+		{
+			name:     "size mismatch",
+			server:   dirServer{truncate: true},
+			existing: "old",
+			wantErr:  errAny,
+			wantFile: "old",
+		},
+		{
+			name:     "checksum mismatch",
+			server:   dirServer{corrupt: true},
+			existing: "old",
+			verify:   true,
+			wantErr:  ErrChecksumMismatch,
+			wantFile: "old",
+		},
+		{
+			name:     "corruption not verified",
+			server:   dirServer{corrupt: true},
+			wantFile: "\x91ew content",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localDir := t.TempDir()
+			localPath := filepath.Join(localDir, "report.txt")
+			if err := os.WriteFile(localPath, []byte("new content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			server := tt.server
+			server.root = t.TempDir()
+			if tt.existing != "" {
+				if err := os.WriteFile(server.local("/report.txt"), []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var client Protocol = &server
+			replacer := &replacingServer{dirServer: &server}
+			if tt.replacer {
+				client = replacer
+			}
+
+			err := UploadAtomic(context.Background(), client, localPath, "/report.txt", false, tt.verify, nil)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("UploadAtomic() = %v", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("UploadAtomic() succeeded")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("UploadAtomic() = %v, want %v", err, tt.wantErr)
+			}
+
+			data, err := os.ReadFile(server.local("/report.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.wantFile {
+				t.Errorf("target = %q, want %q", data, tt.wantFile)
+			}
+			if replacer.replaced != tt.wantReplaced {
+				t.Errorf("Replace called %d times, want %d", replacer.replaced, tt.wantReplaced)
+			}
+
+			// Whether renamed or discarded, no temporary file is left
+			entries, err := os.ReadDir(server.root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if IsPartialUpload(entry.Name()) {
+					t.Errorf("temporary file %s left on the server", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+// errAny matches any error in the table of TestUploadAtomic.
+var errAny = errors.New("any error")
+
+func TestReplaceFileFallback(t *testing.T) {
+	server := &dirServer{root: t.TempDir(), noReplace: true}
+	for name, content := range map[string]string{"/new": "new", "/target": "old"} {
+		if err := os.WriteFile(server.local(name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without knowing the target exists, the refused rename is reported
+	if err := replaceFile(context.Background(), server, "/new", "/target", false); err == nil {
+		t.Fatal("replaceFile() over an unknown target succeeded")
+	}
+
+	if err := replaceFile(context.Background(), server, "/new", "/target", true); err != nil {
+		t.Fatalf("replaceFile() = %v", err)
+	}
+	if data, err := os.ReadFile(server.local("/target")); err != nil || string(data) != "new" {
+		t.Errorf("target = %q, %v, want \"new\"", data, err)
+	}
+	if _, err := os.Stat(server.local("/new")); !os.IsNotExist(err) {
+		t.Errorf("source still exists after replaceFile()")
+	}
+}
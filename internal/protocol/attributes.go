@@ -0,0 +1,77 @@
+// Package protocol provides the attributes of remote files: permissions,
+// ownership, timestamps and symbolic links.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// AttributeChanger changes the attributes of remote files. Every Protocol
+// provides it; operations the server does not support return ErrNotSupported.
+type AttributeChanger interface {
+	// Chmod changes the permission bits of a remote file or directory.
+	Chmod(ctx context.Context, path string, mode os.FileMode) error
+
+	// Chown changes the numeric owner and group of a remote file or
+	// directory.
+	Chown(ctx context.Context, path string, uid, gid int) error
+
+	// Chtimes changes the access and modification times of a remote file.
+	// FTP servers only set the modification time.
+	Chtimes(ctx context.Context, path string, atime, mtime time.Time) error
+
+	// Symlink creates newname as a symbolic link to oldname.
+	Symlink(ctx context.Context, oldname, newname string) error
+
+	// ReadLink returns the target of a symbolic link.
+	ReadLink(ctx context.Context, path string) (string, error)
+
+	// Truncate changes the size of a remote file.
+	Truncate(ctx context.Context, path string, size int64) error
+}
+
+// preservedModeBits are the bits of a local mode copied by uploads.
+const preservedModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// preserveUpload gives the remote copy of an upload the modification time
+// and permissions of the local file, as enabled by config. Servers that
+// cannot set them are left alone.
+func preserveUpload(ctx context.Context, client AttributeChanger, config *ConnectionConfig, remotePath string, local os.FileInfo) error {
+	if config == nil {
+		return nil
+	}
+
+	if config.PreserveModTime {
+		err := client.Chtimes(ctx, remotePath, time.Now(), local.ModTime())
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return fmt.Errorf("failed to set modification time: %w", err)
+		}
+	}
+
+	if config.PreservePermissions {
+		err := client.Chmod(ctx, remotePath, local.Mode()&preservedModeBits)
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return fmt.Errorf("failed to set permissions: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// preserveDownload gives the local copy of a download the modification time
+// of the remote file, as enabled by config. mtime is zero if the server did
+// not tell it.
+func preserveDownload(config *ConnectionConfig, localPath string, mtime time.Time) error {
+	if config == nil || !config.PreserveModTime || mtime.IsZero() {
+		return nil
+	}
+
+	if err := os.Chtimes(localPath, time.Now(), mtime); err != nil {
+		return fmt.Errorf("failed to set modification time: %w", err)
+	}
+	return nil
+}
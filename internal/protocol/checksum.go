@@ -0,0 +1,149 @@
+// Package protocol provides remote file checksums.
+package protocol
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// HashAlgorithm identifies a checksum algorithm.
+type HashAlgorithm string
+
+const (
+	HashMD5    HashAlgorithm = "md5"
+	HashSHA1   HashAlgorithm = "sha1"
+	HashSHA256 HashAlgorithm = "sha256"
+)
+
+// ErrChecksumUnsupported is returned when the server cannot compute a checksum.
+var ErrChecksumUnsupported = errors.New("server-side checksum not supported")
+
+// Checksummer is an optional capability of a Protocol whose server can hash
+// files itself, so that their content need not be downloaded.
+type Checksummer interface {
+	// ChecksumAlgorithms returns the algorithms the server supports, best
+	// first. The result is negotiated once per connection.
+	ChecksumAlgorithms(ctx context.Context) []HashAlgorithm
+
+	// Checksum returns the lowercase hex digest of a remote file computed by
+	// the server. It returns ErrChecksumUnsupported if algo is not available.
+	Checksum(ctx context.Context, path string, algo HashAlgorithm) (string, error)
+}
+
+// NewHash returns a hash.Hash for algo.
+func NewHash(algo HashAlgorithm) (hash.Hash, error) {
+	switch algo {
+	case HashMD5:
+		return md5.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm: %s", algo)
+	}
+}
+
+// HashReader returns the lowercase hex digest of everything read from r.
+func HashReader(r io.Reader, algo HashAlgorithm) (string, error) {
+	h, err := NewHash(algo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashLocalFile returns the lowercase hex digest of a local file.
+func HashLocalFile(path string, algo HashAlgorithm) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HashReader(f, algo)
+}
+
+// PreferredHashAlgorithm returns the strongest algorithm the server of client
+// can compute, or SHA-256 if it has no server-side checksum support (the
+// content is then streamed and hashed locally).
+func PreferredHashAlgorithm(ctx context.Context, client Protocol) HashAlgorithm {
+	if cs, ok := client.(Checksummer); ok {
+		if algos := cs.ChecksumAlgorithms(ctx); len(algos) > 0 {
+			return algos[0]
+		}
+	}
+	return HashSHA256
+}
+
+// RemoteChecksum returns the digest of a remote file, computed by the server
+// when it supports algo and otherwise by streaming the file through GetReader.
+func RemoteChecksum(ctx context.Context, client Protocol, path string, algo HashAlgorithm) (string, error) {
+	if cs, ok := client.(Checksummer); ok {
+		sum, err := cs.Checksum(ctx, path, algo)
+		if err == nil {
+			return sum, nil
+		}
+		if !errors.Is(err, ErrChecksumUnsupported) {
+			return "", err
+		}
+	}
+
+	r, err := client.GetReader(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open remote file: %w", err)
+	}
+	defer r.Close()
+
+	sum, err := HashReader(r, algo)
+	if err != nil {
+		return "", fmt.Errorf("failed to read remote file: %w", err)
+	}
+	return sum, nil
+}
+
+// hasAlgorithm reports whether algos contains algo.
+func hasAlgorithm(algos []HashAlgorithm, algo HashAlgorithm) bool {
+	for _, a := range algos {
+		if a == algo {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHexDigest returns the first field of output if it is a hex digest of
+// the length produced by algo.
+func parseHexDigest(output string, algo HashAlgorithm) (string, bool) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	h, err := NewHash(algo)
+	if err != nil {
+		return "", false
+	}
+
+	digest := strings.ToLower(fields[0])
+	// md5sum and friends prefix the digest with a backslash for escaped names
+	digest = strings.TrimPrefix(digest, "\\")
+	if len(digest) != h.Size()*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", false
+	}
+	return digest, true
+}
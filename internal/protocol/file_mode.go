@@ -0,0 +1,119 @@
+// Package protocol provides conversions between Unix modes, os.FileMode and
+// the permissions shown by ls -l.
+package protocol
+
+import (
+	"os"
+	"strings"
+)
+
+// permissionTypes are the file type characters of ls -l.
+var permissionTypes = []struct {
+	mode os.FileMode
+	char byte
+}{
+	{os.ModeDir, 'd'},
+	{os.ModeSymlink, 'l'},
+	{os.ModeNamedPipe, 'p'},
+	{os.ModeSocket, 's'},
+	{os.ModeDevice | os.ModeCharDevice, 'c'},
+	{os.ModeDevice, 'b'},
+}
+
+// permissionSpecials are the setuid, setgid and sticky bits, with the
+// position and character replacing x in ls -l permissions.
+var permissionSpecials = []struct {
+	mode  os.FileMode
+	unix  uint32
+	index int
+	char  byte
+}{
+	{os.ModeSetuid, 0o4000, 3, 's'},
+	{os.ModeSetgid, 0o2000, 6, 's'},
+	{os.ModeSticky, 0o1000, 9, 't'},
+}
+
+// FormatPermissions returns mode as shown by ls -l, such as "drwxr-xr-x" or
+// "-rwsr-x---". Unlike os.FileMode.String, setuid, setgid and sticky bits
+// replace the execute bits.
+func FormatPermissions(mode os.FileMode) string {
+	const rwx = "rwxrwxrwx"
+
+	b := []byte{'-'}
+	for _, t := range permissionTypes {
+		if mode&t.mode == t.mode {
+			b[0] = t.char
+			break
+		}
+	}
+	for i := 0; i < 9; i++ {
+		if mode&(1<<uint(8-i)) != 0 {
+			b = append(b, rwx[i])
+		} else {
+			b = append(b, '-')
+		}
+	}
+
+	for _, s := range permissionSpecials {
+		if mode&s.mode == 0 {
+			continue
+		}
+		if b[s.index] == 'x' {
+			b[s.index] = s.char
+		} else {
+			b[s.index] = s.char - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
+
+// UnixPermissions returns the permission, setuid, setgid and sticky bits of
+// mode as in a Unix mode, such as 0o2755.
+func UnixPermissions(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	for _, s := range permissionSpecials {
+		if mode&s.mode != 0 {
+			m |= s.unix
+		}
+	}
+	return m
+}
+
+// FileModeFromUnix converts the permission, setuid, setgid and sticky bits of
+// a Unix mode. The file type bits are ignored.
+func FileModeFromUnix(mode uint32) os.FileMode {
+	m := os.FileMode(mode & 0o777)
+	for _, s := range permissionSpecials {
+		if mode&s.unix != 0 {
+			m |= s.mode
+		}
+	}
+	return m
+}
+
+// fileModeFromPermissions parses permissions as shown by ls -l. Unknown
+// permissions, shown as '?', are left unset.
+func fileModeFromPermissions(perms string) os.FileMode {
+	var m os.FileMode
+	if len(perms) < 10 {
+		return m
+	}
+
+	for _, t := range permissionTypes {
+		if perms[0] == t.char {
+			m |= t.mode
+			break
+		}
+	}
+	for i := 0; i < 9; i++ {
+		if strings.IndexByte("rwxst", perms[i+1]) >= 0 {
+			m |= 1 << uint(8-i)
+		}
+	}
+	for _, s := range permissionSpecials {
+		if c := perms[s.index]; c == s.char || c == s.char-'a'+'A' {
+			m |= s.mode
+		}
+	}
+	return m
+}
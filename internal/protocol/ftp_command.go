@@ -0,0 +1,286 @@
+// Package protocol provides a command-only FTP control connection.
+package protocol
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ftpCommandConn is an additional control connection used for commands that
+// jlaffaye/ftp cannot send, such as FEAT, HASH or XSHA256, and for listings
+// whose facts jlaffaye/ftp drops. Its only data connections are listings.
+type ftpCommandConn struct {
+	conn     net.Conn
+	text     *textproto.Conn
+	features map[string]string // FEAT lines: command -> parameters
+
+	config      *ConnectionConfig
+	tlsConfig   *tls.Config // Shared by data connections, to resume the session
+	protectData bool        // PROT P accepted: data connections use TLS
+	skipEPSV    bool        // EPSV failed once, use PASV
+}
+
+// mlstFacts are the MLSx facts requested with OPTS MLST when the server
+// offers them.
+var mlstFacts = []string{
+	"type", "size", "sizd", "modify", "perm",
+	"unix.mode", "unix.owner", "unix.group", "unix.ownername", "unix.groupname", "unix.uid", "unix.gid",
+}
+
+// dialFTPCommandConn opens and authenticates a command connection.
+func dialFTPCommandConn(ctx context.Context, config *ConnectionConfig) (*ftpCommandConn, error) {
+	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
+	conn, err := newDialer(config)(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	fc := &ftpCommandConn{
+		features: make(map[string]string),
+		config:   config,
+	}
+	if config.Protocol != "ftp" {
+		fc.tlsConfig = ftpsTLSConfig(config)
+		if config.TLSImplicit {
+			conn = tls.Client(conn, fc.tlsConfig)
+		}
+	}
+	fc.conn = conn
+	fc.text = textproto.NewConn(conn)
+
+	if err := fc.login(config); err != nil {
+		fc.Close()
+		return nil, err
+	}
+
+	return fc, nil
+}
+
+// login reads the greeting, upgrades to TLS if needed, logs in and reads FEAT.
+func (fc *ftpCommandConn) login(config *ConnectionConfig) error {
+	if _, _, err := fc.readResponse(220); err != nil {
+		return fmt.Errorf("unexpected greeting: %w", err)
+	}
+
+	if config.Protocol != "ftp" && !config.TLSImplicit {
+		if _, _, err := fc.cmd(234, "AUTH TLS"); err != nil {
+			return fmt.Errorf("AUTH TLS failed: %w", err)
+		}
+		fc.conn = tls.Client(fc.conn, fc.tlsConfig)
+		fc.text = textproto.NewConn(fc.conn)
+	}
+
+	code, _, err := fc.cmd(0, "USER %s", config.Username)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	if code == 331 {
+		if _, _, err := fc.cmd(2, "PASS %s", config.Password); err != nil {
+			return fmt.Errorf("login failed: %w", err)
+		}
+	} else if code != 230 {
+		return fmt.Errorf("login failed: unexpected reply %d", code)
+	}
+
+	// FEAT is optional: servers without it simply offer no extensions
+	if _, message, err := fc.cmd(211, "FEAT"); err == nil {
+		for _, line := range strings.Split(message, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.EqualFold(line, "End") || strings.HasSuffix(line, ":") {
+				continue
+			}
+			command, params, _ := strings.Cut(line, " ")
+			fc.features[strings.ToUpper(command)] = strings.TrimSpace(params)
+		}
+	}
+
+	// Listings are encrypted like transfers
+	if fc.tlsConfig != nil {
+		if _, _, err := fc.cmd(2, "PBSZ 0"); err == nil {
+			if _, _, err := fc.cmd(2, "PROT P"); err == nil {
+				fc.protectData = true
+			}
+		}
+	}
+
+	// Ask for the facts describing permissions and owners, often not sent by default
+	if offered, ok := fc.features["MLST"]; ok {
+		if facts := selectMLSTFacts(offered); facts != "" {
+			fc.cmd(2, "OPTS MLST %s", facts)
+		}
+	}
+
+	return nil
+}
+
+// selectMLSTFacts returns the OPTS MLST argument selecting the facts of
+// mlstFacts among those offered in FEAT, as "type*;size*;unix.mode;".
+func selectMLSTFacts(offered string) string {
+	var selected strings.Builder
+	for _, fact := range strings.Split(offered, ";") {
+		fact = strings.TrimSuffix(strings.TrimSpace(fact), "*")
+		for _, wanted := range mlstFacts {
+			if strings.EqualFold(fact, wanted) {
+				selected.WriteString(fact + ";")
+				break
+			}
+		}
+	}
+	return selected.String()
+}
+
+// hasFeature reports whether FEAT advertised command.
+func (fc *ftpCommandConn) hasFeature(command string) bool {
+	_, ok := fc.features[command]
+	return ok
+}
+
+// dataCmd sends a command transferring data from the server, such as MLSD
+// or LIST, through a passive data connection and returns the data.
+func (fc *ftpCommandConn) dataCmd(format string, args ...interface{}) ([]byte, error) {
+	timeout := fc.timeout()
+
+	address, err := fc.passiveAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := newDialer(fc.config)(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("data connection to %s failed: %w", address, err)
+	}
+	if fc.protectData {
+		conn = tls.Client(conn, fc.tlsConfig)
+	}
+	defer conn.Close()
+
+	// 125 or 150: the server is about to send
+	if _, _, err := fc.cmd(1, format, args...); err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	data, readErr := io.ReadAll(conn)
+	conn.Close()
+
+	if _, _, err := fc.readResponse(2); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return data, nil
+}
+
+// passiveAddress asks the server for a passive data port, with EPSV or else
+// PASV. The data connection goes to the host of the control connection when
+// the address in the PASV reply is not reachable from here: a private
+// address of a server behind NAT, or any address through a proxy.
+func (fc *ftpCommandConn) passiveAddress() (string, error) {
+	if !fc.skipEPSV {
+		if _, message, err := fc.cmd(229, "EPSV"); err == nil {
+			// 229 Entering Extended Passive Mode (|||port|)
+			start := strings.Index(message, "|||")
+			end := strings.LastIndex(message, "|")
+			if start >= 0 && end > start+3 {
+				if port, err := strconv.Atoi(message[start+3 : end]); err == nil {
+					return net.JoinHostPort(fc.config.Host, strconv.Itoa(port)), nil
+				}
+			}
+		}
+		fc.skipEPSV = true
+	}
+
+	_, message, err := fc.cmd(227, "PASV")
+	if err != nil {
+		return "", err
+	}
+
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	start := strings.Index(message, "(")
+	end := strings.LastIndex(message, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid PASV reply: %s", message)
+	}
+	fields := strings.Split(message[start+1:end], ",")
+	if len(fields) != 6 {
+		return "", fmt.Errorf("invalid PASV reply: %s", message)
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("invalid PASV reply: %s", message)
+	}
+	port := strconv.Itoa(p1*256 + p2)
+
+	host := fc.config.Host
+	ip := net.ParseIP(strings.Join(fields[:4], "."))
+	if ip != nil && fc.config.Proxy == nil && !ip.IsUnspecified() && (!ip.IsPrivate() || isPrivateAddr(fc.conn.RemoteAddr())) {
+		host = ip.String()
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// isPrivateAddr reports whether addr is a private or loopback IP address.
+func isPrivateAddr(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && (tcpAddr.IP.IsPrivate() || tcpAddr.IP.IsLoopback())
+}
+
+// cmd sends a command and reads the reply. An expected code of 0 accepts
+// any reply; a single digit accepts any reply of that class. A server not
+// answering within the timeout fails the command rather than blocking it.
+func (fc *ftpCommandConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
+	fc.conn.SetDeadline(time.Now().Add(fc.timeout()))
+	defer fc.conn.SetDeadline(time.Time{})
+
+	if err := fc.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return fc.text.ReadResponse(expected)
+}
+
+// readResponse reads a reply not following a command, such as the greeting
+// or the end of a data transfer.
+func (fc *ftpCommandConn) readResponse(expected int) (int, string, error) {
+	fc.conn.SetDeadline(time.Now().Add(fc.timeout()))
+	defer fc.conn.SetDeadline(time.Time{})
+
+	return fc.text.ReadResponse(expected)
+}
+
+// timeout returns how long the server may take to answer.
+func (fc *ftpCommandConn) timeout() time.Duration {
+	if fc.config.Timeout > 0 {
+		return fc.config.Timeout
+	}
+	return 30 * time.Second
+}
+
+// Close logs out and closes the connection.
+func (fc *ftpCommandConn) Close() error {
+	fc.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fc.text.PrintfLine("QUIT")
+	return fc.text.Close()
+}
+
+// ftpsTLSConfig returns the TLS configuration for FTPS connections. Data
+// connections sharing it resume the TLS session of the control connection,
+// which servers such as vsftpd require.
+func ftpsTLSConfig(config *ConnectionConfig) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: config.TLSSkipVerify,
+		ServerName:         config.Host,
+		MinVersion:         tls.VersionTLS12,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+}
@@ -0,0 +1,403 @@
+// Package protocol provides the parsing of FTP directory listings: MLSD and
+// MLST facts (RFC 3659), and LIST output of Unix and Windows servers.
+package protocol
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseMLSxLine parses an entry of MLSD or MLST, "fact=value;...; name". It
+// also returns the type fact, "cdir" and "pdir" naming the listed directory
+// and its parent.
+func parseMLSxLine(line string) (FileInfo, string, error) {
+	info := FileInfo{UID: -1, GID: -1}
+
+	facts, name, ok := strings.Cut(line, " ")
+	if !ok || name == "" {
+		return FileInfo{}, "", fmt.Errorf("invalid MLSx entry: %q", line)
+	}
+	info.Name = path.Base(name)
+
+	var entryType, typeValue, perm string
+	mode := int64(-1)
+	for _, fact := range strings.Split(facts, ";") {
+		key, value, ok := strings.Cut(fact, "=")
+		if !ok {
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "type":
+			entryType, typeValue = strings.ToLower(value), value
+		case "size", "sizd":
+			info.Size, _ = strconv.ParseInt(value, 10, 64)
+		case "modify":
+			info.ModTime = parseMLSxTime(value)
+		case "perm":
+			perm = strings.ToLower(value)
+		case "unix.mode":
+			mode, _ = strconv.ParseInt(value, 8, 64)
+		case "unix.ownername":
+			info.Owner = value
+		case "unix.groupname":
+			info.Group = value
+		case "unix.owner", "unix.uid":
+			if id, err := strconv.Atoi(value); err == nil {
+				info.UID = id
+			}
+			if info.Owner == "" {
+				info.Owner = value
+			}
+		case "unix.group", "unix.gid":
+			if id, err := strconv.Atoi(value); err == nil {
+				info.GID = id
+			}
+			if info.Group == "" {
+				info.Group = value
+			}
+		case "unix.slink":
+			info.LinkTarget = value
+		}
+	}
+
+	// Symbolic links are "OS.unix=symlink", or "OS.unix=slink:target"
+	switch {
+	case entryType == "dir" || entryType == "cdir" || entryType == "pdir":
+		info.IsDir = true
+		info.Mode = os.ModeDir
+	case strings.HasPrefix(entryType, "os.unix=symlink"), strings.HasPrefix(entryType, "os.unix=slink"):
+		info.IsSymlink = true
+		info.Mode = os.ModeSymlink
+		if _, target, ok := strings.Cut(typeValue, ":"); ok && info.LinkTarget == "" {
+			info.LinkTarget = target
+		}
+	}
+
+	switch {
+	case mode >= 0:
+		info.Mode |= FileModeFromUnix(uint32(mode))
+		info.Permissions = FormatPermissions(info.Mode)
+	case perm != "":
+		info.Permissions = formatPermFact(FormatPermissions(info.Mode)[0], perm)
+	}
+
+	return info, entryType, nil
+}
+
+// parseMLSxTime parses a time fact, "YYYYMMDDHHMMSS[.sss]" in UTC.
+func parseMLSxTime(value string) time.Time {
+	value, _, _ = strings.Cut(value, ".")
+	t, err := time.ParseInLocation("20060102150405", value, time.UTC)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// formatPermFact returns permissions from the perm fact, which gives the
+// rights of the logged-in user only: they are shown as the owner's, with
+// those of the group and others unknown.
+func formatPermFact(typeChar byte, perm string) string {
+	b := []byte{typeChar, '-', '-', '-', '?', '?', '?', '?', '?', '?'}
+	if typeChar == 'd' {
+		// l: list, c/m/p/f/d: create, make directories, purge, rename, delete
+		// entries, e: enter
+		if strings.Contains(perm, "l") {
+			b[1] = 'r'
+		}
+		if strings.ContainsAny(perm, "cmp") {
+			b[2] = 'w'
+		}
+		if strings.Contains(perm, "e") {
+			b[3] = 'x'
+		}
+	} else {
+		// r: retrieve, w/a: write, append
+		if strings.Contains(perm, "r") {
+			b[1] = 'r'
+		}
+		if strings.ContainsAny(perm, "wa") {
+			b[2] = 'w'
+		}
+	}
+	return string(b)
+}
+
+// listToken is a whitespace separated field of a LIST line, with the offset
+// following it.
+type listToken struct {
+	text string
+	end  int
+}
+
+// splitListLine splits line into whitespace separated fields.
+func splitListLine(line string) []listToken {
+	var tokens []listToken
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		if i == len(line) || line[i] == ' ' || line[i] == '\t' {
+			if start >= 0 {
+				tokens = append(tokens, listToken{text: line[start:i], end: i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return tokens
+}
+
+// listRemainder returns what follows token in line: a file name, which may
+// contain spaces.
+func listRemainder(line string, token listToken) string {
+	rest := line[token.end:]
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+	return strings.TrimLeft(rest, " \t")
+}
+
+// parseListLine parses a line of LIST output: a Unix "ls -l" line, as sent
+// by vsftpd, ProFTPD, Pure-FTPd and FileZilla Server, or a DOS line, as sent
+// by IIS. It reports false for other lines, such as "total 12". Dates
+// without a year are taken in the last year before now.
+func parseListLine(line string, now time.Time) (FileInfo, bool) {
+	line = strings.TrimRight(line, "\r")
+	tokens := splitListLine(line)
+	if len(tokens) < 4 {
+		return FileInfo{}, false
+	}
+
+	if isUnixPermissions(tokens[0].text) {
+		return parseUnixListLine(line, tokens, now)
+	}
+	return parseDOSListLine(line, tokens)
+}
+
+// isUnixPermissions reports whether field is the permissions of an ls -l
+// line, possibly followed by an ACL or attribute marker.
+func isUnixPermissions(field string) bool {
+	if len(field) < 10 || len(field) > 11 || !strings.ContainsRune("-dlcbpsD", rune(field[0])) {
+		return false
+	}
+	for _, c := range field[1:10] {
+		if !strings.ContainsRune("-rwxsStTlL?", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUnixListLine parses "perms [links] owner [group] size date name".
+func parseUnixListLine(line string, tokens []listToken, now time.Time) (FileInfo, bool) {
+	// The date is three fields ("Jan  2 15:04" or "Jan  2  2006"), or two
+	// ("2006-01-02 15:04"); the size precedes it
+	for i := 2; i < len(tokens)-1; i++ {
+		modTime, n, ok := parseListDate(tokens[i:], now)
+		if !ok || i+n >= len(tokens) {
+			continue
+		}
+		size, err := strconv.ParseInt(tokens[i-1].text, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info := FileInfo{
+			Size:        size,
+			ModTime:     modTime,
+			Permissions: tokens[0].text[:10],
+			Mode:        fileModeFromPermissions(tokens[0].text[:10]),
+			UID:         -1,
+			GID:         -1,
+		}
+
+		// Owner and group follow the link count, which some servers omit
+		names := tokens[1 : i-1]
+		if len(names) > 0 {
+			if _, err := strconv.Atoi(names[0].text); err == nil && len(names) > 1 {
+				names = names[1:]
+			}
+		}
+		// Servers that do not resolve names give numeric IDs
+		if len(names) > 0 {
+			info.Owner = names[0].text
+			if id, err := strconv.Atoi(info.Owner); err == nil {
+				info.UID = id
+			}
+		}
+		if len(names) > 1 {
+			info.Group = names[1].text
+			if id, err := strconv.Atoi(info.Group); err == nil {
+				info.GID = id
+			}
+		}
+
+		name := listRemainder(line, tokens[i+n-1])
+		switch tokens[0].text[0] {
+		case 'd':
+			info.IsDir = true
+		case 'l':
+			info.IsSymlink = true
+			if link, target, ok := strings.Cut(name, " -> "); ok {
+				name, info.LinkTarget = link, target
+			}
+		}
+		if name == "" {
+			return FileInfo{}, false
+		}
+		info.Name = name
+		return info, true
+	}
+
+	return FileInfo{}, false
+}
+
+// parseListDate parses the date starting at tokens[0] and returns how many
+// fields it spans.
+func parseListDate(tokens []listToken, now time.Time) (time.Time, int, bool) {
+	// ISO date, as with ls --time-style=long-iso
+	if t, err := time.ParseInLocation("2006-01-02 15:04", tokens[0].text+" "+tokens[1].text, time.UTC); err == nil {
+		return t, 2, true
+	}
+
+	if len(tokens) < 3 {
+		return time.Time{}, 0, false
+	}
+	month, day, yearOrTime := tokens[0].text, tokens[1].text, tokens[2].text
+	if len(month) != 3 {
+		return time.Time{}, 0, false
+	}
+
+	if t, err := time.ParseInLocation("Jan 2 2006", month+" "+day+" "+yearOrTime, time.UTC); err == nil {
+		return t, 3, true
+	}
+
+	t, err := time.ParseInLocation("Jan 2 15:04", month+" "+day+" "+yearOrTime, time.UTC)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	// Recent files: the year is the current one, unless that is in the future
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.AddDate(0, 0, 1)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, 3, true
+}
+
+// dosDateFormats are the date and time formats of IIS listings.
+var dosDateFormats = []string{
+	"01-02-06 03:04PM",
+	"01-02-2006 03:04PM",
+	"2006-01-02 03:04PM",
+	"01-02-06 15:04",
+	"01-02-2006 15:04",
+	"2006-01-02 15:04",
+}
+
+// parseDOSListLine parses "date time <DIR>|size name".
+func parseDOSListLine(line string, tokens []listToken) (FileInfo, bool) {
+	info := FileInfo{UID: -1, GID: -1}
+
+	var parsed bool
+	for _, format := range dosDateFormats {
+		if t, err := time.ParseInLocation(format, tokens[0].text+" "+strings.ToUpper(tokens[1].text), time.UTC); err == nil {
+			info.ModTime = t
+			parsed = true
+			break
+		}
+	}
+	if !parsed {
+		return FileInfo{}, false
+	}
+
+	if strings.EqualFold(tokens[2].text, "<DIR>") {
+		info.IsDir = true
+		info.Mode = os.ModeDir
+	} else {
+		size, err := strconv.ParseInt(strings.ReplaceAll(tokens[2].text, ",", ""), 10, 64)
+		if err != nil {
+			return FileInfo{}, false
+		}
+		info.Size = size
+	}
+
+	info.Name = listRemainder(line, tokens[2])
+	if info.Name == "" {
+		return FileInfo{}, false
+	}
+	return info, true
+}
+
+// list lists a directory with MLSD if the server offers it, or else LIST.
+func (fc *ftpCommandConn) list(dir string) ([]FileInfo, error) {
+	mlsd := fc.hasFeature("MLST")
+	command := "LIST"
+	if mlsd {
+		command = "MLSD"
+	}
+
+	data, err := fc.dataCmd("%s %s", command, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var files []FileInfo
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		var info FileInfo
+		if mlsd {
+			var entryType string
+			info, entryType, err = parseMLSxLine(line)
+			if err != nil || entryType == "cdir" || entryType == "pdir" {
+				continue
+			}
+		} else {
+			var ok bool
+			if info, ok = parseListLine(line, now); !ok {
+				continue
+			}
+		}
+		if info.Name == "." || info.Name == ".." {
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// stat describes a single file with MLST, whose reply carries its facts on
+// the control connection.
+func (fc *ftpCommandConn) stat(name string) (*FileInfo, error) {
+	_, message, err := fc.cmd(250, "MLST %s", name)
+	if err != nil {
+		return nil, err
+	}
+
+	// "Listing name", the facts line starting with a space, then "End"
+	lines := strings.Split(message, "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimPrefix(strings.TrimRight(line, "\r"), " ")
+		if !strings.Contains(line, "=") {
+			continue
+		}
+		info, _, err := parseMLSxLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if name == "/" {
+			info.Name = "/"
+		}
+		return &info, nil
+	}
+	return nil, fmt.Errorf("invalid MLST reply: %q", message)
+}
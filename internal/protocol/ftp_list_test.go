@@ -0,0 +1,281 @@
+package protocol
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// listNow is the current time for listings whose recent dates have no year.
+var listNow = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+func date(year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+}
+
+// checkFileInfo reports the fields of got that differ from want.
+func checkFileInfo(t *testing.T, line string, got, want FileInfo) {
+	t.Helper()
+	if got.Name != want.Name {
+		t.Errorf("%q: Name = %q, want %q", line, got.Name, want.Name)
+	}
+	if got.Size != want.Size {
+		t.Errorf("%q: Size = %d, want %d", line, got.Size, want.Size)
+	}
+	if got.IsDir != want.IsDir || got.IsSymlink != want.IsSymlink {
+		t.Errorf("%q: IsDir, IsSymlink = %v, %v, want %v, %v", line, got.IsDir, got.IsSymlink, want.IsDir, want.IsSymlink)
+	}
+	if got.LinkTarget != want.LinkTarget {
+		t.Errorf("%q: LinkTarget = %q, want %q", line, got.LinkTarget, want.LinkTarget)
+	}
+	if !got.ModTime.Equal(want.ModTime) {
+		t.Errorf("%q: ModTime = %v, want %v", line, got.ModTime, want.ModTime)
+	}
+	if got.Permissions != want.Permissions || got.Mode != want.Mode {
+		t.Errorf("%q: Permissions, Mode = %q, %v, want %q, %v", line, got.Permissions, got.Mode, want.Permissions, want.Mode)
+	}
+	if got.Owner != want.Owner || got.Group != want.Group {
+		t.Errorf("%q: Owner, Group = %q, %q, want %q, %q", line, got.Owner, got.Group, want.Owner, want.Group)
+	}
+	if got.UID != want.UID || got.GID != want.GID {
+		t.Errorf("%q: UID, GID = %d, %d, want %d, %d", line, got.UID, got.GID, want.UID, want.GID)
+	}
+}
+
+func TestParseListLineUnix(t *testing.T) {
+	tests := []struct {
+		server string
+		line   string
+		want   FileInfo
+	}{
+		{
+			"vsftpd directory",
+			"drwxr-xr-x    2 1000     1000         4096 Mar 05 14:22 docs",
+			FileInfo{Name: "docs", Size: 4096, IsDir: true, ModTime: date(2024, time.March, 5, 14, 22, 0),
+				Permissions: "drwxr-xr-x", Mode: os.ModeDir | 0755, Owner: "1000", Group: "1000", UID: 1000, GID: 1000},
+		},
+		{
+			"vsftpd file from a past year",
+			"-rw-r--r--    1 1000     1000      1048576 Dec 31  2023 backup.tar.gz",
+			FileInfo{Name: "backup.tar.gz", Size: 1048576, ModTime: date(2023, time.December, 31, 0, 0, 0),
+				Permissions: "-rw-r--r--", Mode: 0644, Owner: "1000", Group: "1000", UID: 1000, GID: 1000},
+		},
+		{
+			"vsftpd symbolic link",
+			"lrwxrwxrwx    1 0        0              11 Jan 10 09:30 current -> releases/42",
+			FileInfo{Name: "current", Size: 11, IsSymlink: true, LinkTarget: "releases/42", ModTime: date(2024, time.January, 10, 9, 30, 0),
+				Permissions: "lrwxrwxrwx", Mode: os.ModeSymlink | 0777, Owner: "0", Group: "0", UID: 0, GID: 0},
+		},
+		{
+			"ProFTPD name with spaces",
+			"-rw-r--r--   1 alice    staff        1234 Feb 14 10:00 my  report.txt",
+			FileInfo{Name: "my  report.txt", Size: 1234, ModTime: date(2024, time.February, 14, 10, 0, 0),
+				Permissions: "-rw-r--r--", Mode: 0644, Owner: "alice", Group: "staff", UID: -1, GID: -1},
+		},
+		{
+			"ProFTPD date later in the year is last year",
+			"-rw-r-----   1 alice    staff          42 Dec 24 08:00 gifts.txt",
+			FileInfo{Name: "gifts.txt", Size: 42, ModTime: date(2023, time.December, 24, 8, 0, 0),
+				Permissions: "-rw-r-----", Mode: 0640, Owner: "alice", Group: "staff", UID: -1, GID: -1},
+		},
+		{
+			"Pure-FTPd",
+			"drwxr-xr-x    3 1001       1001             4096 Jan  2 15:04 www",
+			FileInfo{Name: "www", Size: 4096, IsDir: true, ModTime: date(2024, time.January, 2, 15, 4, 0),
+				Permissions: "drwxr-xr-x", Mode: os.ModeDir | 0755, Owner: "1001", Group: "1001", UID: 1001, GID: 1001},
+		},
+		{
+			"FileZilla Server",
+			"-rw-r--r-- 1 ftp ftp          12345 Mar 05  2021 report.pdf",
+			FileInfo{Name: "report.pdf", Size: 12345, ModTime: date(2021, time.March, 5, 0, 0, 0),
+				Permissions: "-rw-r--r--", Mode: 0644, Owner: "ftp", Group: "ftp", UID: -1, GID: -1},
+		},
+		{
+			"no group",
+			"-rw-r--r--   1 owner        512 Jan  2  2006 nogroup",
+			FileInfo{Name: "nogroup", Size: 512, ModTime: date(2006, time.January, 2, 0, 0, 0),
+				Permissions: "-rw-r--r--", Mode: 0644, Owner: "owner", UID: -1, GID: -1},
+		},
+		{
+			"ISO dates and an ACL marker",
+			"-rwxr-x---+ 1 bob developers 100 2024-02-29 13:45 build.sh",
+			FileInfo{Name: "build.sh", Size: 100, ModTime: date(2024, time.February, 29, 13, 45, 0),
+				Permissions: "-rwxr-x---", Mode: 0750, Owner: "bob", Group: "developers", UID: -1, GID: -1},
+		},
+		{
+			"sticky bit",
+			"drwxrwxrwt    9 0        0            4096 Mar 09 23:59 tmp",
+			FileInfo{Name: "tmp", Size: 4096, IsDir: true, ModTime: date(2024, time.March, 9, 23, 59, 0),
+				Permissions: "drwxrwxrwt", Mode: os.ModeDir | os.ModeSticky | 0777, Owner: "0", Group: "0", UID: 0, GID: 0},
+		},
+		{
+			"CRLF line ending",
+			"-rw-r--r--    1 1000     1000            7 Mar 01 08:00 crlf.txt\r",
+			FileInfo{Name: "crlf.txt", Size: 7, ModTime: date(2024, time.March, 1, 8, 0, 0),
+				Permissions: "-rw-r--r--", Mode: 0644, Owner: "1000", Group: "1000", UID: 1000, GID: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			got, ok := parseListLine(tt.line, listNow)
+			if !ok {
+				t.Fatalf("parseListLine(%q) rejected the line", tt.line)
+			}
+			checkFileInfo(t, tt.line, got, tt.want)
+		})
+	}
+}
+
+func TestParseListLineDOS(t *testing.T) {
+	tests := []struct {
+		line string
+		want FileInfo
+	}{
+		{
+			"03-05-24  02:22PM       <DIR>          Documents",
+			FileInfo{Name: "Documents", IsDir: true, Mode: os.ModeDir, ModTime: date(2024, time.March, 5, 14, 22, 0), UID: -1, GID: -1},
+		},
+		{
+			"12-31-23  11:59PM              1048576 archive 2023.zip",
+			FileInfo{Name: "archive 2023.zip", Size: 1048576, ModTime: date(2023, time.December, 31, 23, 59, 0), UID: -1, GID: -1},
+		},
+		{
+			"01-02-2024  09:05AM                  512 web.config",
+			FileInfo{Name: "web.config", Size: 512, ModTime: date(2024, time.January, 2, 9, 5, 0), UID: -1, GID: -1},
+		},
+		{
+			"2024-03-05  14:22                 1,234 report.txt",
+			FileInfo{Name: "report.txt", Size: 1234, ModTime: date(2024, time.March, 5, 14, 22, 0), UID: -1, GID: -1},
+		},
+		{
+			"02-29-24  12:00am       <dir>          wwwroot",
+			FileInfo{Name: "wwwroot", IsDir: true, Mode: os.ModeDir, ModTime: date(2024, time.February, 29, 0, 0, 0), UID: -1, GID: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseListLine(tt.line, listNow)
+		if !ok {
+			t.Errorf("parseListLine(%q) rejected the line", tt.line)
+			continue
+		}
+		checkFileInfo(t, tt.line, got, tt.want)
+	}
+}
+
+func TestParseListLineRejects(t *testing.T) {
+	lines := []string{
+		"",
+		"total 24",
+		"226 Transfer complete",
+		"drwxr-xr-x    2 1000     1000         4096 Mar 05 14:22",
+		"-rw-r--r--    1 1000     1000         size Mar 05 14:22 x",
+		"13-45-24  02:22PM       <DIR>          bad-date",
+		"03-05-24  02:22PM       many          bad-size",
+	}
+	for _, line := range lines {
+		if info, ok := parseListLine(line, listNow); ok {
+			t.Errorf("parseListLine(%q) = %+v, want the line rejected", line, info)
+		}
+	}
+}
+
+func TestParseMLSxLine(t *testing.T) {
+	tests := []struct {
+		server   string
+		line     string
+		wantType string
+		want     FileInfo
+	}{
+		{
+			"ProFTPD current directory",
+			"type=cdir;modify=20240305142200;perm=flcdmpe;unique=803U1A2B; .",
+			"cdir",
+			FileInfo{Name: ".", IsDir: true, Mode: os.ModeDir, ModTime: date(2024, time.March, 5, 14, 22, 0),
+				Permissions: "drwx??????", UID: -1, GID: -1},
+		},
+		{
+			"ProFTPD parent directory",
+			"type=pdir;modify=20240301000000;perm=flcdmpe;unique=803U1A2A; ..",
+			"pdir",
+			FileInfo{Name: "..", IsDir: true, Mode: os.ModeDir, ModTime: date(2024, time.March, 1, 0, 0, 0),
+				Permissions: "drwx??????", UID: -1, GID: -1},
+		},
+		{
+			"ProFTPD file with unix facts",
+			"modify=20231231235959.123;perm=adfrw;size=1048576;type=file;unique=803U1A2C;UNIX.group=1000;UNIX.groupname=staff;UNIX.mode=0640;UNIX.owner=1000;UNIX.ownername=alice; backup.tar.gz",
+			"file",
+			FileInfo{Name: "backup.tar.gz", Size: 1048576, ModTime: date(2023, time.December, 31, 23, 59, 59),
+				Permissions: "-rw-r-----", Mode: 0640, Owner: "alice", Group: "staff", UID: 1000, GID: 1000},
+		},
+		{
+			"ProFTPD symbolic link",
+			"modify=20240110093000;perm=adfrw;size=11;type=OS.unix=slink:/srv/releases/42;unique=803U1A2D;UNIX.group=0;UNIX.mode=0777;UNIX.owner=0; current",
+			"os.unix=slink:/srv/releases/42",
+			FileInfo{Name: "current", Size: 11, IsSymlink: true, LinkTarget: "/srv/releases/42", ModTime: date(2024, time.January, 10, 9, 30, 0),
+				Permissions: "lrwxrwxrwx", Mode: os.ModeSymlink | 0777, Owner: "0", Group: "0", UID: 0, GID: 0},
+		},
+		{
+			"symbolic link with a slink fact",
+			"type=OS.unix=symlink;unix.slink=/etc/hosts;size=10;modify=20240101120000; hosts",
+			"os.unix=symlink",
+			FileInfo{Name: "hosts", Size: 10, IsSymlink: true, LinkTarget: "/etc/hosts", ModTime: date(2024, time.January, 1, 12, 0, 0),
+				Mode: os.ModeSymlink, UID: -1, GID: -1},
+		},
+		{
+			// Some servers describe a link to a directory as the directory
+			"link to a directory listed as one",
+			"type=dir;modify=20240201080000;UNIX.mode=0755;UNIX.uid=33;UNIX.gid=33;unix.slink=/var/www;unique=fd01g4a2; www",
+			"dir",
+			FileInfo{Name: "www", IsDir: true, LinkTarget: "/var/www", ModTime: date(2024, time.February, 1, 8, 0, 0),
+				Permissions: "drwxr-xr-x", Mode: os.ModeDir | 0755, Owner: "33", Group: "33", UID: 33, GID: 33},
+		},
+		{
+			"IIS directory",
+			"type=dir;modify=20240305142200; Documents",
+			"dir",
+			FileInfo{Name: "Documents", IsDir: true, Mode: os.ModeDir, ModTime: date(2024, time.March, 5, 14, 22, 0), UID: -1, GID: -1},
+		},
+		{
+			"IIS file with spaces",
+			"type=file;size=2048;modify=20240102030405;perm=r; annual report 2023.docx",
+			"file",
+			FileInfo{Name: "annual report 2023.docx", Size: 2048, ModTime: date(2024, time.January, 2, 3, 4, 5),
+				Permissions: "-r--??????", UID: -1, GID: -1},
+		},
+		{
+			"MLST reply with a full path",
+			"Type=file;Size=7;Modify=20240102030405;Unique=2049U52C1; /home/alice/notes.txt",
+			"file",
+			FileInfo{Name: "notes.txt", Size: 7, ModTime: date(2024, time.January, 2, 3, 4, 5), UID: -1, GID: -1},
+		},
+		{
+			"unknown and malformed facts",
+			"type=file;size=3;x.custom=1;broken;media-type=text/plain; odd.txt",
+			"file",
+			FileInfo{Name: "odd.txt", Size: 3, UID: -1, GID: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			got, entryType, err := parseMLSxLine(tt.line)
+			if err != nil {
+				t.Fatalf("parseMLSxLine(%q): %v", tt.line, err)
+			}
+			if entryType != tt.wantType {
+				t.Errorf("%q: type = %q, want %q", tt.line, entryType, tt.wantType)
+			}
+			checkFileInfo(t, tt.line, got, tt.want)
+		})
+	}
+}
+
+func TestParseMLSxLineInvalid(t *testing.T) {
+	for _, line := range []string{"", "type=file;size=3;", "type=file;size=3; "} {
+		if _, _, err := parseMLSxLine(line); err == nil {
+			t.Errorf("parseMLSxLine(%q) accepted the line", line)
+		}
+	}
+}
@@ -4,21 +4,38 @@ package protocol
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jlaffaye/ftp"
 )
 
+// pingTimeout bounds how long Ping waits for the reply to NOOP.
+const pingTimeout = 10 * time.Second
+
 // FTPSClient implements the Protocol interface for FTPS connections.
 type FTPSClient struct {
 	conn       *ftp.ServerConn
 	connected  bool
 	currentDir string
 	config     *ConnectionConfig
+
+	// Listings, server-side checksums and SITE commands use a separate command
+	// connection, opened at connect time unless transferOnly is set
+	transferOnly   bool // Pooled connection, only used for transfers
+	checksumMu     sync.Mutex
+	checksumProbed bool
+	cmdConn        *ftpCommandConn
+	hashAlgos      []HashAlgorithm // Supported by the HASH command
+	hashSelected   HashAlgorithm   // Last algorithm chosen with OPTS HASH
 }
 
 // NewFTPSClient creates a new FTPS client instance.
@@ -42,40 +59,31 @@ func (c *FTPSClient) Connect(ctx context.Context, config *ConnectionConfig) erro
 
 	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
 
-	var conn *ftp.ServerConn
-	var err error
+	options := []ftp.DialOption{
+		ftp.DialWithTimeout(timeout),
+		ftp.DialWithContext(ctx),
+	}
 
-	if config.Protocol == "ftp" {
-		// Plain FTP (no TLS)
-		conn, err = ftp.Dial(address,
-			ftp.DialWithTimeout(timeout),
-			ftp.DialWithContext(ctx),
-		)
-	} else {
+	// Plain FTP has no TLS
+	var tlsConfig *tls.Config
+	if config.Protocol != "ftp" {
 		// TLS configuration for FTPS
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: config.TLSSkipVerify,
-			ServerName:         config.Host,
-			MinVersion:         tls.VersionTLS12,
-		}
+		tlsConfig = ftpsTLSConfig(config)
 
 		if config.TLSImplicit {
 			// Implicit FTPS (port 990 typically)
-			conn, err = ftp.Dial(address,
-				ftp.DialWithTimeout(timeout),
-				ftp.DialWithTLS(tlsConfig),
-				ftp.DialWithContext(ctx),
-			)
+			options = append(options, ftp.DialWithTLS(tlsConfig))
 		} else {
 			// Explicit FTPS (AUTH TLS)
-			conn, err = ftp.Dial(address,
-				ftp.DialWithTimeout(timeout),
-				ftp.DialWithExplicitTLS(tlsConfig),
-				ftp.DialWithContext(ctx),
-			)
+			options = append(options, ftp.DialWithExplicitTLS(tlsConfig))
 		}
 	}
 
+	if config.Proxy != nil {
+		options = append(options, ftp.DialWithDialFunc(ftpProxyDialFunc(ctx, config, tlsConfig)))
+	}
+
+	conn, err := ftp.Dial(address, options...)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
@@ -92,15 +100,65 @@ func (c *FTPSClient) Connect(ctx context.Context, config *ConnectionConfig) erro
 	// Get current directory
 	c.currentDir, _ = conn.CurrentDir()
 
+	// FEAT tells which listing commands and facts the server offers. Servers
+	// limiting connections per user may refuse the command connection:
+	// listings then go through jlaffaye/ftp, without permissions and owners
+	if !c.transferOnly {
+		c.checksumMu.Lock()
+		c.checksumProbed = true
+		c.openCommandConn(ctx)
+		c.checksumMu.Unlock()
+	}
+
 	return nil
 }
 
+// ftpProxyDialFunc returns the dial function of jlaffaye/ftp for connections
+// through config.Proxy. The first call opens the control connection, the next
+// ones data connections: those go to config.Host, as the address in passive
+// replies is not reachable through a proxy. jlaffaye/ftp leaves TLS to a dial
+// function, so implicit FTPS encrypts every connection and explicit FTPS the
+// data connections, the control one being upgraded after AUTH TLS.
+func ftpProxyDialFunc(ctx context.Context, config *ConnectionConfig, tlsConfig *tls.Config) func(network, address string) (net.Conn, error) {
+	dial := newDialer(config)
+	var controlOpened atomic.Bool
+
+	return func(network, address string) (net.Conn, error) {
+		isData := controlOpened.Swap(true)
+
+		dialCtx := ctx
+		if isData {
+			_, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			address = net.JoinHostPort(config.Host, port)
+			// The context of Connect may be over long before transfers
+			dialCtx = context.Background()
+		}
+
+		conn, err := dial(dialCtx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil && (config.TLSImplicit || isData) {
+			return tls.Client(conn, tlsConfig), nil
+		}
+		return conn, nil
+	}
+}
+
 // Disconnect closes the FTPS connection.
 func (c *FTPSClient) Disconnect() error {
 	if !c.connected {
 		return nil
 	}
 
+	c.checksumMu.Lock()
+	c.closeCommandConn()
+	c.checksumProbed = false
+	c.checksumMu.Unlock()
+
 	err := c.conn.Quit()
 	c.conn = nil
 	c.connected = false
@@ -108,15 +166,77 @@ func (c *FTPSClient) Disconnect() error {
 	return err
 }
 
+// connectionConfig returns the configuration of the last connection.
+func (c *FTPSClient) connectionConfig() *ConnectionConfig {
+	return c.config
+}
+
 // IsConnected returns true if the client is connected.
 func (c *FTPSClient) IsConnected() bool {
 	return c.connected
 }
 
+// Ping sends NOOP on the control connection, which the server may have closed
+// after an idle timeout. A connection that does not answer within
+// pingTimeout is closed.
+func (c *FTPSClient) Ping(ctx context.Context) error {
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- c.conn.NoOp() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		// Closing the connection makes NOOP return
+		c.conn.Quit()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Reconnect opens a new control connection with the last ConnectionConfig.
+func (c *FTPSClient) Reconnect(ctx context.Context) error {
+	if c.config == nil {
+		return ErrNotConnected
+	}
+
+	config, dir := c.config, c.currentDir
+	c.Disconnect()
+	if err := c.Connect(ctx, config); err != nil {
+		return err
+	}
+	if dir != "" && dir != c.currentDir {
+		c.ChangeDir(dir)
+	}
+	return nil
+}
+
 // List returns the contents of a directory.
 func (c *FTPSClient) List(ctx context.Context, path string) ([]FileInfo, error) {
 	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+		return nil, ErrNotConnected
+	}
+
+	// The command connection keeps the permissions and owners given by MLSD
+	// facts or LIST lines, which jlaffaye/ftp drops
+	var files []FileInfo
+	err := c.withCommandConn(ctx, false, func(fc *ftpCommandConn) error {
+		var err error
+		files, err = fc.list(path)
+		return err
+	})
+	if err == nil {
+		return files, nil
+	}
+	if !errors.Is(err, errNoCommandConn) {
+		return nil, fmt.Errorf("failed to list directory: %w", err)
 	}
 
 	entries, err := c.conn.List(path)
@@ -124,58 +244,77 @@ func (c *FTPSClient) List(ctx context.Context, path string) ([]FileInfo, error)
 		return nil, fmt.Errorf("failed to list directory: %w", err)
 	}
 
-	var files []FileInfo
 	for _, entry := range entries {
-		isDir := entry.Type == ftp.EntryTypeFolder
-
-		// Convert FTP permissions
-		perms := "-rw-r--r--"
-		if isDir {
-			perms = "drwxr-xr-x"
+		if entry.Name == "." || entry.Name == ".." {
+			continue
 		}
-
-		files = append(files, FileInfo{
-			Name:        entry.Name,
-			Size:        int64(entry.Size),
-			IsDir:       isDir,
-			ModTime:     entry.Time,
-			Permissions: perms,
-		})
+		files = append(files, fileInfoFromEntry(entry))
 	}
 
 	return files, nil
 }
 
+// fileInfoFromEntry converts an entry listed by jlaffaye/ftp, which does not
+// tell permissions and owners.
+func fileInfoFromEntry(entry *ftp.Entry) FileInfo {
+	info := FileInfo{
+		Name:       entry.Name,
+		Size:       int64(entry.Size),
+		IsDir:      entry.Type == ftp.EntryTypeFolder,
+		ModTime:    entry.Time,
+		IsSymlink:  entry.Type == ftp.EntryTypeLink,
+		LinkTarget: entry.Target,
+		UID:        -1,
+		GID:        -1,
+	}
+	switch entry.Type {
+	case ftp.EntryTypeFolder:
+		info.Mode = os.ModeDir
+	case ftp.EntryTypeLink:
+		info.Mode = os.ModeSymlink
+	}
+	return info
+}
+
 // Stat returns information about a file or directory.
 func (c *FTPSClient) Stat(ctx context.Context, path string) (*FileInfo, error) {
 	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+		return nil, ErrNotConnected
+	}
+
+	// MLST describes a single file
+	var info *FileInfo
+	err := c.withCommandConn(ctx, false, func(fc *ftpCommandConn) error {
+		if !fc.hasFeature("MLST") {
+			return errNoCommandConn
+		}
+		var err error
+		info, err = fc.stat(path)
+		return err
+	})
+	if err == nil {
+		return info, nil
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code == 550 {
+		return nil, fmt.Errorf("file not found: %s", path)
+	}
+	if !errors.Is(err, errNoCommandConn) {
+		return nil, fmt.Errorf("failed to stat: %w", err)
 	}
 
-	// FTP doesn't have a direct stat command, we need to list the parent directory
+	// Otherwise, look for the file in the listing of its parent directory
 	dir := filepath.Dir(path)
 	name := filepath.Base(path)
 
-	entries, err := c.conn.List(dir)
+	files, err := c.List(ctx, dir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat: %w", err)
 	}
 
-	for _, entry := range entries {
-		if entry.Name == name {
-			isDir := entry.Type == ftp.EntryTypeFolder
-			perms := "-rw-r--r--"
-			if isDir {
-				perms = "drwxr-xr-x"
-			}
-
-			return &FileInfo{
-				Name:        entry.Name,
-				Size:        int64(entry.Size),
-				IsDir:       isDir,
-				ModTime:     entry.Time,
-				Permissions: perms,
-			}, nil
+	for i := range files {
+		if files[i].Name == name {
+			return &files[i], nil
 		}
 	}
 
@@ -185,7 +324,7 @@ func (c *FTPSClient) Stat(ctx context.Context, path string) (*FileInfo, error) {
 // Mkdir creates a directory.
 func (c *FTPSClient) Mkdir(ctx context.Context, path string) error {
 	if !c.connected {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
 	return c.conn.MakeDir(path)
@@ -194,7 +333,7 @@ func (c *FTPSClient) Mkdir(ctx context.Context, path string) error {
 // Remove removes a file.
 func (c *FTPSClient) Remove(ctx context.Context, path string) error {
 	if !c.connected {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
 	return c.conn.Delete(path)
@@ -203,7 +342,7 @@ func (c *FTPSClient) Remove(ctx context.Context, path string) error {
 // RemoveDir removes a directory.
 func (c *FTPSClient) RemoveDir(ctx context.Context, path string) error {
 	if !c.connected {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
 	return c.conn.RemoveDir(path)
@@ -212,7 +351,7 @@ func (c *FTPSClient) RemoveDir(ctx context.Context, path string) error {
 // Rename renames a file or directory.
 func (c *FTPSClient) Rename(ctx context.Context, oldPath, newPath string) error {
 	if !c.connected {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
 	return c.conn.Rename(oldPath, newPath)
@@ -221,7 +360,7 @@ func (c *FTPSClient) Rename(ctx context.Context, oldPath, newPath string) error
 // Upload uploads a file to the remote server with optional resume support.
 func (c *FTPSClient) Upload(ctx context.Context, localPath, remotePath string, resume bool, progressFn func(TransferProgress)) error {
 	if !c.connected {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
 	// Open local file
@@ -240,15 +379,28 @@ func (c *FTPSClient) Upload(ctx context.Context, localPath, remotePath string, r
 
 	var startOffset int64
 
+	// Create progress wrapper. Once ctx is done, reads fail and jlaffaye/ftp
+	// ends the upload by closing the data connection
+	reader := &ProgressReader{
+		Reader:     &contextReader{ctx: ctx, r: throttleUpload(c.config.Throttle, localFile)},
+		TotalSize:  totalSize,
+		StartTime:  time.Now(),
+		FileName:   filepath.Base(localPath),
+		ProgressFn: progressFn,
+	}
+
 	if resume {
-		// Check remote file size using SIZE command
+		// Check remote file size using SIZE command, and that the data
+		// already uploaded matches the local file
 		remoteSize, err := c.conn.FileSize(remotePath)
-		if err == nil && remoteSize > 0 {
-			if remoteSize >= totalSize {
+		if err == nil && remoteSize > 0 && remoteSize <= totalSize &&
+			tailsMatch(localFile, &ftpReaderAt{conn: c.conn, path: remotePath}, remoteSize) {
+			if remoteSize == totalSize {
 				// File already fully uploaded
-				return nil
+				return preserveUpload(ctx, c, c.config, remotePath, localInfo)
 			}
 			startOffset = remoteSize
+			reader.BytesRead = startOffset
 
 			// Seek local file to resume position
 			if _, err := localFile.Seek(startOffset, io.SeekStart); err != nil {
@@ -256,35 +408,31 @@ func (c *FTPSClient) Upload(ctx context.Context, localPath, remotePath string, r
 			}
 
 			// Use REST command for resume
-			if err := c.conn.StorFrom(remotePath, localFile, uint64(startOffset)); err != nil {
+			if err := c.conn.StorFrom(remotePath, reader, uint64(startOffset)); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 				return fmt.Errorf("failed to resume upload: %w", err)
 			}
-			return nil
+			return preserveUpload(ctx, c, c.config, remotePath, localInfo)
 		}
 	}
 
-	// Create progress wrapper
-	reader := &ProgressReader{
-		Reader:     localFile,
-		TotalSize:  totalSize,
-		BytesRead:  startOffset,
-		StartTime:  time.Now(),
-		FileName:   filepath.Base(localPath),
-		ProgressFn: progressFn,
-	}
-
 	// Upload file
 	if err := c.conn.Stor(remotePath, reader); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return fmt.Errorf("upload failed: %w", err)
 	}
 
-	return nil
+	return preserveUpload(ctx, c, c.config, remotePath, localInfo)
 }
 
 // Download downloads a file from the remote server with optional resume support.
 func (c *FTPSClient) Download(ctx context.Context, remotePath, localPath string, resume bool, progressFn func(TransferProgress)) error {
 	if !c.connected {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
 	// Get remote file size
@@ -293,17 +441,24 @@ func (c *FTPSClient) Download(ctx context.Context, remotePath, localPath string,
 		return fmt.Errorf("failed to get remote file size: %w", err)
 	}
 
+	// Modification time to give the local copy, from MDTM
+	var remoteModTime time.Time
+	if c.config.PreserveModTime && c.conn.IsGetTimeSupported() {
+		remoteModTime, _ = c.conn.GetTime(remotePath)
+	}
+
 	var localFile *os.File
 	var startOffset int64
 
 	if resume {
-		// Check if local file exists
+		// Check if local file exists and matches the start of the remote file
 		localInfo, err := os.Stat(localPath)
-		if err == nil && !localInfo.IsDir() {
+		remote := &ftpReaderAt{conn: c.conn, path: remotePath}
+		if err == nil && !localInfo.IsDir() && canResumeDownload(remote, localPath, localInfo.Size(), remoteSize) {
 			startOffset = localInfo.Size()
-			if startOffset >= remoteSize {
+			if startOffset == remoteSize {
 				// File already fully downloaded
-				return nil
+				return preserveDownload(c.config, localPath, remoteModTime)
 			}
 
 			// Open local file for append
@@ -332,7 +487,7 @@ func (c *FTPSClient) Download(ctx context.Context, remotePath, localPath string,
 
 	// Create progress wrapper
 	writer := &ProgressWriter{
-		Writer:     localFile,
+		Writer:     throttleDownload(c.config.Throttle, localFile),
 		TotalSize:  remoteSize,
 		Written:    startOffset,
 		StartTime:  time.Now(),
@@ -353,32 +508,110 @@ func (c *FTPSClient) Download(ctx context.Context, remotePath, localPath string,
 	}
 	defer resp.Close()
 
-	// Copy data with optimized buffer
-	if _, err := CopyWithBuffer(writer, resp, remoteSize); err != nil {
+	// Copy with context cancellation support and optimized buffer. Once ctx
+	// is done, writes fail and a read waiting for the server times out; the
+	// data connection is then closed with resp
+	done := make(chan error, 1)
+	go func() {
+		_, err := CopyWithBuffer(&contextWriter{ctx: ctx, w: writer}, resp, remoteSize)
+		done <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		resp.SetDeadline(time.Now())
+		<-done
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("download failed: %w", err)
+		}
+	}
+
+	// Close before setting the modification time, which writing would change
+	if err := resp.Close(); err != nil {
 		return fmt.Errorf("download failed: %w", err)
 	}
+	if err := localFile.Close(); err != nil {
+		return fmt.Errorf("failed to close local file: %w", err)
+	}
 
-	return nil
+	return preserveDownload(c.config, localPath, remoteModTime)
+}
+
+// ftpReaderAt reads byte ranges of a remote file using REST and RETR.
+type ftpReaderAt struct {
+	conn *ftp.ServerConn
+	path string
+}
+
+// ReadAt reads len(p) bytes starting at off.
+func (r *ftpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	resp, err := r.conn.RetrFrom(r.path, uint64(off))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(resp, p)
+	// Closing before the end aborts the data transfer, which servers answer
+	// with an error reply; only the data read matters here
+	resp.Close()
+
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// contextReader fails reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// contextWriter fails writes once ctx is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
 }
 
 // GetReader returns a reader for a remote file.
 func (c *FTPSClient) GetReader(ctx context.Context, path string) (io.ReadCloser, error) {
 	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+		return nil, ErrNotConnected
 	}
 
 	return c.conn.Retr(path)
 }
 
-// GetWriter returns a writer for a remote file.
+// GetWriter returns a writer for a remote file. Closing it waits for the
+// server to acknowledge the upload, so the connection can be used again.
 func (c *FTPSClient) GetWriter(ctx context.Context, path string, appendMode bool) (io.WriteCloser, error) {
 	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+		return nil, ErrNotConnected
 	}
 
 	// FTP doesn't provide a direct writer interface
 	// We need to use a pipe
 	pr, pw := io.Pipe()
+	done := make(chan error, 1)
 
 	go func() {
 		var err error
@@ -396,15 +629,28 @@ func (c *FTPSClient) GetWriter(ctx context.Context, path string, appendMode bool
 		if err != nil {
 			pr.CloseWithError(err)
 		}
+		done <- err
 	}()
 
-	return pw, nil
+	return &ftpWriter{PipeWriter: pw, done: done}, nil
+}
+
+// ftpWriter is the writing end of a STOR running in the background.
+type ftpWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+// Close ends the upload and returns its outcome.
+func (w *ftpWriter) Close() error {
+	w.PipeWriter.Close()
+	return <-w.done
 }
 
 // CurrentDir returns the current working directory.
 func (c *FTPSClient) CurrentDir() (string, error) {
 	if !c.connected {
-		return "", fmt.Errorf("not connected")
+		return "", ErrNotConnected
 	}
 
 	return c.conn.CurrentDir()
@@ -413,7 +659,7 @@ func (c *FTPSClient) CurrentDir() (string, error) {
 // ChangeDir changes the current working directory.
 func (c *FTPSClient) ChangeDir(path string) error {
 	if !c.connected {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 
 	if err := c.conn.ChangeDir(path); err != nil {
@@ -0,0 +1,189 @@
+// Package protocol provides server-side checksums for FTP/FTPS connections.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+// ftpHashNames maps HASH algorithm names (draft-bryan-ftpext-hash) to algorithms.
+var ftpHashNames = map[string]HashAlgorithm{
+	"SHA-256": HashSHA256,
+	"SHA-1":   HashSHA1,
+	"MD5":     HashMD5,
+}
+
+// ftpXCommands are the legacy non-standard hash commands, best first.
+var ftpXCommands = []struct {
+	algo    HashAlgorithm
+	command string
+}{
+	{HashSHA256, "XSHA256"},
+	{HashSHA1, "XSHA1"},
+	{HashMD5, "XMD5"},
+}
+
+// ChecksumAlgorithms returns the algorithms advertised in FEAT through the
+// HASH command or the XSHA256/XSHA1/XMD5 commands.
+func (c *FTPSClient) ChecksumAlgorithms(ctx context.Context) []HashAlgorithm {
+	if !c.connected {
+		return nil
+	}
+
+	// Pooled connections open no command connection of their own: files they
+	// transfer are verified by streaming them instead
+	if c.transferOnly {
+		return nil
+	}
+
+	c.checksumMu.Lock()
+	defer c.checksumMu.Unlock()
+
+	if !c.checksumProbed {
+		c.checksumProbed = true
+		if err := c.openCommandConn(ctx); err != nil {
+			return nil
+		}
+	}
+	if c.cmdConn == nil {
+		return nil
+	}
+
+	var algos []HashAlgorithm
+	for _, xc := range ftpXCommands {
+		if hasAlgorithm(c.hashAlgos, xc.algo) || c.hasXCommand(xc.algo) {
+			algos = append(algos, xc.algo)
+		}
+	}
+	return algos
+}
+
+// Checksum returns the digest of a remote file computed by the server,
+// preferring the HASH command over the X commands.
+func (c *FTPSClient) Checksum(ctx context.Context, path string, algo HashAlgorithm) (string, error) {
+	if !c.connected {
+		return "", ErrNotConnected
+	}
+
+	if !hasAlgorithm(c.ChecksumAlgorithms(ctx), algo) {
+		return "", ErrChecksumUnsupported
+	}
+
+	c.checksumMu.Lock()
+	defer c.checksumMu.Unlock()
+
+	sum, err := c.serverChecksum(path, algo)
+
+	// The command connection may have been closed by the server while idle
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) && !errors.Is(err, ErrChecksumUnsupported) {
+		c.closeCommandConn()
+		if err := c.openCommandConn(ctx); err != nil {
+			return "", err
+		}
+		sum, err = c.serverChecksum(path, algo)
+	}
+
+	return sum, err
+}
+
+// serverChecksum sends HASH or the matching X command (caller must hold checksumMu).
+func (c *FTPSClient) serverChecksum(path string, algo HashAlgorithm) (string, error) {
+	if hasAlgorithm(c.hashAlgos, algo) {
+		// Select the algorithm once, then HASH replies "213 <algo> <range> <hex> <path>"
+		if c.hashSelected != algo {
+			if _, _, err := c.cmdConn.cmd(2, "OPTS HASH %s", ftpHashName(algo)); err != nil {
+				return "", fmt.Errorf("OPTS HASH failed: %w", err)
+			}
+			c.hashSelected = algo
+		}
+
+		_, message, err := c.cmdConn.cmd(2, "HASH %s", path)
+		if err != nil {
+			return "", fmt.Errorf("HASH failed: %w", err)
+		}
+		fields := strings.Fields(message)
+		if len(fields) >= 3 {
+			if digest, ok := parseHexDigest(fields[2], algo); ok {
+				return digest, nil
+			}
+		}
+		return "", fmt.Errorf("unexpected HASH reply: %q", message)
+	}
+
+	for _, xc := range ftpXCommands {
+		if xc.algo != algo {
+			continue
+		}
+
+		_, message, err := c.cmdConn.cmd(2, "%s %s", xc.command, path)
+		if err != nil {
+			return "", fmt.Errorf("%s failed: %w", xc.command, err)
+		}
+		// Servers differ in whether the digest or the path comes first
+		for _, field := range strings.Fields(message) {
+			if digest, ok := parseHexDigest(field, algo); ok {
+				return digest, nil
+			}
+		}
+		return "", fmt.Errorf("unexpected %s reply: %q", xc.command, message)
+	}
+
+	return "", ErrChecksumUnsupported
+}
+
+// openCommandConn dials the command connection and reads the hash features
+// (caller must hold checksumMu).
+func (c *FTPSClient) openCommandConn(ctx context.Context) error {
+	fc, err := dialFTPCommandConn(ctx, c.config)
+	if err != nil {
+		return err
+	}
+	c.cmdConn = fc
+	c.hashSelected = ""
+
+	// HASH lists its algorithms separated by ';', the current one marked with '*'
+	c.hashAlgos = nil
+	if params, ok := fc.features["HASH"]; ok {
+		for _, name := range strings.Split(params, ";") {
+			name = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(name), "*"))
+			if algo, ok := ftpHashNames[name]; ok {
+				c.hashAlgos = append(c.hashAlgos, algo)
+			}
+		}
+	}
+
+	return nil
+}
+
+// closeCommandConn closes the command connection (caller must hold checksumMu).
+func (c *FTPSClient) closeCommandConn() {
+	if c.cmdConn != nil {
+		c.cmdConn.Close()
+		c.cmdConn = nil
+	}
+}
+
+// hasXCommand reports whether FEAT advertises the X command for algo.
+func (c *FTPSClient) hasXCommand(algo HashAlgorithm) bool {
+	for _, xc := range ftpXCommands {
+		if xc.algo == algo {
+			_, ok := c.cmdConn.features[xc.command]
+			return ok
+		}
+	}
+	return false
+}
+
+// ftpHashName returns the HASH command name of algo.
+func ftpHashName(algo HashAlgorithm) string {
+	for name, a := range ftpHashNames {
+		if a == algo {
+			return name
+		}
+	}
+	return string(algo)
+}
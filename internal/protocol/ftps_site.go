@@ -0,0 +1,179 @@
+// Package protocol provides SITE commands for FTP/FTPS connections.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Chmod changes the permissions of a remote file or directory with
+// SITE CHMOD, which most Unix servers support.
+func (c *FTPSClient) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	if err := c.siteCommand(ctx, "CHMOD %04o %s", UnixPermissions(mode), path); err != nil {
+		return fmt.Errorf("SITE CHMOD failed: %w", err)
+	}
+	return nil
+}
+
+// Chown is not available over FTP.
+func (c *FTPSClient) Chown(ctx context.Context, path string, uid, gid int) error {
+	return ErrNotSupported
+}
+
+// Chtimes changes the modification time of a remote file with MFMT, or
+// ProFTPD's SITE UTIME. FTP has no access time to set.
+func (c *FTPSClient) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	// MFMT goes through the control connection, avoiding a command
+	// connection for pooled transfers
+	if c.conn.IsSetTimeSupported() {
+		if err := c.conn.SetTime(path, mtime); err != nil {
+			return fmt.Errorf("MFMT failed: %w", err)
+		}
+		return nil
+	}
+
+	err := c.siteCommand(ctx, "UTIME %s %s", mtime.UTC().Format("20060102150405"), path)
+	if isUnknownCommand(err) {
+		return ErrNotSupported
+	}
+	if err != nil {
+		return fmt.Errorf("SITE UTIME failed: %w", err)
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname with ProFTPD's
+// SITE SYMLINK.
+func (c *FTPSClient) Symlink(ctx context.Context, oldname, newname string) error {
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	err := c.siteCommand(ctx, "SYMLINK %s %s", oldname, newname)
+	if isUnknownCommand(err) {
+		return ErrNotSupported
+	}
+	if err != nil {
+		return fmt.Errorf("SITE SYMLINK failed: %w", err)
+	}
+	return nil
+}
+
+// ReadLink returns the target of a symbolic link, as shown in the listing of
+// its directory: MLST describes the target of links instead.
+func (c *FTPSClient) ReadLink(ctx context.Context, path string) (string, error) {
+	if !c.connected {
+		return "", ErrNotConnected
+	}
+
+	files, err := c.List(ctx, filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(path)
+	for _, file := range files {
+		if file.Name != name {
+			continue
+		}
+		if !file.IsSymlink {
+			return "", fmt.Errorf("not a symbolic link: %s", path)
+		}
+		if file.LinkTarget == "" {
+			return "", ErrNotSupported
+		}
+		return file.LinkTarget, nil
+	}
+	return "", fmt.Errorf("file not found: %s", path)
+}
+
+// Truncate empties a remote file by storing an empty one: FTP cannot set
+// other sizes.
+func (c *FTPSClient) Truncate(ctx context.Context, path string, size int64) error {
+	if !c.connected {
+		return ErrNotConnected
+	}
+	if size != 0 {
+		return ErrNotSupported
+	}
+
+	if err := c.conn.Stor(path, strings.NewReader("")); err != nil {
+		return fmt.Errorf("failed to truncate: %w", err)
+	}
+	return nil
+}
+
+// isUnknownCommand reports whether err is the reply of a server that does not
+// implement a command or its parameters.
+func isUnknownCommand(err error) bool {
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) {
+		return false
+	}
+	switch protoErr.Code {
+	case 500, 501, 502, 504:
+		return true
+	}
+	return false
+}
+
+// siteCommand sends a SITE command on the command connection.
+func (c *FTPSClient) siteCommand(ctx context.Context, format string, args ...interface{}) error {
+	return c.withCommandConn(ctx, true, func(fc *ftpCommandConn) error {
+		_, _, err := fc.cmd(2, "SITE "+format, args...)
+		return err
+	})
+}
+
+// errNoCommandConn is returned by withCommandConn when there is no command
+// connection to use.
+var errNoCommandConn = errors.New("no FTP command connection")
+
+// withCommandConn runs fn on the command connection, reopening it once if
+// the server closed it while idle. If the connection could not be opened at
+// connect time, it is opened if open is set; otherwise, or if it cannot be
+// reopened, errNoCommandConn is returned.
+func (c *FTPSClient) withCommandConn(ctx context.Context, open bool, fn func(fc *ftpCommandConn) error) error {
+	c.checksumMu.Lock()
+	defer c.checksumMu.Unlock()
+
+	if c.cmdConn == nil {
+		if !open {
+			return errNoCommandConn
+		}
+		c.checksumProbed = true
+		if err := c.openCommandConn(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := fn(c.cmdConn)
+
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) && !errors.Is(err, errNoCommandConn) {
+		c.closeCommandConn()
+		if err := c.openCommandConn(ctx); err != nil {
+			if open {
+				return err
+			}
+			return errNoCommandConn
+		}
+		err = fn(c.cmdConn)
+	}
+
+	return err
+}
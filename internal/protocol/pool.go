@@ -0,0 +1,282 @@
+// Package protocol provides a connection pool for parallel transfers.
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultPoolIdleTimeout is how long an unused pooled connection is kept open.
+const DefaultPoolIdleTimeout = 60 * time.Second
+
+// ConnectionPool opens additional authenticated connections from the same
+// ConnectionConfig and leases one per transfer. It is needed for FTP/FTPS,
+// where a single control connection cannot carry concurrent data transfers.
+type ConnectionPool struct {
+	config      *ConnectionConfig
+	factory     func() Protocol
+	maxSize     int
+	idleTimeout time.Duration
+
+	idle    []*pooledConn
+	total   int // idle + leased + dialing
+	waiters []chan struct{}
+	closed  bool
+	mu      sync.Mutex
+
+	stopReaper chan struct{}
+}
+
+// pooledConn is an idle connection with the time it was returned to the pool.
+type pooledConn struct {
+	client   Protocol
+	lastUsed time.Time
+}
+
+// NewConnectionPool creates a pool that opens at most maxSize connections
+// using factory to create clients and config to connect them.
+func NewConnectionPool(config *ConnectionConfig, factory func() Protocol, maxSize int) *ConnectionPool {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+
+	p := &ConnectionPool{
+		config:      config,
+		factory:     factory,
+		maxSize:     maxSize,
+		idleTimeout: DefaultPoolIdleTimeout,
+		stopReaper:  make(chan struct{}),
+	}
+
+	go p.reapLoop()
+
+	return p
+}
+
+// NewFTPSConnectionPool creates a pool of FTP/FTPS connections.
+func NewFTPSConnectionPool(config *ConnectionConfig, maxSize int) *ConnectionPool {
+	// Pooled connections only transfer files: they open no command connection
+	return NewConnectionPool(config, func() Protocol { return &FTPSClient{transferOnly: true} }, maxSize)
+}
+
+// Acquire leases a connection, reusing an idle one or opening a new one.
+// It blocks while the pool is at capacity until a connection is released
+// or ctx is cancelled.
+func (p *ConnectionPool) Acquire(ctx context.Context) (Protocol, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("connection pool closed")
+		}
+
+		// Reuse the most recently used idle connection
+		var reused Protocol
+		for len(p.idle) > 0 && reused == nil {
+			pc := p.idle[len(p.idle)-1]
+			p.idle = p.idle[:len(p.idle)-1]
+			if pc.client.IsConnected() {
+				reused = pc.client
+			} else {
+				p.total--
+			}
+		}
+		if reused != nil {
+			p.mu.Unlock()
+			if p.healthy(ctx, reused) {
+				return reused, nil
+			}
+			p.mu.Lock()
+			p.total--
+			p.wakeOne()
+			p.mu.Unlock()
+			continue
+		}
+
+		// Open a new connection if below capacity
+		if p.total < p.maxSize {
+			p.total++
+			p.mu.Unlock()
+
+			client := p.factory()
+			if err := client.Connect(ctx, p.config); err != nil {
+				p.mu.Lock()
+				p.total--
+				p.wakeOne()
+				p.mu.Unlock()
+				return nil, fmt.Errorf("failed to open pooled connection: %w", err)
+			}
+			return client, nil
+		}
+
+		// Wait for a release
+		wait := make(chan struct{})
+		p.waiters = append(p.waiters, wait)
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.removeWaiter(wait)
+			p.mu.Unlock()
+			return nil, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+// healthy checks that an idle connection still works before it is leased
+// again, closing it if it does not. The server may have dropped it while it
+// was idle without the client noticing.
+func (p *ConnectionPool) healthy(ctx context.Context, client Protocol) bool {
+	pinger, ok := client.(Pinger)
+	if !ok {
+		return true
+	}
+	if err := pinger.Ping(ctx); err != nil {
+		client.Disconnect()
+		return false
+	}
+	return true
+}
+
+// Release returns a leased connection to the pool. Connections that failed
+// (broken is true) or exceed the current capacity are closed instead.
+func (p *ConnectionPool) Release(client Protocol, broken bool) {
+	if client == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if broken || p.closed || p.total > p.maxSize || !client.IsConnected() {
+		p.total--
+		go client.Disconnect()
+	} else {
+		p.idle = append(p.idle, &pooledConn{client: client, lastUsed: time.Now()})
+	}
+
+	p.wakeOne()
+}
+
+// SetMaxSize changes the maximum number of connections. Excess connections
+// are closed as they are released.
+func (p *ConnectionPool) SetMaxSize(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.maxSize = n
+	for p.total > p.maxSize && len(p.idle) > 0 {
+		pc := p.idle[0]
+		p.idle = p.idle[1:]
+		p.total--
+		go pc.client.Disconnect()
+	}
+	for len(p.waiters) > 0 && p.total < p.maxSize {
+		p.wakeOne()
+	}
+}
+
+// SetIdleTimeout sets how long an unused connection stays open.
+func (p *ConnectionPool) SetIdleTimeout(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idleTimeout = d
+}
+
+// Size returns the number of open connections (idle and leased).
+func (p *ConnectionPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.total
+}
+
+// Close disconnects all idle connections. Leased connections are closed
+// when they are released.
+func (p *ConnectionPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.total -= len(idle)
+	for _, wait := range p.waiters {
+		close(wait)
+	}
+	p.waiters = nil
+	p.mu.Unlock()
+
+	close(p.stopReaper)
+	for _, pc := range idle {
+		pc.client.Disconnect()
+	}
+}
+
+// wakeOne wakes the oldest waiter (caller must hold lock).
+func (p *ConnectionPool) wakeOne() {
+	if len(p.waiters) == 0 {
+		return
+	}
+	close(p.waiters[0])
+	p.waiters = p.waiters[1:]
+}
+
+// removeWaiter removes a waiter that gave up (caller must hold lock).
+func (p *ConnectionPool) removeWaiter(wait chan struct{}) {
+	for i, w := range p.waiters {
+		if w == wait {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// reapLoop periodically closes connections idle for longer than idleTimeout.
+func (p *ConnectionPool) reapLoop() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopReaper:
+			return
+		case <-ticker.C:
+			p.reapIdle()
+		}
+	}
+}
+
+// reapIdle closes expired idle connections.
+func (p *ConnectionPool) reapIdle() {
+	p.mu.Lock()
+	cutoff := time.Now().Add(-p.idleTimeout)
+	var expired []*pooledConn
+	kept := p.idle[:0]
+	for _, pc := range p.idle {
+		if pc.lastUsed.Before(cutoff) {
+			expired = append(expired, pc)
+		} else {
+			kept = append(kept, pc)
+		}
+	}
+	p.idle = kept
+	p.total -= len(expired)
+	if len(expired) > 0 {
+		p.wakeOne()
+	}
+	p.mu.Unlock()
+
+	for _, pc := range expired {
+		pc.client.Disconnect()
+	}
+}
@@ -0,0 +1,323 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConn is a Protocol whose connection state is controlled by the test.
+// Methods other than those below are not used by the pool.
+type fakeConn struct {
+	Protocol
+
+	mu           sync.Mutex
+	connected    bool
+	disconnected bool
+	connectErr   error
+}
+
+func (c *fakeConn) Connect(ctx context.Context, config *ConnectionConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connectErr != nil {
+		return c.connectErr
+	}
+	c.connected = true
+	return nil
+}
+
+func (c *fakeConn) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = false
+	c.disconnected = true
+	return nil
+}
+
+func (c *fakeConn) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *fakeConn) wasDisconnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.disconnected
+}
+
+// newTestPool returns a pool of fakeConns and the list of created ones.
+func newTestPool(t *testing.T, maxSize int) (*ConnectionPool, *[]*fakeConn) {
+	t.Helper()
+	var mu sync.Mutex
+	created := []*fakeConn{}
+	pool := NewConnectionPool(&ConnectionConfig{}, func() Protocol {
+		mu.Lock()
+		defer mu.Unlock()
+		c := &fakeConn{}
+		created = append(created, c)
+		return c
+	}, maxSize)
+	t.Cleanup(pool.Close)
+	return pool, &created
+}
+
+func TestPoolReusesReleasedConnection(t *testing.T) {
+	pool, created := newTestPool(t, 2)
+	ctx := context.Background()
+
+	first, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	pool.Release(first, false)
+
+	second, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if second != first {
+		t.Errorf("Acquire opened a new connection instead of reusing the idle one")
+	}
+	if len(*created) != 1 {
+		t.Errorf("created %d connections, want 1", len(*created))
+	}
+	if got := pool.Size(); got != 1 {
+		t.Errorf("Size() = %d, want 1", got)
+	}
+}
+
+func TestPoolBlocksAtCapacity(t *testing.T) {
+	pool, _ := newTestPool(t, 1)
+	ctx := context.Background()
+
+	leased, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	acquired := make(chan Protocol)
+	go func() {
+		client, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Errorf("Acquire: %v", err)
+		}
+		acquired <- client
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire returned while the pool was at capacity")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.Release(leased, false)
+	select {
+	case client := <-acquired:
+		if client != leased {
+			t.Errorf("waiter got a new connection instead of the released one")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not woken by Release")
+	}
+}
+
+func TestPoolAcquireCancelled(t *testing.T) {
+	pool, _ := newTestPool(t, 1)
+
+	if _, err := pool.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire at capacity = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPoolReleaseBroken(t *testing.T) {
+	pool, created := newTestPool(t, 2)
+
+	client, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	pool.Release(client, true)
+
+	if got := pool.Size(); got != 0 {
+		t.Errorf("Size() after releasing a broken connection = %d, want 0", got)
+	}
+	waitDisconnected(t, (*created)[0])
+
+	if _, err := pool.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if len(*created) != 2 {
+		t.Errorf("created %d connections, want 2", len(*created))
+	}
+}
+
+func TestPoolSkipsDroppedIdleConnection(t *testing.T) {
+	pool, created := newTestPool(t, 1)
+
+	client, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	pool.Release(client, false)
+	(*created)[0].Disconnect()
+
+	again, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if again == client {
+		t.Errorf("Acquire returned a dropped connection")
+	}
+	if got := pool.Size(); got != 1 {
+		t.Errorf("Size() = %d, want 1", got)
+	}
+}
+
+// pingConn is a fakeConn that can be health-checked.
+type pingConn struct {
+	fakeConn
+	pingErr error
+}
+
+func (c *pingConn) Ping(ctx context.Context) error {
+	return c.pingErr
+}
+
+func TestPoolPingsIdleConnection(t *testing.T) {
+	var created []*pingConn
+	pool := NewConnectionPool(&ConnectionConfig{}, func() Protocol {
+		c := &pingConn{}
+		created = append(created, c)
+		return c
+	}, 1)
+	defer pool.Close()
+
+	client, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	pool.Release(client, false)
+
+	again, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if again != client {
+		t.Fatalf("Acquire opened a new connection instead of reusing the one answering Ping")
+	}
+	pool.Release(again, false)
+
+	// The server dropped the idle connection without the client noticing
+	created[0].pingErr = errors.New("connection reset")
+	again, err = pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if again == client {
+		t.Errorf("Acquire returned a connection failing Ping")
+	}
+	if !created[0].wasDisconnected() {
+		t.Errorf("connection failing Ping was not closed")
+	}
+	if got := pool.Size(); got != 1 {
+		t.Errorf("Size() = %d, want 1", got)
+	}
+}
+
+func TestPoolConnectError(t *testing.T) {
+	want := errors.New("refused")
+	pool := NewConnectionPool(&ConnectionConfig{}, func() Protocol {
+		return &fakeConn{connectErr: want}
+	}, 1)
+	defer pool.Close()
+
+	if _, err := pool.Acquire(context.Background()); !errors.Is(err, want) {
+		t.Errorf("Acquire = %v, want %v", err, want)
+	}
+	if got := pool.Size(); got != 0 {
+		t.Errorf("Size() after a failed connection = %d, want 0", got)
+	}
+}
+
+func TestPoolSetMaxSizeClosesIdle(t *testing.T) {
+	pool, created := newTestPool(t, 3)
+	ctx := context.Background()
+
+	var leased []Protocol
+	for i := 0; i < 3; i++ {
+		client, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+		leased = append(leased, client)
+	}
+	for _, client := range leased {
+		pool.Release(client, false)
+	}
+
+	pool.SetMaxSize(1)
+	if got := pool.Size(); got != 1 {
+		t.Errorf("Size() after SetMaxSize(1) = %d, want 1", got)
+	}
+	closed := func() int {
+		n := 0
+		for _, c := range *created {
+			if c.wasDisconnected() {
+				n++
+			}
+		}
+		return n
+	}
+	waitFor(func() bool { return closed() >= 2 })
+	if n := closed(); n != 2 {
+		t.Errorf("%d connections closed, want 2", n)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	pool, created := newTestPool(t, 1)
+
+	client, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	pool.Release(client, false)
+	pool.Close()
+
+	if !(*created)[0].wasDisconnected() {
+		t.Errorf("Close left an idle connection open")
+	}
+	if _, err := pool.Acquire(context.Background()); err == nil {
+		t.Errorf("Acquire on a closed pool succeeded")
+	}
+}
+
+// waitDisconnected waits for a connection closed in the background.
+func waitDisconnected(t *testing.T, c *fakeConn) {
+	t.Helper()
+	if !waitFor(c.wasDisconnected) {
+		t.Errorf("connection was not closed")
+	}
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
@@ -2,9 +2,11 @@
 package protocol
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"net"
+	"os"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -20,6 +22,10 @@ const (
 
 	// LargeBufferSize is used for files larger than LargeFileThreshold (1MB)
 	LargeBufferSize = 1024 * 1024
+
+	// ResumeVerifySize is how much of the already transferred data is
+	// compared on both sides before a transfer is resumed (64KB)
+	ResumeVerifySize = 64 * 1024
 )
 
 // GetOptimalBufferSize returns the optimal buffer size based on file size.
@@ -37,13 +43,73 @@ func CopyWithBuffer(dst io.Writer, src io.Reader, fileSize int64) (int64, error)
 	return io.CopyBuffer(dst, src, buf)
 }
 
+// resumeTailStart returns where the tail compared before resuming at offset begins.
+func resumeTailStart(offset int64) int64 {
+	if offset > ResumeVerifySize {
+		return offset - ResumeVerifySize
+	}
+	return 0
+}
+
+// readRange reads the bytes in [start, end) from r.
+func readRange(r io.ReaderAt, start, end int64) ([]byte, error) {
+	buf := make([]byte, end-start)
+	n, err := r.ReadAt(buf, start)
+	if n == len(buf) {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// tailsMatch reports whether the tails before offset of a partial copy and
+// of its source are identical, i.e. whether the copy can be resumed.
+func tailsMatch(src, partial io.ReaderAt, offset int64) bool {
+	start := resumeTailStart(offset)
+	srcTail, err := readRange(src, start, offset)
+	if err != nil {
+		return false
+	}
+	partialTail, err := readRange(partial, start, offset)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(srcTail, partialTail)
+}
+
+// canResumeDownload reports whether the local file at localPath, size bytes
+// long, is an intact prefix of remote (totalSize bytes long).
+func canResumeDownload(remote io.ReaderAt, localPath string, size, totalSize int64) bool {
+	if size <= 0 || size > totalSize {
+		return false
+	}
+
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return false
+	}
+	defer localFile.Close()
+
+	return tailsMatch(remote, localFile, size)
+}
+
 // FileInfo represents information about a remote file or directory.
 type FileInfo struct {
 	Name        string
 	Size        int64
 	IsDir       bool
 	ModTime     time.Time
-	Permissions string
+	Permissions string      // As shown by ls -l; empty if the server does not tell
+	Mode        os.FileMode // Type and permission bits; no permission bits if the server does not tell
+	IsSymlink   bool
+	LinkTarget  string // Target of a symbolic link, if the server tells
+	UID         int    // Numeric owner and group; -1 if the server does not tell
+	GID         int
+	Owner       string // User name, or ID if the name is unknown
+	Group       string
+	AccessTime  time.Time // Zero if the server does not tell
 }
 
 // TransferProgress represents the progress of a file transfer.
@@ -58,6 +124,32 @@ type TransferProgress struct {
 // HostKeyCallback is a function called to verify SSH host keys.
 type HostKeyCallback func(hostname string, remote net.Addr, key ssh.PublicKey) error
 
+// BandwidthThrottle limits the rate of upload and download streams.
+// Implementations may change their rates while transfers are running.
+type BandwidthThrottle interface {
+	// ThrottleUpload wraps the local reader feeding an upload.
+	ThrottleUpload(r io.Reader) io.Reader
+
+	// ThrottleDownload wraps the local writer receiving a download.
+	ThrottleDownload(w io.Writer) io.Writer
+}
+
+// throttleUpload applies the upload limit of t, if any.
+func throttleUpload(t BandwidthThrottle, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return t.ThrottleUpload(r)
+}
+
+// throttleDownload applies the download limit of t, if any.
+func throttleDownload(t BandwidthThrottle, w io.Writer) io.Writer {
+	if t == nil {
+		return w
+	}
+	return t.ThrottleDownload(w)
+}
+
 // ConnectionConfig holds the configuration for a connection.
 type ConnectionConfig struct {
 	Protocol   string // "sftp", "ftps", or "ftp"
@@ -73,7 +165,26 @@ type ConnectionConfig struct {
 	TLSSkipVerify bool // Skip certificate verification (not recommended)
 
 	// SSH settings for SFTP
-	HostKeyCallback HostKeyCallback // Callback for host key verification
+	HostKeyCallback   HostKeyCallback     // Callback for host key verification
+	HostKeyAlgorithms []string            // Offered in order, known key types first; defaults if empty
+	HostKeysCallback  HostKeysCallback    // Records the host keys the server proves to hold (optional)
+	IdentityFiles     []string            // Private key files tried after PrivateKey
+	IdentitiesOnly    bool                // Only offer agent keys matching the key files
+	AuthMethods       []string            // Tried in order; DefaultAuthMethods if empty
+	Passphrase        PassphraseCallback  // Asked for encrypted private keys (optional)
+	Challenge         ChallengeCallback   // Asked for server prompts and missing passwords (optional)
+	JumpHosts         []*ConnectionConfig // SSH hosts to hop through, first hop first (optional)
+
+	// Proxy used by the SSH connection, or the FTP control and data
+	// connections (optional)
+	Proxy *ProxyConfig
+
+	// Bandwidth limiting, shared by every connection of a session (optional)
+	Throttle BandwidthThrottle
+
+	// Attributes copied from the source of transfers
+	PreserveModTime     bool // Modification time, on uploads and downloads
+	PreservePermissions bool // Permissions of local files, on uploads
 }
 
 // Protocol defines the interface that both SFTP and FTPS clients must implement.
@@ -105,6 +216,9 @@ type Protocol interface {
 	// Rename renames a file or directory.
 	Rename(ctx context.Context, oldPath, newPath string) error
 
+	// Permissions, ownership, timestamps and symbolic links
+	AttributeChanger
+
 	// Upload uploads a file to the remote server.
 	// progressFn is called periodically with transfer progress.
 	Upload(ctx context.Context, localPath, remotePath string, resume bool, progressFn func(TransferProgress)) error
@@ -0,0 +1,171 @@
+// Package protocol provides connections through SOCKS5 and HTTP CONNECT
+// proxies.
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Proxy types
+const (
+	ProxySOCKS5 = "socks5"
+	ProxyHTTP   = "http" // HTTP CONNECT
+)
+
+// ProxyConfig describes the proxy connections are opened through.
+type ProxyConfig struct {
+	Type     string // ProxySOCKS5 or ProxyHTTP
+	Host     string
+	Port     int
+	Username string // Optional
+	Password string
+}
+
+// Address returns the host:port of the proxy.
+func (p *ProxyConfig) Address() string {
+	return net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+}
+
+// newDialer returns the dialFunc opening connections for config: through
+// config.Proxy if set, directly otherwise. Connections report the address
+// they were opened to as their remote address, even through a proxy.
+func newDialer(config *ConnectionConfig) dialFunc {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	direct := &net.Dialer{Timeout: timeout}
+
+	p := config.Proxy
+	if p == nil {
+		return direct.DialContext
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		var conn net.Conn
+		var err error
+		switch p.Type {
+		case ProxySOCKS5:
+			conn, err = dialSOCKS5(ctx, direct, p, network, address)
+		case ProxyHTTP:
+			conn, err = dialHTTPConnect(ctx, direct, p, address)
+		default:
+			return nil, fmt.Errorf("unsupported proxy type: %s", p.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("proxy %s: %w", p.Address(), err)
+		}
+		return &addrConn{Conn: conn, remote: tcpAddr(address)}, nil
+	}
+}
+
+// dialSOCKS5 opens a connection to address through a SOCKS5 proxy. Host
+// names are resolved by the proxy.
+func dialSOCKS5(ctx context.Context, direct *net.Dialer, p *ProxyConfig, network, address string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if p.Username != "" {
+		auth = &proxy.Auth{User: p.Username, Password: p.Password}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", p.Address(), auth, direct)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.(proxy.ContextDialer).DialContext(ctx, network, address)
+}
+
+// dialHTTPConnect opens a tunnel to address with the CONNECT method of an
+// HTTP proxy.
+func dialHTTPConnect(ctx context.Context, direct *net.Dialer, p *ProxyConfig, address string) (net.Conn, error) {
+	conn, err := direct.DialContext(ctx, "tcp", p.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	// The proxy may not answer at all; give up with the context or timeout
+	deadline, ok := ctx.Deadline()
+	if !ok && direct.Timeout > 0 {
+		deadline = time.Now().Add(direct.Timeout)
+	}
+	conn.SetDeadline(deadline)
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if p.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.Username + ":" + p.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("CONNECT to %s refused: %s", address, resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	// SSH and FTP servers speak first: keep what was read past the response
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// addrConn is a connection opened through a proxy or a jump host. It reports
+// the address it was opened to as its remote address, as a direct connection
+// would, so that host keys are recorded under the same name either way.
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+// RemoteAddr returns the address the connection was opened to.
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// tcpAddr returns the TCP address of "host:port". The IP is left empty when
+// host is a name, which only the proxy or jump host may be able to resolve.
+func tcpAddr(address string) *net.TCPAddr {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	port, _ := strconv.Atoi(portStr)
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: port}
+}
+
+// bufferedConn is a connection whose first bytes were already read into reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads the buffered bytes first.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,85 @@
+// Package protocol provides reconnection and error classification for
+// interrupted connections.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"syscall"
+
+	"github.com/pkg/sftp"
+)
+
+// ErrNotConnected is returned by operations on a client that is not connected.
+var ErrNotConnected = errors.New("not connected")
+
+// Reconnector is an optional capability of a Protocol that can reopen its
+// connection with the ConnectionConfig it was last connected with.
+type Reconnector interface {
+	// Reconnect closes what is left of the connection and connects again,
+	// keeping the current directory.
+	Reconnect(ctx context.Context) error
+}
+
+// Pinger is an optional capability of a Protocol that can check with the
+// server that an idle connection still works, which IsConnected does not.
+type Pinger interface {
+	// Ping sends a request that has no effect and waits for its reply.
+	Ping(ctx context.Context) error
+}
+
+// transientErrnos are system errors caused by the network rather than by the
+// files being transferred.
+var transientErrnos = []syscall.Errno{
+	syscall.ECONNRESET,
+	syscall.ECONNREFUSED,
+	syscall.ECONNABORTED,
+	syscall.EPIPE,
+	syscall.ETIMEDOUT,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+	syscall.ENETDOWN,
+}
+
+// IsTransientError reports whether an operation that failed with err may
+// succeed if tried again, possibly after reconnecting: lost connections,
+// network timeouts and FTP 4xx replies. Missing files, permission errors,
+// FTP 5xx replies and cancellations are permanent.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, ErrNotConnected) ||
+		errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, sftp.ErrSSHFxNoConnection) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	var statusErr *sftp.StatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.FxCode()
+		return code == sftp.ErrSSHFxConnectionLost || code == sftp.ErrSSHFxNoConnection
+	}
+
+	var ftpErr *textproto.Error
+	if errors.As(err, &ftpErr) {
+		return ftpErr.Code >= 400 && ftpErr.Code < 500
+	}
+
+	// Dial errors, timeouts and other failures of the connection itself
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
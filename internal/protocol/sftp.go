@@ -3,11 +3,13 @@ package protocol
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -16,10 +18,29 @@ import (
 
 // SFTPClient implements the Protocol interface for SFTP connections.
 type SFTPClient struct {
+	// Session, replaced as a whole by Reconnect while requests may run
+	connMu     sync.RWMutex
 	sshClient  *ssh.Client
+	jumps      []*ssh.Client // Jump hosts, first hop first
 	sftpClient *sftp.Client
 	connected  bool
+	lost       chan struct{} // Closed when the SSH connection drops
+
 	currentDir string
+	throttle   BandwidthThrottle
+	config     *ConnectionConfig
+
+	// Server-side checksum support, negotiated on first use
+	checksumMu     sync.Mutex
+	checksumProbed bool
+	execAlgos      []HashAlgorithm
+	checkFileAlgos []HashAlgorithm
+
+	// Owner and group names, looked up on first use
+	namesMu          sync.Mutex
+	namesUnavailable bool
+	userNames        map[int]string
+	groupNames       map[int]string
 }
 
 // NewSFTPClient creates a new SFTP client instance.
@@ -29,30 +50,83 @@ func NewSFTPClient() *SFTPClient {
 
 // Connect establishes an SFTP connection to the remote server.
 func (c *SFTPClient) Connect(ctx context.Context, config *ConnectionConfig) error {
-	if c.connected {
+	c.connMu.RLock()
+	connected := c.connected
+	c.connMu.RUnlock()
+	if connected {
 		return fmt.Errorf("already connected")
 	}
 
-	// Build SSH auth methods
-	var authMethods []ssh.AuthMethod
+	session, err := openSFTPSession(ctx, config)
+	if err != nil {
+		return err
+	}
+	c.setSession(session)
+
+	c.config = config
+	c.currentDir, _ = session.sftpClient.Getwd()
+	c.throttle = config.Throttle
+
+	return nil
+}
+
+// sftpSession is an open SSH connection, with its jump hosts and the SFTP
+// client running on it.
+type sftpSession struct {
+	sshClient  *ssh.Client
+	jumps      []*ssh.Client
+	sftpClient *sftp.Client
+	lost       chan struct{}
+}
+
+// openSFTPSession connects to config.Host and starts the SFTP subsystem.
+func openSFTPSession(ctx context.Context, config *ConnectionConfig) (*sftpSession, error) {
+	// Reach the server through the proxy and the jump hosts, if any
+	dial := newDialer(config)
+	jumps, err := dialJumpHosts(ctx, dial, config.JumpHosts)
+	if err != nil {
+		return nil, err
+	}
+	if len(jumps) > 0 {
+		dial = jumpDialer(jumps[len(jumps)-1])
+	}
 
-	// Password authentication
-	if config.Password != "" {
-		authMethods = append(authMethods, ssh.Password(config.Password))
+	sshClient, err := dialSSH(ctx, dial, config)
+	if err != nil {
+		closeJumpHosts(jumps)
+		return nil, err
 	}
 
-	// Private key authentication
-	if len(config.PrivateKey) > 0 {
-		signer, err := ssh.ParsePrivateKey(config.PrivateKey)
-		if err != nil {
-			return fmt.Errorf("failed to parse private key: %w", err)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
+	// Notice when the server or the network closes the session
+	lost := make(chan struct{})
+	go func(client *ssh.Client) {
+		client.Wait()
+		close(lost)
+	}(sshClient)
+
+	// Create SFTP client with concurrent requests for better performance
+	sftpClient, err := sftp.NewClient(sshClient,
+		sftp.MaxConcurrentRequestsPerFile(64),  // Allow 64 concurrent requests per file
+		sftp.MaxPacket(32768),                   // 32KB packet size for optimal throughput
+	)
+	if err != nil {
+		sshClient.Close()
+		closeJumpHosts(jumps)
+		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
 	}
 
-	if len(authMethods) == 0 {
-		return fmt.Errorf("no authentication method provided")
+	return &sftpSession{sshClient: sshClient, jumps: jumps, sftpClient: sftpClient, lost: lost}, nil
+}
+
+// dialSSH opens a connection to config.Host with dial and performs the SSH
+// handshake and authentication.
+func dialSSH(ctx context.Context, dial dialFunc, config *ConnectionConfig) (*ssh.Client, error) {
+	// Build SSH auth methods; agent keys are only needed during the handshake
+	auth, err := newSSHAuth(config)
+	if err != nil {
+		return nil, err
 	}
+	defer auth.Close()
 
 	// Set default timeout
 	timeout := config.Timeout
@@ -62,172 +136,402 @@ func (c *SFTPClient) Connect(ctx context.Context, config *ConnectionConfig) erro
 
 	// SSH client configuration - Host key verification is REQUIRED for security
 	if config.HostKeyCallback == nil {
-		return fmt.Errorf("host key verification is required for SFTP connections - no HostKeyCallback provided")
+		return nil, fmt.Errorf("host key verification is required for SFTP connections - no HostKeyCallback provided")
 	}
 	hostKeyCallback := ssh.HostKeyCallback(config.HostKeyCallback)
 
 	sshConfig := &ssh.ClientConfig{
-		User:            config.Username,
-		Auth:            authMethods,
-		HostKeyCallback: hostKeyCallback,
-		Timeout:         timeout,
+		User:              config.Username,
+		Auth:              auth.methods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: config.HostKeyAlgorithms,
+		Timeout:           timeout,
 	}
 
 	// Connect to SSH server
 	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
 
 	// Use context for connection timeout
-	var d net.Dialer
-	conn, err := d.DialContext(ctx, "tcp", address)
+	conn, err := dial(ctx, "tcp", address)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", address, err)
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
 	}
 
 	// Establish SSH connection
 	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, sshConfig)
 	if err != nil {
 		conn.Close()
-		return fmt.Errorf("SSH handshake failed: %w", err)
+		return nil, fmt.Errorf("SSH handshake failed: %w", err)
 	}
 
-	c.sshClient = ssh.NewClient(sshConn, chans, reqs)
-
-	// Create SFTP client with concurrent requests for better performance
-	c.sftpClient, err = sftp.NewClient(c.sshClient,
-		sftp.MaxConcurrentRequestsPerFile(64),  // Allow 64 concurrent requests per file
-		sftp.MaxPacket(32768),                   // 32KB packet size for optimal throughput
-	)
-	if err != nil {
-		c.sshClient.Close()
-		return fmt.Errorf("failed to create SFTP client: %w", err)
+	// Keys added or retired by the server are announced after authentication
+	if config.HostKeysCallback != nil {
+		reqs = watchHostKeys(sshConn, reqs, address, conn.RemoteAddr(), config.HostKeysCallback)
 	}
 
-	c.connected = true
-	c.currentDir, _ = c.sftpClient.Getwd()
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// close closes the SFTP client, the SSH connection and the jump hosts.
+func (s *sftpSession) close() error {
+	var errs []error
 
+	if err := s.sftpClient.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("SFTP close: %w", err))
+	}
+	if err := s.sshClient.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("SSH close: %w", err))
+	}
+	closeJumpHosts(s.jumps)
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
 	return nil
 }
 
-// Disconnect closes the SFTP and SSH connections.
-func (c *SFTPClient) Disconnect() error {
+// setSession makes session the current one, or disconnects the client if it
+// is nil, and returns the previous session, if any. Requests already running
+// keep the clients they started with.
+func (c *SFTPClient) setSession(session *sftpSession) *sftpSession {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	var old *sftpSession
+	if c.connected {
+		old = &sftpSession{sshClient: c.sshClient, jumps: c.jumps, sftpClient: c.sftpClient, lost: c.lost}
+	}
+
+	c.sshClient, c.jumps, c.sftpClient, c.lost = nil, nil, nil, nil
+	if session != nil {
+		c.sshClient, c.jumps, c.sftpClient, c.lost = session.sshClient, session.jumps, session.sftpClient, session.lost
+	}
+	c.connected = session != nil
+	return old
+}
+
+// sftpConn returns the SFTP client of the current session.
+func (c *SFTPClient) sftpConn() (*sftp.Client, error) {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
 	if !c.connected {
-		return nil
+		return nil, ErrNotConnected
 	}
+	return c.sftpClient, nil
+}
 
-	var errs []error
+// sshConn returns the SSH client of the current session.
+func (c *SFTPClient) sshConn() (*ssh.Client, error) {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
 
-	if c.sftpClient != nil {
-		if err := c.sftpClient.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("SFTP close: %w", err))
-		}
+	if !c.connected {
+		return nil, ErrNotConnected
 	}
+	return c.sshClient, nil
+}
 
-	if c.sshClient != nil {
-		if err := c.sshClient.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("SSH close: %w", err))
-		}
+// Disconnect closes the SFTP and SSH connections.
+func (c *SFTPClient) Disconnect() error {
+	old := c.setSession(nil)
+	if old == nil {
+		return nil
 	}
 
-	c.connected = false
-	c.sftpClient = nil
-	c.sshClient = nil
+	err := old.close()
+	c.forgetServer()
+	return err
+}
 
-	if len(errs) > 0 {
-		return errs[0]
-	}
-	return nil
+// forgetServer drops what was learnt about the server of the last session.
+func (c *SFTPClient) forgetServer() {
+	c.checksumMu.Lock()
+	c.checksumProbed = false
+	c.execAlgos = nil
+	c.checkFileAlgos = nil
+	c.checksumMu.Unlock()
+
+	c.namesMu.Lock()
+	c.namesUnavailable = false
+	c.userNames = nil
+	c.groupNames = nil
+	c.namesMu.Unlock()
+}
+
+// connectionConfig returns the configuration of the last connection.
+func (c *SFTPClient) connectionConfig() *ConnectionConfig {
+	return c.config
 }
 
-// IsConnected returns true if the client is connected.
+// IsConnected returns true if the client is connected and the SSH session
+// has not dropped.
 func (c *SFTPClient) IsConnected() bool {
-	return c.connected
+	c.connMu.RLock()
+	connected, lost := c.connected, c.lost
+	c.connMu.RUnlock()
+
+	if !connected {
+		return false
+	}
+	select {
+	case <-lost:
+		return false
+	default:
+		return true
+	}
+}
+
+// Reconnect opens a new session with the last ConnectionConfig, replacing a
+// dropped one. The new session is opened before the old one is closed, so
+// concurrent requests fail with the old clients rather than find none.
+func (c *SFTPClient) Reconnect(ctx context.Context) error {
+	if c.config == nil {
+		return ErrNotConnected
+	}
+
+	session, err := openSFTPSession(ctx, c.config)
+	if err != nil {
+		return err
+	}
+	if old := c.setSession(session); old != nil {
+		old.close()
+	}
+	c.forgetServer()
+	if c.currentDir == "" {
+		c.currentDir, _ = session.sftpClient.Getwd()
+	}
+	return nil
 }
 
 // List returns the contents of a directory.
 func (c *SFTPClient) List(ctx context.Context, path string) ([]FileInfo, error) {
-	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return nil, err
 	}
 
-	entries, err := c.sftpClient.ReadDir(path)
+	entries, err := client.ReadDir(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list directory: %w", err)
 	}
 
 	var files []FileInfo
 	for _, entry := range entries {
-		files = append(files, FileInfo{
-			Name:        entry.Name(),
-			Size:        entry.Size(),
-			IsDir:       entry.IsDir(),
-			ModTime:     entry.ModTime(),
-			Permissions: entry.Mode().String(),
-		})
+		files = append(files, sftpFileInfo(entry))
 	}
 
+	readLinks(client, path, files)
+	c.resolveOwners(ctx, files)
+
 	return files, nil
 }
 
-// Stat returns information about a file or directory.
+// Stat returns information about a file or directory. Symbolic links are
+// followed: IsSymlink and LinkTarget are set, and the other fields describe
+// the target, unless it does not exist.
 func (c *SFTPClient) Stat(ctx context.Context, path string) (*FileInfo, error) {
-	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return nil, err
 	}
 
-	info, err := c.sftpClient.Stat(path)
+	info, err := client.Lstat(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat: %w", err)
 	}
 
-	return &FileInfo{
+	file := sftpFileInfo(info)
+	if file.IsSymlink {
+		if target, err := client.Stat(path); err == nil {
+			file = sftpFileInfo(target)
+			file.Name = info.Name()
+			file.IsSymlink = true
+		}
+		file.LinkTarget, _ = client.ReadLink(path)
+	}
+
+	files := []FileInfo{file}
+	c.resolveOwners(ctx, files)
+	return &files[0], nil
+}
+
+// sftpFileInfo converts a file described by pkg/sftp.
+func sftpFileInfo(info os.FileInfo) FileInfo {
+	file := FileInfo{
 		Name:        info.Name(),
 		Size:        info.Size(),
 		IsDir:       info.IsDir(),
 		ModTime:     info.ModTime(),
-		Permissions: info.Mode().String(),
-	}, nil
+		Permissions: FormatPermissions(info.Mode()),
+		Mode:        info.Mode(),
+		IsSymlink:   info.Mode()&os.ModeSymlink != 0,
+		UID:         -1,
+		GID:         -1,
+	}
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		file.UID, file.GID = int(stat.UID), int(stat.GID)
+		if stat.Atime != 0 {
+			file.AccessTime = time.Unix(int64(stat.Atime), 0)
+		}
+	}
+	return file
+}
+
+// readLinks sets the LinkTarget of the symbolic links among the files of dir.
+func readLinks(client *sftp.Client, dir string, files []FileInfo) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, DefaultTreeWorkers)
+	for i := range files {
+		if !files[i].IsSymlink {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(file *FileInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if target, err := client.ReadLink(path.Join(dir, file.Name)); err == nil {
+				file.LinkTarget = target
+			}
+		}(&files[i])
+	}
+	wg.Wait()
 }
 
 // Mkdir creates a directory.
 func (c *SFTPClient) Mkdir(ctx context.Context, path string) error {
-	if !c.connected {
-		return fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
 	}
 
-	return c.sftpClient.Mkdir(path)
+	return client.Mkdir(path)
 }
 
 // Remove removes a file.
 func (c *SFTPClient) Remove(ctx context.Context, path string) error {
-	if !c.connected {
-		return fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
 	}
 
-	return c.sftpClient.Remove(path)
+	return client.Remove(path)
 }
 
 // RemoveDir removes a directory.
 func (c *SFTPClient) RemoveDir(ctx context.Context, path string) error {
-	if !c.connected {
-		return fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
 	}
 
-	return c.sftpClient.RemoveDirectory(path)
+	return client.RemoveDirectory(path)
 }
 
 // Rename renames a file or directory.
 func (c *SFTPClient) Rename(ctx context.Context, oldPath, newPath string) error {
-	if !c.connected {
-		return fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
+	}
+
+	return client.Rename(oldPath, newPath)
+}
+
+// Replace renames oldPath over newPath in a single step with the
+// posix-rename@openssh.com extension.
+func (c *SFTPClient) Replace(ctx context.Context, oldPath, newPath string) error {
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
+	}
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); !ok {
+		return ErrNotSupported
+	}
+
+	return client.PosixRename(oldPath, newPath)
+}
+
+// Chmod changes the permissions of a remote file or directory.
+func (c *SFTPClient) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
+	}
+
+	return sftpUnsupported(client.Chmod(path, mode))
+}
+
+// Chown changes the numeric owner and group of a remote file or directory.
+func (c *SFTPClient) Chown(ctx context.Context, path string, uid, gid int) error {
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
+	}
+
+	return sftpUnsupported(client.Chown(path, uid, gid))
+}
+
+// Chtimes changes the access and modification times of a remote file.
+func (c *SFTPClient) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
+	}
+
+	return sftpUnsupported(client.Chtimes(path, atime, mtime))
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (c *SFTPClient) Symlink(ctx context.Context, oldname, newname string) error {
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
+	}
+
+	return sftpUnsupported(client.Symlink(oldname, newname))
+}
+
+// ReadLink returns the target of a symbolic link.
+func (c *SFTPClient) ReadLink(ctx context.Context, path string) (string, error) {
+	client, err := c.sftpConn()
+	if err != nil {
+		return "", err
+	}
+
+	target, err := client.ReadLink(path)
+	return target, sftpUnsupported(err)
+}
+
+// Truncate changes the size of a remote file.
+func (c *SFTPClient) Truncate(ctx context.Context, path string, size int64) error {
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
 	}
 
-	return c.sftpClient.Rename(oldPath, newPath)
+	return sftpUnsupported(client.Truncate(path, size))
+}
+
+// sftpUnsupported returns ErrNotSupported for requests the server does not
+// implement, and err otherwise.
+func sftpUnsupported(err error) error {
+	var statusErr *sftp.StatusError
+	if errors.As(err, &statusErr) && statusErr.FxCode() == sftp.ErrSSHFxOpUnsupported {
+		return ErrNotSupported
+	}
+	return err
 }
 
 // Upload uploads a file to the remote server with optional resume support.
 func (c *SFTPClient) Upload(ctx context.Context, localPath, remotePath string, resume bool, progressFn func(TransferProgress)) error {
-	if !c.connected {
-		return fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
 	}
 
 	// Open local file
@@ -248,13 +552,13 @@ func (c *SFTPClient) Upload(ctx context.Context, localPath, remotePath string, r
 	var startOffset int64
 
 	if resume {
-		// Check if remote file exists and get its size
-		remoteInfo, err := c.sftpClient.Stat(remotePath)
-		if err == nil && !remoteInfo.IsDir() {
+		// Check if remote file exists and matches the start of the local file
+		remoteInfo, err := client.Stat(remotePath)
+		if err == nil && !remoteInfo.IsDir() && canResumeUpload(client, localFile, remotePath, remoteInfo.Size(), totalSize) {
 			startOffset = remoteInfo.Size()
-			if startOffset >= totalSize {
+			if startOffset == totalSize {
 				// File already fully uploaded
-				return nil
+				return preserveUpload(ctx, c, c.config, remotePath, localInfo)
 			}
 
 			// Seek local file to resume position
@@ -263,16 +567,22 @@ func (c *SFTPClient) Upload(ctx context.Context, localPath, remotePath string, r
 			}
 
 			// Open remote file for append
-			remoteFile, err = c.sftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_APPEND)
+			remoteFile, err = client.OpenFile(remotePath, os.O_WRONLY|os.O_APPEND)
 			if err != nil {
 				return fmt.Errorf("failed to open remote file for append: %w", err)
 			}
+
+			// Writes go to the handle offset; not every server honors the append flag
+			if _, err := remoteFile.Seek(startOffset, io.SeekStart); err != nil {
+				remoteFile.Close()
+				return fmt.Errorf("failed to seek remote file: %w", err)
+			}
 		}
 	}
 
 	if remoteFile == nil {
 		// Create new remote file
-		remoteFile, err = c.sftpClient.Create(remotePath)
+		remoteFile, err = client.Create(remotePath)
 		if err != nil {
 			return fmt.Errorf("failed to create remote file: %w", err)
 		}
@@ -282,7 +592,7 @@ func (c *SFTPClient) Upload(ctx context.Context, localPath, remotePath string, r
 
 	// Create progress wrapper
 	reader := &ProgressReader{
-		Reader:     localFile,
+		Reader:     throttleUpload(c.throttle, localFile),
 		TotalSize:  totalSize,
 		BytesRead:  startOffset,
 		StartTime:  time.Now(),
@@ -299,6 +609,11 @@ func (c *SFTPClient) Upload(ctx context.Context, localPath, remotePath string, r
 
 	select {
 	case <-ctx.Done():
+		// Closing the files makes the copy fail; it must have stopped
+		// before the caller reuses the partial file
+		localFile.Close()
+		remoteFile.Close()
+		<-done
 		return ctx.Err()
 	case err := <-done:
 		if err != nil {
@@ -306,24 +621,45 @@ func (c *SFTPClient) Upload(ctx context.Context, localPath, remotePath string, r
 		}
 	}
 
-	return nil
+	// The server may set the times when the file is closed
+	if err := remoteFile.Close(); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	return preserveUpload(ctx, c, c.config, remotePath, localInfo)
+}
+
+// canResumeUpload reports whether a remote file of size bytes is an intact
+// prefix of localFile (totalSize bytes long) that an upload can extend.
+func canResumeUpload(client *sftp.Client, localFile *os.File, remotePath string, size, totalSize int64) bool {
+	if size <= 0 || size > totalSize {
+		return false
+	}
+
+	remoteFile, err := client.Open(remotePath)
+	if err != nil {
+		return false
+	}
+	defer remoteFile.Close()
+
+	return tailsMatch(localFile, remoteFile, size)
 }
 
 // Download downloads a file from the remote server with optional resume support.
 func (c *SFTPClient) Download(ctx context.Context, remotePath, localPath string, resume bool, progressFn func(TransferProgress)) error {
-	if !c.connected {
-		return fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
 	}
 
 	// Get remote file info
-	remoteInfo, err := c.sftpClient.Stat(remotePath)
+	remoteInfo, err := client.Stat(remotePath)
 	if err != nil {
 		return fmt.Errorf("failed to stat remote file: %w", err)
 	}
 	totalSize := remoteInfo.Size()
 
 	// Open remote file
-	remoteFile, err := c.sftpClient.Open(remotePath)
+	remoteFile, err := client.Open(remotePath)
 	if err != nil {
 		return fmt.Errorf("failed to open remote file: %w", err)
 	}
@@ -333,13 +669,13 @@ func (c *SFTPClient) Download(ctx context.Context, remotePath, localPath string,
 	var startOffset int64
 
 	if resume {
-		// Check if local file exists
+		// Check if local file exists and matches the start of the remote file
 		localInfo, err := os.Stat(localPath)
-		if err == nil && !localInfo.IsDir() {
+		if err == nil && !localInfo.IsDir() && canResumeDownload(remoteFile, localPath, localInfo.Size(), totalSize) {
 			startOffset = localInfo.Size()
-			if startOffset >= totalSize {
+			if startOffset == totalSize {
 				// File already fully downloaded
-				return nil
+				return preserveDownload(c.config, localPath, remoteInfo.ModTime())
 			}
 
 			// Seek remote file to resume position
@@ -373,7 +709,7 @@ func (c *SFTPClient) Download(ctx context.Context, remotePath, localPath string,
 
 	// Create progress wrapper
 	writer := &ProgressWriter{
-		Writer:     localFile,
+		Writer:     throttleDownload(c.throttle, localFile),
 		TotalSize:  totalSize,
 		Written:    startOffset,
 		StartTime:  time.Now(),
@@ -390,6 +726,11 @@ func (c *SFTPClient) Download(ctx context.Context, remotePath, localPath string,
 
 	select {
 	case <-ctx.Done():
+		// Closing the files makes the copy fail; it must have stopped
+		// before the caller reuses the partial file
+		remoteFile.Close()
+		localFile.Close()
+		<-done
 		return ctx.Err()
 	case err := <-done:
 		if err != nil {
@@ -397,22 +738,27 @@ func (c *SFTPClient) Download(ctx context.Context, remotePath, localPath string,
 		}
 	}
 
-	return nil
+	if err := localFile.Close(); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	return preserveDownload(c.config, localPath, remoteInfo.ModTime())
 }
 
 // GetReader returns a reader for a remote file.
 func (c *SFTPClient) GetReader(ctx context.Context, path string) (io.ReadCloser, error) {
-	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return nil, err
 	}
 
-	return c.sftpClient.Open(path)
+	return client.Open(path)
 }
 
 // GetWriter returns a writer for a remote file.
 func (c *SFTPClient) GetWriter(ctx context.Context, path string, append bool) (io.WriteCloser, error) {
-	if !c.connected {
-		return nil, fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return nil, err
 	}
 
 	flags := os.O_WRONLY | os.O_CREATE
@@ -422,26 +768,28 @@ func (c *SFTPClient) GetWriter(ctx context.Context, path string, append bool) (i
 		flags |= os.O_TRUNC
 	}
 
-	return c.sftpClient.OpenFile(path, flags)
+	return client.OpenFile(path, flags)
 }
 
 // CurrentDir returns the current working directory.
 func (c *SFTPClient) CurrentDir() (string, error) {
-	if !c.connected {
-		return "", fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return "", err
 	}
 
-	return c.sftpClient.Getwd()
+	return client.Getwd()
 }
 
 // ChangeDir changes the current working directory.
 func (c *SFTPClient) ChangeDir(path string) error {
-	if !c.connected {
-		return fmt.Errorf("not connected")
+	client, err := c.sftpConn()
+	if err != nil {
+		return err
 	}
 
 	// Verify the directory exists
-	info, err := c.sftpClient.Stat(path)
+	info, err := client.Stat(path)
 	if err != nil {
 		return fmt.Errorf("directory does not exist: %w", err)
 	}
@@ -0,0 +1,384 @@
+// Package protocol provides server-side checksums for SFTP connections.
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// sftpHashCommands are the commands run over an SSH exec session to hash a
+// file, best algorithm first.
+var sftpHashCommands = []struct {
+	algo    HashAlgorithm
+	command string
+}{
+	{HashSHA256, "sha256sum"},
+	{HashSHA1, "sha1sum"},
+	{HashMD5, "md5sum"},
+}
+
+// checksumProbeTimeout bounds the exec session used to detect hash commands.
+const checksumProbeTimeout = 10 * time.Second
+
+// SFTP packet types used by the check-file extension
+const (
+	sshFxpInit          = 1
+	sshFxpVersion       = 2
+	sshFxpStatus        = 101
+	sshFxpExtended      = 200
+	sshFxpExtendedReply = 201
+)
+
+// ChecksumAlgorithms returns the algorithms the server can hash with, using
+// either hash commands over SSH exec or the "check-file" SFTP extension.
+func (c *SFTPClient) ChecksumAlgorithms(ctx context.Context) []HashAlgorithm {
+	if !c.IsConnected() {
+		return nil
+	}
+
+	c.checksumMu.Lock()
+	defer c.checksumMu.Unlock()
+
+	if !c.checksumProbed {
+		c.checksumProbed = true
+		c.execAlgos = c.probeHashCommands(ctx)
+		c.checkFileAlgos = c.checkFileAlgorithms()
+	}
+
+	algos := append([]HashAlgorithm{}, c.execAlgos...)
+	for _, algo := range c.checkFileAlgos {
+		if !hasAlgorithm(algos, algo) {
+			algos = append(algos, algo)
+		}
+	}
+	return algos
+}
+
+// Checksum returns the digest of a remote file computed by the server.
+func (c *SFTPClient) Checksum(ctx context.Context, path string, algo HashAlgorithm) (string, error) {
+	if !c.IsConnected() {
+		return "", ErrNotConnected
+	}
+
+	c.ChecksumAlgorithms(ctx)
+
+	c.checksumMu.Lock()
+	useExec := hasAlgorithm(c.execAlgos, algo)
+	useCheckFile := hasAlgorithm(c.checkFileAlgos, algo)
+	c.checksumMu.Unlock()
+
+	switch {
+	case useExec:
+		return c.execChecksum(ctx, path, algo)
+	case useCheckFile:
+		sum, err := c.checkFileChecksum(ctx, path, algo)
+		if err == ErrChecksumUnsupported {
+			// The extension does not know this algorithm: stop asking for it
+			c.checksumMu.Lock()
+			c.checkFileAlgos = removeAlgorithm(c.checkFileAlgos, algo)
+			c.checksumMu.Unlock()
+		}
+		return sum, err
+	default:
+		return "", ErrChecksumUnsupported
+	}
+}
+
+// probeHashCommands runs the hash commands on empty input and returns the
+// algorithms whose command produced a valid digest.
+func (c *SFTPClient) probeHashCommands(ctx context.Context) []HashAlgorithm {
+	ctx, cancel := context.WithTimeout(ctx, checksumProbeTimeout)
+	defer cancel()
+
+	commands := make([]string, len(sftpHashCommands))
+	for i, hc := range sftpHashCommands {
+		commands[i] = hc.command + " /dev/null 2>/dev/null"
+	}
+
+	// A failing last command makes the session exit non-zero: only the output matters
+	output, _ := c.runCommand(ctx, strings.Join(commands, "; "))
+
+	var algos []HashAlgorithm
+	for _, line := range strings.Split(output, "\n") {
+		for _, hc := range sftpHashCommands {
+			digest, ok := parseHexDigest(line, hc.algo)
+			if ok && digest == emptyDigest(hc.algo) && !hasAlgorithm(algos, hc.algo) {
+				algos = append(algos, hc.algo)
+			}
+		}
+	}
+
+	// Keep the preferred order
+	var ordered []HashAlgorithm
+	for _, hc := range sftpHashCommands {
+		if hasAlgorithm(algos, hc.algo) {
+			ordered = append(ordered, hc.algo)
+		}
+	}
+	return ordered
+}
+
+// execChecksum hashes a file with the matching command over SSH exec.
+func (c *SFTPClient) execChecksum(ctx context.Context, path string, algo HashAlgorithm) (string, error) {
+	var command string
+	for _, hc := range sftpHashCommands {
+		if hc.algo == algo {
+			command = hc.command
+		}
+	}
+
+	output, err := c.runCommand(ctx, command+" -- "+shellQuote(path))
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", command, err)
+	}
+
+	digest, ok := parseHexDigest(output, algo)
+	if !ok {
+		return "", fmt.Errorf("unexpected %s output: %q", command, strings.TrimSpace(output))
+	}
+	return digest, nil
+}
+
+// runCommand runs a command in an SSH exec session and returns its output.
+func (c *SFTPClient) runCommand(ctx context.Context, command string) (string, error) {
+	client, err := c.sshConn()
+	if err != nil {
+		return "", err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := session.Output(command)
+		done <- result{output, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Close()
+		return "", ctx.Err()
+	case r := <-done:
+		return string(r.output), r.err
+	}
+}
+
+// checkFileAlgorithms returns the algorithms offered by the "check-file"
+// extension, or nil if the server does not advertise it.
+func (c *SFTPClient) checkFileAlgorithms() []HashAlgorithm {
+	client, err := c.sftpConn()
+	if err != nil {
+		return nil
+	}
+	data, ok := client.HasExtension("check-file")
+	if !ok {
+		return nil
+	}
+
+	// Some servers list their algorithms in the extension data
+	var algos []HashAlgorithm
+	for _, name := range strings.Split(data, ",") {
+		algo := HashAlgorithm(strings.TrimSpace(name))
+		if _, err := NewHash(algo); err == nil {
+			algos = append(algos, algo)
+		}
+	}
+	if len(algos) > 0 {
+		return algos
+	}
+
+	// Unknown: try them all, unsupported ones are dropped on first use
+	for _, hc := range sftpHashCommands {
+		algos = append(algos, hc.algo)
+	}
+	return algos
+}
+
+// checkFileChecksum hashes a file with the "check-file-name" SFTP extension.
+// pkg/sftp cannot send arbitrary extended requests, so the exchange runs on
+// a dedicated SFTP channel.
+func (c *SFTPClient) checkFileChecksum(ctx context.Context, path string, algo HashAlgorithm) (string, error) {
+	client, err := c.sshConn()
+	if err != nil {
+		return "", err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return "", fmt.Errorf("failed to start SFTP subsystem: %w", err)
+	}
+
+	type result struct {
+		digest string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		digest, err := checkFileExchange(stdin, bufio.NewReader(stdout), path, algo)
+		done <- result{digest, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Close()
+		return "", ctx.Err()
+	case r := <-done:
+		return r.digest, r.err
+	}
+}
+
+// checkFileExchange performs the SFTP version handshake and a single
+// check-file-name request for the whole file.
+func checkFileExchange(w io.Writer, r io.Reader, path string, algo HashAlgorithm) (string, error) {
+	// SSH_FXP_INIT, version 3
+	if err := writeSFTPPacket(w, sshFxpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return "", err
+	}
+	if typ, _, err := readSFTPPacket(r); err != nil {
+		return "", err
+	} else if typ != sshFxpVersion {
+		return "", fmt.Errorf("unexpected SFTP packet type %d", typ)
+	}
+
+	// SSH_FXP_EXTENDED "check-file-name": whole file, a single hash
+	const requestID = 1
+	payload := binary.BigEndian.AppendUint32(nil, requestID)
+	payload = appendSFTPString(payload, "check-file-name")
+	payload = appendSFTPString(payload, path)
+	payload = appendSFTPString(payload, string(algo))
+	payload = binary.BigEndian.AppendUint64(payload, 0) // start offset
+	payload = binary.BigEndian.AppendUint64(payload, 0) // length, 0 = to end
+	payload = binary.BigEndian.AppendUint32(payload, 0) // block size, 0 = one hash
+	if err := writeSFTPPacket(w, sshFxpExtended, payload); err != nil {
+		return "", err
+	}
+
+	typ, data, err := readSFTPPacket(r)
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case sshFxpStatus:
+		// SSH_FX_OP_UNSUPPORTED or an unknown algorithm
+		return "", ErrChecksumUnsupported
+	case sshFxpExtendedReply:
+	default:
+		return "", fmt.Errorf("unexpected SFTP packet type %d", typ)
+	}
+
+	// uint32 id, string "check-file", string algorithm used, hash bytes
+	if len(data) < 4 {
+		return "", fmt.Errorf("short check-file reply")
+	}
+	data = data[4:]
+	if _, data, err = readSFTPString(data); err != nil {
+		return "", err
+	}
+	used, hashBytes, err := readSFTPString(data)
+	if err != nil {
+		return "", err
+	}
+	if HashAlgorithm(used) != algo {
+		return "", ErrChecksumUnsupported
+	}
+
+	h, _ := NewHash(algo)
+	if len(hashBytes) != h.Size() {
+		return "", fmt.Errorf("invalid check-file hash length %d", len(hashBytes))
+	}
+	return hex.EncodeToString(hashBytes), nil
+}
+
+// writeSFTPPacket writes a length-prefixed SFTP packet.
+func writeSFTPPacket(w io.Writer, typ byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, typ)
+	packet = append(packet, payload...)
+	_, err := w.Write(packet)
+	return err
+}
+
+// readSFTPPacket reads a length-prefixed SFTP packet.
+func readSFTPPacket(r io.Reader) (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length < 1 || length > 256*1024 {
+		return 0, nil, fmt.Errorf("invalid SFTP packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, nil, err
+	}
+	return packet[0], packet[1:], nil
+}
+
+// appendSFTPString appends an SFTP string (uint32 length and bytes).
+func appendSFTPString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// readSFTPString reads an SFTP string and returns it with the remaining data.
+func readSFTPString(b []byte) (string, []byte, error) {
+	if len(b) < 4 {
+		return "", nil, fmt.Errorf("short SFTP string")
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return "", nil, fmt.Errorf("short SFTP string")
+	}
+	return string(b[4 : 4+n]), b[4+n:], nil
+}
+
+// emptyDigest returns the digest of empty input for algo.
+func emptyDigest(algo HashAlgorithm) string {
+	h, err := NewHash(algo)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// removeAlgorithm returns algos without algo.
+func removeAlgorithm(algos []HashAlgorithm, algo HashAlgorithm) []HashAlgorithm {
+	result := make([]HashAlgorithm, 0, len(algos))
+	for _, a := range algos {
+		if a != algo {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
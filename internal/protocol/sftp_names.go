@@ -0,0 +1,124 @@
+// Package protocol provides the owner and group names of SFTP files.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// nameLookupTimeout bounds the exec session resolving owner and group names.
+const nameLookupTimeout = 10 * time.Second
+
+// resolveOwners sets the Owner and Group of files from their numeric IDs.
+// SFTP only gives IDs: names are looked up with getent over SSH exec, once
+// per ID and connection. Without a shell, as on SFTP-only accounts, or for
+// IDs without a name, the IDs are shown instead.
+func (c *SFTPClient) resolveOwners(ctx context.Context, files []FileInfo) {
+	c.namesMu.Lock()
+	defer c.namesMu.Unlock()
+
+	if c.userNames == nil {
+		c.userNames = make(map[int]string)
+		c.groupNames = make(map[int]string)
+	}
+
+	uids := unknownIDs(files, c.userNames, func(f FileInfo) int { return f.UID })
+	gids := unknownIDs(files, c.groupNames, func(f FileInfo) int { return f.GID })
+	if len(uids)+len(gids) > 0 && !c.namesUnavailable {
+		c.lookupNames(ctx, uids, gids)
+	}
+
+	for i := range files {
+		if files[i].UID >= 0 {
+			files[i].Owner = idName(c.userNames, files[i].UID)
+		}
+		if files[i].GID >= 0 {
+			files[i].Group = idName(c.groupNames, files[i].GID)
+		}
+	}
+}
+
+// unknownIDs returns the IDs of files not yet in names.
+func unknownIDs(files []FileInfo, names map[int]string, id func(FileInfo) int) []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, f := range files {
+		n := id(f)
+		if _, known := names[n]; known || n < 0 || seen[n] {
+			continue
+		}
+		seen[n] = true
+		ids = append(ids, n)
+	}
+	return ids
+}
+
+// idName returns the name of id, or id itself if it has none.
+func idName(names map[int]string, id int) string {
+	if name := names[id]; name != "" {
+		return name
+	}
+	return strconv.Itoa(id)
+}
+
+// lookupNames runs getent for the given user and group IDs and records their
+// names. IDs without a name are recorded too, so they are not looked up again.
+func (c *SFTPClient) lookupNames(ctx context.Context, uids, gids []int) {
+	for _, id := range uids {
+		c.userNames[id] = ""
+	}
+	for _, id := range gids {
+		c.groupNames[id] = ""
+	}
+
+	var commands []string
+	if len(uids) > 0 {
+		commands = append(commands, "getent passwd "+joinIDs(uids)+" 2>/dev/null")
+	}
+	if len(gids) > 0 {
+		commands = append(commands, "getent group "+joinIDs(gids)+" 2>/dev/null")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, nameLookupTimeout)
+	defer cancel()
+
+	// getent exits non-zero if an ID has no name: only the output matters,
+	// unless the server refused the session
+	output, err := c.runCommand(ctx, strings.Join(commands, "; "))
+	var exitErr *ssh.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		c.namesUnavailable = true
+		return
+	}
+
+	// passwd entries have seven fields, group entries four
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 7 && len(fields) != 4 {
+			continue
+		}
+		id, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		if len(fields) == 7 {
+			c.userNames[id] = fields[0]
+		} else {
+			c.groupNames[id] = fields[0]
+		}
+	}
+}
+
+// joinIDs returns ids separated by spaces.
+func joinIDs(ids []int) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.Itoa(id)
+	}
+	return strings.Join(strs, " ")
+}
@@ -0,0 +1,407 @@
+// Package protocol provides SSH authentication with agents, encrypted keys
+// and certificates.
+package protocol
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSH authentication methods for ConnectionConfig.AuthMethods.
+const (
+	AuthPublicKey           = "publickey" // PrivateKey and IdentityFiles
+	AuthAgent               = "agent"     // Keys held by the agent at SSH_AUTH_SOCK
+	AuthKeyboardInteractive = "keyboard-interactive"
+	AuthPassword            = "password"
+)
+
+// DefaultAuthMethods is the order used when ConnectionConfig.AuthMethods is
+// empty. Like OpenSSH, key files come first, then the agent's other keys,
+// then server prompts such as one-time passwords, then the password.
+var DefaultAuthMethods = []string{AuthPublicKey, AuthAgent, AuthKeyboardInteractive, AuthPassword}
+
+// IsAuthMethod reports whether name is a supported SSH authentication method.
+func IsAuthMethod(name string) bool {
+	return containsString(DefaultAuthMethods, name)
+}
+
+// PassphraseCallback returns the passphrase of the encrypted private key at
+// keyPath (empty for ConnectionConfig.PrivateKey). It is called only once the
+// server accepts the key; retry is true when the previous passphrase was wrong.
+type PassphraseCallback func(keyPath string, retry bool) ([]byte, error)
+
+// ChallengeCallback answers the questions of a keyboard-interactive round,
+// such as a one-time password, in order. name and instruction come from the
+// server and may be empty; echos tells whether each answer may be shown as
+// it is typed. It is also used to ask for a password the config lacks.
+type ChallengeCallback func(name, instruction string, questions []string, echos []bool) ([]string, error)
+
+// maxPassphraseAttempts is the number of passphrases tried per key, as in OpenSSH.
+const maxPassphraseAttempts = 3
+
+// maxChallengeAttempts is the number of times a prompted password or
+// keyboard-interactive round is tried, as in OpenSSH.
+const maxChallengeAttempts = 3
+
+// sshAuth holds the authentication methods of a connection and the agent
+// connection their signers depend on until the handshake is over.
+type sshAuth struct {
+	methods   []ssh.AuthMethod
+	agentConn net.Conn
+}
+
+// Close closes the agent connection, if any.
+func (a *sshAuth) Close() {
+	if a.agentConn != nil {
+		a.agentConn.Close()
+	}
+}
+
+// newSSHAuth builds the authentication methods of config in the order of
+// config.AuthMethods. Agent keys and key files are offered together by a
+// single "publickey" method, in the order their entries appear. Servers
+// requiring several methods in sequence get the next one they accept.
+func newSSHAuth(config *ConnectionConfig) (*sshAuth, error) {
+	order := config.AuthMethods
+	if len(order) == 0 {
+		order = DefaultAuthMethods
+	}
+
+	auth := &sshAuth{}
+	var agentSigners []ssh.Signer
+	var agentErr error
+	if containsString(order, AuthAgent) {
+		agentSigners, agentErr = auth.dialAgent()
+	}
+
+	var signers []ssh.Signer
+	offered := make(map[string]bool)
+	offer := func(signer ssh.Signer) {
+		key := string(signer.PublicKey().Marshal())
+		if !offered[key] {
+			offered[key] = true
+			signers = append(signers, signer)
+		}
+	}
+
+	// Key files; IdentitiesOnly also restricts agent keys to them
+	var identities []ssh.Signer
+	identityKeys := make(map[string]bool)
+	if containsString(order, AuthPublicKey) || config.IdentitiesOnly {
+		var err error
+		if identities, err = loadIdentities(config, agentSigners); err != nil {
+			auth.Close()
+			return nil, err
+		}
+		for _, signer := range identities {
+			identityKeys[string(signer.PublicKey().Marshal())] = true
+		}
+	}
+
+	publicKeyAdded := false
+	for _, method := range order {
+		switch method {
+		case AuthPublicKey, AuthAgent:
+			if method == AuthPublicKey {
+				for _, signer := range identities {
+					offer(signer)
+				}
+			} else {
+				for _, signer := range agentSigners {
+					if config.IdentitiesOnly && !identityKeys[string(signer.PublicKey().Marshal())] {
+						continue
+					}
+					offer(signer)
+				}
+			}
+
+			if !publicKeyAdded {
+				publicKeyAdded = true
+				auth.methods = append(auth.methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+					return signers, nil
+				}))
+			}
+		case AuthKeyboardInteractive:
+			if config.Challenge != nil || config.Password != "" {
+				auth.methods = append(auth.methods, ssh.RetryableAuthMethod(
+					ssh.KeyboardInteractive(keyboardInteractive(config)), maxChallengeAttempts))
+			}
+		case AuthPassword:
+			if config.Password != "" {
+				auth.methods = append(auth.methods, ssh.Password(config.Password))
+			} else if config.Challenge != nil {
+				auth.methods = append(auth.methods, ssh.RetryableAuthMethod(
+					ssh.PasswordCallback(askPassword(config)), maxChallengeAttempts))
+			}
+		default:
+			auth.Close()
+			return nil, fmt.Errorf("unknown SSH authentication method: %s", method)
+		}
+	}
+
+	if len(signers) == 0 && config.Password == "" && config.Challenge == nil {
+		auth.Close()
+		if agentErr != nil {
+			return nil, fmt.Errorf("no authentication method provided: %w", agentErr)
+		}
+		return nil, fmt.Errorf("no authentication method provided")
+	}
+
+	return auth, nil
+}
+
+// keyboardInteractive answers keyboard-interactive rounds with
+// config.Challenge. A lone hidden password question, as PAM asks, is answered
+// with config.Password until the server asks it twice in a row, which means
+// it was rejected.
+func keyboardInteractive(config *ConnectionConfig) ssh.KeyboardInteractiveChallenge {
+	passwordSent, passwordRejected := false, false
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		// Servers may send empty rounds, e.g. before or after a banner
+		if len(questions) == 0 {
+			return nil, nil
+		}
+
+		isPassword := len(questions) == 1 && !echos[0] &&
+			strings.Contains(strings.ToLower(questions[0]), "password")
+		if isPassword && passwordSent {
+			passwordRejected = true
+		}
+		passwordSent = false
+		if isPassword && config.Password != "" && !passwordRejected {
+			passwordSent = true
+			return []string{config.Password}, nil
+		}
+
+		if config.Challenge == nil {
+			return nil, fmt.Errorf("the server asks %q and no prompt is available", questions[0])
+		}
+		answers, err := config.Challenge(name, instruction, questions, echos)
+		if err == nil && len(answers) != len(questions) {
+			err = fmt.Errorf("expected %d answers, got %d", len(questions), len(answers))
+		}
+		return answers, err
+	}
+}
+
+// askPassword returns a password callback asking config.Challenge for it.
+// The question names the account, which tells jump hosts apart.
+func askPassword(config *ConnectionConfig) func() (string, error) {
+	question := fmt.Sprintf("%s@%s's password: ", config.Username, config.Host)
+	return func() (string, error) {
+		answers, err := config.Challenge("", "", []string{question}, []bool{false})
+		if err != nil {
+			return "", err
+		}
+		if len(answers) != 1 {
+			return "", fmt.Errorf("expected 1 answer, got %d", len(answers))
+		}
+		return answers[0], nil
+	}
+}
+
+// dialAgent connects to the agent at SSH_AUTH_SOCK and returns its keys.
+func (a *sshAuth) dialAgent() ([]ssh.Signer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to list SSH agent keys: %w", err)
+	}
+
+	a.agentConn = conn
+	return signers, nil
+}
+
+// loadIdentities returns the signers of config.PrivateKey and of
+// config.IdentityFiles, in order. Keys also held by the agent are used
+// through it, so that their passphrase is not needed.
+func loadIdentities(config *ConnectionConfig, agentSigners []ssh.Signer) ([]ssh.Signer, error) {
+	var signers []ssh.Signer
+
+	if len(config.PrivateKey) > 0 {
+		keySigners, err := identitySigners("", config.PrivateKey, config.Passphrase, agentSigners)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, keySigners...)
+	}
+
+	for _, keyPath := range config.IdentityFiles {
+		keyData, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		keySigners, err := identitySigners(keyPath, keyData, config.Passphrase, agentSigners)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, keySigners...)
+	}
+
+	return signers, nil
+}
+
+// identitySigners returns the signers of one private key: its OpenSSH
+// certificate first if a "-cert.pub" file sits next to it, then the key.
+func identitySigners(keyPath string, keyData []byte, passphrase PassphraseCallback, agentSigners []ssh.Signer) ([]ssh.Signer, error) {
+	name := keyPath
+	if name == "" {
+		name = "(profile key)"
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyData)
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case err == nil:
+	case errors.As(err, &missing):
+		pub := missing.PublicKey
+		if pub == nil && keyPath != "" {
+			pub = readPublicKey(keyPath + ".pub")
+		}
+
+		if agentSigner := findSigner(agentSigners, pub); agentSigner != nil {
+			signer = agentSigner
+		} else if pub != nil {
+			signer = &encryptedKeySigner{path: keyPath, name: name, data: keyData, pub: pub, passphrase: passphrase}
+		} else if signer, err = decryptKey(keyPath, name, keyData, passphrase); err != nil {
+			// The public key is unknown: it cannot be offered before decryption
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to parse private key %s: %w", name, err)
+	}
+
+	signers := []ssh.Signer{signer}
+	if keyPath != "" {
+		if cert := readCertificate(keyPath + "-cert.pub"); cert != nil {
+			certSigner, err := ssh.NewCertSigner(cert, signer)
+			if err != nil {
+				return nil, fmt.Errorf("certificate %s-cert.pub: %w", keyPath, err)
+			}
+			signers = append([]ssh.Signer{certSigner}, signers...)
+		}
+	}
+
+	return signers, nil
+}
+
+// decryptKey asks for the passphrase of an encrypted key until it is right,
+// up to maxPassphraseAttempts times.
+func decryptKey(keyPath, name string, keyData []byte, passphrase PassphraseCallback) (ssh.Signer, error) {
+	if passphrase == nil {
+		return nil, fmt.Errorf("private key %s is encrypted and no passphrase was provided", name)
+	}
+
+	for attempt := 1; ; attempt++ {
+		pass, err := passphrase(keyPath, attempt > 1)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(keyData, pass)
+		if err == nil {
+			return signer, nil
+		}
+		if !errors.Is(err, x509.IncorrectPasswordError) || attempt == maxPassphraseAttempts {
+			return nil, fmt.Errorf("failed to decrypt private key %s: %w", name, err)
+		}
+	}
+}
+
+// encryptedKeySigner decrypts a passphrase-protected key the first time it
+// signs, so that the passphrase is only asked for keys the server accepts.
+type encryptedKeySigner struct {
+	path       string
+	name       string
+	data       []byte
+	pub        ssh.PublicKey
+	passphrase PassphraseCallback
+
+	once   sync.Once
+	signer ssh.Signer
+	err    error
+}
+
+func (s *encryptedKeySigner) PublicKey() ssh.PublicKey {
+	return s.pub
+}
+
+func (s *encryptedKeySigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *encryptedKeySigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.once.Do(func() {
+		s.signer, s.err = decryptKey(s.path, s.name, s.data, s.passphrase)
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	if as, ok := s.signer.(ssh.AlgorithmSigner); ok {
+		return as.SignWithAlgorithm(rand, data, algorithm)
+	}
+	return s.signer.Sign(rand, data)
+}
+
+// findSigner returns the signer of pub among signers, or nil.
+func findSigner(signers []ssh.Signer, pub ssh.PublicKey) ssh.Signer {
+	if pub == nil {
+		return nil
+	}
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+			return signer
+		}
+	}
+	return nil
+}
+
+// readPublicKey parses an authorized_keys style public key file, or returns nil.
+func readPublicKey(path string) ssh.PublicKey {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil
+	}
+	return pub
+}
+
+// readCertificate parses an OpenSSH certificate file, or returns nil.
+func readCertificate(path string) *ssh.Certificate {
+	cert, _ := readPublicKey(path).(*ssh.Certificate)
+	return cert
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
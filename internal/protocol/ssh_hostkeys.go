@@ -0,0 +1,120 @@
+// Package protocol provides OpenSSH's host key rotation extension.
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Global requests of OpenSSH's host key rotation extension
+const (
+	requestHostKeys      = "hostkeys-00@openssh.com"
+	requestHostKeysProve = "hostkeys-prove-00@openssh.com"
+)
+
+// HostKeysCallback is called with every host key a server proved to hold
+// after authentication, to record keys added or retired by the server.
+type HostKeysCallback func(hostname string, remote net.Addr, keys []ssh.PublicKey) error
+
+// watchHostKeys returns the global requests of conn, except the
+// hostkeys-00@openssh.com announcements sent by OpenSSH servers after
+// authentication. The announced keys are passed to callback once the server
+// proved it holds them.
+func watchHostKeys(conn ssh.Conn, reqs <-chan *ssh.Request, hostname string, remote net.Addr, callback HostKeysCallback) <-chan *ssh.Request {
+	out := make(chan *ssh.Request)
+	go func() {
+		defer close(out)
+		for req := range reqs {
+			if req.Type != requestHostKeys {
+				out <- req
+				continue
+			}
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+
+			// Proving needs a round trip on the connection being set up
+			payload := req.Payload
+			go func() {
+				if keys, err := proveHostKeys(conn, payload); err == nil && len(keys) > 0 {
+					callback(hostname, remote, keys)
+				}
+			}()
+		}
+	}()
+	return out
+}
+
+// proveHostKeys asks the server to sign the session ID with each announced
+// host key and returns the keys whose signature is valid. Keys of
+// unsupported types are ignored.
+func proveHostKeys(conn ssh.Conn, payload []byte) ([]ssh.PublicKey, error) {
+	blobs, err := parseSSHStrings(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s request: %w", requestHostKeys, err)
+	}
+
+	var keys []ssh.PublicKey
+	var request []byte
+	for _, blob := range blobs {
+		key, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+		request = append(request, ssh.Marshal(struct{ Blob []byte }{blob})...)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	ok, reply, err := conn.SendRequest(requestHostKeysProve, true, request)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("server refused to prove its host keys")
+	}
+
+	signatures, err := parseSSHStrings(reply)
+	if err != nil || len(signatures) != len(keys) {
+		return nil, fmt.Errorf("invalid %s reply", requestHostKeysProve)
+	}
+
+	for i, key := range keys {
+		signature := new(ssh.Signature)
+		if err := ssh.Unmarshal(signatures[i], signature); err != nil {
+			return nil, fmt.Errorf("invalid host key signature: %w", err)
+		}
+		signed := ssh.Marshal(struct {
+			Request   string
+			SessionID []byte
+			Blob      []byte
+		}{requestHostKeysProve, conn.SessionID(), key.Marshal()})
+		if err := key.Verify(signed, signature); err != nil {
+			return nil, fmt.Errorf("host key %s not proved: %w", key.Type(), err)
+		}
+	}
+	return keys, nil
+}
+
+// parseSSHStrings splits data into the length-prefixed strings it is made of.
+func parseSSHStrings(data []byte) ([][]byte, error) {
+	var strs [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated string length")
+		}
+		n := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return nil, fmt.Errorf("truncated string")
+		}
+		strs = append(strs, data[:n])
+		data = data[n:]
+	}
+	return strs, nil
+}
@@ -0,0 +1,71 @@
+// Package protocol provides SSH jump host chaining for SFTP connections.
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialFunc opens a network connection, as net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// dialJumpHosts connects to each of hops in turn, the first one with dial and
+// the next ones through the previous hop, as OpenSSH's ProxyJump. Each hop
+// verifies its own host key and uses its own credentials. The chain is flat:
+// the JumpHosts of hops are ignored.
+func dialJumpHosts(ctx context.Context, dial dialFunc, hops []*ConnectionConfig) ([]*ssh.Client, error) {
+	var jumps []*ssh.Client
+	for _, hop := range hops {
+		client, err := dialSSH(ctx, dial, hop)
+		if err != nil {
+			closeJumpHosts(jumps)
+			return nil, fmt.Errorf("jump host %s: %w", hop.Host, err)
+		}
+		jumps = append(jumps, client)
+		dial = jumpDialer(client)
+	}
+	return jumps, nil
+}
+
+// jumpDialer returns a dialFunc opening connections from the jump host of
+// client.
+func jumpDialer(client *ssh.Client) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+
+		// ssh.Client.Dial cannot be cancelled, wait for it in the background
+		done := make(chan result, 1)
+		go func() {
+			conn, err := client.Dial(network, address)
+			if err == nil {
+				conn = &addrConn{Conn: conn, remote: tcpAddr(address)}
+			}
+			done <- result{conn, err}
+		}()
+
+		select {
+		case r := <-done:
+			return r.conn, r.err
+		case <-ctx.Done():
+			go func() {
+				if r := <-done; r.conn != nil {
+					r.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// closeJumpHosts closes the connections to jump hosts, last hop first.
+func closeJumpHosts(jumps []*ssh.Client) {
+	for i := len(jumps) - 1; i >= 0; i-- {
+		jumps[i].Close()
+	}
+}
@@ -0,0 +1,313 @@
+// Package protocol provides recursive operations on remote directory trees.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+// DefaultTreeWorkers is the number of concurrent requests used by tree
+// operations on clients that can serve several at once.
+const DefaultTreeWorkers = 8
+
+// ErrNotSupported is returned for operations the server does not provide.
+var ErrNotSupported = errors.New("operation not supported by the server")
+
+// TreeStats counts the entries of a remote directory tree.
+type TreeStats struct {
+	Files int
+	Dirs  int // Not counting the root
+	Bytes int64
+}
+
+// treeEntry is a path found below the root of a tree.
+type treeEntry struct {
+	path   string
+	isDir  bool
+	isLink bool // Symbolic link, never followed
+	depth  int  // 1 for the children of the root
+}
+
+// TreeWorkers returns the number of concurrent requests to use with client.
+// FTP has a single control connection, so its requests are serialized.
+func TreeWorkers(client Protocol) int {
+	if _, ok := client.(*FTPSClient); ok {
+		return 1
+	}
+	return DefaultTreeWorkers
+}
+
+// TreeSize lists root recursively and counts its files, directories and bytes.
+// Symbolic links are counted as files and not followed.
+func TreeSize(ctx context.Context, client Protocol, root string, workers int) (TreeStats, error) {
+	if isLinkPath(ctx, client, root) {
+		return TreeStats{Files: 1}, nil
+	}
+	_, stats, err := scanTree(ctx, client, root, workers)
+	return stats, err
+}
+
+// RemoveTree deletes root and everything below it: files first, then
+// directories from the deepest up. progress, if not nil, is called after each
+// removal with the number of entries removed and the total (root included).
+// Symbolic links are removed, not the directories they point to.
+func RemoveTree(ctx context.Context, client Protocol, root string, workers int, progress func(done, total int)) error {
+	if isLinkPath(ctx, client, root) {
+		if err := client.Remove(ctx, root); err != nil {
+			return err
+		}
+		newTreeProgress(1, progress).step()
+		return nil
+	}
+
+	entries, _, err := scanTree(ctx, client, root, workers)
+	if err != nil {
+		return err
+	}
+
+	// Directories must be empty before they are removed, so they go level by
+	// level; entries of the same level are independent
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].isDir != entries[j].isDir {
+			return !entries[i].isDir
+		}
+		return entries[i].depth > entries[j].depth
+	})
+
+	counter := newTreeProgress(len(entries)+1, progress)
+	for start := 0; start < len(entries); {
+		end := start + 1
+		for end < len(entries) && entries[end].isDir == entries[start].isDir &&
+			(!entries[start].isDir || entries[end].depth == entries[start].depth) {
+			end++
+		}
+
+		err := forEachEntry(ctx, entries[start:end], workers, func(entry treeEntry) error {
+			if entry.isDir {
+				return client.RemoveDir(ctx, entry.path)
+			}
+			return client.Remove(ctx, entry.path)
+		}, counter)
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+
+	if err := client.RemoveDir(ctx, root); err != nil {
+		return err
+	}
+	counter.step()
+	return nil
+}
+
+// ChmodTree changes the permissions of root and everything below it, using
+// dirMode for directories and fileMode for files. Symbolic links below root
+// are skipped, as changing them would change their target.
+func ChmodTree(ctx context.Context, client Protocol, root string, fileMode, dirMode os.FileMode, workers int, progress func(done, total int)) error {
+	return applyTree(ctx, client, root, workers, progress, func(entry treeEntry) error {
+		if entry.isDir {
+			return client.Chmod(ctx, entry.path, dirMode)
+		}
+		return client.Chmod(ctx, entry.path, fileMode)
+	})
+}
+
+// ChownTree changes the owner and group of root and everything below it,
+// skipping symbolic links.
+func ChownTree(ctx context.Context, client Protocol, root string, uid, gid int, workers int, progress func(done, total int)) error {
+	return applyTree(ctx, client, root, workers, progress, func(entry treeEntry) error {
+		return client.Chown(ctx, entry.path, uid, gid)
+	})
+}
+
+// applyTree calls fn for root and every entry below it but symbolic links.
+// If root itself is a link, fn is only called for it.
+func applyTree(ctx context.Context, client Protocol, root string, workers int, progress func(done, total int), fn func(treeEntry) error) error {
+	if isLinkPath(ctx, client, root) {
+		return forEachEntry(ctx, []treeEntry{{path: root, isLink: true}}, 1, fn, newTreeProgress(1, progress))
+	}
+
+	scanned, _, err := scanTree(ctx, client, root, workers)
+	if err != nil {
+		return err
+	}
+	entries := make([]treeEntry, 0, len(scanned)+1)
+	for _, entry := range scanned {
+		if !entry.isLink {
+			entries = append(entries, entry)
+		}
+	}
+	entries = append(entries, treeEntry{path: root, isDir: true})
+
+	return forEachEntry(ctx, entries, workers, fn, newTreeProgress(len(entries), progress))
+}
+
+// isLink tells whether file is a symbolic link. Some FTP servers describe a
+// link to a directory as a directory in MLSD, and only give its target.
+func isLink(file *FileInfo) bool {
+	return file.IsSymlink || file.LinkTarget != ""
+}
+
+// isLinkPath tells whether path is a symbolic link. Stat errors are left to
+// the operation itself.
+func isLinkPath(ctx context.Context, client Protocol, path string) bool {
+	info, err := client.Stat(ctx, path)
+	return err == nil && isLink(info)
+}
+
+// scanTree lists root recursively, with up to workers List requests at once.
+// Symbolic links are listed as files and not followed.
+func scanTree(ctx context.Context, client Protocol, root string, workers int) ([]treeEntry, TreeStats, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		entries []treeEntry
+		stats   TreeStats
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, workers)
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	var list func(dir string, depth int)
+	list = func(dir string, depth int) {
+		defer wg.Done()
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(ctx.Err())
+			return
+		}
+		files, err := client.List(ctx, dir)
+		<-sem
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, file := range files {
+			if file.Name == "." || file.Name == ".." {
+				continue
+			}
+
+			link := isLink(&file)
+			entry := treeEntry{path: path.Join(dir, file.Name), isDir: file.IsDir && !link, isLink: link, depth: depth}
+			entries = append(entries, entry)
+			if entry.isDir {
+				stats.Dirs++
+				wg.Add(1)
+				go list(entry.path, depth+1)
+			} else {
+				stats.Files++
+				stats.Bytes += file.Size
+			}
+		}
+	}
+
+	wg.Add(1)
+	go list(root, 1)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, TreeStats{}, firstErr
+	}
+	return entries, stats, nil
+}
+
+// forEachEntry calls fn for each entry with up to workers calls at once. It
+// stops at the first error or when ctx is cancelled.
+func forEachEntry(ctx context.Context, entries []treeEntry, workers int, fn func(treeEntry) error, counter *treeProgress) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		firstErr error
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan treeEntry)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				if err := fn(entry); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("%s: %w", entry.path, err)
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				counter.step()
+			}
+		}()
+	}
+
+feed:
+	for _, entry := range entries {
+		select {
+		case jobs <- entry:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// treeProgress reports the progress of a tree operation.
+type treeProgress struct {
+	mu    sync.Mutex
+	done  int
+	total int
+	fn    func(done, total int)
+}
+
+func newTreeProgress(total int, fn func(done, total int)) *treeProgress {
+	return &treeProgress{total: total, fn: fn}
+}
+
+// step counts one more processed entry. Calls to fn are serialized.
+func (p *treeProgress) step() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	if p.fn != nil {
+		p.fn(p.done, p.total)
+	}
+}
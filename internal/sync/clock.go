@@ -0,0 +1,335 @@
+package sync
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"secure-ftp/internal/protocol"
+	"secure-ftp/pkg/fileutil"
+)
+
+// DefaultModTimeTolerance is the difference below which modification times
+// are considered equal while the precision of a server is unknown.
+const DefaultModTimeTolerance = 2 * time.Second
+
+// clockProbeInterval is how long a measured server clock is trusted before
+// it is probed again.
+const clockProbeInterval = 24 * time.Hour
+
+// clockProbePrefix starts the name of the file written to probe a server.
+const clockProbePrefix = ".secure-ftp-clock-"
+
+// clockProbeTime returns the modification time given to the probe file. Its
+// odd second and fraction reveal how the server truncates or rounds times;
+// it is recent so that LIST output shows the time of day.
+func clockProbeTime() time.Time {
+	return time.Now().Add(-time.Hour).Truncate(time.Hour).Add(5*time.Minute + 7789*time.Millisecond)
+}
+
+// granularities are the timestamp precisions told apart, finest first: FAT
+// keeps even seconds and FTP LIST output shows minutes.
+var granularities = []time.Duration{
+	time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	time.Minute,
+}
+
+// minGranularitySamples is the number of timestamps needed before their
+// common precision is trusted.
+const minGranularitySamples = 8
+
+// ServerClock describes how the modification times reported by a server
+// relate to local ones. It is measured by writing a probe file before a
+// sync, and stored per server.
+type ServerClock struct {
+	// Server clock minus local clock, as seen in the modification times the
+	// server gives to files it writes
+	Skew time.Duration `json:"skew"`
+	// Added by the server to the modification times set by clients, such as
+	// by LIST output in the server's time zone
+	Offset time.Duration `json:"offset"`
+	// Precision of the modification times reported by the server
+	Granularity time.Duration `json:"granularity"`
+	// False if the server cannot set modification times
+	SetsModTime bool      `json:"sets_mod_time"`
+	Measured    time.Time `json:"measured"`
+
+	path string
+}
+
+// ClockPath returns the file storing the clock of the given server.
+func ClockPath(stateDir, server string) string {
+	sum := sha256.Sum256([]byte(server))
+	return filepath.Join(stateDir, "clock-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// LoadServerClock reads the server clock stored at path.
+// A missing file yields an unmeasured clock.
+func LoadServerClock(path string) (*ServerClock, error) {
+	clock := &ServerClock{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return clock, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, clock); err != nil {
+		return nil, err
+	}
+	return clock, nil
+}
+
+// Save writes the clock to disk, replacing the file atomically.
+func (c *ServerClock) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.AtomicWriteFile(c.path, data, 0644)
+}
+
+// stale reports whether the clock must be measured again.
+func (c *ServerClock) stale() bool {
+	return time.Since(c.Measured) > clockProbeInterval
+}
+
+// Probe measures the clock of the server by writing a small file in
+// remoteDir, reading back the modification time the server gave it, setting
+// a known one and reading it back again. The file is removed afterwards.
+func (c *ServerClock) Probe(ctx context.Context, client protocol.Protocol, remoteDir string) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	probePath := filepath.Join(remoteDir, clockProbePrefix+hex.EncodeToString(suffix))
+
+	before := time.Now()
+	w, err := client.GetWriter(ctx, probePath, false)
+	if err != nil {
+		return fmt.Errorf("failed to write clock probe: %w", err)
+	}
+	defer client.Remove(ctx, probePath)
+	_, err = w.Write([]byte("clock probe\n"))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write clock probe: %w", err)
+	}
+	after := time.Now()
+
+	info, err := client.Stat(ctx, probePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat clock probe: %w", err)
+	}
+	written := before.Add(after.Sub(before) / 2)
+	reported := info.ModTime
+
+	probeTime := clockProbeTime()
+	err = client.Chtimes(ctx, probePath, probeTime, probeTime)
+	if errors.Is(err, protocol.ErrNotSupported) {
+		// Only files written by the server exist: their times follow its
+		// clock, whose skew also covers any time zone offset
+		c.Skew = reported.Sub(written).Round(time.Second)
+		c.Offset, c.Granularity, c.SetsModTime = 0, 0, false
+		c.Measured = time.Now()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set clock probe time: %w", err)
+	}
+
+	info, err = client.Stat(ctx, probePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat clock probe: %w", err)
+	}
+
+	// Time zone offsets are whole quarters of an hour; what remains comes
+	// from the precision of the server
+	diff := info.ModTime.Sub(probeTime)
+	offset := diff.Round(15 * time.Minute)
+	residual := diff - offset
+	if residual < 0 {
+		residual = -residual
+	}
+
+	c.Granularity = granularities[len(granularities)-1]
+	for _, g := range granularities {
+		if residual < g {
+			c.Granularity = g
+			break
+		}
+	}
+
+	// The reported write time was truncated to the granularity: the middle
+	// of that interval is the best estimate, and a skew within it cannot be
+	// told apart from none
+	c.Skew = reported.Add(c.Granularity / 2).Sub(written).Round(time.Second)
+	if c.Skew > -c.Granularity && c.Skew < c.Granularity {
+		c.Skew = 0
+	}
+	c.Offset, c.SetsModTime = offset, true
+	c.Measured = time.Now()
+	return nil
+}
+
+// inferGranularity returns the coarsest precision all times are multiples
+// of, or 0 if there are too few of them to tell.
+func inferGranularity(times []time.Time) time.Duration {
+	if len(times) < minGranularitySamples {
+		return 0
+	}
+
+	for i := len(granularities) - 1; i >= 0; i-- {
+		g := granularities[i]
+		aligned := true
+		for _, t := range times {
+			if !t.Truncate(g).Equal(t) {
+				aligned = false
+				break
+			}
+		}
+		if aligned {
+			return g
+		}
+	}
+	return 0
+}
+
+// loadClock loads the stored server clock on first use. Without a ClockPath
+// the clock lives as long as the Syncer.
+func (s *Syncer) loadClock() error {
+	if s.clock != nil {
+		return nil
+	}
+	if s.options.ClockPath == "" {
+		s.clock = &ServerClock{}
+		return nil
+	}
+
+	clock, err := LoadServerClock(s.options.ClockPath)
+	if err != nil {
+		return fmt.Errorf("failed to load server clock: %w", err)
+	}
+	s.clock = clock
+	return nil
+}
+
+// measureClock probes the server clock if it was never measured or not for
+// a long time. Failures only leave the previous measure in place.
+func (s *Syncer) measureClock(ctx context.Context, remoteDir string) {
+	if err := s.loadClock(); err != nil {
+		s.log.Warnf("%v", err)
+		return
+	}
+	if !s.clock.stale() {
+		return
+	}
+
+	if err := s.clock.Probe(ctx, s.client, remoteDir); err != nil {
+		s.log.Warnf("Failed to measure server clock: %v", err)
+		return
+	}
+	s.log.Debugf("Server clock: skew %v, offset %v, granularity %v, sets times %v",
+		s.clock.Skew, s.clock.Offset, s.clock.Granularity, s.clock.SetsModTime)
+
+	if s.options.ClockPath != "" {
+		if err := s.clock.Save(); err != nil {
+			s.log.Warnf("Failed to save server clock: %v", err)
+		}
+	}
+}
+
+// learnTolerance sets the difference below which modification times are
+// equal: the coarser precision of both sides, from the server clock or
+// otherwise from the times of the scanned files.
+func (s *Syncer) learnTolerance() {
+	localTimes := make([]time.Time, 0, len(s.localMap))
+	for _, info := range s.localMap {
+		localTimes = append(localTimes, info.ModTime())
+	}
+	remoteTimes := make([]time.Time, 0, len(s.remoteMap))
+	for _, info := range s.remoteMap {
+		remoteTimes = append(remoteTimes, info.ModTime)
+	}
+
+	remote := s.clock.Granularity
+	if remote == 0 {
+		remote = inferGranularity(remoteTimes)
+	}
+	if remote == 0 {
+		remote = DefaultModTimeTolerance
+	}
+
+	s.tolerance = remote
+	if local := inferGranularity(localTimes); local > s.tolerance {
+		s.tolerance = local
+	}
+}
+
+// sameModTime reports whether a local and a remote modification time are
+// equal within the precision of both sides, as after a transfer that copied
+// the time.
+func (s *Syncer) sameModTime(local, remote time.Time) bool {
+	diff := remote.Add(-s.clock.Offset).Sub(local)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= s.tolerance
+}
+
+// localNewer reports whether a local file was modified after a remote one,
+// reading the remote time on the local clock.
+func (s *Syncer) localNewer(local, remote time.Time) bool {
+	return local.After(remote.Add(-s.clock.Skew))
+}
+
+// remoteNewer reports whether a remote file was modified after a local one,
+// reading the remote time on the local clock.
+func (s *Syncer) remoteNewer(local, remote time.Time) bool {
+	return remote.Add(-s.clock.Skew).After(local)
+}
+
+// stampUpload gives the remote copy of an upload the modification time of
+// the local file, so that the next comparison finds them identical. Servers
+// known not to set times are left alone.
+func (s *Syncer) stampUpload(ctx context.Context, localPath, remotePath string) {
+	if !s.clock.SetsModTime && !s.clock.Measured.IsZero() {
+		return
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return
+	}
+
+	err = s.client.Chtimes(ctx, remotePath, time.Now(), info.ModTime())
+	if err != nil && !errors.Is(err, protocol.ErrNotSupported) {
+		s.log.Warnf("Failed to set modification time of %s: %v", remotePath, err)
+	}
+}
+
+// stampDownload gives the local copy of a download the modification time of
+// the remote file.
+func (s *Syncer) stampDownload(localPath string, remoteModTime time.Time) {
+	if remoteModTime.IsZero() {
+		return
+	}
+
+	if err := os.Chtimes(localPath, time.Now(), remoteModTime.Add(-s.clock.Offset)); err != nil {
+		s.log.Warnf("Failed to set modification time of %s: %v", localPath, err)
+	}
+}
@@ -0,0 +1,298 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"secure-ftp/internal/protocol"
+)
+
+// clockServer is a protocol.Protocol whose clock runs skew ahead of the local
+// one and whose modification times have the given granularity. Times set by
+// clients get offset added, as by a server listing times in its time zone.
+// Methods other than those used by ServerClock.Probe are not implemented.
+type clockServer struct {
+	protocol.Protocol
+	skew        time.Duration
+	offset      time.Duration
+	granularity time.Duration
+	noChtimes   bool
+
+	modTimes map[string]time.Time
+}
+
+func (c *clockServer) GetWriter(ctx context.Context, path string, append bool) (io.WriteCloser, error) {
+	return &clockWriter{server: c, path: path}, nil
+}
+
+func (c *clockServer) Stat(ctx context.Context, path string) (*protocol.FileInfo, error) {
+	modTime, ok := c.modTimes[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &protocol.FileInfo{Name: filepath.Base(path), ModTime: modTime}, nil
+}
+
+func (c *clockServer) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	if c.noChtimes {
+		return protocol.ErrNotSupported
+	}
+	c.modTimes[path] = mtime.Add(c.offset).Truncate(c.granularity)
+	return nil
+}
+
+func (c *clockServer) Remove(ctx context.Context, path string) error {
+	delete(c.modTimes, path)
+	return nil
+}
+
+// clockWriter stamps the file with the server clock when it is closed.
+type clockWriter struct {
+	bytes.Buffer
+	server *clockServer
+	path   string
+}
+
+func (w *clockWriter) Close() error {
+	w.server.modTimes[w.path] = time.Now().Add(w.server.skew).Truncate(w.server.granularity)
+	return nil
+}
+
+func TestServerClockProbe(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      clockServer
+		wantSkew    time.Duration
+		wantOffset  time.Duration
+		wantGranule time.Duration
+		wantSets    bool
+	}{
+		{
+			name:        "exact clock",
+			server:      clockServer{granularity: time.Nanosecond},
+			wantGranule: time.Millisecond,
+			wantSets:    true,
+		},
+		{
+			name:        "seconds, clock ahead",
+			server:      clockServer{skew: 90 * time.Second, granularity: time.Second},
+			wantSkew:    90 * time.Second,
+			wantGranule: time.Second,
+			wantSets:    true,
+		},
+		{
+			name:        "seconds, clock behind",
+			server:      clockServer{skew: -5 * time.Minute, granularity: time.Second},
+			wantSkew:    -5 * time.Minute,
+			wantGranule: time.Second,
+			wantSets:    true,
+		},
+		{
+			name:        "two seconds, as FAT",
+			server:      clockServer{skew: 10 * time.Second, granularity: 2 * time.Second},
+			wantSkew:    10 * time.Second,
+			wantGranule: 2 * time.Second,
+			wantSets:    true,
+		},
+		{
+			name:        "minutes, as LIST output",
+			server:      clockServer{skew: 10 * time.Minute, granularity: time.Minute},
+			wantSkew:    10 * time.Minute,
+			wantGranule: time.Minute,
+			wantSets:    true,
+		},
+		{
+			name:        "skew within the granularity",
+			server:      clockServer{skew: 20 * time.Second, granularity: time.Minute},
+			wantGranule: time.Minute,
+			wantSets:    true,
+		},
+		{
+			name:        "no skew at two seconds",
+			server:      clockServer{granularity: 2 * time.Second},
+			wantGranule: 2 * time.Second,
+			wantSets:    true,
+		},
+		{
+			name:        "time zone ahead",
+			server:      clockServer{offset: 2 * time.Hour, granularity: time.Minute},
+			wantOffset:  2 * time.Hour,
+			wantGranule: time.Minute,
+			wantSets:    true,
+		},
+		{
+			name:        "quarter-hour time zone behind",
+			server:      clockServer{skew: 3 * time.Minute, offset: -(3*time.Hour + 45*time.Minute), granularity: time.Second},
+			wantSkew:    3 * time.Minute,
+			wantOffset:  -(3*time.Hour + 45*time.Minute),
+			wantGranule: time.Second,
+			wantSets:    true,
+		},
+		{
+			name:     "times cannot be set",
+			server:   clockServer{skew: 42 * time.Second, granularity: time.Second, noChtimes: true},
+			wantSkew: 42 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.server
+			server.modTimes = make(map[string]time.Time)
+
+			var clock ServerClock
+			if err := clock.Probe(context.Background(), &server, "/data"); err != nil {
+				t.Fatal(err)
+			}
+
+			// The write time is only known within the granularity
+			margin := tt.wantGranule / 2
+			if margin < time.Second {
+				margin = time.Second
+			}
+			if diff := clock.Skew - tt.wantSkew; diff < -margin || diff > margin {
+				t.Errorf("Skew = %v, want %v ± %v", clock.Skew, tt.wantSkew, margin)
+			}
+			if clock.Offset != tt.wantOffset {
+				t.Errorf("Offset = %v, want %v", clock.Offset, tt.wantOffset)
+			}
+			if clock.Granularity != tt.wantGranule {
+				t.Errorf("Granularity = %v, want %v", clock.Granularity, tt.wantGranule)
+			}
+			if clock.SetsModTime != tt.wantSets {
+				t.Errorf("SetsModTime = %v, want %v", clock.SetsModTime, tt.wantSets)
+			}
+			if clock.Measured.IsZero() || clock.stale() {
+				t.Errorf("Measured = %v, want now", clock.Measured)
+			}
+			if len(server.modTimes) != 0 {
+				t.Errorf("probe file left on the server: %v", server.modTimes)
+			}
+		})
+	}
+}
+
+func TestInferGranularity(t *testing.T) {
+	base := time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC)
+
+	// times returns n times step apart, starting at base plus start
+	times := func(n int, start, step time.Duration) []time.Time {
+		var ts []time.Time
+		for i := 0; i < n; i++ {
+			ts = append(ts, base.Add(start+time.Duration(i)*step))
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  time.Duration
+	}{
+		{"too few times", times(minGranularitySamples-1, 0, time.Minute), 0},
+		{"minutes", times(10, 0, time.Hour+time.Minute), time.Minute},
+		{"even seconds", times(10, 0, 34*time.Second), 2 * time.Second},
+		{"seconds", times(10, time.Second, 34*time.Second), time.Second},
+		{"milliseconds", times(10, 0, 1500*time.Millisecond+time.Millisecond), time.Millisecond},
+		{"nanoseconds", times(10, time.Nanosecond, time.Second), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inferGranularity(tt.times); got != tt.want {
+				t.Errorf("inferGranularity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameModTime(t *testing.T) {
+	local := time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		offset    time.Duration
+		tolerance time.Duration
+		remote    time.Time
+		want      bool
+	}{
+		{"equal", 0, time.Second, local, true},
+		{"within the tolerance", 0, 2 * time.Second, local.Add(-2 * time.Second), true},
+		{"beyond the tolerance", 0, 2 * time.Second, local.Add(3 * time.Second), false},
+		{"truncated to the minute", 0, time.Minute, local.Truncate(time.Minute), true},
+		{"time zone offset", 2 * time.Hour, time.Second, local.Add(2 * time.Hour), true},
+		{"time zone offset not applied", 2 * time.Hour, time.Second, local, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Syncer{clock: &ServerClock{Offset: tt.offset}, tolerance: tt.tolerance}
+			if got := s.sameModTime(local, tt.remote); got != tt.want {
+				t.Errorf("sameModTime(%v, %v) = %v, want %v", local, tt.remote, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLearnTolerance(t *testing.T) {
+	base := time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC)
+
+	// modTimes returns n distinct times that are multiples of step
+	modTimes := func(n int, step time.Duration) []time.Time {
+		var ts []time.Time
+		for i := 0; i < n; i++ {
+			ts = append(ts, base.Add(time.Duration(2*i+1)*step))
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name        string
+		granularity time.Duration // Measured on the server
+		remote      []time.Time
+		local       []time.Time
+		want        time.Duration
+	}{
+		{"measured", time.Second, modTimes(10, time.Minute), modTimes(10, time.Millisecond+time.Nanosecond), time.Second},
+		{"inferred from remote times", 0, modTimes(10, time.Minute), modTimes(10, time.Millisecond+time.Nanosecond), time.Minute},
+		{"coarser local times", time.Second, nil, modTimes(10, 2*time.Second), 2 * time.Second},
+		{"unknown", 0, modTimes(3, time.Minute), nil, DefaultModTimeTolerance},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := &Syncer{
+				clock:     &ServerClock{Granularity: tt.granularity},
+				localMap:  make(map[string]os.FileInfo),
+				remoteMap: make(map[string]protocol.FileInfo),
+			}
+			for i, modTime := range tt.local {
+				localPath := filepath.Join(dir, string(rune('a'+i)))
+				writeFile(t, localPath, "x")
+				if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+				info, err := os.Stat(localPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.localMap[info.Name()] = info
+			}
+			for i, modTime := range tt.remote {
+				name := string(rune('a' + i))
+				s.remoteMap[name] = protocol.FileInfo{Name: name, ModTime: modTime}
+			}
+
+			s.learnTolerance()
+			if s.tolerance != tt.want {
+				t.Errorf("tolerance = %v, want %v", s.tolerance, tt.want)
+			}
+		})
+	}
+}
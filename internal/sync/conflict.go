@@ -0,0 +1,201 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"secure-ftp/internal/protocol"
+)
+
+// ConflictPolicy determines how a file changed on both sides is resolved.
+type ConflictPolicy int
+
+const (
+	// ConflictAsk leaves conflicts untouched so they can be reviewed.
+	ConflictAsk ConflictPolicy = iota
+	// ConflictKeepBoth renames the older copy to a conflict name and keeps both.
+	ConflictKeepBoth
+	// ConflictPreferLocal overwrites (or deletes) the remote copy.
+	ConflictPreferLocal
+	// ConflictPreferRemote overwrites (or deletes) the local copy.
+	ConflictPreferRemote
+	// ConflictPreferLarger keeps the larger copy, or both if sizes are equal.
+	ConflictPreferLarger
+)
+
+// String returns the policy name as used on the command line.
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictAsk:
+		return "ask"
+	case ConflictKeepBoth:
+		return "keep-both"
+	case ConflictPreferLocal:
+		return "local"
+	case ConflictPreferRemote:
+		return "remote"
+	case ConflictPreferLarger:
+		return "larger"
+	default:
+		return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+	}
+}
+
+// Conflict describes a file that changed on both sides since the last sync.
+type Conflict struct {
+	Path          string         `json:"path"` // Relative to the synced folders
+	LocalPath     string         `json:"local_path"`
+	RemotePath    string         `json:"remote_path"`
+	Reason        string         `json:"reason"`
+	LocalExists   bool           `json:"local_exists"`
+	LocalSize     int64          `json:"local_size,omitempty"`
+	LocalModTime  time.Time      `json:"local_mod_time,omitempty"`
+	RemoteExists  bool           `json:"remote_exists"`
+	RemoteSize    int64          `json:"remote_size,omitempty"`
+	RemoteModTime time.Time      `json:"remote_mod_time,omitempty"`
+	Resolution    ConflictPolicy `json:"resolution"` // ConflictAsk while unresolved
+}
+
+// newConflictAction returns an unresolved conflict action. Either info may be
+// nil when the file was deleted on that side.
+func newConflictAction(relPath, localPath, remotePath, reason string, localInfo os.FileInfo, remoteInfo *protocol.FileInfo) SyncAction {
+	c := &Conflict{
+		Path:       relPath,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Reason:     reason,
+	}
+	if localInfo != nil {
+		c.LocalExists = true
+		c.LocalSize = localInfo.Size()
+		c.LocalModTime = localInfo.ModTime()
+	}
+	if remoteInfo != nil {
+		c.RemoteExists = true
+		c.RemoteSize = remoteInfo.Size
+		c.RemoteModTime = remoteInfo.ModTime
+	}
+
+	return SyncAction{
+		Type:       "conflict",
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Reason:     reason,
+		Conflict:   c,
+	}
+}
+
+// resolveConflict turns a conflict action into the action chosen by the
+// per-file resolution or, failing that, the configured policy.
+func (s *Syncer) resolveConflict(action SyncAction) SyncAction {
+	c := action.Conflict
+	policy := s.options.ConflictPolicy
+	if p, ok := s.options.Resolutions[c.Path]; ok {
+		policy = p
+	}
+
+	if policy == ConflictPreferLarger {
+		switch {
+		case !c.RemoteExists || (c.LocalExists && c.LocalSize > c.RemoteSize):
+			policy = ConflictPreferLocal
+		case !c.LocalExists || c.RemoteSize > c.LocalSize:
+			policy = ConflictPreferRemote
+		default:
+			policy = ConflictKeepBoth
+		}
+	}
+
+	// With one side deleted there is nothing to rename: keeping both means
+	// restoring the modified copy
+	if policy == ConflictKeepBoth && !(c.LocalExists && c.RemoteExists) {
+		if c.LocalExists {
+			policy = ConflictPreferLocal
+		} else {
+			policy = ConflictPreferRemote
+		}
+	}
+
+	c.Resolution = policy
+	switch policy {
+	case ConflictKeepBoth:
+		action.Type = "keep_both"
+	case ConflictPreferLocal:
+		if c.LocalExists {
+			action.Type = "upload"
+		} else {
+			action.Type = "delete_remote"
+		}
+	case ConflictPreferRemote:
+		if c.RemoteExists {
+			action.Type = "download"
+		} else {
+			action.Type = "delete_local"
+		}
+	default:
+		return action
+	}
+
+	action.Reason = fmt.Sprintf("%s, resolved: %s", c.Reason, policy)
+	return action
+}
+
+// keepBoth resolves a conflict by renaming the older copy to a conflict name
+// and transferring both copies, so that each side ends up with the two
+// versions. It returns the relative path of the conflict copy.
+func (s *Syncer) keepBoth(ctx context.Context, action SyncAction) (string, error) {
+	c := action.Conflict
+	now := time.Now()
+
+	if !s.localNewer(c.LocalModTime, c.RemoteModTime) {
+		// Local copy is older
+		host, _ := os.Hostname()
+		localCopy := conflictName(action.LocalPath, host, now)
+		remoteCopy := filepath.Join(filepath.Dir(action.RemotePath), filepath.Base(localCopy))
+
+		if err := os.Rename(action.LocalPath, localCopy); err != nil {
+			return "", err
+		}
+		if err := s.upload(ctx, localCopy, remoteCopy); err != nil {
+			return "", err
+		}
+		s.stampUpload(ctx, localCopy, remoteCopy)
+		if err := s.client.Download(ctx, action.RemotePath, action.LocalPath, false, nil); err != nil {
+			return "", err
+		}
+		s.stampDownload(action.LocalPath, c.RemoteModTime)
+		return conflictName(c.Path, host, now), nil
+	}
+
+	// Remote copy is older
+	host := s.options.RemoteHost
+	if host == "" {
+		host = "remote"
+	}
+	remoteCopy := conflictName(action.RemotePath, host, now)
+	localCopy := filepath.Join(filepath.Dir(action.LocalPath), filepath.Base(remoteCopy))
+
+	if err := s.client.Rename(ctx, action.RemotePath, remoteCopy); err != nil {
+		return "", err
+	}
+	if err := s.client.Download(ctx, remoteCopy, localCopy, false, nil); err != nil {
+		return "", err
+	}
+	s.stampDownload(localCopy, c.RemoteModTime)
+	if err := s.upload(ctx, action.LocalPath, action.RemotePath); err != nil {
+		return "", err
+	}
+	s.stampUpload(ctx, action.LocalPath, action.RemotePath)
+	return conflictName(c.Path, host, now), nil
+}
+
+// conflictName returns the name given to the losing copy of a conflict:
+// name.conflict-<host>-<timestamp>, keeping the extension last.
+func conflictName(path, host string, t time.Time) string {
+	ext := filepath.Ext(path)
+	host = strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(host)
+	return fmt.Sprintf("%s.conflict-%s-%s%s", strings.TrimSuffix(path, ext), host, t.Format("20060102-150405"), ext)
+}
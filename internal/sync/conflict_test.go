@@ -0,0 +1,215 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"secure-ftp/internal/protocol"
+)
+
+// dirClient is a protocol.Protocol serving remote paths from a local
+// directory. Methods other than Rename, Upload, Download and Chtimes are not
+// implemented.
+type dirClient struct {
+	protocol.Protocol
+	root string
+}
+
+func (c *dirClient) path(remotePath string) string {
+	return filepath.Join(c.root, filepath.FromSlash(remotePath))
+}
+
+func (c *dirClient) Rename(ctx context.Context, oldPath, newPath string) error {
+	return os.Rename(c.path(oldPath), c.path(newPath))
+}
+
+func (c *dirClient) Upload(ctx context.Context, localPath, remotePath string, resume bool, progressFn func(protocol.TransferProgress)) error {
+	return copyFile(localPath, c.path(remotePath))
+}
+
+func (c *dirClient) Download(ctx context.Context, remotePath, localPath string, resume bool, progressFn func(protocol.TransferProgress)) error {
+	return copyFile(c.path(remotePath), localPath)
+}
+
+func (c *dirClient) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	return os.Chtimes(c.path(path), atime, mtime)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func TestResolveConflict(t *testing.T) {
+	both := Conflict{Path: "a.txt", Reason: "modified on both sides", LocalExists: true, LocalSize: 10, RemoteExists: true, RemoteSize: 20}
+	localOnly := Conflict{Path: "a.txt", Reason: "modified locally, deleted remotely", LocalExists: true, LocalSize: 10}
+	remoteOnly := Conflict{Path: "a.txt", Reason: "deleted locally, modified remotely", RemoteExists: true, RemoteSize: 20}
+	sameSize := Conflict{Path: "a.txt", Reason: "modified on both sides", LocalExists: true, LocalSize: 20, RemoteExists: true, RemoteSize: 20}
+
+	tests := []struct {
+		name        string
+		conflict    Conflict
+		policy      ConflictPolicy
+		resolutions map[string]ConflictPolicy
+		wantType    string
+		wantPolicy  ConflictPolicy
+	}{
+		{"ask leaves the conflict", both, ConflictAsk, nil, "conflict", ConflictAsk},
+		{"keep both", both, ConflictKeepBoth, nil, "keep_both", ConflictKeepBoth},
+		{"keep both restores a deleted remote copy", localOnly, ConflictKeepBoth, nil, "upload", ConflictPreferLocal},
+		{"keep both restores a deleted local copy", remoteOnly, ConflictKeepBoth, nil, "download", ConflictPreferRemote},
+		{"local uploads", both, ConflictPreferLocal, nil, "upload", ConflictPreferLocal},
+		{"local propagates a local deletion", remoteOnly, ConflictPreferLocal, nil, "delete_remote", ConflictPreferLocal},
+		{"remote downloads", both, ConflictPreferRemote, nil, "download", ConflictPreferRemote},
+		{"remote propagates a remote deletion", localOnly, ConflictPreferRemote, nil, "delete_local", ConflictPreferRemote},
+		{"larger remote", both, ConflictPreferLarger, nil, "download", ConflictPreferRemote},
+		{"larger keeps the only copy", localOnly, ConflictPreferLarger, nil, "upload", ConflictPreferLocal},
+		{"larger keeps both of equal size", sameSize, ConflictPreferLarger, nil, "keep_both", ConflictKeepBoth},
+		{"resolution overrides the policy", both, ConflictAsk, map[string]ConflictPolicy{"a.txt": ConflictPreferLocal}, "upload", ConflictPreferLocal},
+		{"resolution of another file", both, ConflictAsk, map[string]ConflictPolicy{"b.txt": ConflictPreferLocal}, "conflict", ConflictAsk},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Syncer{options: SyncOptions{ConflictPolicy: tt.policy, Resolutions: tt.resolutions}}
+			c := tt.conflict
+			action := s.resolveConflict(SyncAction{Type: "conflict", Reason: c.Reason, Conflict: &c})
+
+			if action.Type != tt.wantType {
+				t.Errorf("Type = %q, want %q", action.Type, tt.wantType)
+			}
+			if c.Resolution != tt.wantPolicy {
+				t.Errorf("Resolution = %v, want %v", c.Resolution, tt.wantPolicy)
+			}
+			if tt.wantType == "conflict" {
+				if action.Reason != c.Reason {
+					t.Errorf("Reason = %q, want it unchanged", action.Reason)
+				}
+			} else if want := c.Reason + ", resolved: " + tt.wantPolicy.String(); action.Reason != want {
+				t.Errorf("Reason = %q, want %q", action.Reason, want)
+			}
+		})
+	}
+}
+
+func TestConflictName(t *testing.T) {
+	at := time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+	tests := []struct {
+		path, host, want string
+	}{
+		{"docs/report.pdf", "laptop", "docs/report.conflict-laptop-20240309-140507.pdf"},
+		{"Makefile", "laptop", "Makefile.conflict-laptop-20240309-140507"},
+		{"archive.tar.gz", "laptop", "archive.tar.conflict-laptop-20240309-140507.gz"},
+		{"a.txt", "ftp.example.com:2121", "a.conflict-ftp.example.com_2121-20240309-140507.txt"},
+		{"a.txt", `DOMAIN\pc/1`, "a.conflict-DOMAIN_pc_1-20240309-140507.txt"},
+	}
+	for _, tt := range tests {
+		if got := conflictName(tt.path, tt.host, at); got != tt.want {
+			t.Errorf("conflictName(%q, %q) = %q, want %q", tt.path, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestKeepBoth(t *testing.T) {
+	tests := []struct {
+		name       string
+		localOlder bool
+		host       string // Expected in the name of the conflict copy
+	}{
+		{"local copy older", true, ""},
+		{"remote copy older", false, "srv_22"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localDir := t.TempDir()
+			remoteRoot := t.TempDir()
+			writeFile(t, filepath.Join(localDir, "a.txt"), "local")
+			writeFile(t, filepath.Join(remoteRoot, "srv", "a.txt"), "remote")
+
+			now := time.Now()
+			c := &Conflict{Path: "a.txt", LocalExists: true, RemoteExists: true, LocalModTime: now, RemoteModTime: now.Add(-time.Hour)}
+			if tt.localOlder {
+				c.LocalModTime, c.RemoteModTime = c.RemoteModTime, c.LocalModTime
+			}
+			s := &Syncer{
+				client:  &dirClient{root: remoteRoot},
+				options: SyncOptions{RemoteHost: "srv:22"},
+				clock:   &ServerClock{},
+			}
+
+			copyPath, err := s.keepBoth(context.Background(), SyncAction{
+				Type:       "keep_both",
+				LocalPath:  filepath.Join(localDir, "a.txt"),
+				RemotePath: "/srv/a.txt",
+				Conflict:   c,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(copyPath, "a.conflict-"+tt.host) || !strings.HasSuffix(copyPath, ".txt") {
+				t.Errorf("conflict copy = %q, want a.conflict-%s-<time>.txt", copyPath, tt.host)
+			}
+
+			// Both sides hold the newer copy under the original name and the
+			// older one under the conflict name
+			newer, older := "local", "remote"
+			if tt.localOlder {
+				newer, older = older, newer
+			}
+			for _, dir := range []string{localDir, filepath.Join(remoteRoot, "srv")} {
+				if got := dirContents(t, dir); len(got) != 2 || got["a.txt"] != newer || got[copyPath] != older {
+					t.Errorf("%s holds %v, want a.txt=%q and %s=%q", dir, got, newer, copyPath, older)
+				}
+			}
+		})
+	}
+}
+
+// writeFile creates path and its parent directories with content.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dirContents returns the content of each file in dir by name.
+func dirContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]string)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[entry.Name()] = string(data)
+	}
+	return contents
+}
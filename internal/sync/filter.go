@@ -0,0 +1,323 @@
+package sync
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IgnoreFileName is the name of the per-directory rule files read from the
+// local tree. They use .gitignore syntax and apply to their directory.
+const IgnoreFileName = ".sftpignore"
+
+// filterRule is one compiled .gitignore-style pattern.
+type filterRule struct {
+	pattern string // As written, for explanations
+	source  string // Where the rule comes from
+	base    string // Directory the rule is relative to ("" for the root)
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// Filter decides which paths are synchronized, using .gitignore semantics:
+// the last matching rule wins, "!" re-includes, a trailing "/" only matches
+// directories, a "/" elsewhere anchors the pattern to its directory, and
+// "**" matches any number of directories. Files below an excluded directory
+// are always excluded.
+type Filter struct {
+	rules        []*filterRule
+	includes     []*filterRule // If set, files must match one of them
+	ignoreHidden bool
+	maxSize      int64
+	maxAge       time.Duration
+	now          time.Time
+}
+
+// NewFilter creates a filter from the patterns and limits in options.
+// Rules from .sftpignore files are added with LoadIgnoreFile.
+func NewFilter(options SyncOptions) (*Filter, error) {
+	f := &Filter{
+		ignoreHidden: options.IgnoreHidden,
+		maxSize:      options.MaxFileSize,
+		maxAge:       options.MaxFileAge,
+		now:          time.Now(),
+	}
+
+	for _, pattern := range options.ExcludePatterns {
+		rule, err := parseRule(pattern, "", "exclude pattern")
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil {
+			f.rules = append(f.rules, rule)
+		}
+	}
+
+	for _, pattern := range options.IncludePatterns {
+		rule, err := parseRule(pattern, "", "include pattern")
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil {
+			f.includes = append(f.includes, rule)
+		}
+	}
+
+	return f, nil
+}
+
+// LoadIgnoreFile adds the rules of an ignore file found in dir, a slash
+// separated path relative to the synced root ("" for the root itself).
+// A missing file is not an error.
+func (f *Filter) LoadIgnoreFile(filePath, dir string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	source := path.Join(dir, IgnoreFileName)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		rule, err := parseRule(scanner.Text(), dir, fmt.Sprintf("%s:%d", source, lineNo))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", source, lineNo, err)
+		}
+		if rule != nil {
+			f.rules = append(f.rules, rule)
+		}
+	}
+	return scanner.Err()
+}
+
+// Match reports whether a path must be skipped, without looking at its
+// parent directories; tree walks skip excluded directories instead. The
+// reason names the rule or limit that decided, and is empty if none did.
+// size and modTime are ignored for directories.
+func (f *Filter) Match(relPath string, isDir bool, size int64, modTime time.Time) (excluded bool, reason string) {
+	relPath = filepath.ToSlash(relPath)
+	name := path.Base(relPath)
+
+	if f.ignoreHidden && strings.HasPrefix(name, ".") {
+		return true, "hidden"
+	}
+
+	for _, rule := range f.rules {
+		if rule.matches(relPath, isDir) {
+			excluded, reason = !rule.negate, rule.describe()
+		}
+	}
+	if excluded || isDir {
+		return excluded, reason
+	}
+
+	if len(f.includes) > 0 {
+		included := false
+		for _, rule := range f.includes {
+			if rule.matches(relPath, false) {
+				included = !rule.negate
+			}
+		}
+		if !included {
+			return true, "not matched by any include pattern"
+		}
+	}
+
+	if f.maxSize > 0 && size > f.maxSize {
+		return true, fmt.Sprintf("larger than %d bytes", f.maxSize)
+	}
+	if f.maxAge > 0 && !modTime.IsZero() && f.now.Sub(modTime) > f.maxAge {
+		return true, fmt.Sprintf("not modified for more than %s", f.maxAge)
+	}
+
+	return false, reason
+}
+
+// Explain is like Match but also checks every parent directory, so it can be
+// used on any path. It is meant for previews and single-path checks.
+func (f *Filter) Explain(relPath string, isDir bool, size int64, modTime time.Time) (excluded bool, reason string) {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if excluded, reason := f.Match(dir, true, 0, time.Time{}); excluded {
+			return true, fmt.Sprintf("parent directory %s excluded by %s", dir, reason)
+		}
+	}
+	return f.Match(relPath, isDir, size, modTime)
+}
+
+// matches reports whether the rule applies to relPath.
+func (r *filterRule) matches(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = relPath[len(r.base)+1:]
+	}
+	return r.re.MatchString(relPath)
+}
+
+// describe returns the rule and its origin.
+func (r *filterRule) describe() string {
+	return fmt.Sprintf("%s %q", r.source, r.pattern)
+}
+
+// parseRule compiles one .gitignore line. It returns nil for blank lines and
+// comments.
+func parseRule(line, base, source string) (*filterRule, error) {
+	pattern := strings.TrimRight(line, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil, nil
+	}
+
+	rule := &filterRule{pattern: pattern, source: source, base: base}
+
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	// A slash at the start or in the middle anchors the pattern
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return nil, nil
+	}
+
+	expr, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+
+	rule.re, err = regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	return rule, nil
+}
+
+// globToRegexp translates a .gitignore glob into a regular expression.
+func globToRegexp(pattern string) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				atStart := i == 0 || pattern[i-1] == '/'
+				i++
+				switch {
+				case atStart && i+1 < len(pattern) && pattern[i+1] == '/':
+					// "**/": zero or more directories
+					sb.WriteString("(?:.*/)?")
+					i++
+				case atStart && i+1 == len(pattern):
+					// Trailing "/**": everything inside
+					sb.WriteString(".*")
+				default:
+					sb.WriteString("[^/]*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+
+		case '?':
+			sb.WriteString("[^/]")
+
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// ParseSize parses a file size such as "2G", "500M", "64K" or "1024"
+// (binary multiples, optional trailing "B").
+func ParseSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %q", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// ParseAge parses a file age: a Go duration ("36h") or a number of days
+// ("90d").
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age: %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age: %q", s)
+	}
+	return age, nil
+}
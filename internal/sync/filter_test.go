@@ -0,0 +1,276 @@
+package sync
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		// Unanchored patterns match at any depth
+		{"name anywhere", []string{"*.tmp"}, "a/b/c.tmp", false, true},
+		{"name at root", []string{"*.tmp"}, "c.tmp", false, true},
+		{"other extension", []string{"*.tmp"}, "c.txt", false, false},
+		{"star stays in segment", []string{"a*c"}, "ab/c", false, false},
+		{"question mark", []string{"file?.log"}, "logs/file1.log", false, true},
+		{"question mark no slash", []string{"a?b"}, "a/b", false, false},
+		{"character class", []string{"file[0-9].log"}, "file7.log", false, true},
+		{"negated class", []string{"file[!0-9].log"}, "file7.log", false, false},
+		{"negated class other", []string{"file[!0-9].log"}, "filex.log", false, true},
+		{"escaped star", []string{`\*.txt`}, "*.txt", false, true},
+		{"escaped star literal", []string{`\*.txt`}, "a.txt", false, false},
+
+		// A slash anchors the pattern to the root
+		{"leading slash", []string{"/build"}, "build", true, true},
+		{"leading slash not nested", []string{"/build"}, "src/build", true, false},
+		{"middle slash", []string{"doc/*.html"}, "doc/index.html", false, true},
+		{"middle slash not nested", []string{"doc/*.html"}, "x/doc/index.html", false, false},
+		{"middle slash one level", []string{"doc/*.html"}, "doc/api/index.html", false, false},
+
+		// A trailing slash only matches directories
+		{"dir only", []string{"cache/"}, "cache", true, true},
+		{"dir only file", []string{"cache/"}, "cache", false, false},
+		{"dir only nested", []string{"cache/"}, "a/cache", true, true},
+
+		// Double stars
+		{"leading **", []string{"**/node_modules/"}, "node_modules", true, true},
+		{"leading ** nested", []string{"**/node_modules/"}, "web/app/node_modules", true, true},
+		{"middle **", []string{"a/**/b"}, "a/b", false, true},
+		{"middle ** deep", []string{"a/**/b"}, "a/x/y/b", false, true},
+		{"middle ** other root", []string{"a/**/b"}, "c/x/b", false, false},
+		{"trailing **", []string{"logs/**"}, "logs/2024/app.log", false, true},
+		{"trailing ** not the dir", []string{"logs/**"}, "logs", true, false},
+		{"** inside a name", []string{"a**b"}, "axyb", false, true},
+		{"** inside a name no slash", []string{"a**b"}, "ax/yb", false, false},
+
+		// The last matching rule wins
+		{"negation", []string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{"negation other", []string{"*.log", "!keep.log"}, "drop.log", false, true},
+		{"negation undone", []string{"*.log", "!keep.log", "keep.log"}, "keep.log", false, true},
+		{"escaped bang", []string{`\!important`}, "!important", false, true},
+
+		// Blank lines and comments
+		{"comment", []string{"# *.go"}, "main.go", false, false},
+		{"escaped hash", []string{`\#notes`}, "#notes", false, true},
+		{"trailing spaces", []string{"*.bak   "}, "x.bak", false, true},
+		{"blank", []string{"", "  "}, "x", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(SyncOptions{ExcludePatterns: tt.patterns})
+			if err != nil {
+				t.Fatalf("NewFilter(%q): %v", tt.patterns, err)
+			}
+			got, reason := f.Match(tt.path, tt.isDir, 0, time.Time{})
+			if got != tt.want {
+				t.Errorf("Match(%q) with %q = %v (%s), want %v", tt.path, tt.patterns, got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterInvalidPattern(t *testing.T) {
+	if _, err := NewFilter(SyncOptions{ExcludePatterns: []string{"file[0-9"}}); err == nil {
+		t.Errorf("NewFilter accepted an unterminated character class")
+	}
+}
+
+func TestFilterIncludePatterns(t *testing.T) {
+	f, err := NewFilter(SyncOptions{
+		IncludePatterns: []string{"*.go", "!*_test.go"},
+		ExcludePatterns: []string{"vendor/"},
+	})
+	if err != nil {
+		t.Fatalf("NewFilter: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"main.go", false, false},
+		{"pkg/util.go", false, false},
+		{"pkg/util_test.go", false, true},
+		{"README.md", false, true},
+		// Directories are walked even if no include pattern names them
+		{"pkg", true, false},
+		{"vendor", true, true},
+	}
+	for _, tt := range tests {
+		if got, reason := f.Match(tt.path, tt.isDir, 0, time.Time{}); got != tt.want {
+			t.Errorf("Match(%q) = %v (%s), want %v", tt.path, got, reason, tt.want)
+		}
+	}
+}
+
+func TestFilterLimits(t *testing.T) {
+	now := time.Now()
+	f, err := NewFilter(SyncOptions{
+		IgnoreHidden: true,
+		MaxFileSize:  1024,
+		MaxFileAge:   24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewFilter: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		isDir   bool
+		size    int64
+		modTime time.Time
+		want    bool
+	}{
+		{"small recent", "a.txt", false, 100, now, false},
+		{"too large", "a.txt", false, 2048, now, true},
+		{"too old", "a.txt", false, 100, now.Add(-48 * time.Hour), true},
+		{"unknown time", "a.txt", false, 100, time.Time{}, false},
+		{"large directory", "dir", true, 1 << 20, now.Add(-48 * time.Hour), false},
+		{"hidden file", "dir/.env", false, 1, now, true},
+		{"hidden directory", ".git", true, 0, now, true},
+	}
+	for _, tt := range tests {
+		if got, reason := f.Match(tt.path, tt.isDir, tt.size, tt.modTime); got != tt.want {
+			t.Errorf("%s: Match(%q) = %v (%s), want %v", tt.name, tt.path, got, reason, tt.want)
+		}
+	}
+}
+
+func TestFilterExplainChecksParents(t *testing.T) {
+	f, err := NewFilter(SyncOptions{ExcludePatterns: []string{"build/", "!build/keep.txt"}})
+	if err != nil {
+		t.Fatalf("NewFilter: %v", err)
+	}
+
+	// As in git, a file cannot be re-included below an excluded directory
+	excluded, reason := f.Explain("build/keep.txt", false, 0, time.Time{})
+	if !excluded {
+		t.Fatalf("Explain(build/keep.txt) was not excluded")
+	}
+	if !strings.Contains(reason, "parent directory build") {
+		t.Errorf("Explain reason = %q, want the parent directory", reason)
+	}
+
+	if excluded, _ := f.Match("build/keep.txt", false, 0, time.Time{}); excluded {
+		t.Errorf("Match(build/keep.txt) looked at the parent directory")
+	}
+}
+
+func TestFilterIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, IgnoreFileName), "# Root rules\n*.log\n/dist/\n")
+	writeFile(t, filepath.Join(root, "web", IgnoreFileName), "!debug.log\n/cache\n")
+
+	f, err := NewFilter(SyncOptions{})
+	if err != nil {
+		t.Fatalf("NewFilter: %v", err)
+	}
+	if err := f.LoadIgnoreFile(filepath.Join(root, IgnoreFileName), ""); err != nil {
+		t.Fatalf("LoadIgnoreFile: %v", err)
+	}
+	if err := f.LoadIgnoreFile(filepath.Join(root, "web", IgnoreFileName), "web"); err != nil {
+		t.Fatalf("LoadIgnoreFile: %v", err)
+	}
+	if err := f.LoadIgnoreFile(filepath.Join(root, "missing", IgnoreFileName), "missing"); err != nil {
+		t.Errorf("LoadIgnoreFile of a missing file: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"web/app.log", false, true},
+		{"web/debug.log", false, false},
+		{"debug.log", false, true},
+		{"dist", true, true},
+		{"web/dist", true, false},
+		// Anchored to the directory of its rule file
+		{"web/cache", true, true},
+		{"cache", true, false},
+		{"web/sub/cache", true, false},
+	}
+	for _, tt := range tests {
+		if got, reason := f.Match(tt.path, tt.isDir, 0, time.Time{}); got != tt.want {
+			t.Errorf("Match(%q) = %v (%s), want %v", tt.path, got, reason, tt.want)
+		}
+	}
+
+	_, reason := f.Match("web/app.log", false, 0, time.Time{})
+	if want := IgnoreFileName + ":2"; !strings.Contains(reason, want) {
+		t.Errorf("reason = %q, want it to name %s", reason, want)
+	}
+}
+
+func TestFilterIgnoreFileError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), IgnoreFileName)
+	writeFile(t, path, "ok\n[broken\n")
+
+	f, err := NewFilter(SyncOptions{})
+	if err != nil {
+		t.Fatalf("NewFilter: %v", err)
+	}
+	err = f.LoadIgnoreFile(path, "")
+	if err == nil || !strings.Contains(err.Error(), IgnoreFileName+":2") {
+		t.Errorf("LoadIgnoreFile = %v, want an error on line 2", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"64K", 64 << 10, false},
+		{"500m", 500 << 20, false},
+		{"2G", 2 << 30, false},
+		{"2GB", 2 << 30, false},
+		{"1.5M", 3 << 19, false},
+		{" 1T ", 1 << 40, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"ten", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90d", 90 * 24 * time.Hour, false},
+		{"0.5d", 12 * time.Hour, false},
+		{"36h", 36 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"-1h", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAge(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"secure-ftp/internal/protocol"
+	"secure-ftp/pkg/fileutil"
+)
+
+// FileState records what a file looked like on both sides after it was last
+// synchronized.
+type FileState struct {
+	LocalSize     int64     `json:"local_size"`
+	LocalModTime  time.Time `json:"local_mod_time"`
+	RemoteSize    int64     `json:"remote_size"`
+	RemoteModTime time.Time `json:"remote_mod_time"`
+	// Content hash, only kept for CompareByHash
+	Hash     string                 `json:"hash,omitempty"`
+	HashAlgo protocol.HashAlgorithm `json:"hash_algo,omitempty"`
+}
+
+// SyncState is the sync history of one local/remote folder pair.
+// ModeBidirectional uses it as the common ancestor of both sides.
+type SyncState struct {
+	LocalDir  string                `json:"local_dir"`
+	RemoteDir string                `json:"remote_dir"`
+	LastSync  time.Time             `json:"last_sync"`
+	Files     map[string]*FileState `json:"files"` // Keyed by slash-separated relative path
+
+	path string
+	mu   gosync.RWMutex
+}
+
+// StatePath returns the state file used for a folder pair on the given
+// server. The pair is hashed so any directory names are safe to use.
+func StatePath(stateDir, server, localDir, remoteDir string) string {
+	absLocal, err := filepath.Abs(localDir)
+	if err != nil {
+		absLocal = localDir
+	}
+	sum := sha256.Sum256([]byte(server + "\x00" + absLocal + "\x00" + remoteDir))
+	return filepath.Join(stateDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// LoadSyncState reads the sync state stored at path.
+// A missing file yields an empty state.
+func LoadSyncState(path string) (*SyncState, error) {
+	state := &SyncState{
+		Files: make(map[string]*FileState),
+		path:  path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]*FileState)
+	}
+
+	return state, nil
+}
+
+// Get returns the recorded state of relPath, or nil if it was never synced.
+func (st *SyncState) Get(relPath string) *FileState {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.Files[filepath.ToSlash(relPath)]
+}
+
+// Set records the state of relPath after a successful sync.
+func (st *SyncState) Set(relPath string, fs *FileState) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Files[filepath.ToSlash(relPath)] = fs
+}
+
+// Delete forgets relPath.
+func (st *SyncState) Delete(relPath string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.Files, filepath.ToSlash(relPath))
+}
+
+// Paths returns the relative paths of all recorded files.
+func (st *SyncState) Paths() []string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	paths := make([]string, 0, len(st.Files))
+	for p := range st.Files {
+		paths = append(paths, filepath.FromSlash(p))
+	}
+	return paths
+}
+
+// Save writes the state to disk.
+// The file is replaced atomically so that a crash never leaves it truncated.
+func (st *SyncState) Save() error {
+	st.mu.Lock()
+	st.LastSync = time.Now()
+	data, err := json.MarshalIndent(st, "", "  ")
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return fileutil.AtomicWriteFile(st.path, data, 0644)
+}
+
+// localChanged reports whether the local file differs from its recorded state.
+func (fs *FileState) localChanged(size int64, modTime time.Time) bool {
+	return size != fs.LocalSize || !modTime.Equal(fs.LocalModTime)
+}
+
+// remoteChanged reports whether the remote file differs from its recorded state.
+func (fs *FileState) remoteChanged(size int64, modTime time.Time) bool {
+	return size != fs.RemoteSize || !modTime.Equal(fs.RemoteModTime)
+}
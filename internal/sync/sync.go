@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	gosync "sync"
 	"time"
 
 	"secure-ftp/internal/protocol"
@@ -26,7 +27,9 @@ const (
 	ModeDownload
 	// ModeMirror makes remote exactly match local (including deletions).
 	ModeMirror
-	// ModeBidirectional syncs changes in both directions (newest wins).
+	// ModeBidirectional syncs changes in both directions. With a state file
+	// it propagates deletions and reports conflicts; files without sync
+	// history fall back to newest wins.
 	ModeBidirectional
 )
 
@@ -44,11 +47,22 @@ const (
 type SyncOptions struct {
 	Mode          SyncMode
 	CompareMethod CompareMethod
-	ExcludePatterns []string   // Glob patterns to exclude
-	IncludePatterns []string   // Glob patterns to include (if set, only these are synced)
+	ExcludePatterns []string   // .gitignore-style patterns to exclude (see Filter)
+	IncludePatterns []string   // Patterns to include (if set, only matching files are synced)
 	DeleteExtra     bool       // Delete files on destination not present on source
 	DryRun          bool       // Don't actually transfer, just report what would happen
 	IgnoreHidden    bool       // Skip hidden files (starting with .)
+	MaxFileSize     int64         // Skip larger files (bytes, 0 = no limit)
+	MaxFileAge      time.Duration // Skip files not modified for longer (0 = no limit)
+	StatePath       string     // Sync history for ModeBidirectional (see StatePath)
+	ClockPath       string     // Learned clock of the server (see ClockPath)
+	AtomicUploads   bool       // Upload to a temporary name, then rename
+	RemoteHost      string     // Server name used in conflict copy names
+
+	// Conflict handling in ModeBidirectional; Resolutions overrides the
+	// policy per relative path, typically after reviewing ConflictAsk results
+	ConflictPolicy ConflictPolicy
+	Resolutions    map[string]ConflictPolicy
 }
 
 // SyncResult contains the results of a synchronization.
@@ -57,6 +71,7 @@ type SyncResult struct {
 	FilesDownloaded  int
 	FilesDeleted     int
 	FilesSkipped     int
+	Conflicts        []Conflict // Resolved and unresolved conflicts
 	BytesTransferred int64
 	Errors           []error
 	Duration         time.Duration
@@ -64,10 +79,11 @@ type SyncResult struct {
 
 // SyncAction represents a planned sync action.
 type SyncAction struct {
-	Type       string // "upload", "download", "delete_local", "delete_remote", "skip"
-	LocalPath  string
-	RemotePath string
-	Reason     string
+	Type       string `json:"type"` // "upload", "download", "delete_local", "delete_remote", "conflict", "skip"
+	LocalPath  string `json:"local_path,omitempty"`
+	RemotePath string `json:"remote_path,omitempty"`
+	Reason     string `json:"reason"`
+	Conflict   *Conflict `json:"conflict,omitempty"` // Set for conflicts, even once resolved
 }
 
 // Syncer handles folder synchronization.
@@ -76,6 +92,19 @@ type Syncer struct {
 	manager  *transfer.TransferManager
 	log      *logger.Logger
 	options  SyncOptions
+	hashAlgo protocol.HashAlgorithm // Chosen on first hash comparison
+	state    *SyncState             // Loaded by Analyze in ModeBidirectional
+	filter   *Filter                // Built by Analyze, see currentFilter
+	filterMu gosync.RWMutex
+
+	// Relation between local and remote modification times: the server
+	// clock is probed by Execute, the tolerance set by Analyze
+	clock     *ServerClock
+	tolerance time.Duration
+
+	// Scan results of the last Analyze, keyed by relative path
+	localMap  map[string]os.FileInfo
+	remoteMap map[string]protocol.FileInfo
 }
 
 // NewSyncer creates a new syncer instance.
@@ -92,11 +121,17 @@ func NewSyncer(client protocol.Protocol, manager *transfer.TransferManager, opti
 func (s *Syncer) Analyze(ctx context.Context, localDir, remoteDir string) ([]SyncAction, error) {
 	var actions []SyncAction
 
-	// Get local files
-	localFiles, err := s.scanLocalDir(localDir)
+	filter, err := NewFilter(s.options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get local files, loading their rule files
+	localFiles, err := s.scanLocalDir(localDir, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan local directory: %w", err)
 	}
+	s.setFilter(filter)
 
 	// Get remote files
 	remoteFiles, err := s.scanRemoteDir(ctx, remoteDir)
@@ -118,6 +153,22 @@ func (s *Syncer) Analyze(ctx context.Context, localDir, remoteDir string) ([]Syn
 		remoteMap[relPath] = f.info
 	}
 
+	s.localMap, s.remoteMap = localMap, remoteMap
+	if err := s.loadClock(); err != nil {
+		return nil, err
+	}
+	s.learnTolerance()
+
+	s.state = nil
+	if s.options.Mode == ModeBidirectional && s.options.StatePath != "" {
+		state, err := LoadSyncState(s.options.StatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sync state: %w", err)
+		}
+		state.LocalDir, state.RemoteDir = localDir, remoteDir
+		s.state = state
+	}
+
 	switch s.options.Mode {
 	case ModeUpload:
 		actions = s.analyzeUpload(localDir, remoteDir, localMap, remoteMap)
@@ -129,6 +180,12 @@ func (s *Syncer) Analyze(ctx context.Context, localDir, remoteDir string) ([]Syn
 		actions = s.analyzeBidirectional(localDir, remoteDir, localMap, remoteMap)
 	}
 
+	for i, action := range actions {
+		if action.Type == "conflict" {
+			actions[i] = s.resolveConflict(action)
+		}
+	}
+
 	return actions, nil
 }
 
@@ -137,6 +194,10 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 	startTime := time.Now()
 	result := &SyncResult{}
 
+	if !s.options.DryRun {
+		s.measureClock(ctx, remoteDir)
+	}
+
 	actions, err := s.Analyze(ctx, localDir, remoteDir)
 	if err != nil {
 		return nil, err
@@ -145,11 +206,17 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 	if s.options.DryRun {
 		// Just count what would happen
 		for _, action := range actions {
+			if action.Conflict != nil {
+				result.Conflicts = append(result.Conflicts, *action.Conflict)
+			}
 			switch action.Type {
 			case "upload":
 				result.FilesUploaded++
 			case "download":
 				result.FilesDownloaded++
+			case "keep_both":
+				result.FilesUploaded++
+				result.FilesDownloaded++
 			case "delete_local", "delete_remote":
 				result.FilesDeleted++
 			case "skip":
@@ -160,6 +227,16 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 		return result, nil
 	}
 
+	// Record the outcome in the sync history even if interrupted
+	if s.state != nil {
+		defer func() {
+			s.forgetVanished()
+			if err := s.state.Save(); err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("save sync state: %w", err))
+			}
+		}()
+	}
+
 	// Execute actions
 	for _, action := range actions {
 		select {
@@ -170,15 +247,25 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 		default:
 		}
 
+		relPath, _ := filepath.Rel(localDir, action.LocalPath)
+		if action.LocalPath == "" {
+			relPath = strings.TrimPrefix(strings.TrimPrefix(action.RemotePath, remoteDir), "/")
+		}
+		if action.Conflict != nil {
+			result.Conflicts = append(result.Conflicts, *action.Conflict)
+		}
+
 		switch action.Type {
 		case "upload":
-			if err := s.client.Upload(ctx, action.LocalPath, action.RemotePath, false, nil); err != nil {
+			if err := s.upload(ctx, action.LocalPath, action.RemotePath); err != nil {
 				result.Errors = append(result.Errors, fmt.Errorf("upload %s: %w", action.LocalPath, err))
 			} else {
 				result.FilesUploaded++
 				if info, err := os.Stat(action.LocalPath); err == nil {
 					result.BytesTransferred += info.Size()
 				}
+				s.stampUpload(ctx, action.LocalPath, action.RemotePath)
+				s.recordState(ctx, relPath, action, nil, nil)
 			}
 
 		case "download":
@@ -186,9 +273,11 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 				result.Errors = append(result.Errors, fmt.Errorf("download %s: %w", action.RemotePath, err))
 			} else {
 				result.FilesDownloaded++
-				if info, _ := s.client.Stat(ctx, action.RemotePath); info != nil {
+				if info, ok := s.remoteMap[relPath]; ok {
 					result.BytesTransferred += info.Size
+					s.stampDownload(action.LocalPath, info.ModTime)
 				}
+				s.recordState(ctx, relPath, action, nil, nil)
 			}
 
 		case "delete_local":
@@ -196,6 +285,9 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 				result.Errors = append(result.Errors, fmt.Errorf("delete local %s: %w", action.LocalPath, err))
 			} else {
 				result.FilesDeleted++
+				if s.state != nil {
+					s.state.Delete(relPath)
+				}
 			}
 
 		case "delete_remote":
@@ -203,10 +295,35 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 				result.Errors = append(result.Errors, fmt.Errorf("delete remote %s: %w", action.RemotePath, err))
 			} else {
 				result.FilesDeleted++
+				if s.state != nil {
+					s.state.Delete(relPath)
+				}
+			}
+
+		case "keep_both":
+			copyPath, err := s.keepBoth(ctx, action)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("keep both %s: %w", action.LocalPath, err))
+			} else {
+				result.FilesUploaded++
+				result.FilesDownloaded++
+				s.recordState(ctx, relPath, action, nil, nil)
+				s.recordState(ctx, copyPath, SyncAction{
+					LocalPath:  filepath.Join(localDir, copyPath),
+					RemotePath: filepath.Join(remoteDir, copyPath),
+				}, nil, nil)
 			}
 
+		case "conflict":
+			// Left untouched until resolved; the history keeps the common ancestor
+
 		case "skip":
 			result.FilesSkipped++
+			localInfo, localOK := s.localMap[relPath]
+			remoteInfo, remoteOK := s.remoteMap[relPath]
+			if localOK && remoteOK {
+				s.recordState(ctx, relPath, action, localInfo, &remoteInfo)
+			}
 		}
 	}
 
@@ -214,6 +331,68 @@ func (s *Syncer) Execute(ctx context.Context, localDir, remoteDir string) (*Sync
 	return result, nil
 }
 
+// upload sends one file directly, through a temporary name if AtomicUploads
+// is set.
+func (s *Syncer) upload(ctx context.Context, localPath, remotePath string) error {
+	if s.options.AtomicUploads {
+		return protocol.UploadAtomic(ctx, s.client, localPath, remotePath, true, false, nil)
+	}
+	return s.client.Upload(ctx, localPath, remotePath, false, nil)
+}
+
+// recordState stores the current state of both copies of relPath in the sync
+// history. Missing infos are fetched again, since a transfer changed them.
+func (s *Syncer) recordState(ctx context.Context, relPath string, action SyncAction, localInfo os.FileInfo, remoteInfo *protocol.FileInfo) {
+	if s.state == nil {
+		return
+	}
+
+	if localInfo == nil {
+		info, err := os.Stat(action.LocalPath)
+		if err != nil {
+			s.log.Warnf("Failed to record sync state for %s: %v", relPath, err)
+			return
+		}
+		localInfo = info
+	}
+	if remoteInfo == nil {
+		info, err := s.client.Stat(ctx, action.RemotePath)
+		if err != nil {
+			s.log.Warnf("Failed to record sync state for %s: %v", relPath, err)
+			return
+		}
+		remoteInfo = info
+	}
+
+	fs := &FileState{
+		LocalSize:     localInfo.Size(),
+		LocalModTime:  localInfo.ModTime(),
+		RemoteSize:    remoteInfo.Size,
+		RemoteModTime: remoteInfo.ModTime,
+	}
+	if s.options.CompareMethod == CompareByHash {
+		if s.hashAlgo == "" {
+			s.hashAlgo = protocol.PreferredHashAlgorithm(ctx, s.client)
+		}
+		if hash, err := protocol.HashLocalFile(action.LocalPath, s.hashAlgo); err == nil {
+			fs.Hash, fs.HashAlgo = hash, s.hashAlgo
+		}
+	}
+	s.state.Set(relPath, fs)
+}
+
+// forgetVanished drops history entries for files that no longer exist on
+// either side.
+func (s *Syncer) forgetVanished() {
+	for _, relPath := range s.state.Paths() {
+		_, local := s.localMap[relPath]
+		_, remote := s.remoteMap[relPath]
+		if !local && !remote {
+			s.state.Delete(relPath)
+		}
+	}
+}
+
 type localFileInfo struct {
 	path string
 	info os.FileInfo
@@ -224,7 +403,24 @@ type remoteFileInfo struct {
 	info protocol.FileInfo
 }
 
-func (s *Syncer) scanLocalDir(dir string) ([]localFileInfo, error) {
+// currentFilter returns the filter built by the last Analyze or rule reload.
+func (s *Syncer) currentFilter() *Filter {
+	s.filterMu.RLock()
+	defer s.filterMu.RUnlock()
+	return s.filter
+}
+
+// setFilter replaces the filter once it is complete.
+func (s *Syncer) setFilter(filter *Filter) {
+	s.filterMu.Lock()
+	defer s.filterMu.Unlock()
+	s.filter = filter
+}
+
+// scanLocalDir lists the files to sync below dir. The .sftpignore files
+// found on the way are added to filter before their directory's contents
+// are examined.
+func (s *Syncer) scanLocalDir(dir string, filter *Filter) ([]localFileInfo, error) {
 	var files []localFileInfo
 
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
@@ -232,20 +428,20 @@ func (s *Syncer) scanLocalDir(dir string) ([]localFileInfo, error) {
 			return err
 		}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
+		relPath, _ := filepath.Rel(dir, path)
+		if relPath == "." {
+			return filter.LoadIgnoreFile(filepath.Join(path, IgnoreFileName), "")
 		}
 
-		// Skip hidden files if configured
-		if s.options.IgnoreHidden && strings.HasPrefix(info.Name(), ".") {
+		if excluded, _ := filter.Match(relPath, info.IsDir(), info.Size(), info.ModTime()); excluded {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Check exclude patterns
-		relPath, _ := filepath.Rel(dir, path)
-		if s.isExcluded(relPath) {
-			return nil
+		if info.IsDir() {
+			return filter.LoadIgnoreFile(filepath.Join(path, IgnoreFileName), filepath.ToSlash(relPath))
 		}
 
 		files = append(files, localFileInfo{path: path, info: info})
@@ -257,6 +453,7 @@ func (s *Syncer) scanLocalDir(dir string) ([]localFileInfo, error) {
 
 func (s *Syncer) scanRemoteDir(ctx context.Context, dir string) ([]remoteFileInfo, error) {
 	var files []remoteFileInfo
+	filter := s.currentFilter()
 
 	var scan func(path string) error
 	scan = func(path string) error {
@@ -266,17 +463,20 @@ func (s *Syncer) scanRemoteDir(ctx context.Context, dir string) ([]remoteFileInf
 		}
 
 		for _, entry := range entries {
-			fullPath := filepath.Join(path, entry.Name)
-
-			// Skip hidden files if configured
-			if s.options.IgnoreHidden && strings.HasPrefix(entry.Name, ".") {
+			// Left behind by an interrupted clock probe
+			if strings.HasPrefix(entry.Name, clockProbePrefix) {
+				continue
+			}
+			// Temporary file of an atomic upload in progress or interrupted
+			if protocol.IsPartialUpload(entry.Name) {
 				continue
 			}
 
-			// Check exclude patterns
+			fullPath := filepath.Join(path, entry.Name)
+
 			relPath := strings.TrimPrefix(fullPath, dir)
 			relPath = strings.TrimPrefix(relPath, "/")
-			if s.isExcluded(relPath) {
+			if excluded, _ := filter.Match(relPath, entry.IsDir, entry.Size, entry.ModTime); excluded {
 				continue
 			}
 
@@ -296,31 +496,38 @@ func (s *Syncer) scanRemoteDir(ctx context.Context, dir string) ([]remoteFileInf
 	return files, err
 }
 
-func (s *Syncer) isExcluded(path string) bool {
-	// Check exclude patterns
-	for _, pattern := range s.options.ExcludePatterns {
-		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
-			return true
-		}
-		if matched, _ := filepath.Match(pattern, path); matched {
-			return true
-		}
+// Explain reports whether relPath, relative to localDir, is excluded from
+// sync and which rule or limit decided it. The .sftpignore files of localDir
+// and of the parent directories of relPath are taken into account; the file
+// does not need to exist.
+func (s *Syncer) Explain(localDir, relPath string) (excluded bool, reason string, err error) {
+	filter, err := NewFilter(s.options)
+	if err != nil {
+		return false, "", err
 	}
 
-	// If include patterns are set, only include matching files
-	if len(s.options.IncludePatterns) > 0 {
-		for _, pattern := range s.options.IncludePatterns {
-			if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
-				return false
-			}
-			if matched, _ := filepath.Match(pattern, path); matched {
-				return false
-			}
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	dir := ""
+	if err := filter.LoadIgnoreFile(filepath.Join(localDir, IgnoreFileName), dir); err != nil {
+		return false, "", err
+	}
+	parts := strings.Split(relPath, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = strings.TrimPrefix(dir+"/"+part, "/")
+		if err := filter.LoadIgnoreFile(filepath.Join(localDir, filepath.FromSlash(dir), IgnoreFileName), dir); err != nil {
+			return false, "", err
 		}
-		return true
 	}
 
-	return false
+	var isDir bool
+	var size int64
+	var modTime time.Time
+	if info, err := os.Stat(filepath.Join(localDir, filepath.FromSlash(relPath))); err == nil {
+		isDir, size, modTime = info.IsDir(), info.Size(), info.ModTime()
+	}
+
+	excluded, reason = filter.Explain(relPath, isDir, size, modTime)
+	return excluded, reason, nil
 }
 
 func (s *Syncer) needsSync(localInfo os.FileInfo, remoteInfo protocol.FileInfo) bool {
@@ -329,22 +536,13 @@ func (s *Syncer) needsSync(localInfo os.FileInfo, remoteInfo protocol.FileInfo)
 		return localInfo.Size() != remoteInfo.Size
 
 	case CompareByModTime:
-		// Allow 2 second tolerance for time comparison
-		diff := localInfo.ModTime().Sub(remoteInfo.ModTime)
-		if diff < 0 {
-			diff = -diff
-		}
-		return diff > 2*time.Second
+		return !s.sameModTime(localInfo.ModTime(), remoteInfo.ModTime)
 
 	case CompareBySizeAndTime:
 		if localInfo.Size() != remoteInfo.Size {
 			return true
 		}
-		diff := localInfo.ModTime().Sub(remoteInfo.ModTime)
-		if diff < 0 {
-			diff = -diff
-		}
-		return diff > 2*time.Second
+		return !s.sameModTime(localInfo.ModTime(), remoteInfo.ModTime)
 
 	case CompareByHash:
 		// Quick check: different sizes means different content
@@ -360,32 +558,22 @@ func (s *Syncer) needsSync(localInfo os.FileInfo, remoteInfo protocol.FileInfo)
 	}
 }
 
-// needsSyncByHash compares files using MD5 hash.
+// needsSyncByHash compares files by checksum, computed by the server when it
+// supports it and otherwise by streaming the remote file.
 // Returns true if files are different, false if identical.
 func (s *Syncer) needsSyncByHash(ctx context.Context, localPath, remotePath string) (bool, error) {
-	// Compute local file hash
-	localHash, err := ComputeLocalChecksum(localPath)
-	if err != nil {
-		return true, fmt.Errorf("failed to compute local hash: %w", err)
+	if s.hashAlgo == "" {
+		s.hashAlgo = protocol.PreferredHashAlgorithm(ctx, s.client)
 	}
 
-	// Download remote file to compute hash
-	// Create a temporary file to store remote content
-	tmpFile, err := os.CreateTemp("", "sftp-hash-*")
+	// Compute local file hash
+	localHash, err := protocol.HashLocalFile(localPath, s.hashAlgo)
 	if err != nil {
-		return true, fmt.Errorf("failed to create temp file: %w", err)
-	}
-	tmpPath := tmpFile.Name()
-	tmpFile.Close()
-	defer os.Remove(tmpPath)
-
-	// Download remote file to temp
-	if err := s.client.Download(ctx, remotePath, tmpPath, false, nil); err != nil {
-		return true, fmt.Errorf("failed to download for hash comparison: %w", err)
+		return true, fmt.Errorf("failed to compute local hash: %w", err)
 	}
 
 	// Compute remote file hash
-	remoteHash, err := ComputeLocalChecksum(tmpPath)
+	remoteHash, err := protocol.RemoteChecksum(ctx, s.client, remotePath, s.hashAlgo)
 	if err != nil {
 		return true, fmt.Errorf("failed to compute remote hash: %w", err)
 	}
@@ -406,7 +594,7 @@ func (s *Syncer) analyzeUpload(localDir, remoteDir string, localMap map[string]o
 			needSync := s.needsSync(localInfo, remoteInfo)
 
 			// For hash comparison, do the actual hash check
-			if needSync && s.options.CompareMethod == CompareByHash {
+			if needSync && s.options.CompareMethod == CompareByHash && localInfo.Size() == remoteInfo.Size {
 				different, err := s.needsSyncByHash(ctx, localPath, remotePath)
 				if err != nil {
 					// On error, assume sync needed
@@ -416,7 +604,7 @@ func (s *Syncer) analyzeUpload(localDir, remoteDir string, localMap map[string]o
 				}
 			}
 
-			if needSync && localInfo.ModTime().After(remoteInfo.ModTime) {
+			if needSync && s.localNewer(localInfo.ModTime(), remoteInfo.ModTime) {
 				actions = append(actions, SyncAction{
 					Type:       "upload",
 					LocalPath:  localPath,
@@ -456,7 +644,7 @@ func (s *Syncer) analyzeDownload(localDir, remoteDir string, localMap map[string
 			needSync := s.needsSync(localInfo, remoteInfo)
 
 			// For hash comparison, do the actual hash check
-			if needSync && s.options.CompareMethod == CompareByHash {
+			if needSync && s.options.CompareMethod == CompareByHash && localInfo.Size() == remoteInfo.Size {
 				different, err := s.needsSyncByHash(ctx, localPath, remotePath)
 				if err != nil {
 					s.log.Warnf("Hash comparison failed for %s: %v", localPath, err)
@@ -465,7 +653,7 @@ func (s *Syncer) analyzeDownload(localDir, remoteDir string, localMap map[string
 				}
 			}
 
-			if needSync && remoteInfo.ModTime.After(localInfo.ModTime()) {
+			if needSync && s.remoteNewer(localInfo.ModTime(), remoteInfo.ModTime) {
 				actions = append(actions, SyncAction{
 					Type:       "download",
 					LocalPath:  localPath,
@@ -521,64 +709,176 @@ func (s *Syncer) analyzeBidirectional(localDir, remoteDir string, localMap map[s
 	for relPath, localInfo := range localMap {
 		localPath := filepath.Join(localDir, relPath)
 		remotePath := filepath.Join(remoteDir, relPath)
+		base := s.baseState(relPath)
 
-		if remoteInfo, exists := remoteMap[relPath]; exists {
-			needSync := s.needsSync(localInfo, remoteInfo)
-
-			// For hash comparison, do the actual hash check
-			if needSync && s.options.CompareMethod == CompareByHash {
-				different, err := s.needsSyncByHash(ctx, localPath, remotePath)
-				if err != nil {
-					s.log.Warnf("Hash comparison failed for %s: %v", localPath, err)
+		remoteInfo, exists := remoteMap[relPath]
+		if !exists {
+			action := SyncAction{
+				Type:       "upload",
+				LocalPath:  localPath,
+				RemotePath: remotePath,
+				Reason:     "file does not exist on remote",
+			}
+			if base != nil {
+				if s.localChanged(ctx, base, localPath, localInfo) {
+					action = newConflictAction(relPath, localPath, remotePath,
+						"file was modified locally and deleted on remote", localInfo, nil)
 				} else {
-					needSync = different
+					action.Type = "delete_local"
+					action.Reason = "file was deleted on remote"
 				}
 			}
+			actions = append(actions, action)
+			continue
+		}
+
+		action := SyncAction{
+			Type:       "skip",
+			LocalPath:  localPath,
+			RemotePath: remotePath,
+			Reason:     "files are identical",
+		}
 
-			if needSync {
-				if localInfo.ModTime().After(remoteInfo.ModTime) {
-					actions = append(actions, SyncAction{
-						Type:       "upload",
-						LocalPath:  localPath,
-						RemotePath: remotePath,
-						Reason:     "local file is newer",
-					})
+		if base != nil {
+			localChanged := s.localChanged(ctx, base, localPath, localInfo)
+			remoteChanged := s.remoteChanged(ctx, base, remotePath, remoteInfo)
+			switch {
+			case localChanged && remoteChanged:
+				if s.filesDiffer(ctx, localPath, remotePath, localInfo, remoteInfo) {
+					action = newConflictAction(relPath, localPath, remotePath,
+						"file was modified on both sides", localInfo, &remoteInfo)
 				} else {
-					actions = append(actions, SyncAction{
-						Type:       "download",
-						LocalPath:  localPath,
-						RemotePath: remotePath,
-						Reason:     "remote file is newer",
-					})
+					action.Reason = "file was modified identically on both sides"
 				}
+			case localChanged:
+				action.Type = "upload"
+				action.Reason = "file was modified locally"
+			case remoteChanged:
+				action.Type = "download"
+				action.Reason = "file was modified on remote"
+			default:
+				action.Reason = "file is unchanged since last sync"
 			}
-		} else {
-			actions = append(actions, SyncAction{
-				Type:       "upload",
-				LocalPath:  localPath,
-				RemotePath: remotePath,
-				Reason:     "file does not exist on remote",
-			})
+			actions = append(actions, action)
+			continue
 		}
+
+		// No sync history for this file: newest wins
+		if s.filesDiffer(ctx, localPath, remotePath, localInfo, remoteInfo) {
+			if s.localNewer(localInfo.ModTime(), remoteInfo.ModTime) {
+				action.Type = "upload"
+				action.Reason = "local file is newer"
+			} else {
+				action.Type = "download"
+				action.Reason = "remote file is newer"
+			}
+		}
+		actions = append(actions, action)
 	}
 
 	// Process remote-only files
-	for relPath := range remoteMap {
-		if _, exists := localMap[relPath]; !exists {
-			localPath := filepath.Join(localDir, relPath)
-			remotePath := filepath.Join(remoteDir, relPath)
-			actions = append(actions, SyncAction{
-				Type:       "download",
-				LocalPath:  localPath,
-				RemotePath: remotePath,
-				Reason:     "file does not exist locally",
-			})
+	for relPath, remoteInfo := range remoteMap {
+		if _, exists := localMap[relPath]; exists {
+			continue
+		}
+
+		localPath := filepath.Join(localDir, relPath)
+		remotePath := filepath.Join(remoteDir, relPath)
+		action := SyncAction{
+			Type:       "download",
+			LocalPath:  localPath,
+			RemotePath: remotePath,
+			Reason:     "file does not exist locally",
 		}
+		if base := s.baseState(relPath); base != nil {
+			if s.remoteChanged(ctx, base, remotePath, remoteInfo) {
+				action = newConflictAction(relPath, localPath, remotePath,
+					"file was deleted locally and modified on remote", nil, &remoteInfo)
+			} else {
+				action.Type = "delete_remote"
+				action.Reason = "file was deleted locally"
+			}
+		}
+		actions = append(actions, action)
 	}
 
 	return actions
 }
 
+// baseState returns the sync history of relPath, or nil if there is none.
+func (s *Syncer) baseState(relPath string) *FileState {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.Get(relPath)
+}
+
+// filesDiffer reports whether the local and remote copies of a file differ
+// according to the configured comparison method.
+func (s *Syncer) filesDiffer(ctx context.Context, localPath, remotePath string, localInfo os.FileInfo, remoteInfo protocol.FileInfo) bool {
+	needSync := s.needsSync(localInfo, remoteInfo)
+
+	// For hash comparison, do the actual hash check
+	if needSync && s.options.CompareMethod == CompareByHash && localInfo.Size() == remoteInfo.Size {
+		different, err := s.needsSyncByHash(ctx, localPath, remotePath)
+		if err != nil {
+			s.log.Warnf("Hash comparison failed for %s: %v", localPath, err)
+		} else {
+			needSync = different
+		}
+	}
+
+	return needSync
+}
+
+// localChanged reports whether the local file changed since the last sync.
+// With CompareByHash, a touched file whose content is unchanged is not
+// considered changed.
+func (s *Syncer) localChanged(ctx context.Context, base *FileState, localPath string, info os.FileInfo) bool {
+	if !base.localChanged(info.Size(), info.ModTime()) {
+		return false
+	}
+	if !s.canCompareHash(ctx, base, info.Size() == base.LocalSize) {
+		return true
+	}
+
+	hash, err := protocol.HashLocalFile(localPath, s.hashAlgo)
+	if err != nil {
+		s.log.Warnf("Hash computation failed for %s: %v", localPath, err)
+		return true
+	}
+	return hash != base.Hash
+}
+
+// remoteChanged reports whether the remote file changed since the last sync.
+func (s *Syncer) remoteChanged(ctx context.Context, base *FileState, remotePath string, info protocol.FileInfo) bool {
+	if !base.remoteChanged(info.Size, info.ModTime) {
+		return false
+	}
+	if !s.canCompareHash(ctx, base, info.Size == base.RemoteSize) {
+		return true
+	}
+
+	hash, err := protocol.RemoteChecksum(ctx, s.client, remotePath, s.hashAlgo)
+	if err != nil {
+		s.log.Warnf("Hash computation failed for %s: %v", remotePath, err)
+		return true
+	}
+	return hash != base.Hash
+}
+
+// canCompareHash reports whether a changed-looking file of unchanged size can
+// be checked against the hash recorded in base.
+func (s *Syncer) canCompareHash(ctx context.Context, base *FileState, sameSize bool) bool {
+	if s.options.CompareMethod != CompareByHash || !sameSize || base.Hash == "" {
+		return false
+	}
+	if s.hashAlgo == "" {
+		s.hashAlgo = protocol.PreferredHashAlgorithm(ctx, s.client)
+	}
+	return base.HashAlgo == s.hashAlgo
+}
+
 // ComputeLocalChecksum computes MD5 checksum of a local file.
 func ComputeLocalChecksum(path string) (string, error) {
 	file, err := os.Open(path)
@@ -0,0 +1,422 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"secure-ftp/internal/transfer"
+)
+
+// Default watch timings.
+const (
+	DefaultWatchDebounce     = 2 * time.Second
+	DefaultWatchPollInterval = 30 * time.Second
+)
+
+// WatchOptions configures continuous synchronization.
+type WatchOptions struct {
+	Debounce     time.Duration // Quiet period after the last local event before syncing
+	PollInterval time.Duration // Remote polling interval in ModeBidirectional and ModeDownload
+
+	// OnQueued is called for each upload queued on the TransferManager
+	OnQueued func(*transfer.TransferItem)
+	// OnSync is called after the initial sync, each batch of local changes,
+	// each queued upload once it has ended and each remote poll
+	OnSync func(*SyncResult)
+}
+
+// Watch performs a full synchronization, then keeps the folders in sync until
+// ctx is cancelled. Local changes are detected with filesystem events,
+// debounced and uploaded individually, through the TransferManager when the
+// syncer has one. In ModeBidirectional (and ModeDownload) the remote side is
+// polled with a full sync, since servers do not push changes.
+func (s *Syncer) Watch(ctx context.Context, localDir, remoteDir string, opts WatchOptions) error {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultWatchPollInterval
+	}
+
+	w := &watchState{
+		syncer:    s,
+		localDir:  localDir,
+		remoteDir: remoteDir,
+		opts:      opts,
+		queued:    make(map[*transfer.TransferItem]bool),
+		ended:     make(chan queuedUpload),
+	}
+
+	if err := w.fullSync(ctx); err != nil {
+		return err
+	}
+
+	var poll <-chan time.Time
+	if s.options.Mode == ModeBidirectional || s.options.Mode == ModeDownload {
+		ticker := time.NewTicker(opts.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	// Local changes are irrelevant when only downloading
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if s.options.Mode != ModeDownload {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("failed to create watcher: %w", err)
+		}
+		defer watcher.Close()
+		w.watcher = watcher
+
+		if err := w.addTree(localDir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", localDir, err)
+		}
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	debounce := time.NewTimer(opts.Debounce)
+	debounce.Stop()
+	pending := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.wg.Wait()
+			return nil
+
+		case upload := <-w.ended:
+			w.uploadEnded(ctx, upload)
+
+		case event := <-events:
+			w.handleEvent(event, pending)
+			debounce.Reset(opts.Debounce)
+
+		case err := <-watchErrors:
+			s.log.Warnf("Watch error on %s: %v", localDir, err)
+
+		case <-debounce.C:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			pending = make(map[string]bool)
+			w.syncPaths(ctx, paths)
+
+		case <-poll:
+			// A full sync would see uploads in flight as conflicts
+			if w.busy() {
+				continue
+			}
+			if err := w.fullSync(ctx); err != nil {
+				s.log.Warnf("Watch poll of %s failed: %v", remoteDir, err)
+			}
+		}
+	}
+}
+
+// watchState holds the state of one Watch call. It is only used by the
+// Watch loop, apart from the goroutines waiting for queued uploads.
+type watchState struct {
+	syncer    *Syncer
+	localDir  string
+	remoteDir string
+	opts      WatchOptions
+	watcher   *fsnotify.Watcher
+
+	// Uploads queued on the TransferManager, until the loop handles their end
+	queued map[*transfer.TransferItem]bool
+	ended  chan queuedUpload
+	wg     gosync.WaitGroup // Goroutines waiting for queued uploads
+}
+
+// queuedUpload is a local change uploaded through the TransferManager.
+type queuedUpload struct {
+	item       *transfer.TransferItem
+	relPath    string
+	localPath  string
+	remotePath string
+}
+
+// fullSync runs a complete Execute and reports it.
+func (w *watchState) fullSync(ctx context.Context) error {
+	result, err := w.syncer.Execute(ctx, w.localDir, w.remoteDir)
+	if err != nil {
+		return err
+	}
+	if w.opts.OnSync != nil {
+		w.opts.OnSync(result)
+	}
+	return nil
+}
+
+// busy reports whether queued uploads are still running. Paused ones do
+// not count, as they may stay paused for good.
+func (w *watchState) busy() bool {
+	for item := range w.queued {
+		if !w.syncer.manager.IsPaused(item.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// addTree watches dir and all its subdirectories (fsnotify is not recursive).
+func (w *watchState) addTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return w.watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// handleEvent records the paths affected by a filesystem event.
+func (w *watchState) handleEvent(event fsnotify.Event, pending map[string]bool) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+
+	pending[event.Name] = true
+
+	// A new directory must be watched too, and files may already have been
+	// written into it before the watch was added
+	if event.Op&fsnotify.Create != 0 {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := w.addTree(event.Name); err != nil {
+				w.syncer.log.Warnf("Failed to watch %s: %v", event.Name, err)
+			}
+			filepath.Walk(event.Name, func(path string, info os.FileInfo, err error) error {
+				if err == nil {
+					pending[path] = true
+				}
+				return nil
+			})
+		}
+	}
+}
+
+// syncPaths propagates a batch of local changes to the remote side.
+func (w *watchState) syncPaths(ctx context.Context, paths []string) {
+	s := w.syncer
+	result := &SyncResult{}
+	startTime := time.Now()
+
+	// Parents sort before their children, so directories are created first
+	sort.Strings(paths)
+
+	// Edited rule files change what the whole tree excludes
+	for _, localPath := range paths {
+		if filepath.Base(localPath) == IgnoreFileName {
+			w.reloadFilter()
+			break
+		}
+	}
+
+	for _, localPath := range paths {
+		relPath, err := filepath.Rel(w.localDir, localPath)
+		if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		remotePath := filepath.Join(w.remoteDir, relPath)
+
+		info, err := os.Stat(localPath)
+		if err == nil {
+			if excluded, _ := s.currentFilter().Explain(relPath, info.IsDir(), info.Size(), info.ModTime()); excluded {
+				continue
+			}
+		} else if excluded, _ := s.currentFilter().Explain(relPath, false, 0, time.Time{}); excluded {
+			continue
+		}
+
+		switch {
+		case err == nil && info.IsDir():
+			if err := s.client.Mkdir(ctx, remotePath); err != nil {
+				// Usually the directory exists already
+				s.log.Debugf("Mkdir %s: %v", remotePath, err)
+			}
+
+		case err == nil:
+			if !w.shouldUpload(ctx, relPath, remotePath, info) {
+				result.FilesSkipped++
+				continue
+			}
+			w.upload(ctx, relPath, localPath, remotePath, result)
+
+		case os.IsNotExist(err):
+			if !w.shouldDelete(ctx, relPath, remotePath) {
+				continue
+			}
+			if err := s.client.Remove(ctx, remotePath); err != nil {
+				if err := s.client.RemoveDir(ctx, remotePath); err != nil {
+					result.Errors = append(result.Errors, fmt.Errorf("delete remote %s: %w", remotePath, err))
+					continue
+				}
+			}
+			result.FilesDeleted++
+			if s.state != nil {
+				s.state.Delete(relPath)
+			}
+		}
+	}
+
+	if s.state != nil {
+		if err := s.state.Save(); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("save sync state: %w", err))
+		}
+	}
+
+	result.Duration = time.Since(startTime)
+	if w.opts.OnSync != nil {
+		w.opts.OnSync(result)
+	}
+}
+
+// reloadFilter rebuilds the sync filter from the current .sftpignore files.
+func (w *watchState) reloadFilter() {
+	s := w.syncer
+	filter, err := NewFilter(s.options)
+	if err != nil {
+		s.log.Warnf("Failed to reload sync rules: %v", err)
+		return
+	}
+	if _, err := s.scanLocalDir(w.localDir, filter); err != nil {
+		s.log.Warnf("Failed to reload sync rules: %v", err)
+		return
+	}
+	s.setFilter(filter)
+}
+
+// shouldUpload reports whether a locally changed file must be uploaded.
+// In ModeBidirectional, files that did not change since the last sync (e.g.
+// just downloaded) are skipped, and files also changed on the remote side
+// are left for the next poll to report as conflicts.
+func (w *watchState) shouldUpload(ctx context.Context, relPath, remotePath string, info os.FileInfo) bool {
+	s := w.syncer
+	base := s.baseState(relPath)
+	if base == nil {
+		return true
+	}
+	if !s.localChanged(ctx, base, filepath.Join(w.localDir, relPath), info) {
+		return false
+	}
+
+	remoteInfo, err := s.client.Stat(ctx, remotePath)
+	if err != nil {
+		return false
+	}
+	return !s.remoteChanged(ctx, base, remotePath, *remoteInfo)
+}
+
+// shouldDelete reports whether a locally deleted path must be deleted remotely.
+func (w *watchState) shouldDelete(ctx context.Context, relPath, remotePath string) bool {
+	s := w.syncer
+	switch s.options.Mode {
+	case ModeMirror:
+		return s.options.DeleteExtra
+	case ModeBidirectional:
+		base := s.baseState(relPath)
+		if base == nil {
+			return false
+		}
+		remoteInfo, err := s.client.Stat(ctx, remotePath)
+		if err != nil {
+			return false
+		}
+		return !s.remoteChanged(ctx, base, remotePath, *remoteInfo)
+	default:
+		return false
+	}
+}
+
+// upload sends one file, through the TransferManager if there is one.
+func (w *watchState) upload(ctx context.Context, relPath, localPath, remotePath string, result *SyncResult) {
+	s := w.syncer
+	action := SyncAction{Type: "upload", LocalPath: localPath, RemotePath: remotePath}
+
+	if s.manager == nil {
+		if err := s.upload(ctx, localPath, remotePath); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("upload %s: %w", localPath, err))
+			return
+		}
+		result.FilesUploaded++
+		if info, err := os.Stat(localPath); err == nil {
+			result.BytesTransferred += info.Size()
+		}
+		s.stampUpload(ctx, localPath, remotePath)
+		s.recordState(ctx, relPath, action, nil, nil)
+		return
+	}
+
+	// The upload is counted once it has ended, see uploadEnded
+	var item *transfer.TransferItem
+	if s.options.AtomicUploads {
+		item = s.manager.AddAtomicUpload(localPath, remotePath, 0)
+	} else {
+		item = s.manager.AddUpload(localPath, remotePath, 0)
+	}
+	if w.opts.OnQueued != nil {
+		w.opts.OnQueued(item)
+	}
+
+	// The loop records the result, so that the client and the sync state
+	// are only used by one goroutine
+	w.queued[item] = true
+	upload := queuedUpload{item: item, relPath: relPath, localPath: localPath, remotePath: remotePath}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		select {
+		case <-item.Done():
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case w.ended <- upload:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// uploadEnded records a queued upload once it has ended and reports it.
+func (w *watchState) uploadEnded(ctx context.Context, upload queuedUpload) {
+	s := w.syncer
+	item := upload.item
+	delete(w.queued, item)
+
+	result := &SyncResult{}
+	switch item.Status {
+	case transfer.StatusCompleted:
+		result.FilesUploaded = 1
+		result.BytesTransferred = item.TotalBytes
+		result.Duration = item.EndTime.Sub(item.StartTime)
+		s.stampUpload(ctx, upload.localPath, upload.remotePath)
+		if s.state != nil {
+			action := SyncAction{Type: "upload", LocalPath: upload.localPath, RemotePath: upload.remotePath}
+			s.recordState(ctx, upload.relPath, action, nil, nil)
+			if err := s.state.Save(); err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("save sync state: %w", err))
+			}
+		}
+	case transfer.StatusFailed:
+		result.Errors = append(result.Errors, fmt.Errorf("upload %s: %w", upload.localPath, item.Error))
+	default:
+		// Cancelled by the user
+		return
+	}
+
+	if w.opts.OnSync != nil {
+		w.opts.OnSync(result)
+	}
+}
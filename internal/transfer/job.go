@@ -0,0 +1,600 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"secure-ftp/internal/protocol"
+)
+
+// TransferJob is a recursive directory transfer. Its tree is scanned in the
+// background: directories are created on the destination side and each file
+// is queued as a child TransferItem. The job reports aggregate progress and
+// is paused, resumed, cancelled or retried as a unit.
+type TransferJob struct {
+	ID         string
+	Direction  TransferDirection
+	LocalPath  string
+	RemotePath string
+	Priority   int
+	Error      error // Set when the tree could not be scanned or created
+
+	items     []*TransferItem
+	running   int  // Child items that have not ended yet
+	scanning  bool // Tree walk in progress
+	scanned   bool // Tree walk completed, every file is queued
+	paused    bool // New child items are queued paused
+	cancelled bool // Cancelled as a whole
+
+	onEnded func(*TransferJob)
+	mu      sync.RWMutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// Items returns the child transfers queued so far.
+func (j *TransferJob) Items() []*TransferItem {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	result := make([]*TransferItem, len(j.items))
+	copy(result, j.items)
+	return result
+}
+
+// Status returns the overall state of the job, derived from its children.
+func (j *TransferJob) Status() TransferStatus {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if j.cancelled && j.ended() {
+		return StatusCancelled
+	}
+
+	counts := make(map[TransferStatus]int)
+	for _, item := range j.items {
+		counts[item.Status]++
+	}
+	ended := counts[StatusCompleted] + counts[StatusFailed] + counts[StatusCancelled]
+
+	switch {
+	case j.scanning || counts[StatusInProgress] > 0:
+		return StatusInProgress
+	case counts[StatusPending] > 0 && ended > 0:
+		return StatusInProgress
+	case counts[StatusPending] > 0:
+		return StatusPending
+	case counts[StatusPaused] > 0:
+		return StatusPaused
+	case j.Error != nil || counts[StatusFailed] > 0:
+		return StatusFailed
+	case counts[StatusCancelled] > 0:
+		return StatusCancelled
+	default:
+		return StatusCompleted
+	}
+}
+
+// TotalBytes returns the size of all files queued so far.
+func (j *TransferJob) TotalBytes() int64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	var total int64
+	for _, item := range j.items {
+		total += item.TotalBytes
+	}
+	return total
+}
+
+// TransferredBytes returns the bytes transferred by all children.
+func (j *TransferJob) TransferredBytes() int64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	var transferred int64
+	for _, item := range j.items {
+		transferred += item.TransferredBytes
+	}
+	return transferred
+}
+
+// BytesPerSecond returns the combined speed of the running children.
+func (j *TransferJob) BytesPerSecond() int64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	var speed int64
+	for _, item := range j.items {
+		if item.Status == StatusInProgress {
+			speed += item.BytesPerSecond
+		}
+	}
+	return speed
+}
+
+// Progress returns the job progress as a percentage.
+func (j *TransferJob) Progress() float64 {
+	total := j.TotalBytes()
+	if total == 0 {
+		return 0
+	}
+	return float64(j.TransferredBytes()) / float64(total) * 100
+}
+
+// FileCounts returns the number of completed child transfers and the number
+// of files queued so far.
+func (j *TransferJob) FileCounts() (completed, total int) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	for _, item := range j.items {
+		if item.Status == StatusCompleted {
+			completed++
+		}
+	}
+	return completed, len(j.items)
+}
+
+// ended reports whether nothing is left to run (caller must hold lock).
+func (j *TransferJob) ended() bool {
+	return j.running == 0 && !j.scanning
+}
+
+// childEnded accounts for a child item that has ended. It may be called with
+// the manager lock held, so the completion callback runs in its own goroutine.
+func (j *TransferJob) childEnded() {
+	j.mu.Lock()
+	j.running--
+	ended := j.ended()
+	j.mu.Unlock()
+
+	if ended && j.onEnded != nil {
+		go j.onEnded(j)
+	}
+}
+
+// AddUploadDir queues the recursive upload of localDir to remoteDir.
+func (m *TransferManager) AddUploadDir(localDir, remoteDir string, priority int) *TransferJob {
+	return m.addJob(DirectionUpload, localDir, remoteDir, priority)
+}
+
+// AddDownloadDir queues the recursive download of remoteDir to localDir.
+func (m *TransferManager) AddDownloadDir(remoteDir, localDir string, priority int) *TransferJob {
+	return m.addJob(DirectionDownload, localDir, remoteDir, priority)
+}
+
+func (m *TransferManager) addJob(direction TransferDirection, localDir, remoteDir string, priority int) *TransferJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(m.ctx)
+
+	m.idCounter++
+	job := &TransferJob{
+		ID:         fmt.Sprintf("job-%s-%d", m.idPrefix, m.idCounter),
+		Direction:  direction,
+		LocalPath:  localDir,
+		RemotePath: remoteDir,
+		Priority:   priority,
+		scanning:   true,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	job.onEnded = m.jobEnded
+	m.jobs[job.ID] = job
+
+	m.wg.Add(1)
+	go m.scanJob(job)
+
+	return job
+}
+
+// restoreJob returns the job of a file restored from the journal, recreating
+// it on first use (caller must hold lock). Its tree walk is not resumed: the
+// job only runs the files that were journaled.
+func (m *TransferManager) restoreJob(info *ResumeInfo) *TransferJob {
+	if job, ok := m.jobs[info.JobID]; ok {
+		return job
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	job := &TransferJob{
+		ID:         info.JobID,
+		Direction:  info.Direction,
+		LocalPath:  info.JobLocalPath,
+		RemotePath: info.JobRemotePath,
+		Priority:   info.Priority,
+		scanned:    true,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	if job.LocalPath == "" {
+		job.LocalPath = filepath.Dir(info.LocalPath)
+		job.RemotePath = path.Dir(info.RemotePath)
+	}
+	job.onEnded = m.jobEnded
+	m.jobs[job.ID] = job
+	return job
+}
+
+// GetJob returns a directory transfer by ID, or nil.
+func (m *TransferManager) GetJob(id string) *TransferJob {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.jobs[id]
+}
+
+// SetJobCompleteCallback sets the callback called each time a directory
+// transfer has no more running children.
+func (m *TransferManager) SetJobCompleteCallback(fn func(*TransferJob)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onJobComplete = fn
+}
+
+// scanJob walks the job tree, creates the directories and queues the files.
+func (m *TransferManager) scanJob(job *TransferJob) {
+	defer m.wg.Done()
+
+	m.mu.RLock()
+	pool := m.pool
+	m.mu.RUnlock()
+
+	client := m.client
+	var err error
+	if pool != nil {
+		client, err = pool.Acquire(job.ctx)
+	}
+
+	if err == nil {
+		if job.Direction == DirectionUpload {
+			err = m.scanLocalTree(job, client)
+		} else {
+			err = m.scanRemoteTree(job, client)
+		}
+		if pool != nil {
+			pool.Release(client, err != nil)
+		}
+	}
+
+	job.mu.Lock()
+	job.scanning = false
+	if err != nil && job.ctx.Err() == nil {
+		job.Error = err
+	} else if err == nil {
+		job.scanned = true
+	}
+	ended := job.ended()
+	job.mu.Unlock()
+
+	if err != nil && m.log != nil {
+		m.log.Warnf("Directory transfer %s stopped: %v", job.LocalPath, err)
+	}
+
+	if ended {
+		m.jobEnded(job)
+	}
+}
+
+// scanLocalTree creates the remote skeleton of an upload and queues its files.
+// Symbolic links are recreated rather than followed.
+func (m *TransferManager) scanLocalTree(job *TransferJob, client protocol.Protocol) error {
+	return filepath.Walk(job.LocalPath, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := job.ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(job.LocalPath, localPath)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(job.RemotePath, filepath.ToSlash(relPath))
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(localPath)
+			if err == nil {
+				err = client.Symlink(job.ctx, target, remotePath)
+			}
+			m.symlinkFailed(localPath, err)
+			return nil
+		}
+		if info.IsDir() {
+			return mkdirRemote(job.ctx, client, remotePath)
+		}
+		if info.Mode().IsRegular() {
+			m.addJobItem(job, localPath, remotePath, info.Size())
+		}
+		return nil
+	})
+}
+
+// scanRemoteTree creates the local skeleton of a download and queues its
+// files. Symbolic links are recreated rather than followed, even those that
+// MLSD reports as directories.
+func (m *TransferManager) scanRemoteTree(job *TransferJob, client protocol.Protocol) error {
+	var scan func(remoteDir, localDir string) error
+	scan = func(remoteDir, localDir string) error {
+		if err := os.MkdirAll(localDir, 0755); err != nil {
+			return err
+		}
+
+		entries, err := client.List(job.ctx, remoteDir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := job.ctx.Err(); err != nil {
+				return err
+			}
+			// Incomplete files of atomic uploads are not worth a copy
+			if entry.Name == "." || entry.Name == ".." || protocol.IsPartialUpload(entry.Name) {
+				continue
+			}
+
+			remotePath := path.Join(remoteDir, entry.Name)
+			localPath := filepath.Join(localDir, entry.Name)
+			if entry.IsSymlink || entry.LinkTarget != "" {
+				target, err := entry.LinkTarget, error(nil)
+				if target == "" {
+					target, err = client.ReadLink(job.ctx, remotePath)
+				}
+				if err == nil {
+					err = os.Symlink(target, localPath)
+				}
+				m.symlinkFailed(remotePath, err)
+				continue
+			}
+			if entry.IsDir {
+				if err := scan(remotePath, localPath); err != nil {
+					return err
+				}
+			} else {
+				m.addJobItem(job, localPath, remotePath, entry.Size)
+			}
+		}
+		return nil
+	}
+
+	return scan(job.RemotePath, job.LocalPath)
+}
+
+// symlinkFailed reports a symbolic link that could not be recreated. It does
+// not stop the job.
+func (m *TransferManager) symlinkFailed(linkPath string, err error) {
+	if err != nil && m.log != nil {
+		m.log.Warnf("Symbolic link %s not copied: %v", linkPath, err)
+	}
+}
+
+// mkdirRemote creates a remote directory unless it already exists.
+func mkdirRemote(ctx context.Context, client protocol.Protocol, dir string) error {
+	if info, err := client.Stat(ctx, dir); err == nil {
+		if !info.IsDir {
+			return fmt.Errorf("%s exists and is not a directory", dir)
+		}
+		return nil
+	}
+	return client.Mkdir(ctx, dir)
+}
+
+// addJobItem queues one file of a job. Files already queued by a previous
+// walk of the same job are skipped.
+func (m *TransferManager) addJobItem(job *TransferJob, localPath, remotePath string, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if job.cancelled {
+		return
+	}
+	for _, existing := range job.items {
+		if existing.LocalPath == localPath {
+			return
+		}
+	}
+
+	item := m.newJobItem(job, localPath, remotePath, false)
+	item.TotalBytes = size
+	job.items = append(job.items, item)
+	job.running++
+	m.enqueue(item)
+
+	go m.processQueue()
+}
+
+// newJobItem creates a child item of job (caller must hold both locks).
+func (m *TransferManager) newJobItem(job *TransferJob, localPath, remotePath string, restart bool) *TransferItem {
+	ctx, cancel := context.WithCancel(job.ctx)
+
+	status := StatusPending
+	if job.paused {
+		status = StatusPaused
+	}
+
+	return &TransferItem{
+		ID:         m.nextID(),
+		Direction:  job.Direction,
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Status:     status,
+		Priority:   job.Priority,
+		JobID:      job.ID,
+		restart:    restart,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		job:        job,
+	}
+}
+
+// retryJobItem replaces a failed child of job with a new item, which the
+// caller queues (caller must hold the manager lock).
+func (m *TransferManager) retryJobItem(job *TransferJob, item *TransferItem) *TransferItem {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	// Children of a cancelled job need a live context again
+	if job.ctx.Err() != nil {
+		job.ctx, job.cancel = context.WithCancel(m.ctx)
+		job.cancelled = false
+	}
+
+	newItem := m.newJobItem(job, item.LocalPath, item.RemotePath, errors.Is(item.Error, ErrChecksumMismatch))
+	newItem.TotalBytes = item.TotalBytes
+	newItem.atomic = item.atomic
+	for i, existing := range job.items {
+		if existing == item {
+			job.items[i] = newItem
+		}
+	}
+	job.running++
+	return newItem
+}
+
+// jobEnded reports a job with no more running children.
+func (m *TransferManager) jobEnded(job *TransferJob) {
+	m.mu.RLock()
+	fn := m.onJobComplete
+	m.mu.RUnlock()
+
+	if fn != nil {
+		fn(job)
+	}
+}
+
+// PauseJob pauses the pending and running children of a job. Files queued
+// later by the tree walk are queued paused too.
+func (m *TransferManager) PauseJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.paused = true
+	for _, item := range job.items {
+		m.pauseItem(item)
+	}
+	return nil
+}
+
+// ResumeJob resumes the paused children of a job.
+func (m *TransferManager) ResumeJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.paused = false
+	for _, item := range job.items {
+		if item.Status == StatusPaused {
+			m.resumeItem(item, job.ctx)
+		}
+	}
+
+	go m.processQueue()
+	return nil
+}
+
+// CancelJob stops the tree walk and cancels every unfinished child of a job.
+func (m *TransferManager) CancelJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+
+	job.mu.Lock()
+	job.cancelled = true
+	items := make([]*TransferItem, len(job.items))
+	copy(items, job.items)
+	job.mu.Unlock()
+
+	// Running children are cancelled through the job context and end in
+	// executeTransfer; the others end here
+	job.cancel()
+	for _, item := range items {
+		item.pausing = false
+		if item.Status == StatusPending || item.Status == StatusPaused {
+			item.Status = StatusCancelled
+			if m.journal != nil {
+				m.journal.CompleteTransfer(item.ID)
+			}
+			item.finish()
+		}
+	}
+	return nil
+}
+
+// RetryJob re-queues the failed and cancelled children of an ended job, and
+// resumes its tree walk if it did not complete.
+func (m *TransferManager) RetryJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if !job.ended() {
+		return fmt.Errorf("job still running: %s", id)
+	}
+
+	job.ctx, job.cancel = context.WithCancel(m.ctx)
+	job.Error = nil
+	job.paused = false
+	job.cancelled = false
+
+	for i, item := range job.items {
+		if item.Status != StatusFailed && item.Status != StatusCancelled {
+			continue
+		}
+		if m.journal != nil {
+			m.journal.CompleteTransfer(item.ID)
+		}
+
+		newItem := m.newJobItem(job, item.LocalPath, item.RemotePath, errors.Is(item.Error, ErrChecksumMismatch))
+		newItem.TotalBytes = item.TotalBytes
+		newItem.atomic = item.atomic
+		job.items[i] = newItem
+		job.running++
+		m.enqueue(newItem)
+	}
+
+	if !job.scanned {
+		job.scanning = true
+		m.wg.Add(1)
+		go m.scanJob(job)
+	}
+
+	go m.processQueue()
+	return nil
+}
@@ -3,7 +3,10 @@ package transfer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -64,9 +67,35 @@ type TransferItem struct {
 	StartTime      time.Time
 	EndTime        time.Time
 	Priority       int // Higher = more priority
+	JobID          string // Parent directory transfer, if any
+	Attempts       int       // Attempts made by the current run
+	RetryAt        time.Time // Next automatic attempt after a transient failure
+
+	job     *TransferJob
+	restart bool // Ignore partial data, e.g. after a checksum mismatch
+	atomic  bool // Upload to a temporary name, then rename
+	pausing bool // Pause requested while in progress
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	done     chan struct{} // Closed once the transfer has ended
+	doneOnce sync.Once
+}
 
-	ctx    context.Context
-	cancel context.CancelFunc
+// Done returns a channel that is closed when the transfer has completed,
+// failed or been cancelled.
+func (t *TransferItem) Done() <-chan struct{} {
+	return t.done
+}
+
+// finish closes the Done channel and notifies the parent job.
+func (t *TransferItem) finish() {
+	t.doneOnce.Do(func() {
+		close(t.done)
+		if t.job != nil {
+			t.job.childEnded()
+		}
+	})
 }
 
 // Progress returns the transfer progress as a percentage.
@@ -89,16 +118,29 @@ func (t *TransferItem) RemainingTime() time.Duration {
 // TransferManager manages file transfers with a concurrent queue.
 type TransferManager struct {
 	client      protocol.Protocol
+	pool        *protocol.ConnectionPool // Optional, one connection per transfer
 	queue       []*TransferItem
 	history     []*TransferItem
+	jobs        map[string]*TransferJob
 	maxParallel int
+	verify      bool // Compare checksums after each transfer
+	atomic      bool // Upload to a temporary name, then rename
+	retry       RetryPolicy
 	active      int
 	mu          sync.RWMutex
 	log         *logger.Logger
 
-	onUpdate   func(*TransferItem)
-	onComplete func(*TransferItem)
+	reconnectMu sync.Mutex // Serializes reconnections of client
+
+	onUpdate      func(*TransferItem)
+	onComplete    func(*TransferItem)
+	onJobComplete func(*TransferJob)
 
+	// Optional on-disk journal of the queue
+	journal   *ResumeManager
+	profileID string
+
+	idPrefix  string // Keeps IDs unique across sessions sharing a journal
 	idCounter int
 	wg        sync.WaitGroup
 	ctx       context.Context
@@ -112,13 +154,62 @@ func NewTransferManager(client protocol.Protocol, maxParallel int) *TransferMana
 		client:      client,
 		queue:       make([]*TransferItem, 0),
 		history:     make([]*TransferItem, 0),
+		jobs:        make(map[string]*TransferJob),
 		maxParallel: maxParallel,
+		retry:       DefaultRetryPolicy(),
 		log:         logger.GetInstance(),
+		idPrefix:    strconv.FormatInt(time.Now().UnixNano(), 36),
 		ctx:         ctx,
 		cancel:      cancel,
 	}
 }
 
+// SetJournal records every queued transfer of profileID in journal so that
+// unfinished ones can be restored after a restart. Completed and cancelled
+// transfers are removed from it; transfers interrupted by Stop are kept.
+func (m *TransferManager) SetJournal(journal *ResumeManager, profileID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.journal = journal
+	m.profileID = profileID
+}
+
+// SetConnectionPool makes each transfer lease its own connection from pool
+// instead of sharing the client. This is required for parallel FTP/FTPS
+// transfers. The pool is resized with SetMaxParallel and closed by Stop.
+func (m *TransferManager) SetConnectionPool(pool *protocol.ConnectionPool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pool = pool
+	if pool != nil {
+		pool.SetMaxSize(m.maxParallel)
+	}
+}
+
+// SetVerify enables a full checksum comparison after each transfer.
+// Transfers whose copies differ are marked as failed.
+func (m *TransferManager) SetVerify(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verify = enabled
+}
+
+// SetAtomicUploads makes every upload write to a temporary name and replace
+// the target only once complete (see protocol.UploadAtomic).
+func (m *TransferManager) SetAtomicUploads(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.atomic = enabled
+}
+
+// SetRetryPolicy sets how transfers failing with a transient error are
+// retried. DefaultRetryPolicy is used until it is called.
+func (m *TransferManager) SetRetryPolicy(policy RetryPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retry = policy
+}
+
 // SetUpdateCallback sets the callback for transfer updates.
 func (m *TransferManager) SetUpdateCallback(fn func(*TransferItem)) {
 	m.mu.Lock()
@@ -135,33 +226,110 @@ func (m *TransferManager) SetCompleteCallback(fn func(*TransferItem)) {
 
 // AddUpload queues an upload task.
 func (m *TransferManager) AddUpload(localPath, remotePath string, priority int) *TransferItem {
-	return m.addTransfer(DirectionUpload, localPath, remotePath, priority)
+	return m.addTransfer(DirectionUpload, localPath, remotePath, priority, false)
+}
+
+// AddAtomicUpload queues an upload task that writes to a temporary name,
+// whether or not SetAtomicUploads is enabled.
+func (m *TransferManager) AddAtomicUpload(localPath, remotePath string, priority int) *TransferItem {
+	return m.addTransfer(DirectionUpload, localPath, remotePath, priority, true)
 }
 
 // AddDownload queues a download task.
 func (m *TransferManager) AddDownload(remotePath, localPath string, priority int) *TransferItem {
-	return m.addTransfer(DirectionDownload, localPath, remotePath, priority)
+	return m.addTransfer(DirectionDownload, localPath, remotePath, priority, false)
 }
 
-func (m *TransferManager) addTransfer(direction TransferDirection, localPath, remotePath string, priority int) *TransferItem {
+func (m *TransferManager) addTransfer(direction TransferDirection, localPath, remotePath string, priority int, atomic bool) *TransferItem {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.idCounter++
 	ctx, cancel := context.WithCancel(m.ctx)
 
 	item := &TransferItem{
-		ID:         fmt.Sprintf("transfer-%d", m.idCounter),
+		ID:         m.nextID(),
 		Direction:  direction,
 		LocalPath:  localPath,
 		RemotePath: remotePath,
 		Status:     StatusPending,
 		Priority:   priority,
+		atomic:     atomic,
 		ctx:        ctx,
 		cancel:     cancel,
+		done:       make(chan struct{}),
 	}
 
-	// Insert in priority order
+	m.enqueue(item)
+
+	// Try to start more transfers
+	go m.processQueue()
+
+	return item
+}
+
+// Restore re-queues transfers saved in the journal by a previous session.
+// Paused transfers stay paused; the others resume from their byte offset.
+// Files of a directory transfer rejoin their job, see GetJob.
+func (m *TransferManager) Restore(infos []*ResumeInfo) []*TransferItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := make([]*TransferItem, 0, len(infos))
+	for _, info := range infos {
+		var job *TransferJob
+		parent := m.ctx
+		if info.JobID != "" {
+			job = m.restoreJob(info)
+			parent = job.ctx
+		}
+		ctx, cancel := context.WithCancel(parent)
+
+		status := StatusPending
+		if info.Status == StatusPaused {
+			status = StatusPaused
+		}
+
+		item := &TransferItem{
+			ID:               info.ID,
+			Direction:        info.Direction,
+			LocalPath:        info.LocalPath,
+			RemotePath:       info.RemotePath,
+			TotalBytes:       info.TotalBytes,
+			TransferredBytes: info.TransferredBytes,
+			Status:           status,
+			Priority:         info.Priority,
+			JobID:            info.JobID,
+			job:              job,
+			atomic:           info.Atomic,
+			restart:          strings.HasPrefix(info.Error, ErrChecksumMismatch.Error()),
+			ctx:              ctx,
+			cancel:           cancel,
+			done:             make(chan struct{}),
+		}
+		if job != nil {
+			job.mu.Lock()
+			job.items = append(job.items, item)
+			job.running++
+			job.mu.Unlock()
+		}
+
+		m.enqueue(item)
+		items = append(items, item)
+	}
+
+	go m.processQueue()
+
+	return items
+}
+
+// nextID returns a new transfer ID (caller must hold lock).
+func (m *TransferManager) nextID() string {
+	m.idCounter++
+	return fmt.Sprintf("transfer-%s-%d", m.idPrefix, m.idCounter)
+}
+
+// enqueue inserts an item in priority order and journals it (caller must hold lock).
+func (m *TransferManager) enqueue(item *TransferItem) {
 	inserted := false
 	for i, existing := range m.queue {
 		if item.Priority > existing.Priority {
@@ -174,10 +342,14 @@ func (m *TransferManager) addTransfer(direction TransferDirection, localPath, re
 		m.queue = append(m.queue, item)
 	}
 
-	// Try to start more transfers
-	go m.processQueue()
-
-	return item
+	// An upload keeps the mode it was queued with, so that once restored it
+	// resumes into the same temporary file
+	if m.atomic && item.Direction == DirectionUpload {
+		item.atomic = true
+	}
+	if m.journal != nil {
+		m.journal.TrackItem(m.profileID, item)
+	}
 }
 
 // processQueue starts pending transfers if slots are available.
@@ -218,11 +390,22 @@ func (m *TransferManager) executeTransfer(item *TransferItem) {
 		go m.processQueue()
 	}()
 
+	m.mu.RLock()
+	journal := m.journal
+	m.mu.RUnlock()
+	if journal != nil {
+		journal.SetStatus(item.ID, StatusInProgress)
+	}
+
 	progressFn := func(progress protocol.TransferProgress) {
 		item.TotalBytes = progress.TotalBytes
 		item.TransferredBytes = progress.TransferredBytes
 		item.BytesPerSecond = progress.BytesPerSecond
 
+		if journal != nil {
+			journal.UpdateProgress(item.ID, progress.TransferredBytes, progress.TotalBytes)
+		}
+
 		if m.onUpdate != nil {
 			m.onUpdate(item)
 		}
@@ -231,10 +414,61 @@ func (m *TransferManager) executeTransfer(item *TransferItem) {
 	var err error
 	startTime := time.Now()
 
-	if item.Direction == DirectionUpload {
-		err = m.client.Upload(item.ctx, item.LocalPath, item.RemotePath, true, progressFn)
-	} else {
-		err = m.client.Download(item.ctx, item.RemotePath, item.LocalPath, true, progressFn)
+	m.mu.RLock()
+	pool := m.pool
+	verify := m.verify
+	atomic := m.atomic || item.atomic
+	retry := m.retry
+	m.mu.RUnlock()
+
+	for attempt := 1; ; attempt++ {
+		item.Attempts = attempt
+		err = m.attemptTransfer(item, pool, verify, atomic, progressFn)
+		if err == nil || item.ctx.Err() != nil || !retry.ShouldRetry(err, attempt) {
+			break
+		}
+
+		// Transient failure: wait, then resume from the bytes already transferred
+		delay := retry.Delay(attempt)
+		if m.log != nil {
+			m.log.Warnf("Transfer of %s failed (attempt %d/%d), retrying in %s: %v",
+				item.RemotePath, attempt, retry.MaxAttempts, delay.Round(time.Second), err)
+		}
+		item.Error = err
+		item.RetryAt = time.Now().Add(delay)
+		item.BytesPerSecond = 0
+		item.restart = false // The partial data now comes from this transfer
+		if m.onUpdate != nil {
+			m.onUpdate(item)
+		}
+
+		waitErr := sleepContext(item.ctx, delay)
+		item.Error = nil
+		item.RetryAt = time.Time{}
+		if waitErr != nil {
+			err = waitErr
+			break
+		}
+	}
+
+	// A paused transfer keeps its place in the queue and resumes later from
+	// the bytes already transferred
+	m.mu.Lock()
+	paused := err != nil && item.pausing
+	item.pausing = false
+	if paused {
+		item.Status = StatusPaused
+		item.BytesPerSecond = 0
+	}
+	m.mu.Unlock()
+	if paused {
+		if journal != nil {
+			journal.PauseTransfer(item.ID, item.TransferredBytes, item.TotalBytes)
+		}
+		if m.onUpdate != nil {
+			m.onUpdate(item)
+		}
+		return
 	}
 
 	item.EndTime = time.Now()
@@ -251,6 +485,18 @@ func (m *TransferManager) executeTransfer(item *TransferItem) {
 		item.Status = StatusCompleted
 	}
 
+	if journal != nil {
+		switch {
+		case item.Status == StatusFailed:
+			journal.FailTransfer(item.ID, item.TransferredBytes, err)
+		case item.Status == StatusCancelled && m.ctx.Err() != nil:
+			// Interrupted by Stop (disconnect or exit): keep it for next time
+			journal.SetStatus(item.ID, StatusPending)
+		default:
+			journal.CompleteTransfer(item.ID)
+		}
+	}
+
 	// Log transfer
 	if m.log != nil {
 		direction := "download"
@@ -271,11 +517,74 @@ func (m *TransferManager) executeTransfer(item *TransferItem) {
 	}
 	m.mu.Unlock()
 
+	item.finish()
+
 	if m.onComplete != nil {
 		m.onComplete(item)
 	}
 }
 
+// attemptTransfer makes one attempt at item, on a pooled connection or on the
+// shared client, which is reconnected first if its connection was lost.
+func (m *TransferManager) attemptTransfer(item *TransferItem, pool *protocol.ConnectionPool, verify, atomic bool, progressFn func(protocol.TransferProgress)) error {
+	client := m.client
+	if pool != nil {
+		// Lease a dedicated connection; broken ones are replaced by the pool
+		var err error
+		if client, err = pool.Acquire(item.ctx); err != nil {
+			return err
+		}
+	} else if err := m.reconnect(item.ctx); err != nil {
+		return fmt.Errorf("reconnection failed: %w", err)
+	}
+
+	var err error
+	resume := !item.restart
+	switch {
+	case item.Direction == DirectionUpload && atomic:
+		// Verified before the rename, so that a corrupt copy never replaces
+		// the target
+		err = protocol.UploadAtomic(item.ctx, client, item.LocalPath, item.RemotePath, resume, verify, progressFn)
+		verify = false
+	case item.Direction == DirectionUpload:
+		err = client.Upload(item.ctx, item.LocalPath, item.RemotePath, resume, progressFn)
+	default:
+		err = client.Download(item.ctx, item.RemotePath, item.LocalPath, resume, progressFn)
+	}
+
+	if err == nil && verify {
+		err = VerifyTransfer(item.ctx, client, item.LocalPath, item.RemotePath)
+	}
+
+	// An interrupted FTP data transfer leaves the control connection unusable
+	if pool != nil {
+		pool.Release(client, err != nil)
+	}
+
+	return err
+}
+
+// reconnect reopens the shared client with its stored ConnectionConfig if
+// its connection was lost. Transfers that failed together reconnect it once.
+func (m *TransferManager) reconnect(ctx context.Context) error {
+	m.reconnectMu.Lock()
+	defer m.reconnectMu.Unlock()
+
+	if m.client.IsConnected() {
+		return nil
+	}
+
+	reconnector, ok := m.client.(protocol.Reconnector)
+	if !ok {
+		return protocol.ErrNotConnected
+	}
+
+	if m.log != nil {
+		m.log.Infof("Connection to the %s server lost, reconnecting", m.client.GetProtocolName())
+	}
+	return reconnector.Reconnect(ctx)
+}
+
 // removeFromQueue removes an item from the queue by ID.
 func (m *TransferManager) removeFromQueue(id string) {
 	for i, item := range m.queue {
@@ -294,9 +603,14 @@ func (m *TransferManager) Cancel(id string) error {
 	for _, item := range m.queue {
 		if item.ID == id {
 			if item.Status == StatusInProgress {
+				item.pausing = false
 				item.cancel()
 			} else {
 				item.Status = StatusCancelled
+				if m.journal != nil {
+					m.journal.CompleteTransfer(item.ID)
+				}
+				item.finish()
 			}
 			return nil
 		}
@@ -310,22 +624,33 @@ func (m *TransferManager) CancelAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// Pending transfers stay journaled when the manager itself is stopping
+	stopping := m.ctx.Err() != nil
+
 	for _, item := range m.queue {
 		if item.Status == StatusPending || item.Status == StatusInProgress {
+			pending := item.Status == StatusPending
+			if pending && m.journal != nil && !stopping {
+				m.journal.CompleteTransfer(item.ID)
+			}
+			item.pausing = false
 			item.cancel()
 			item.Status = StatusCancelled
+			if pending {
+				item.finish()
+			}
 		}
 	}
 }
 
-// Pause pauses a transfer (only pending transfers).
+// Pause pauses a transfer. A transfer in progress is interrupted and frees
+// its slot; Resume continues it from the bytes already transferred.
 func (m *TransferManager) Pause(id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for _, item := range m.queue {
-		if item.ID == id && item.Status == StatusPending {
-			item.Status = StatusPaused
+		if item.ID == id && m.pauseItem(item) {
 			return nil
 		}
 	}
@@ -333,6 +658,25 @@ func (m *TransferManager) Pause(id string) error {
 	return fmt.Errorf("cannot pause transfer: %s", id)
 }
 
+// pauseItem pauses a pending or in-progress item (caller must hold lock).
+// An item in progress becomes paused once executeTransfer has stopped it.
+func (m *TransferManager) pauseItem(item *TransferItem) bool {
+	switch item.Status {
+	case StatusPending:
+		item.Status = StatusPaused
+		if m.journal != nil {
+			m.journal.SetStatus(item.ID, StatusPaused)
+		}
+		return true
+	case StatusInProgress:
+		item.pausing = true
+		item.cancel()
+		return true
+	default:
+		return false
+	}
+}
+
 // Resume resumes a paused transfer.
 func (m *TransferManager) Resume(id string) error {
 	m.mu.Lock()
@@ -340,7 +684,11 @@ func (m *TransferManager) Resume(id string) error {
 
 	for _, item := range m.queue {
 		if item.ID == id && item.Status == StatusPaused {
-			item.Status = StatusPending
+			parent := m.ctx
+			if item.job != nil {
+				parent = item.job.ctx
+			}
+			m.resumeItem(item, parent)
 			go m.processQueue()
 			return nil
 		}
@@ -349,6 +697,31 @@ func (m *TransferManager) Resume(id string) error {
 	return fmt.Errorf("cannot resume transfer: %s", id)
 }
 
+// IsPaused reports whether a queued transfer is paused.
+func (m *TransferManager) IsPaused(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, item := range m.queue {
+		if item.ID == id {
+			return item.Status == StatusPaused
+		}
+	}
+	return false
+}
+
+// resumeItem queues a paused item again (caller must hold lock). An item
+// interrupted while in progress gets a new context derived from parent.
+func (m *TransferManager) resumeItem(item *TransferItem, parent context.Context) {
+	if item.ctx.Err() != nil {
+		item.ctx, item.cancel = context.WithCancel(parent)
+	}
+	item.Status = StatusPending
+	if m.journal != nil {
+		m.journal.SetStatus(item.ID, StatusPending)
+	}
+}
+
 // GetQueue returns the current transfer queue.
 func (m *TransferManager) GetQueue() []*TransferItem {
 	m.mu.RLock()
@@ -380,6 +753,9 @@ func (m *TransferManager) GetActiveCount() int {
 func (m *TransferManager) SetMaxParallel(n int) {
 	m.mu.Lock()
 	m.maxParallel = n
+	if m.pool != nil {
+		m.pool.SetMaxSize(n)
+	}
 	m.mu.Unlock()
 	go m.processQueue()
 }
@@ -394,6 +770,13 @@ func (m *TransferManager) Stop() {
 	m.cancel()
 	m.CancelAll()
 	m.wg.Wait()
+
+	m.mu.RLock()
+	pool := m.pool
+	m.mu.RUnlock()
+	if pool != nil {
+		pool.Close()
+	}
 }
 
 // ClearHistory clears the transfer history.
@@ -403,7 +786,25 @@ func (m *TransferManager) ClearHistory() {
 	m.history = make([]*TransferItem, 0)
 }
 
-// Retry retries a failed transfer by re-adding it to the queue.
+// ClearCompleted forgets ended transfers: it clears the history and removes
+// the directory transfers that have nothing left to run.
+func (m *TransferManager) ClearCompleted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.history = make([]*TransferItem, 0)
+	for id, job := range m.jobs {
+		job.mu.RLock()
+		ended := job.ended()
+		job.mu.RUnlock()
+		if ended {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// Retry retries a failed transfer by re-adding it to the queue. The file of
+// a directory transfer stays part of its job.
 func (m *TransferManager) Retry(id string) (*TransferItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -414,33 +815,33 @@ func (m *TransferManager) Retry(id string) (*TransferItem, error) {
 			// Remove from history
 			m.history = append(m.history[:i], m.history[i+1:]...)
 
-			// Create new transfer with same params
-			m.idCounter++
-			ctx, cancel := context.WithCancel(m.ctx)
-
-			newItem := &TransferItem{
-				ID:         fmt.Sprintf("transfer-%d", m.idCounter),
-				Direction:  item.Direction,
-				LocalPath:  item.LocalPath,
-				RemotePath: item.RemotePath,
-				Status:     StatusPending,
-				Priority:   item.Priority,
-				ctx:        ctx,
-				cancel:     cancel,
+			if m.journal != nil {
+				m.journal.CompleteTransfer(item.ID)
 			}
 
-			// Add to queue with priority
-			inserted := false
-			for j, existing := range m.queue {
-				if newItem.Priority > existing.Priority {
-					m.queue = append(m.queue[:j], append([]*TransferItem{newItem}, m.queue[j:]...)...)
-					inserted = true
-					break
+			// Create new transfer with same params
+			var newItem *TransferItem
+			if item.job != nil {
+				newItem = m.retryJobItem(item.job, item)
+			} else {
+				ctx, cancel := context.WithCancel(m.ctx)
+				newItem = &TransferItem{
+					ID:         m.nextID(),
+					Direction:  item.Direction,
+					LocalPath:  item.LocalPath,
+					RemotePath: item.RemotePath,
+					Status:     StatusPending,
+					Priority:   item.Priority,
+					restart:    errors.Is(item.Error, ErrChecksumMismatch),
+					atomic:     item.atomic,
+					ctx:        ctx,
+					cancel:     cancel,
+					done:       make(chan struct{}),
 				}
 			}
-			if !inserted {
-				m.queue = append(m.queue, newItem)
-			}
+
+			// Add to queue with priority
+			m.enqueue(newItem)
 
 			// Start processing
 			go m.processQueue()
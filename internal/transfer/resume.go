@@ -4,15 +4,20 @@ package transfer
 import (
 	"encoding/json"
 	"os"
-	"path/filepath"
+	"sort"
 	"sync"
 	"time"
+
+	"secure-ftp/pkg/fileutil"
 )
 
 // ResumeInfo stores information about an incomplete transfer for resumption.
 type ResumeInfo struct {
 	ID             string            `json:"id"`
+	ProfileID      string            `json:"profile_id,omitempty"`
 	Direction      TransferDirection `json:"direction"`
+	Status         TransferStatus    `json:"status"`
+	Priority       int               `json:"priority,omitempty"`
 	LocalPath      string            `json:"local_path"`
 	RemotePath     string            `json:"remote_path"`
 	TotalBytes     int64             `json:"total_bytes"`
@@ -20,13 +25,25 @@ type ResumeInfo struct {
 	StartTime      time.Time         `json:"start_time"`
 	LastUpdate     time.Time         `json:"last_update"`
 	Checksum       string            `json:"checksum,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	Atomic         bool              `json:"atomic,omitempty"` // Upload to a temporary name, then rename
+	// Directory transfer the file belongs to, and the roots of that job
+	JobID          string            `json:"job_id,omitempty"`
+	JobLocalPath   string            `json:"job_local_path,omitempty"`
+	JobRemotePath  string            `json:"job_remote_path,omitempty"`
 }
 
+// progressSaveInterval limits how often progress updates are written to disk.
+const progressSaveInterval = time.Second
+
 // ResumeManager manages transfer resumption state.
+// It doubles as the on-disk journal of the transfer queue.
 type ResumeManager struct {
 	statePath string
 	transfers map[string]*ResumeInfo
+	lastSave  time.Time
 	mu        sync.RWMutex
+	saveMu    sync.Mutex // Serializes writes to statePath
 }
 
 // NewResumeManager creates a new resume manager.
@@ -68,11 +85,15 @@ func (rm *ResumeManager) load() error {
 }
 
 // save writes the resume state to disk.
+// The file is replaced atomically so that a crash never leaves it truncated.
 func (rm *ResumeManager) save() error {
+	rm.saveMu.Lock()
+	defer rm.saveMu.Unlock()
+
 	rm.mu.RLock()
-	transfers := make([]*ResumeInfo, 0, len(rm.transfers))
+	transfers := make([]ResumeInfo, 0, len(rm.transfers))
 	for _, t := range rm.transfers {
-		transfers = append(transfers, t)
+		transfers = append(transfers, *t)
 	}
 	rm.mu.RUnlock()
 
@@ -81,13 +102,12 @@ func (rm *ResumeManager) save() error {
 		return err
 	}
 
-	// Ensure directory exists
-	dir := filepath.Dir(rm.statePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
+	return fileutil.AtomicWriteFile(rm.statePath, data, 0644)
+}
 
-	return os.WriteFile(rm.statePath, data, 0644)
+// Save writes the resume state to disk immediately.
+func (rm *ResumeManager) Save() error {
+	return rm.save()
 }
 
 // StartTransfer records the start of a new transfer.
@@ -109,16 +129,77 @@ func (rm *ResumeManager) StartTransfer(id string, direction TransferDirection, l
 	go rm.save()
 }
 
+// TrackItem journals a queued transfer so that it can be offered again after
+// a restart. profileID identifies the connection profile it belongs to.
+func (rm *ResumeManager) TrackItem(profileID string, item *TransferItem) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	info := &ResumeInfo{
+		ID:               item.ID,
+		ProfileID:        profileID,
+		Direction:        item.Direction,
+		Status:           item.Status,
+		Priority:         item.Priority,
+		LocalPath:        item.LocalPath,
+		RemotePath:       item.RemotePath,
+		TotalBytes:       item.TotalBytes,
+		TransferredBytes: item.TransferredBytes,
+		StartTime:        time.Now(),
+		LastUpdate:       time.Now(),
+		JobID:            item.JobID,
+		Atomic:           item.atomic,
+	}
+	if item.job != nil {
+		info.JobLocalPath, info.JobRemotePath = item.job.LocalPath, item.job.RemotePath
+	}
+	rm.transfers[item.ID] = info
+
+	go rm.save()
+}
+
 // UpdateProgress updates the progress of an ongoing transfer.
-func (rm *ResumeManager) UpdateProgress(id string, transferredBytes int64) {
+func (rm *ResumeManager) UpdateProgress(id string, transferredBytes, totalBytes int64) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
 	if info, ok := rm.transfers[id]; ok {
 		info.TransferredBytes = transferredBytes
+		info.TotalBytes = totalBytes
 		info.LastUpdate = time.Now()
 
 		// Save periodically (not on every update to avoid disk thrashing)
+		if time.Since(rm.lastSave) >= progressSaveInterval {
+			rm.lastSave = time.Now()
+			go rm.save()
+		}
+	}
+}
+
+// SetStatus records the queue status of a journaled transfer.
+func (rm *ResumeManager) SetStatus(id string, status TransferStatus) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if info, ok := rm.transfers[id]; ok && info.Status != status {
+		info.Status = status
+		info.LastUpdate = time.Now()
+		go rm.save()
+	}
+}
+
+// PauseTransfer records the offset reached by a transfer paused while in
+// progress. It is saved immediately so that the transfer resumes from there
+// even after a restart.
+func (rm *ResumeManager) PauseTransfer(id string, transferredBytes, totalBytes int64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if info, ok := rm.transfers[id]; ok {
+		info.Status = StatusPaused
+		info.TransferredBytes = transferredBytes
+		info.TotalBytes = totalBytes
+		info.LastUpdate = time.Now()
 		go rm.save()
 	}
 }
@@ -133,13 +214,17 @@ func (rm *ResumeManager) CompleteTransfer(id string) {
 }
 
 // FailTransfer marks a transfer as failed but keeps it for potential resumption.
-func (rm *ResumeManager) FailTransfer(id string, transferredBytes int64) {
+func (rm *ResumeManager) FailTransfer(id string, transferredBytes int64, err error) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
 	if info, ok := rm.transfers[id]; ok {
+		info.Status = StatusFailed
 		info.TransferredBytes = transferredBytes
 		info.LastUpdate = time.Now()
+		if err != nil {
+			info.Error = err.Error()
+		}
 		go rm.save()
 	}
 }
@@ -160,6 +245,26 @@ func (rm *ResumeManager) GetIncomplete() []*ResumeInfo {
 	return result
 }
 
+// GetForProfile returns the journaled transfers of a profile, oldest first.
+func (rm *ResumeManager) GetForProfile(profileID string) []*ResumeInfo {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	result := make([]*ResumeInfo, 0)
+	for _, info := range rm.transfers {
+		if info.ProfileID == profileID {
+			copied := *info
+			result = append(result, &copied)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+
+	return result
+}
+
 // GetResumeInfo returns resume info for a specific transfer.
 func (rm *ResumeManager) GetResumeInfo(id string) *ResumeInfo {
 	rm.mu.RLock()
@@ -0,0 +1,47 @@
+package transfer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalKeepsAtomicUploads(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "transfers.json")
+	journal, err := NewResumeManager(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No transfer is started, they stay queued as at a restart
+	m := NewTransferManager(nil, 0)
+	m.SetJournal(journal, "p1")
+	m.SetAtomicUploads(true)
+	upload := m.AddUpload("/local/a.txt", "/remote/a.txt", 0)
+	m.AddDownload("/remote/b.txt", "/local/b.txt", 0)
+	if err := journal.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewResumeManager(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := reloaded.GetForProfile("p1")
+	if len(infos) != 2 {
+		t.Fatalf("journal holds %d transfers, want 2", len(infos))
+	}
+	for _, info := range infos {
+		if want := info.ID == upload.ID; info.Atomic != want {
+			t.Errorf("journaled %s Atomic = %v, want %v", info.RemotePath, info.Atomic, want)
+		}
+	}
+
+	// The restored upload resumes into its temporary file even though atomic
+	// uploads are now disabled
+	restarted := NewTransferManager(nil, 0)
+	for _, item := range restarted.Restore(infos) {
+		if want := item.ID == upload.ID; item.atomic != want {
+			t.Errorf("restored %s atomic = %v, want %v", item.RemotePath, item.atomic, want)
+		}
+	}
+}
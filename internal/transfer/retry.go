@@ -0,0 +1,98 @@
+// Package transfer provides automatic retries of failed transfers.
+package transfer
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"secure-ftp/internal/protocol"
+)
+
+// DefaultMaxRetries is the number of automatic retries after a first failed attempt.
+const DefaultMaxRetries = 5
+
+// RetryPolicy controls how transfers that fail with a transient error are
+// retried. Each retry resumes from the bytes already transferred.
+type RetryPolicy struct {
+	MaxAttempts  int           // Including the first one; 1 disables retries
+	InitialDelay time.Duration // Delay before the first retry
+	MaxDelay     time.Duration // Upper bound of the delay between attempts
+	Multiplier   float64       // Delay growth factor between retries
+	Jitter       float64       // Fraction of the delay randomly added or removed (0-1)
+
+	// RetryOn reports whether an error is worth retrying.
+	// protocol.IsTransientError is used if nil.
+	RetryOn func(error) bool
+}
+
+// DefaultRetryPolicy returns a policy retrying transient errors up to
+// DefaultMaxRetries times, waiting from 1 to 30 seconds between attempts.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  DefaultMaxRetries + 1,
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// NewRetryPolicy returns DefaultRetryPolicy allowing maxRetries retries after
+// the first attempt. Zero or less disables retries.
+func NewRetryPolicy(maxRetries int) RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 1
+	if maxRetries > 0 {
+		policy.MaxAttempts += maxRetries
+	}
+	return policy
+}
+
+// ShouldRetry reports whether another attempt should follow attempt (1 for
+// the first one) that failed with err.
+func (p RetryPolicy) ShouldRetry(err error, attempt int) bool {
+	if err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.RetryOn != nil {
+		return p.RetryOn(err)
+	}
+	return protocol.IsTransientError(err)
+}
+
+// Delay returns how long to wait after attempt (1 for the first one) failed.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	// Spread the retries of transfers that failed together
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// sleepContext sleeps for d, returning early with an error if ctx is cancelled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"secure-ftp/internal/protocol"
+)
+
+func TestShouldRetryClassifiesErrors(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"not connected", protocol.ErrNotConnected, true},
+		{"EOF", io.EOF, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"closed connection", fmt.Errorf("write: %w", net.ErrClosed), true},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"dial refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"FTP 421 service unavailable", &textproto.Error{Code: 421, Msg: "Timeout"}, true},
+		{"FTP 425 no data connection", fmt.Errorf("stor: %w", &textproto.Error{Code: 425, Msg: "Can't open data connection"}), true},
+		{"FTP 550 not found", &textproto.Error{Code: 550, Msg: "No such file"}, false},
+		{"FTP 530 not logged in", &textproto.Error{Code: 530, Msg: "Login incorrect"}, false},
+		{"cancelled", context.Canceled, false},
+		{"local file missing", os.ErrNotExist, false},
+		{"permission denied", os.ErrPermission, false},
+		{"checksum mismatch", ErrChecksumMismatch, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.ShouldRetry(tt.err, 1); got != tt.want {
+				t.Errorf("ShouldRetry(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldRetryStopsAtMaxAttempts(t *testing.T) {
+	policy := NewRetryPolicy(2)
+	if policy.MaxAttempts != 3 {
+		t.Fatalf("MaxAttempts = %d, want 3", policy.MaxAttempts)
+	}
+
+	for attempt, want := range map[int]bool{1: true, 2: true, 3: false, 4: false} {
+		if got := policy.ShouldRetry(io.EOF, attempt); got != want {
+			t.Errorf("ShouldRetry(EOF, %d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	if NewRetryPolicy(0).ShouldRetry(io.EOF, 1) {
+		t.Errorf("NewRetryPolicy(0) retries")
+	}
+}
+
+func TestShouldRetryCustomClassifier(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.RetryOn = func(err error) bool { return errors.Is(err, os.ErrNotExist) }
+
+	if !policy.ShouldRetry(os.ErrNotExist, 1) {
+		t.Errorf("RetryOn was not used for a matching error")
+	}
+	if policy.ShouldRetry(io.EOF, 1) {
+		t.Errorf("RetryOn was not used for a transient error")
+	}
+}
+
+func TestDelayBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+	}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	// A multiplier below 1 keeps the delay constant
+	policy.Multiplier = 0
+	if got := policy.Delay(3); got != time.Second {
+		t.Errorf("Delay(3) without multiplier = %v, want %v", got, time.Second)
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+
+	for i := 0; i < 100; i++ {
+		got := policy.Delay(2)
+		if got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+			t.Fatalf("Delay(2) with 20%% jitter = %v, want within 1.6s-2.4s", got)
+		}
+	}
+}
+
+func TestSleepContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := sleepContext(ctx, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("sleepContext = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("sleepContext did not return when cancelled")
+	}
+}
@@ -41,6 +41,9 @@ func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
 func (r *RateLimiter) SetRate(bytesPerSecond int64) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if r.bytesPerSecond == bytesPerSecond {
+		return
+	}
 	r.bytesPerSecond = bytesPerSecond
 	r.tokens = bytesPerSecond
 }
@@ -53,47 +56,49 @@ func (r *RateLimiter) GetRate() int64 {
 }
 
 // Wait blocks until n bytes can be transferred.
+// A limiter shared by several streams caps their combined rate: tokens may
+// go negative, and later callers also wait for that debt to be repaid.
 func (r *RateLimiter) Wait(n int64) {
+	r.mu.Lock()
 	if r.bytesPerSecond <= 0 {
+		r.mu.Unlock()
 		return // Unlimited
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	// Refill tokens based on elapsed time
 	now := time.Now()
 	elapsed := now.Sub(r.lastRefill)
-	refill := int64(elapsed.Seconds() * float64(r.bytesPerSecond))
-	r.tokens += refill
+	r.tokens += int64(elapsed.Seconds() * float64(r.bytesPerSecond))
 	if r.tokens > r.bytesPerSecond {
 		r.tokens = r.bytesPerSecond
 	}
 	r.lastRefill = now
 
-	// If we don't have enough tokens, wait
-	for r.tokens < n {
-		// Calculate wait time
-		needed := n - r.tokens
-		waitTime := time.Duration(float64(needed) / float64(r.bytesPerSecond) * float64(time.Second))
+	// Consume tokens and wait for any deficit
+	r.tokens -= n
+	var waitTime time.Duration
+	if r.tokens < 0 {
+		waitTime = time.Duration(float64(-r.tokens) / float64(r.bytesPerSecond) * float64(time.Second))
+	}
+	r.mu.Unlock()
 
-		r.mu.Unlock()
+	if waitTime > 0 {
 		time.Sleep(waitTime)
-		r.mu.Lock()
-
-		// Refill after waiting
-		now = time.Now()
-		elapsed = now.Sub(r.lastRefill)
-		refill = int64(elapsed.Seconds() * float64(r.bytesPerSecond))
-		r.tokens += refill
-		if r.tokens > r.bytesPerSecond {
-			r.tokens = r.bytesPerSecond
-		}
-		r.lastRefill = now
 	}
+}
 
-	// Consume tokens
-	r.tokens -= n
+// chunkSize returns the largest read or write allowed before waiting, so that
+// throttled streams progress smoothly instead of in bursts (0 = unlimited).
+func (r *RateLimiter) chunkSize() int {
+	rate := r.GetRate()
+	if rate <= 0 {
+		return 0
+	}
+	chunk := rate / 10
+	if chunk < 1024 {
+		chunk = 1024
+	}
+	return int(chunk)
 }
 
 // NewThrottledReader creates a new throttled reader.
@@ -106,6 +111,11 @@ func NewThrottledReader(reader io.Reader, limiter *RateLimiter) *ThrottledReader
 
 // Read implements io.Reader with rate limiting.
 func (tr *ThrottledReader) Read(p []byte) (int, error) {
+	if tr.limiter != nil {
+		if chunk := tr.limiter.chunkSize(); chunk > 0 && len(p) > chunk {
+			p = p[:chunk]
+		}
+	}
 	n, err := tr.reader.Read(p)
 	if n > 0 && tr.limiter != nil {
 		tr.limiter.Wait(int64(n))
@@ -123,13 +133,29 @@ func NewThrottledWriter(writer io.Writer, limiter *RateLimiter) *ThrottledWriter
 
 // Write implements io.Writer with rate limiting.
 func (tw *ThrottledWriter) Write(p []byte) (int, error) {
-	if tw.limiter != nil {
-		tw.limiter.Wait(int64(len(p)))
+	if tw.limiter == nil {
+		return tw.writer.Write(p)
+	}
+
+	written := 0
+	for written < len(p) {
+		end := len(p)
+		if chunk := tw.limiter.chunkSize(); chunk > 0 && end-written > chunk {
+			end = written + chunk
+		}
+		tw.limiter.Wait(int64(end - written))
+		n, err := tw.writer.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
 	}
-	return tw.writer.Write(p)
+	return written, nil
 }
 
 // BandwidthLimiter manages bandwidth limits for uploads and downloads.
+// A single limiter is shared by all transfers of a session and implements
+// protocol.BandwidthThrottle; rates can be changed while transfers run.
 type BandwidthLimiter struct {
 	uploadLimiter   *RateLimiter
 	downloadLimiter *RateLimiter
@@ -180,6 +206,17 @@ func (bl *BandwidthLimiter) WrapWriter(w io.Writer) io.Writer {
 	return NewThrottledWriter(w, bl.uploadLimiter)
 }
 
+// ThrottleUpload wraps the local reader feeding an upload.
+// The stream is always wrapped so that a limit set later also applies to it.
+func (bl *BandwidthLimiter) ThrottleUpload(r io.Reader) io.Reader {
+	return NewThrottledReader(r, bl.uploadLimiter)
+}
+
+// ThrottleDownload wraps the local writer receiving a download.
+func (bl *BandwidthLimiter) ThrottleDownload(w io.Writer) io.Writer {
+	return NewThrottledWriter(w, bl.downloadLimiter)
+}
+
 // Common bandwidth presets (bytes per second)
 const (
 	BandwidthUnlimited = 0
@@ -0,0 +1,35 @@
+// Package transfer provides post-transfer integrity verification.
+package transfer
+
+import (
+	"context"
+	"fmt"
+
+	"secure-ftp/internal/protocol"
+)
+
+// ErrChecksumMismatch is returned when the local and remote copies of a
+// transferred file differ. Atomic uploads return the same error.
+var ErrChecksumMismatch = protocol.ErrChecksumMismatch
+
+// VerifyTransfer compares the checksums of a local file and its remote copy.
+// The remote checksum is computed by the server when it supports it.
+// It returns an error wrapping ErrChecksumMismatch if they differ.
+func VerifyTransfer(ctx context.Context, client protocol.Protocol, localPath, remotePath string) error {
+	algo := protocol.PreferredHashAlgorithm(ctx, client)
+
+	localSum, err := protocol.HashLocalFile(localPath, algo)
+	if err != nil {
+		return fmt.Errorf("failed to hash local file: %w", err)
+	}
+
+	remoteSum, err := protocol.RemoteChecksum(ctx, client, remotePath, algo)
+	if err != nil {
+		return fmt.Errorf("failed to hash remote file: %w", err)
+	}
+
+	if localSum != remoteSum {
+		return fmt.Errorf("%w: local %s %s, remote %s", ErrChecksumMismatch, algo, localSum, remoteSum)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"os"
 	"strconv"
 
 	"fyne.io/fyne/v2"
@@ -277,11 +278,6 @@ func (cd *ConnectionDialog) handleConnect() {
 		return
 	}
 
-	if cd.passwordEntry.Text == "" && cd.privateKeyEntry.Text == "" {
-		dialog.ShowError(errMissingAuth, cd.window)
-		return
-	}
-
 	port, err := strconv.Atoi(cd.portEntry.Text)
 	if err != nil || port < 1 || port > 65535 {
 		dialog.ShowError(errInvalidPort, cd.window)
@@ -296,16 +292,28 @@ func (cd *ConnectionDialog) handleConnect() {
 		protocol = "ftp"
 	}
 
-	profile := &config.ConnectionProfile{
-		ID:             cd.selectedProfileID,
-		Name:           cd.profileNameEntry.Text,
-		Protocol:       protocol,
-		Host:           cd.hostEntry.Text,
-		Port:           port,
-		Username:       cd.usernameEntry.Text,
-		PrivateKeyPath: cd.privateKeyEntry.Text,
-		RemoteDir:      cd.remoteDirEntry.Text,
-		TLSImplicit:    cd.tlsImplicitCheck.Checked,
+	// Settings edited in the profiles dialog are kept
+	profile := &config.ConnectionProfile{}
+	if saved := cd.configMgr.GetProfile(cd.selectedProfileID); saved != nil {
+		profile = saved
+	}
+	profile.ID = cd.selectedProfileID
+	profile.Protocol = protocol
+	profile.Host = cd.hostEntry.Text
+	profile.Port = port
+	profile.Username = cd.usernameEntry.Text
+	profile.PrivateKeyPath = cd.privateKeyEntry.Text
+	profile.RemoteDir = cd.remoteDirEntry.Text
+	profile.TLSImplicit = cd.tlsImplicitCheck.Checked
+	if profile.Name == "" {
+		profile.Name = cd.profileNameEntry.Text
+	}
+
+	// SFTP can also authenticate with other key files or the SSH agent
+	sshKeys := protocol == "sftp" && (len(profile.KeyFiles()) > 0 || os.Getenv("SSH_AUTH_SOCK") != "")
+	if cd.passwordEntry.Text == "" && !sshKeys {
+		dialog.ShowError(errMissingAuth, cd.window)
+		return
 	}
 
 	if cd.saveProfileCheck.Checked && cd.profileNameEntry.Text != "" {
@@ -332,7 +340,7 @@ func (cd *ConnectionDialog) handleConnect() {
 var (
 	errMissingHost     = &connectionError{"L'hôte est requis"}
 	errMissingUsername = &connectionError{"Le nom d'utilisateur est requis"}
-	errMissingAuth     = &connectionError{"Le mot de passe ou la clé privée est requis"}
+	errMissingAuth     = &connectionError{"Le mot de passe, une clé privée ou un agent SSH est requis"}
 	errInvalidPort     = &connectionError{"Numéro de port invalide (1-65535)"}
 )
 
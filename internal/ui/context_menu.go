@@ -75,9 +75,8 @@ func FileContextMenuItems(
 	}
 	if onDownloadUpload != nil {
 		items = append(items, ContextMenuItem{
-			Label:    transferLabel,
-			Action:   onDownloadUpload,
-			Disabled: isDir,
+			Label:  transferLabel,
+			Action: onDownloadUpload,
 		})
 	}
 
@@ -30,8 +30,8 @@ type DragDropManager struct {
 	window      fyne.Window
 
 	// Callbacks
-	onUpload   func(localPath string)
-	onDownload func(remotePath string)
+	onUpload   func(localPath string, isDir bool)
+	onDownload func(remotePath string, isDir bool)
 }
 
 // NewDragDropManager creates a new drag and drop manager.
@@ -48,12 +48,12 @@ func (ddm *DragDropManager) SetBrowsers(local, remote *FileBrowser) {
 }
 
 // SetOnUpload sets the callback for upload operations.
-func (ddm *DragDropManager) SetOnUpload(fn func(localPath string)) {
+func (ddm *DragDropManager) SetOnUpload(fn func(localPath string, isDir bool)) {
 	ddm.onUpload = fn
 }
 
 // SetOnDownload sets the callback for download operations.
-func (ddm *DragDropManager) SetOnDownload(fn func(remotePath string)) {
+func (ddm *DragDropManager) SetOnDownload(fn func(remotePath string, isDir bool)) {
 	ddm.onDownload = fn
 }
 
@@ -104,15 +104,15 @@ func (ddm *DragDropManager) Drop(target *FileBrowser) {
 	if source.isLocal && target == ddm.remoteBrowser {
 		// Local → Remote = Upload
 		for _, item := range items {
-			if !item.IsDir && ddm.onUpload != nil {
-				ddm.onUpload(item.Path)
+			if ddm.onUpload != nil {
+				ddm.onUpload(item.Path, item.IsDir)
 			}
 		}
 	} else if !source.isLocal && target == ddm.localBrowser {
 		// Remote → Local = Download
 		for _, item := range items {
-			if !item.IsDir && ddm.onDownload != nil {
-				ddm.onDownload(item.Path)
+			if ddm.onDownload != nil {
+				ddm.onDownload(item.Path, item.IsDir)
 			}
 		}
 	}
@@ -277,7 +277,7 @@ func NewDraggableItem(content fyne.CanvasObject, item *FileItem, browser *FileBr
 
 // Dragged implements fyne.Draggable.
 func (di *DraggableItem) Dragged(e *fyne.DragEvent) {
-	if !di.dragging && di.item != nil && !di.item.IsDir && di.item.Name != ".." {
+	if !di.dragging && di.item != nil && di.item.Name != ".." {
 		di.dragging = true
 		di.startPos = e.Position
 
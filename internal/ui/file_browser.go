@@ -17,6 +17,7 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"secure-ftp/internal/config"
 	"secure-ftp/internal/protocol"
 )
 
@@ -26,10 +27,30 @@ type FileItem struct {
 	Path        string
 	IsDir       bool
 	Size        int64
+	ModTime     time.Time
 	Permissions string
+	Owner       string
+	Group       string
+	IsSymlink   bool
+	LinkTarget  string
 	Selected    bool
 }
 
+// sizeColumnWidth is the width of the size column, always shown.
+const sizeColumnWidth = 80
+
+// browserColumns are the optional columns, in display order.
+var browserColumns = []struct {
+	id     string
+	header string
+	width  float32
+}{
+	{config.ColumnModified, "Modifié", 130},
+	{config.ColumnPermissions, "Permissions", 100},
+	{config.ColumnOwner, "Propriétaire", 90},
+	{config.ColumnGroup, "Groupe", 90},
+}
+
 // FileBrowser provides a file navigation component.
 type FileBrowser struct {
 	window      fyne.Window
@@ -39,12 +60,14 @@ type FileBrowser struct {
 	files       []FileItem
 	disabled    bool
 	showHidden  bool
+	columns     map[string]bool // Optional columns shown
 
 	// UI components
 	container     *fyne.Container
 	pathEntry     *widget.Entry
 	fileList      *widget.List
 	pathLabel     *widget.Label
+	columnHeader  *fyne.Container
 	dropHighlight *canvas.Rectangle
 
 	// Action buttons
@@ -80,6 +103,7 @@ func NewFileBrowser(window fyne.Window, isLocal bool, startPath string) *FileBro
 		currentPath:     startPath,
 		files:           make([]FileItem, 0),
 		selectedIndices: make(map[int]bool),
+		columns:         make(map[string]bool),
 		cache:           NewDirCache(DefaultCacheTTL),
 		lastSelectedIdx: -1,
 		lastClickedIdx:  -1,
@@ -154,10 +178,19 @@ func (fb *FileBrowser) buildUI() {
 			return len(fb.files)
 		},
 		func() fyne.CanvasObject {
-			return container.NewHBox(
+			nameLabel := widget.NewLabel("filename.txt")
+			nameLabel.Truncation = fyne.TextTruncateEllipsis
+
+			cells := []fyne.CanvasObject{newColumnCell(widget.NewLabel("1.2 MB"), sizeColumnWidth)}
+			for _, column := range browserColumns {
+				cells = append(cells, newColumnCell(widget.NewLabel(""), column.width))
+			}
+
+			// Objects: name, icon, cells
+			return container.NewBorder(nil, nil,
 				widget.NewIcon(theme.FileIcon()),
-				widget.NewLabel("filename.txt"),
-				widget.NewLabel("1.2 MB"),
+				container.NewHBox(cells...),
+				nameLabel,
 			)
 		},
 		func(id widget.ListItemID, obj fyne.CanvasObject) {
@@ -166,26 +199,41 @@ func (fb *FileBrowser) buildUI() {
 			}
 
 			item := fb.files[id]
-			box := obj.(*fyne.Container)
+			row := obj.(*fyne.Container)
 
 			// Icon
-			icon := box.Objects[0].(*widget.Icon)
+			icon := row.Objects[1].(*widget.Icon)
 			if item.IsDir {
 				icon.SetResource(theme.FolderIcon())
 			} else {
 				icon.SetResource(theme.FileIcon())
 			}
 
-			// Name
-			nameLabel := box.Objects[1].(*widget.Label)
-			nameLabel.SetText(item.Name)
+			// Name, with the target of symbolic links
+			nameLabel := row.Objects[0].(*widget.Label)
+			if item.IsSymlink && item.LinkTarget != "" {
+				nameLabel.SetText(item.Name + " → " + item.LinkTarget)
+			} else {
+				nameLabel.SetText(item.Name)
+			}
 
 			// Size
-			sizeLabel := box.Objects[2].(*widget.Label)
+			cells := row.Objects[2].(*fyne.Container).Objects
 			if item.IsDir {
-				sizeLabel.SetText("<DIR>")
+				setColumnCell(cells[0], "<DIR>")
 			} else {
-				sizeLabel.SetText(formatSize(item.Size))
+				setColumnCell(cells[0], formatSize(item.Size))
+			}
+
+			// Optional columns
+			for i, column := range browserColumns {
+				cell := cells[i+1]
+				if !fb.columns[column.id] {
+					cell.Hide()
+					continue
+				}
+				cell.Show()
+				setColumnCell(cell, columnText(item, column.id))
 			}
 		},
 	)
@@ -255,6 +303,18 @@ func (fb *FileBrowser) buildUI() {
 		}
 	}
 
+	// Column headers, aligned with the cells of the rows
+	headerCells := []fyne.CanvasObject{newColumnCell(newColumnHeader("Taille"), sizeColumnWidth)}
+	for _, column := range browserColumns {
+		cell := newColumnCell(newColumnHeader(column.header), column.width)
+		cell.Hide()
+		headerCells = append(headerCells, cell)
+	}
+	iconSpace := canvas.NewRectangle(color.Transparent)
+	iconSpace.SetMinSize(fyne.NewSize(theme.IconInlineSize(), theme.IconInlineSize()))
+	fb.columnHeader = container.NewHBox(headerCells...)
+	columnHeaderRow := container.NewBorder(nil, nil, iconSpace, fb.columnHeader, newColumnHeader("Nom"))
+
 	// Build container
 	header := widget.NewLabelWithStyle(title, fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
 
@@ -268,7 +328,7 @@ func (fb *FileBrowser) buildUI() {
 	listWithHighlight := container.NewStack(fb.fileList, fb.dropHighlight)
 
 	fb.container = container.NewBorder(
-		container.NewVBox(header, pathBar),
+		container.NewVBox(header, pathBar, columnHeaderRow),
 		nil, nil, nil,
 		listWithHighlight,
 	)
@@ -386,13 +446,20 @@ func (fb *FileBrowser) readLocalDirectory(path string) ([]FileItem, error) {
 			continue
 		}
 
-		items = append(items, FileItem{
+		item := FileItem{
 			Name:        entry.Name(),
 			Path:        filepath.Join(path, entry.Name()),
 			IsDir:       entry.IsDir(),
 			Size:        info.Size(),
-			Permissions: info.Mode().String(),
-		})
+			ModTime:     info.ModTime(),
+			Permissions: protocol.FormatPermissions(info.Mode()),
+			IsSymlink:   info.Mode()&os.ModeSymlink != 0,
+		}
+		item.Owner, item.Group = localOwner(info)
+		if item.IsSymlink {
+			item.LinkTarget, _ = os.Readlink(item.Path)
+		}
+		items = append(items, item)
 	}
 
 	// Sort: directories first, then by name
@@ -445,7 +512,12 @@ func (fb *FileBrowser) readRemoteDirectory(path string) ([]FileItem, error) {
 			Path:        filepath.Join(path, entry.Name),
 			IsDir:       entry.IsDir,
 			Size:        entry.Size,
+			ModTime:     entry.ModTime,
 			Permissions: entry.Permissions,
+			Owner:       entry.Owner,
+			Group:       entry.Group,
+			IsSymlink:   entry.IsSymlink,
+			LinkTarget:  entry.LinkTarget,
 		})
 	}
 
@@ -551,6 +623,24 @@ func (fb *FileBrowser) SetShowHidden(show bool) {
 	fb.Refresh()
 }
 
+// SetColumns sets the optional columns shown (config.Column* constants).
+func (fb *FileBrowser) SetColumns(columns []string) {
+	fb.columns = make(map[string]bool)
+	for _, column := range columns {
+		fb.columns[column] = true
+	}
+
+	for i, column := range browserColumns {
+		cell := fb.columnHeader.Objects[i+1]
+		if fb.columns[column.id] {
+			cell.Show()
+		} else {
+			cell.Hide()
+		}
+	}
+	fb.fileList.Refresh()
+}
+
 // SetOnNewFolder sets the callback for new folder action.
 func (fb *FileBrowser) SetOnNewFolder(callback func()) {
 	fb.onNewFolder = callback
@@ -588,6 +678,44 @@ func (fb *FileBrowser) GetSelectedItems() []FileItem {
 	return items
 }
 
+// newColumnCell gives label the fixed width of a column.
+func newColumnCell(label *widget.Label, width float32) *fyne.Container {
+	label.Truncation = fyne.TextTruncateEllipsis
+	return container.NewGridWrap(fyne.NewSize(width, label.MinSize().Height), label)
+}
+
+// newColumnHeader creates the label of a column header.
+func newColumnHeader(text string) *widget.Label {
+	return widget.NewLabelWithStyle(text, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+}
+
+// setColumnCell sets the text of a cell created by newColumnCell.
+func setColumnCell(cell fyne.CanvasObject, text string) {
+	cell.(*fyne.Container).Objects[0].(*widget.Label).SetText(text)
+}
+
+// columnText returns the text of an optional column for item.
+func columnText(item FileItem, column string) string {
+	if item.Name == ".." {
+		return ""
+	}
+
+	switch column {
+	case config.ColumnModified:
+		if item.ModTime.IsZero() {
+			return ""
+		}
+		return item.ModTime.Format("02/01/2006 15:04")
+	case config.ColumnPermissions:
+		return item.Permissions
+	case config.ColumnOwner:
+		return item.Owner
+	case config.ColumnGroup:
+		return item.Group
+	}
+	return ""
+}
+
 // formatSize formats a file size in human-readable form.
 func formatSize(bytes int64) string {
 	const unit = 1024
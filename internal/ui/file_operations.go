@@ -3,11 +3,16 @@ package ui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
@@ -141,6 +146,26 @@ func (fo *FileOperations) DeleteRemote(path string, isDir bool, onComplete func(
 		itemType = "le dossier"
 	}
 
+	// Directories are measured first so the confirmation shows what goes away
+	if isDir {
+		fo.scanRemote(path, func(stats protocol.TreeStats) {
+			dialog.ShowConfirm("Supprimer "+itemType,
+				fmt.Sprintf("Êtes-vous sûr de vouloir supprimer '%s' et tout son contenu ?\n\n%s",
+					filepath.Base(path), formatTreeStats(stats)),
+				func(confirmed bool) {
+					if !confirmed {
+						return
+					}
+					fo.runTreeOperation("Suppression de "+filepath.Base(path), func(ctx context.Context, progress func(done, total int)) error {
+						return protocol.RemoveTree(ctx, fo.client, path, protocol.TreeWorkers(fo.client), progress)
+					}, onComplete)
+				},
+				fo.window,
+			)
+		})
+		return
+	}
+
 	dialog.ShowConfirm("Supprimer "+itemType,
 		fmt.Sprintf("Êtes-vous sûr de vouloir supprimer '%s' ?", filepath.Base(path)),
 		func(confirmed bool) {
@@ -148,12 +173,7 @@ func (fo *FileOperations) DeleteRemote(path string, isDir bool, onComplete func(
 				return
 			}
 
-			var err error
-			if isDir {
-				err = fo.client.RemoveDir(context.Background(), path)
-			} else {
-				err = fo.client.Remove(context.Background(), path)
-			}
+			err := fo.client.Remove(context.Background(), path)
 
 			if err != nil {
 				dialog.ShowError(fmt.Errorf("échec de la suppression : %v", err), fo.window)
@@ -263,40 +283,417 @@ func (fo *FileOperations) ShowPropertiesLocal(path string) {
 	dialog.ShowInformation("Propriétés", content, fo.window)
 }
 
-// ShowPropertiesRemote shows remote file/directory properties.
-func (fo *FileOperations) ShowPropertiesRemote(path string) {
+// propertiesTimeLayout is the layout of times in the properties dialogs.
+const propertiesTimeLayout = "02/01/2006 15:04:05"
+
+// ShowPropertiesRemote shows the properties of a remote file or directory and
+// lets the user change its permissions, owner and modification time.
+func (fo *FileOperations) ShowPropertiesRemote(path string, onComplete func()) {
 	if fo.client == nil {
 		dialog.ShowError(fmt.Errorf("non connecté"), fo.window)
 		return
 	}
 
-	info, err := fo.client.Stat(context.Background(), path)
+	ctx := context.Background()
+	info, err := fo.client.Stat(ctx, path)
 	if err != nil {
 		dialog.ShowError(err, fo.window)
 		return
 	}
 
-	var content string
+	kind := "Fichier"
 	if info.IsDir {
-		content = fmt.Sprintf(
-			"Nom : %s\nType : Dossier\nChemin : %s\nPermissions : %s\nModifié : %s",
-			info.Name,
-			path,
-			info.Permissions,
-			info.ModTime.Format("02/01/2006 15:04:05"),
-		)
-	} else {
-		content = fmt.Sprintf(
-			"Nom : %s\nType : Fichier\nTaille : %s\nChemin : %s\nPermissions : %s\nModifié : %s",
-			info.Name,
-			formatFileSize(info.Size),
-			path,
-			info.Permissions,
-			info.ModTime.Format("02/01/2006 15:04:05"),
-		)
+		kind = "Dossier"
+	}
+	items := []*widget.FormItem{
+		widget.NewFormItem("Nom :", widget.NewLabel(info.Name)),
+		widget.NewFormItem("Chemin :", widget.NewLabel(path)),
+	}
+	if info.IsSymlink {
+		kind = "Lien symbolique vers un " + strings.ToLower(kind)
+		target := info.LinkTarget
+		if target == "" {
+			target, _ = fo.client.ReadLink(ctx, path)
+		}
+		if target == "" {
+			target = "-"
+		}
+		items = append(items, widget.NewFormItem("Cible :", widget.NewLabel(target)))
+	}
+	items = append(items, widget.NewFormItem("Type :", widget.NewLabel(kind)))
+	if !info.IsDir {
+		items = append(items, widget.NewFormItem("Taille :", widget.NewLabel(formatFileSize(info.Size))))
+	}
+	if !info.AccessTime.IsZero() {
+		items = append(items, widget.NewFormItem("Accédé :",
+			widget.NewLabel(info.AccessTime.Format(propertiesTimeLayout))))
 	}
 
-	dialog.ShowInformation("Propriétés", content, fo.window)
+	// Editable attributes, left empty when the server does not tell them
+	modTime := info.ModTime.Format(propertiesTimeLayout)
+	modTimeEntry := widget.NewEntry()
+	modTimeEntry.SetText(modTime)
+
+	var perms string
+	if info.Permissions != "" && !strings.Contains(info.Permissions, "?") {
+		perms = fmt.Sprintf("%04o", protocol.UnixPermissions(info.Mode))
+	}
+	permsEntry := widget.NewEntry()
+	permsEntry.SetText(perms)
+
+	var uid, gid string
+	if info.UID >= 0 {
+		uid = strconv.Itoa(info.UID)
+	}
+	if info.GID >= 0 {
+		gid = strconv.Itoa(info.GID)
+	}
+	uidEntry := widget.NewEntry()
+	uidEntry.SetText(uid)
+	gidEntry := widget.NewEntry()
+	gidEntry.SetText(gid)
+
+	permsItem := widget.NewFormItem("Permissions (octal) :", permsEntry)
+	permsItem.HintText = info.Permissions
+	uidItem := widget.NewFormItem("UID :", uidEntry)
+	uidItem.HintText = info.Owner
+	gidItem := widget.NewFormItem("GID :", gidEntry)
+	gidItem.HintText = info.Group
+	items = append(items,
+		widget.NewFormItem("Modifié :", modTimeEntry),
+		permsItem,
+		uidItem,
+		gidItem,
+	)
+
+	dialog.ShowForm("Propriétés de "+info.Name, "Appliquer", "Fermer", items,
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+
+			var changes []func() error
+			if text := strings.TrimSpace(permsEntry.Text); text != perms {
+				mode, err := parseFileMode(text)
+				if err != nil {
+					dialog.ShowError(err, fo.window)
+					return
+				}
+				changes = append(changes, func() error {
+					return attributeError("Changement de permissions", fo.client.Chmod(ctx, path, mode))
+				})
+			}
+			if newUID, newGID := strings.TrimSpace(uidEntry.Text), strings.TrimSpace(gidEntry.Text); newUID != uid || newGID != gid {
+				uidValue, err := strconv.Atoi(newUID)
+				if err != nil || uidValue < 0 {
+					dialog.ShowError(fmt.Errorf("UID invalide : %q", uidEntry.Text), fo.window)
+					return
+				}
+				gidValue, err := strconv.Atoi(newGID)
+				if err != nil || gidValue < 0 {
+					dialog.ShowError(fmt.Errorf("GID invalide : %q", gidEntry.Text), fo.window)
+					return
+				}
+				changes = append(changes, func() error {
+					return attributeError("Changement de propriétaire", fo.client.Chown(ctx, path, uidValue, gidValue))
+				})
+			}
+			if text := strings.TrimSpace(modTimeEntry.Text); text != modTime {
+				mtime, err := time.ParseInLocation(propertiesTimeLayout, text, time.Local)
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("date invalide : %q (format JJ/MM/AAAA HH:MM:SS)", text), fo.window)
+					return
+				}
+				atime := info.AccessTime
+				if atime.IsZero() {
+					atime = time.Now()
+				}
+				changes = append(changes, func() error {
+					return attributeError("Changement de date", fo.client.Chtimes(ctx, path, atime, mtime))
+				})
+			}
+			if len(changes) == 0 {
+				return
+			}
+
+			// Apply every change, even after a failure, then report them all
+			var errs []string
+			for _, change := range changes {
+				if err := change(); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+			if len(errs) > 0 {
+				dialog.ShowError(fmt.Errorf("%s", strings.Join(errs, "\n")), fo.window)
+			}
+
+			if onComplete != nil {
+				onComplete()
+			}
+		},
+		fo.window,
+	)
+}
+
+// CreateSymlinkRemote creates a symbolic link in a remote folder.
+func (fo *FileOperations) CreateSymlinkRemote(parentPath, target string, onComplete func()) {
+	if fo.client == nil {
+		dialog.ShowError(fmt.Errorf("non connecté"), fo.window)
+		return
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Nouveau lien")
+	if target != "" {
+		nameEntry.SetText(filepath.Base(target))
+	}
+	targetEntry := widget.NewEntry()
+	targetEntry.SetText(target)
+
+	dialog.ShowForm("Nouveau lien symbolique", "Créer", "Annuler",
+		[]*widget.FormItem{
+			widget.NewFormItem("Nom du lien :", nameEntry),
+			widget.NewFormItem("Cible :", targetEntry),
+		},
+		func(confirmed bool) {
+			if !confirmed || nameEntry.Text == "" || targetEntry.Text == "" {
+				return
+			}
+
+			linkPath := filepath.Join(parentPath, nameEntry.Text)
+			err := fo.client.Symlink(context.Background(), targetEntry.Text, linkPath)
+			if err := attributeError("Création du lien", err); err != nil {
+				dialog.ShowError(err, fo.window)
+				return
+			}
+
+			if onComplete != nil {
+				onComplete()
+			}
+		},
+		fo.window,
+	)
+}
+
+// ShowFolderSizeRemote computes the size of a remote directory tree.
+func (fo *FileOperations) ShowFolderSizeRemote(path string) {
+	if fo.client == nil {
+		dialog.ShowError(fmt.Errorf("non connecté"), fo.window)
+		return
+	}
+
+	fo.scanRemote(path, func(stats protocol.TreeStats) {
+		dialog.ShowInformation("Taille du dossier",
+			fmt.Sprintf("%s\n\n%s", path, formatTreeStats(stats)), fo.window)
+	})
+}
+
+// ChmodRemote changes the permissions of a remote file, or of a directory
+// and optionally everything below it.
+func (fo *FileOperations) ChmodRemote(path string, isDir bool, onComplete func()) {
+	if fo.client == nil {
+		dialog.ShowError(fmt.Errorf("non connecté"), fo.window)
+		return
+	}
+
+	fileEntry := widget.NewEntry()
+	fileEntry.SetText("644")
+	dirEntry := widget.NewEntry()
+	dirEntry.SetText("755")
+	recursiveCheck := widget.NewCheck("Appliquer à tout le contenu", nil)
+
+	items := []*widget.FormItem{widget.NewFormItem("Fichiers (octal) :", fileEntry)}
+	if isDir {
+		items = []*widget.FormItem{
+			widget.NewFormItem("Dossiers (octal) :", dirEntry),
+			widget.NewFormItem("Fichiers (octal) :", fileEntry),
+			widget.NewFormItem("", recursiveCheck),
+		}
+	}
+
+	dialog.ShowForm("Permissions de "+filepath.Base(path), "Appliquer", "Annuler", items,
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+
+			fileMode, err := parseFileMode(fileEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, fo.window)
+				return
+			}
+			dirMode, err := parseFileMode(dirEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, fo.window)
+				return
+			}
+
+			if !isDir || !recursiveCheck.Checked {
+				mode := fileMode
+				if isDir {
+					mode = dirMode
+				}
+				err := fo.client.Chmod(context.Background(), path, mode)
+				if err := attributeError("Changement de permissions", err); err != nil {
+					dialog.ShowError(err, fo.window)
+					return
+				}
+				if onComplete != nil {
+					onComplete()
+				}
+				return
+			}
+
+			fo.runTreeOperation("Permissions de "+filepath.Base(path), func(ctx context.Context, progress func(done, total int)) error {
+				return protocol.ChmodTree(ctx, fo.client, path, fileMode, dirMode, protocol.TreeWorkers(fo.client), progress)
+			}, onComplete)
+		},
+		fo.window,
+	)
+}
+
+// ChownRemote changes the numeric owner and group of a remote file, or of a
+// directory and optionally everything below it.
+func (fo *FileOperations) ChownRemote(path string, isDir bool, onComplete func()) {
+	if fo.client == nil {
+		dialog.ShowError(fmt.Errorf("non connecté"), fo.window)
+		return
+	}
+
+	uidEntry := widget.NewEntry()
+	uidEntry.SetPlaceHolder("1000")
+	gidEntry := widget.NewEntry()
+	gidEntry.SetPlaceHolder("1000")
+	recursiveCheck := widget.NewCheck("Appliquer à tout le contenu", nil)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("UID :", uidEntry),
+		widget.NewFormItem("GID :", gidEntry),
+	}
+	if isDir {
+		items = append(items, widget.NewFormItem("", recursiveCheck))
+	}
+
+	dialog.ShowForm("Propriétaire de "+filepath.Base(path), "Appliquer", "Annuler", items,
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+
+			uid, err := strconv.Atoi(strings.TrimSpace(uidEntry.Text))
+			if err != nil || uid < 0 {
+				dialog.ShowError(fmt.Errorf("UID invalide : %q", uidEntry.Text), fo.window)
+				return
+			}
+			gid, err := strconv.Atoi(strings.TrimSpace(gidEntry.Text))
+			if err != nil || gid < 0 {
+				dialog.ShowError(fmt.Errorf("GID invalide : %q", gidEntry.Text), fo.window)
+				return
+			}
+
+			if !isDir || !recursiveCheck.Checked {
+				err := fo.client.Chown(context.Background(), path, uid, gid)
+				if err := attributeError("Changement de propriétaire", err); err != nil {
+					dialog.ShowError(err, fo.window)
+					return
+				}
+				if onComplete != nil {
+					onComplete()
+				}
+				return
+			}
+
+			fo.runTreeOperation("Propriétaire de "+filepath.Base(path), func(ctx context.Context, progress func(done, total int)) error {
+				return protocol.ChownTree(ctx, fo.client, path, uid, gid, protocol.TreeWorkers(fo.client), progress)
+			}, onComplete)
+		},
+		fo.window,
+	)
+}
+
+// scanRemote measures a remote directory tree behind a cancellable dialog and
+// passes the result to onDone.
+func (fo *FileOperations) scanRemote(path string, onDone func(protocol.TreeStats)) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	progress := widget.NewProgressBarInfinite()
+	dlg := dialog.NewCustom("Analyse de "+filepath.Base(path), "Annuler", progress, fo.window)
+	dlg.SetOnClosed(cancel)
+	dlg.Show()
+
+	go func() {
+		stats, err := protocol.TreeSize(ctx, fo.client, path, protocol.TreeWorkers(fo.client))
+		cancelled := ctx.Err() != nil
+		dlg.Hide()
+
+		switch {
+		case cancelled:
+		case err != nil:
+			dialog.ShowError(fmt.Errorf("échec de l'analyse du dossier : %v", err), fo.window)
+		default:
+			onDone(stats)
+		}
+	}()
+}
+
+// runTreeOperation runs a recursive operation in the background behind a
+// progress dialog whose button cancels it, then calls onComplete.
+func (fo *FileOperations) runTreeOperation(title string, op func(ctx context.Context, progress func(done, total int)) error, onComplete func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	progressBar := widget.NewProgressBar()
+	statusLabel := widget.NewLabel("Analyse...")
+	dlg := dialog.NewCustom(title, "Annuler", container.NewVBox(statusLabel, progressBar), fo.window)
+	dlg.SetOnClosed(cancel)
+	dlg.Resize(fyne.NewSize(400, 0))
+	dlg.Show()
+
+	go func() {
+		err := op(ctx, func(done, total int) {
+			progressBar.SetValue(float64(done) / float64(total))
+			statusLabel.SetText(fmt.Sprintf("%d / %d élément(s)", done, total))
+		})
+		cancelled := ctx.Err() != nil
+		dlg.Hide()
+
+		if err != nil && !cancelled {
+			dialog.ShowError(fmt.Errorf("%s a échoué : %v", title, err), fo.window)
+		}
+
+		// Partial changes are visible too after a failure or cancellation
+		if onComplete != nil {
+			onComplete()
+		}
+	}()
+}
+
+// parseFileMode parses octal permission bits such as "755", or "2775" with
+// setuid, setgid and sticky bits.
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("permissions invalides : %q", s)
+	}
+	return protocol.FileModeFromUnix(uint32(mode)), nil
+}
+
+// attributeError describes the failure of an attribute change, telling apart
+// servers that cannot make it.
+func attributeError(action string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, protocol.ErrNotSupported):
+		return fmt.Errorf("%s : non pris en charge par le serveur", action)
+	default:
+		return fmt.Errorf("%s a échoué : %v", action, err)
+	}
+}
+
+// formatTreeStats describes the content of a directory tree.
+func formatTreeStats(stats protocol.TreeStats) string {
+	return fmt.Sprintf("%d fichier(s), %d dossier(s), %s",
+		stats.Files, stats.Dirs, formatFileSize(stats.Bytes))
 }
 
 // formatFileSize formats a file size in human-readable form.
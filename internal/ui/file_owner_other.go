@@ -0,0 +1,10 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package ui
+
+import "os"
+
+// localOwner is not supported on this platform: files have no Unix owner.
+func localOwner(info os.FileInfo) (owner, group string) {
+	return "", ""
+}
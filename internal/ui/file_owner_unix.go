@@ -0,0 +1,45 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package ui
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// Names of local users and groups, by ID
+var (
+	localNamesMu sync.Mutex
+	localUsers   = make(map[uint32]string)
+	localGroups  = make(map[uint32]string)
+)
+
+// localOwner returns the owner and group names of a local file, or their IDs
+// if they have no name.
+func localOwner(info os.FileInfo) (owner, group string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", ""
+	}
+
+	localNamesMu.Lock()
+	defer localNamesMu.Unlock()
+
+	uid, gid := uint32(stat.Uid), uint32(stat.Gid)
+	if _, ok := localUsers[uid]; !ok {
+		localUsers[uid] = strconv.FormatUint(uint64(uid), 10)
+		if u, err := user.LookupId(localUsers[uid]); err == nil {
+			localUsers[uid] = u.Username
+		}
+	}
+	if _, ok := localGroups[gid]; !ok {
+		localGroups[gid] = strconv.FormatUint(uint64(gid), 10)
+		if g, err := user.LookupGroupId(localGroups[gid]); err == nil {
+			localGroups[gid] = g.Name
+		}
+	}
+	return localUsers[uid], localGroups[gid]
+}
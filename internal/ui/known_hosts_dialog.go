@@ -0,0 +1,228 @@
+// Package ui provides the trusted SSH host keys dialog.
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"secure-ftp/internal/config"
+)
+
+// KnownHostsDialog lists the trusted SSH host keys, to remove or annotate them.
+type KnownHostsDialog struct {
+	window     fyne.Window
+	knownHosts *config.KnownHostsManager
+
+	// UI components
+	entryList     *widget.List
+	entries       []config.KnownHostEntry
+	selectedIndex int
+
+	// Details of the selected key
+	hostsLabel     *widget.Label
+	keyLabel       *widget.Label
+	sourceLabel    *widget.Label
+	commentEntry   *widget.Entry
+	saveCommentBtn *widget.Button
+	removeBtn      *widget.Button
+}
+
+// NewKnownHostsDialog creates a new host keys dialog.
+func NewKnownHostsDialog(parent fyne.Window, knownHosts *config.KnownHostsManager) *KnownHostsDialog {
+	return &KnownHostsDialog{
+		window:        parent,
+		knownHosts:    knownHosts,
+		selectedIndex: -1,
+	}
+}
+
+// Show displays the host keys dialog.
+func (kd *KnownHostsDialog) Show() {
+	kd.entries = kd.knownHosts.Entries()
+	kd.buildDialog()
+}
+
+// buildDialog constructs the dialog.
+func (kd *KnownHostsDialog) buildDialog() {
+	kd.entryList = widget.NewList(
+		func() int {
+			return len(kd.entries)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("host ssh-ed25519")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(knownHostSummary(kd.entries[id]))
+		},
+	)
+
+	kd.entryList.OnSelected = func(id widget.ListItemID) {
+		kd.selectedIndex = id
+		kd.loadEntry(id)
+	}
+
+	kd.hostsLabel = widget.NewLabel("")
+	kd.hostsLabel.Wrapping = fyne.TextWrapBreak
+	kd.keyLabel = widget.NewLabel("")
+	kd.keyLabel.Wrapping = fyne.TextWrapBreak
+	kd.sourceLabel = widget.NewLabel("")
+	kd.sourceLabel.Wrapping = fyne.TextWrapBreak
+	kd.commentEntry = widget.NewEntry()
+	kd.commentEntry.SetPlaceHolder("serveur de production, clé renouvelée en mars…")
+
+	kd.saveCommentBtn = widget.NewButton("Enregistrer le commentaire", kd.saveComment)
+	kd.removeBtn = widget.NewButton("Supprimer", kd.removeEntry)
+	kd.clearDetails()
+
+	details := container.NewVBox(
+		widget.NewLabel("Hôtes :"),
+		kd.hostsLabel,
+		widget.NewLabel("Clé :"),
+		kd.keyLabel,
+		widget.NewLabel("Fichier :"),
+		kd.sourceLabel,
+		widget.NewLabel("Commentaire :"),
+		kd.commentEntry,
+		widget.NewSeparator(),
+		container.NewHBox(kd.saveCommentBtn, kd.removeBtn),
+	)
+
+	detailsScroll := container.NewVScroll(details)
+	detailsScroll.SetMinSize(fyne.NewSize(300, 400))
+
+	listPanel := container.NewBorder(
+		widget.NewLabel("Clés d'hôtes de confiance"),
+		nil, nil, nil,
+		kd.entryList,
+	)
+
+	split := container.NewHSplit(listPanel, detailsScroll)
+	split.SetOffset(0.5)
+
+	dlg := dialog.NewCustom("Clés d'hôtes SSH", "Fermer", split, kd.window)
+	dlg.Resize(fyne.NewSize(800, 500))
+	dlg.Show()
+}
+
+// knownHostSummary returns the list line of a host key.
+func knownHostSummary(entry config.KnownHostEntry) string {
+	hosts := entry.Hosts
+	if strings.HasPrefix(hosts, "|1|") {
+		hosts = "(nom haché)"
+	}
+
+	keyType := entry.KeyType
+	if keyType == "" {
+		keyType = "empreinte"
+	}
+
+	summary := fmt.Sprintf("%s  %s", hosts, keyType)
+	switch entry.Marker {
+	case "@cert-authority":
+		summary = "[autorité] " + summary
+	case "@revoked":
+		summary = "[révoquée] " + summary
+	}
+	if entry.ReadOnly {
+		summary += "  (OpenSSH)"
+	}
+	return summary
+}
+
+// loadEntry shows the details of a host key.
+func (kd *KnownHostsDialog) loadEntry(index int) {
+	if index < 0 || index >= len(kd.entries) {
+		kd.clearDetails()
+		return
+	}
+
+	entry := kd.entries[index]
+	kd.hostsLabel.SetText(strings.ReplaceAll(entry.Hosts, ",", ", "))
+	if entry.KeyType == "" {
+		kd.keyLabel.SetText(fmt.Sprintf("SHA256:%s\n(empreinte enregistrée par une version précédente, remplacée par la clé complète à la prochaine connexion)", entry.Fingerprint))
+	} else {
+		kd.keyLabel.SetText(fmt.Sprintf("%s\nSHA256:%s", entry.KeyType, entry.Fingerprint))
+	}
+	kd.sourceLabel.SetText(entry.Source)
+	kd.commentEntry.SetText(entry.Comment)
+
+	// Keys of the OpenSSH files are managed with OpenSSH's tools
+	if entry.ReadOnly {
+		kd.commentEntry.Disable()
+		kd.saveCommentBtn.Disable()
+		kd.removeBtn.Disable()
+	} else {
+		kd.commentEntry.Enable()
+		kd.saveCommentBtn.Enable()
+		kd.removeBtn.Enable()
+		if entry.KeyType == "" {
+			kd.commentEntry.Disable()
+			kd.saveCommentBtn.Disable()
+		}
+	}
+}
+
+// clearDetails empties the details of the selected key.
+func (kd *KnownHostsDialog) clearDetails() {
+	kd.hostsLabel.SetText("")
+	kd.keyLabel.SetText("")
+	kd.sourceLabel.SetText("")
+	kd.commentEntry.SetText("")
+	kd.commentEntry.Disable()
+	kd.saveCommentBtn.Disable()
+	kd.removeBtn.Disable()
+}
+
+// refresh reloads the host keys after a change.
+func (kd *KnownHostsDialog) refresh() {
+	kd.entries = kd.knownHosts.Entries()
+	kd.selectedIndex = -1
+	kd.entryList.UnselectAll()
+	kd.entryList.Refresh()
+	kd.clearDetails()
+}
+
+// saveComment annotates the selected host key.
+func (kd *KnownHostsDialog) saveComment() {
+	if kd.selectedIndex < 0 || kd.selectedIndex >= len(kd.entries) {
+		return
+	}
+
+	if err := kd.knownHosts.SetComment(kd.entries[kd.selectedIndex], kd.commentEntry.Text); err != nil {
+		dialog.ShowError(err, kd.window)
+		return
+	}
+
+	index := kd.selectedIndex
+	kd.entries = kd.knownHosts.Entries()
+	kd.entryList.Refresh()
+	kd.loadEntry(index)
+}
+
+// removeEntry removes the selected host key after confirmation.
+func (kd *KnownHostsDialog) removeEntry() {
+	if kd.selectedIndex < 0 || kd.selectedIndex >= len(kd.entries) {
+		dialog.ShowError(fmt.Errorf("Aucune clé sélectionnée"), kd.window)
+		return
+	}
+
+	entry := kd.entries[kd.selectedIndex]
+	dialog.ShowConfirm("Supprimer la clé d'hôte",
+		fmt.Sprintf("Ne plus faire confiance à la clé %s de '%s' ?\n"+
+			"Une nouvelle confirmation sera demandée à la prochaine connexion.", entry.KeyType, entry.Hosts),
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := kd.knownHosts.RemoveEntry(entry); err != nil {
+				dialog.ShowError(err, kd.window)
+				return
+			}
+			kd.refresh()
+		}, kd.window)
+}
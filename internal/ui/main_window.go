@@ -4,9 +4,9 @@ package ui
 import (
 	"context"
 	"fmt"
-	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,7 +17,6 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"golang.org/x/crypto/ssh"
 
 	"secure-ftp/internal/config"
 	"secure-ftp/internal/protocol"
@@ -37,8 +36,11 @@ type MainWindow struct {
 	// Connection state
 	client         protocol.Protocol
 	transferMgr    *transfer.TransferManager
+	bandwidth      *transfer.BandwidthLimiter // Shared by all transfers of the session
+	resumeMgr      *transfer.ResumeManager    // Journal of unfinished transfers
 	connected      bool
 	currentProfile *config.ConnectionProfile
+	stopWatch      context.CancelFunc // Stops the running watch-mode sync, if any
 
 	// Security
 	knownHosts *config.KnownHostsManager
@@ -68,6 +70,9 @@ func NewMainWindow(configMgr *config.ConfigManager) *MainWindow {
 	// Apply theme from settings
 	mw.applyTheme(cfg.Theme)
 
+	// Bandwidth limits are global to the session and adjusted from settings
+	mw.bandwidth = transfer.NewBandwidthLimiter(cfg.RateLimits(nil))
+
 	mw.app.SetIcon(AppIcon)
 	mw.window = mw.app.NewWindow("Secure FTP - Client de transfert sécurisé")
 	mw.window.SetIcon(AppIcon)
@@ -93,8 +98,23 @@ func NewMainWindow(configMgr *config.ConfigManager) *MainWindow {
 		mw.credentialsMgr = credsMgr
 	}
 
+	// Open the transfer journal; entries untouched for a month are dropped
+	resumeMgr, err := transfer.NewResumeManager(cfg.ResumeStatePath)
+	if err != nil {
+		mw.log.Warnf("Failed to load transfer journal: %v", err)
+	} else {
+		resumeMgr.ClearOld(30 * 24 * time.Hour)
+		mw.resumeMgr = resumeMgr
+	}
+
 	mw.buildUI()
 
+	if mw.resumeMgr != nil {
+		if n := mw.resumeMgr.Count(); n > 0 {
+			mw.statusBar.SetText(fmt.Sprintf("Déconnecté - %d transfert(s) inachevé(s), reconnectez-vous pour les reprendre", n))
+		}
+	}
+
 	return mw
 }
 
@@ -107,21 +127,23 @@ func (mw *MainWindow) buildUI() {
 	cfg := mw.configMgr.Get()
 	mw.localBrowser = NewFileBrowser(mw.window, true, cfg.DefaultLocalDir)
 	mw.localBrowser.SetShowHidden(cfg.ShowHiddenFiles)
+	mw.localBrowser.SetColumns(cfg.BrowserColumns)
 	mw.remoteBrowser = NewFileBrowser(mw.window, false, "/")
 	mw.remoteBrowser.SetShowHidden(cfg.ShowHiddenFiles)
+	mw.remoteBrowser.SetColumns(cfg.BrowserColumns)
 	mw.remoteBrowser.SetDisabled(true) // Disabled until connected
 
 	// Initialize drag & drop manager
 	mw.dragDropMgr = NewDragDropManager(mw.window)
 	mw.dragDropMgr.SetBrowsers(mw.localBrowser, mw.remoteBrowser)
-	mw.dragDropMgr.SetOnUpload(func(localPath string) {
+	mw.dragDropMgr.SetOnUpload(func(localPath string, isDir bool) {
 		if mw.connected {
-			mw.uploadFile(localPath)
+			mw.uploadFile(localPath, isDir)
 		}
 	})
-	mw.dragDropMgr.SetOnDownload(func(remotePath string) {
+	mw.dragDropMgr.SetOnDownload(func(remotePath string, isDir bool) {
 		if mw.connected {
-			mw.downloadFile(remotePath)
+			mw.downloadFile(remotePath, isDir)
 		}
 	})
 
@@ -208,12 +230,16 @@ func (mw *MainWindow) createMenu() {
 		fyne.NewMenuItem("Déconnexion", mw.onDisconnect),
 		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Profils...", mw.onManageProfiles),
+		fyne.NewMenuItem("Importer les hôtes de ~/.ssh/config", mw.onImportSSHConfig),
+		fyne.NewMenuItem("Importer ~/.ssh/known_hosts", mw.onImportKnownHosts),
+		fyne.NewMenuItem("Exporter vers ~/.ssh/known_hosts", mw.onExportKnownHosts),
 		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Quitter", func() { mw.app.Quit() }),
 	)
 
 	editMenu := fyne.NewMenu("Édition",
 		fyne.NewMenuItem("Paramètres...", mw.onSettings),
+		fyne.NewMenuItem("Clés d'hôtes SSH...", mw.onManageKnownHosts),
 	)
 
 	transferMenu := fyne.NewMenu("Transfert",
@@ -221,15 +247,25 @@ func (mw *MainWindow) createMenu() {
 		fyne.NewMenuItem("Télécharger la sélection", mw.onDownload),
 		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Synchroniser les dossiers...", mw.onSync),
+		fyne.NewMenuItem("Arrêter la surveillance", mw.onStopWatch),
 		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Annuler tout", mw.onCancelAll),
 	)
 
+	remoteMenu := fyne.NewMenu("Distant",
+		fyne.NewMenuItem("Propriétés...", mw.onRemoteProperties),
+		fyne.NewMenuItem("Taille du dossier...", mw.onRemoteFolderSize),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Permissions...", mw.onRemoteChmod),
+		fyne.NewMenuItem("Propriétaire...", mw.onRemoteChown),
+		fyne.NewMenuItem("Nouveau lien symbolique...", mw.onRemoteSymlink),
+	)
+
 	helpMenu := fyne.NewMenu("Aide",
 		fyne.NewMenuItem("À propos", mw.onAbout),
 	)
 
-	mainMenu := fyne.NewMainMenu(fileMenu, editMenu, transferMenu, helpMenu)
+	mainMenu := fyne.NewMainMenu(fileMenu, editMenu, transferMenu, remoteMenu, helpMenu)
 	mw.window.SetMainMenu(mainMenu)
 }
 
@@ -241,14 +277,14 @@ func (mw *MainWindow) setupCallbacks() {
 	// Double-click on local file to upload
 	mw.localBrowser.SetOnFileDoubleClick(func(path string, isDir bool) {
 		if !isDir && mw.connected {
-			mw.uploadFile(path)
+			mw.uploadFile(path, false)
 		}
 	})
 
 	// Double-click on remote file to download
 	mw.remoteBrowser.SetOnFileDoubleClick(func(path string, isDir bool) {
 		if !isDir && mw.connected {
-			mw.downloadFile(path)
+			mw.downloadFile(path, false)
 		}
 	})
 
@@ -312,31 +348,65 @@ func (mw *MainWindow) setupCallbacks() {
 	})
 
 	// Transfer view callbacks
+	// Directory transfers are controlled as a whole through their job
 	mw.transferView.SetOnPause(func(id string) {
-		if mw.transferMgr != nil {
+		if mw.transferMgr == nil {
+			return
+		}
+		if mw.transferMgr.GetJob(id) != nil {
+			mw.transferMgr.PauseJob(id)
+		} else {
 			mw.transferMgr.Pause(id)
 		}
+		mw.transferView.list.Refresh()
 	})
 
 	mw.transferView.SetOnResume(func(id string) {
-		if mw.transferMgr != nil {
+		if mw.transferMgr == nil {
+			return
+		}
+		if mw.transferMgr.GetJob(id) != nil {
+			mw.transferMgr.ResumeJob(id)
+		} else {
 			mw.transferMgr.Resume(id)
 		}
+		mw.transferView.list.Refresh()
 	})
 
 	mw.transferView.SetOnCancel(func(id string) {
-		if mw.transferMgr != nil {
+		if mw.transferMgr == nil {
+			return
+		}
+		if mw.transferMgr.GetJob(id) != nil {
+			mw.transferMgr.CancelJob(id)
+		} else {
 			mw.transferMgr.Cancel(id)
 		}
+		mw.transferView.list.Refresh()
 	})
 
 	mw.transferView.SetOnRetry(func(id string) {
-		if mw.transferMgr != nil {
-			if newItem, err := mw.transferMgr.Retry(id); err == nil {
+		if mw.transferMgr == nil {
+			return
+		}
+		if mw.transferMgr.GetJob(id) != nil {
+			if err := mw.transferMgr.RetryJob(id); err == nil {
+				mw.transferView.list.Refresh()
+			}
+		} else if newItem, err := mw.transferMgr.Retry(id); err == nil {
+			if newItem.JobID == "" {
 				mw.transferView.AddTransfer(newItem)
+			} else {
+				mw.transferView.list.Refresh()
 			}
 		}
 	})
+
+	mw.transferView.SetOnClearCompleted(func() {
+		if mw.transferMgr != nil {
+			mw.transferMgr.ClearCompleted()
+		}
+	})
 }
 
 // onConnect handles the connect button click.
@@ -362,38 +432,21 @@ func (mw *MainWindow) connect(profile *config.ConnectionProfile, password string
 		}
 
 		// Build connection config
-		connConfig := &protocol.ConnectionConfig{
-			Protocol:      profile.Protocol,
-			Host:          profile.Host,
-			Port:          profile.Port,
-			Username:      profile.Username,
-			Password:      password,
-			TLSImplicit:   profile.TLSImplicit,
-		}
-
-		// Set up host key verification for SFTP
-		if profile.Protocol == "sftp" {
-			if mw.knownHosts != nil {
-				connConfig.HostKeyCallback = mw.createHostKeyCallback()
-			} else {
-				// Fallback: accept all host keys (less secure but allows connection)
-				connConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-					mw.log.Warnf("Host key verification disabled - accepting key for %s", hostname)
-					return nil
-				}
-			}
-		}
-
-		// Load private key if specified
-		if profile.PrivateKeyPath != "" {
-			keyData, err := os.ReadFile(profile.PrivateKeyPath)
-			if err != nil {
-				dialog.ShowError(fmt.Errorf("Échec de lecture de la clé privée : %w", err), mw.window)
-				mw.statusBar.SetText("Échec de connexion")
-				return
-			}
-			connConfig.PrivateKey = keyData
+		connConfig, err := mw.configMgr.ConnectionConfig(profile, config.ConnectEnv{
+			Password:    password,
+			Credentials: mw.credentialsMgr,
+			KnownHosts:  mw.knownHosts,
+			Passphrase:  mw.askKeyPassphrase,
+			Challenge:   mw.askChallenge,
+		})
+		if err != nil {
+			mw.window.Canvas().Refresh(mw.statusBar)
+			dialog.ShowError(fmt.Errorf("Échec de connexion : %w", err), mw.window)
+			mw.statusBar.SetText("Échec de connexion")
+			return
 		}
+		connConfig.Throttle = mw.bandwidth
+		mw.applyRateLimits(profile)
 
 		ctx := context.Background()
 		if err := client.Connect(ctx, connConfig); err != nil {
@@ -414,8 +467,19 @@ func (mw *MainWindow) connect(profile *config.ConnectionProfile, password string
 		// Create transfer manager
 		cfg := mw.configMgr.Get()
 		mw.transferMgr = transfer.NewTransferManager(client, cfg.MaxParallelTransfers)
+		if profile.Protocol != "sftp" {
+			// FTP cannot run parallel transfers over the browsing connection
+			mw.transferMgr.SetConnectionPool(protocol.NewFTPSConnectionPool(connConfig, cfg.MaxParallelTransfers))
+		}
+		mw.transferMgr.SetVerify(cfg.VerifyTransfers)
+		mw.transferMgr.SetAtomicUploads(profile.AtomicUploads)
+		mw.transferMgr.SetRetryPolicy(transfer.NewRetryPolicy(cfg.TransferRetries))
 		mw.transferMgr.SetUpdateCallback(mw.onTransferUpdate)
 		mw.transferMgr.SetCompleteCallback(mw.onTransferComplete)
+		mw.transferMgr.SetJobCompleteCallback(mw.onJobComplete)
+		if mw.resumeMgr != nil && profile.ID != "" {
+			mw.transferMgr.SetJournal(mw.resumeMgr, profile.ID)
+		}
 
 		// Update UI
 		mw.updateConnectionState()
@@ -428,11 +492,58 @@ func (mw *MainWindow) connect(profile *config.ConnectionProfile, password string
 			startDir = profile.RemoteDir
 		}
 		mw.remoteBrowser.NavigateTo(startDir)
+
+		mw.offerUnfinishedTransfers(profile)
 	}()
 }
 
+// offerUnfinishedTransfers asks whether to resume the transfers of profile
+// left unfinished by a previous session.
+func (mw *MainWindow) offerUnfinishedTransfers(profile *config.ConnectionProfile) {
+	if mw.resumeMgr == nil || profile.ID == "" {
+		return
+	}
+
+	infos := mw.resumeMgr.GetForProfile(profile.ID)
+	if len(infos) == 0 {
+		return
+	}
+
+	dialog.ShowConfirm("Transferts inachevés",
+		fmt.Sprintf("%d transfert(s) vers %s n'ont pas été terminés lors de la session précédente.\nVoulez-vous les reprendre ?", len(infos), profile.Host),
+		func(resume bool) {
+			if resume && mw.transferMgr != nil {
+				// Files of a directory transfer rejoin their job's line
+				shownJobs := make(map[string]bool)
+				for _, item := range mw.transferMgr.Restore(infos) {
+					if item.JobID == "" {
+						mw.transferView.AddTransfer(item)
+					} else if job := mw.transferMgr.GetJob(item.JobID); job != nil && !shownJobs[job.ID] {
+						shownJobs[job.ID] = true
+						mw.transferView.AddJob(job)
+					}
+				}
+				mw.statusBar.SetText(fmt.Sprintf("Reprise de %d transfert(s)", len(infos)))
+				return
+			}
+
+			// Declined: forget them
+			for _, info := range infos {
+				mw.resumeMgr.CompleteTransfer(info.ID)
+			}
+		}, mw.window)
+}
+
 // onDisconnect handles the disconnect button click.
 func (mw *MainWindow) onDisconnect() {
+	mw.onStopWatch()
+
+	// Stop transfers first so that they are journaled as interrupted, not failed
+	if mw.transferMgr != nil {
+		mw.transferMgr.Stop()
+		mw.transferMgr = nil
+	}
+
 	if mw.client != nil {
 		mw.client.Disconnect()
 	}
@@ -440,11 +551,7 @@ func (mw *MainWindow) onDisconnect() {
 	mw.client = nil
 	mw.connected = false
 	mw.currentProfile = nil
-
-	if mw.transferMgr != nil {
-		mw.transferMgr.Stop()
-		mw.transferMgr = nil
-	}
+	mw.applyRateLimits(nil)
 
 	mw.updateConnectionState()
 	mw.statusBar.SetText("Déconnecté")
@@ -479,22 +586,22 @@ func (mw *MainWindow) onUpload() {
 		return
 	}
 
-	selected := mw.localBrowser.GetSelectedFiles()
+	selected := mw.localBrowser.GetSelectedItems()
 	if len(selected) == 0 {
 		dialog.ShowInformation("Aucune sélection", "Veuillez sélectionner des fichiers à envoyer.", mw.window)
 		return
 	}
 
 	remoteDir := mw.remoteBrowser.GetCurrentPath()
-	for _, localPath := range selected {
-		mw.uploadFile(localPath)
+	for _, item := range selected {
+		mw.uploadFile(item.Path, item.IsDir)
 	}
 
-	mw.statusBar.SetText(fmt.Sprintf("Envoi de %d fichier(s) vers %s", len(selected), remoteDir))
+	mw.statusBar.SetText(fmt.Sprintf("Envoi de %d élément(s) vers %s", len(selected), remoteDir))
 }
 
-// uploadFile uploads a single file.
-func (mw *MainWindow) uploadFile(localPath string) {
+// uploadFile uploads a single file, or a directory recursively.
+func (mw *MainWindow) uploadFile(localPath string, isDir bool) {
 	if mw.transferMgr == nil {
 		return
 	}
@@ -502,6 +609,12 @@ func (mw *MainWindow) uploadFile(localPath string) {
 	remoteDir := mw.remoteBrowser.GetCurrentPath()
 	remotePath := remoteDir + "/" + mw.localBrowser.GetFileName(localPath)
 
+	if isDir {
+		job := mw.transferMgr.AddUploadDir(localPath, remotePath, 0)
+		mw.transferView.AddJob(job)
+		return
+	}
+
 	item := mw.transferMgr.AddUpload(localPath, remotePath, 0)
 	mw.transferView.AddTransfer(item)
 }
@@ -513,21 +626,21 @@ func (mw *MainWindow) onDownload() {
 		return
 	}
 
-	selected := mw.remoteBrowser.GetSelectedFiles()
+	selected := mw.remoteBrowser.GetSelectedItems()
 	if len(selected) == 0 {
 		dialog.ShowInformation("Aucune sélection", "Veuillez sélectionner des fichiers à télécharger.", mw.window)
 		return
 	}
 
-	for _, remotePath := range selected {
-		mw.downloadFile(remotePath)
+	for _, item := range selected {
+		mw.downloadFile(item.Path, item.IsDir)
 	}
 
-	mw.statusBar.SetText(fmt.Sprintf("Téléchargement de %d fichier(s)", len(selected)))
+	mw.statusBar.SetText(fmt.Sprintf("Téléchargement de %d élément(s)", len(selected)))
 }
 
-// downloadFile downloads a single file.
-func (mw *MainWindow) downloadFile(remotePath string) {
+// downloadFile downloads a single file, or a directory recursively.
+func (mw *MainWindow) downloadFile(remotePath string, isDir bool) {
 	if mw.transferMgr == nil {
 		return
 	}
@@ -535,6 +648,12 @@ func (mw *MainWindow) downloadFile(remotePath string) {
 	localDir := mw.localBrowser.GetCurrentPath()
 	localPath := localDir + "/" + mw.remoteBrowser.GetFileName(remotePath)
 
+	if isDir {
+		job := mw.transferMgr.AddDownloadDir(remotePath, localPath, 0)
+		mw.transferView.AddJob(job)
+		return
+	}
+
 	item := mw.transferMgr.AddDownload(remotePath, localPath, 0)
 	mw.transferView.AddTransfer(item)
 }
@@ -554,52 +673,152 @@ func (mw *MainWindow) onSync() {
 }
 
 // performSync executes folder synchronization.
-func (mw *MainWindow) performSync(options ftpsync.SyncOptions, localDir, remoteDir string) {
+// In bidirectional mode with the "ask" policy, conflicts are reviewed first.
+func (mw *MainWindow) performSync(options ftpsync.SyncOptions, localDir, remoteDir string, watch bool) {
 	mw.statusBar.SetText("Synchronisation des dossiers...")
 
+	if mw.currentProfile != nil {
+		cfg := mw.configMgr.Get()
+		options.ClockPath = ftpsync.ClockPath(cfg.SyncStateDir, mw.currentProfile.SyncServerKey())
+		options.AtomicUploads = options.AtomicUploads || mw.currentProfile.AtomicUploads
+		if options.Mode == ftpsync.ModeBidirectional {
+			options.StatePath = ftpsync.StatePath(cfg.SyncStateDir, mw.currentProfile.SyncServerKey(), localDir, remoteDir)
+			options.RemoteHost = mw.currentProfile.Host
+		}
+	}
+
+	if watch {
+		mw.startWatch(options, localDir, remoteDir)
+		return
+	}
+
+	if options.Mode != ftpsync.ModeBidirectional || options.ConflictPolicy != ftpsync.ConflictAsk || options.DryRun {
+		go mw.executeSync(options, localDir, remoteDir)
+		return
+	}
+
 	go func() {
 		syncer := ftpsync.NewSyncer(mw.client, mw.transferMgr, options)
-		result, err := syncer.Execute(context.Background(), localDir, remoteDir)
-
+		actions, err := syncer.Analyze(context.Background(), localDir, remoteDir)
 		if err != nil {
 			dialog.ShowError(err, mw.window)
 			mw.statusBar.SetText("Échec de synchronisation")
 			return
 		}
 
-		// Show results
-		msg := fmt.Sprintf("Synchronisation terminée !\n\n"+
-			"Envoyés : %d fichiers\n"+
-			"Téléchargés : %d fichiers\n"+
-			"Supprimés : %d fichiers\n"+
-			"Ignorés : %d fichiers\n"+
-			"Total transféré : %s\n"+
-			"Durée : %s",
-			result.FilesUploaded,
-			result.FilesDownloaded,
-			result.FilesDeleted,
-			result.FilesSkipped,
-			formatBytes(result.BytesTransferred),
-			result.Duration.Round(time.Millisecond),
-		)
-
-		if len(result.Errors) > 0 {
-			msg += fmt.Sprintf("\n\nErreurs : %d", len(result.Errors))
+		var conflicts []ftpsync.Conflict
+		for _, action := range actions {
+			if action.Conflict != nil {
+				conflicts = append(conflicts, *action.Conflict)
+			}
+		}
+		if len(conflicts) == 0 {
+			mw.executeSync(options, localDir, remoteDir)
+			return
 		}
 
-		if options.DryRun {
-			msg = "[SIMULATION - Aucune modification effectuée]\n\n" + msg
+		mw.statusBar.SetText(fmt.Sprintf("%d conflit(s) à résoudre", len(conflicts)))
+		ShowConflictReview(mw.window, conflicts, func(resolutions map[string]ftpsync.ConflictPolicy) {
+			options.Resolutions = resolutions
+			mw.statusBar.SetText("Synchronisation des dossiers...")
+			go mw.executeSync(options, localDir, remoteDir)
+		})
+	}()
+}
+
+// executeSync runs the synchronization and reports its result.
+func (mw *MainWindow) executeSync(options ftpsync.SyncOptions, localDir, remoteDir string) {
+	syncer := ftpsync.NewSyncer(mw.client, mw.transferMgr, options)
+	result, err := syncer.Execute(context.Background(), localDir, remoteDir)
+
+	if err != nil {
+		dialog.ShowError(err, mw.window)
+		mw.statusBar.SetText("Échec de synchronisation")
+		return
+	}
+
+	unresolved := 0
+	for _, c := range result.Conflicts {
+		if c.Resolution == ftpsync.ConflictAsk {
+			unresolved++
 		}
+	}
 
-		dialog.ShowInformation("Synchronisation terminée", msg, mw.window)
-		mw.statusBar.SetText("Synchronisation terminée")
+	// Show results
+	msg := fmt.Sprintf("Synchronisation terminée !\n\n"+
+		"Envoyés : %d fichiers\n"+
+		"Téléchargés : %d fichiers\n"+
+		"Supprimés : %d fichiers\n"+
+		"Ignorés : %d fichiers\n"+
+		"Conflits : %d fichiers (%d non résolus)\n"+
+		"Total transféré : %s\n"+
+		"Durée : %s",
+		result.FilesUploaded,
+		result.FilesDownloaded,
+		result.FilesDeleted,
+		result.FilesSkipped,
+		len(result.Conflicts),
+		unresolved,
+		formatBytes(result.BytesTransferred),
+		result.Duration.Round(time.Millisecond),
+	)
 
-		// Refresh both browsers
-		mw.localBrowser.Refresh()
-		mw.remoteBrowser.Refresh()
+	if len(result.Errors) > 0 {
+		msg += fmt.Sprintf("\n\nErreurs : %d", len(result.Errors))
+	}
+
+	if options.DryRun {
+		msg = "[SIMULATION - Aucune modification effectuée]\n\n" + msg
+	}
+
+	dialog.ShowInformation("Synchronisation terminée", msg, mw.window)
+	mw.statusBar.SetText("Synchronisation terminée")
+
+	// Refresh both browsers
+	mw.localBrowser.Refresh()
+	mw.remoteBrowser.Refresh()
+}
+
+// startWatch keeps localDir and remoteDir in sync until stopped or
+// disconnected. Only one watch runs at a time.
+func (mw *MainWindow) startWatch(options ftpsync.SyncOptions, localDir, remoteDir string) {
+	mw.onStopWatch()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mw.stopWatch = cancel
+
+	syncer := ftpsync.NewSyncer(mw.client, mw.transferMgr, options)
+	go func() {
+		err := syncer.Watch(ctx, localDir, remoteDir, ftpsync.WatchOptions{
+			OnQueued: mw.transferView.AddTransfer,
+			OnSync: func(result *ftpsync.SyncResult) {
+				mw.statusBar.SetText(fmt.Sprintf("Surveillance de %s : %d envoyé(s), %d téléchargé(s), %d supprimé(s), %d conflit(s) - %s",
+					localDir, result.FilesUploaded, result.FilesDownloaded, result.FilesDeleted,
+					len(result.Conflicts), time.Now().Format("15:04:05")))
+				if result.FilesDownloaded+result.FilesDeleted > 0 {
+					mw.localBrowser.Refresh()
+				}
+				if result.FilesUploaded+result.FilesDeleted > 0 {
+					mw.remoteBrowser.Refresh()
+				}
+			},
+		})
+		if err != nil {
+			dialog.ShowError(err, mw.window)
+			mw.statusBar.SetText("Échec de la surveillance")
+		}
 	}()
 }
 
+// onStopWatch stops the running watch-mode sync.
+func (mw *MainWindow) onStopWatch() {
+	if mw.stopWatch != nil {
+		mw.stopWatch()
+		mw.stopWatch = nil
+		mw.statusBar.SetText("Surveillance arrêtée")
+	}
+}
+
 // onCancelAll cancels all transfers.
 func (mw *MainWindow) onCancelAll() {
 	if mw.transferMgr != nil {
@@ -616,9 +835,66 @@ func (mw *MainWindow) onManageProfiles() {
 	dlg.Show()
 }
 
+// onImportSSHConfig adds a profile for each host of ~/.ssh/config.
+func (mw *MainWindow) onImportSSHConfig() {
+	path := config.DefaultSSHConfigPath()
+	added, err := mw.configMgr.ImportSSHConfig(path)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("Échec de l'import de %s : %w", path, err), mw.window)
+		return
+	}
+	dialog.ShowInformation("Import terminé",
+		fmt.Sprintf("%d profil(s) importé(s) depuis %s.\nLes hôtes portant le nom d'un profil existant ont été ignorés.", added, path),
+		mw.window)
+}
+
+// onImportKnownHosts copies the keys of OpenSSH's known_hosts into ours.
+func (mw *MainWindow) onImportKnownHosts() {
+	if mw.knownHosts == nil {
+		return
+	}
+	path := config.SystemKnownHostsFiles()[0]
+	added, err := mw.knownHosts.Import(path)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("Échec de l'import de %s : %w", path, err), mw.window)
+		return
+	}
+	dialog.ShowInformation("Import terminé", fmt.Sprintf("%d clé(s) d'hôte importée(s) depuis %s.", added, path), mw.window)
+}
+
+// onExportKnownHosts adds our host keys to OpenSSH's known_hosts.
+func (mw *MainWindow) onExportKnownHosts() {
+	if mw.knownHosts == nil {
+		return
+	}
+	path := config.SystemKnownHostsFiles()[0]
+	dialog.ShowConfirm("Exporter les clés d'hôte",
+		fmt.Sprintf("Ajouter à %s les clés d'hôte connues de Secure FTP qui n'y figurent pas ?", path),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			added, err := mw.knownHosts.Export(path)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("Échec de l'export vers %s : %w", path, err), mw.window)
+				return
+			}
+			dialog.ShowInformation("Export terminé", fmt.Sprintf("%d clé(s) d'hôte ajoutée(s) à %s.", added, path), mw.window)
+		}, mw.window)
+}
+
+// onManageKnownHosts opens the trusted SSH host keys dialog.
+func (mw *MainWindow) onManageKnownHosts() {
+	if mw.knownHosts == nil {
+		dialog.ShowInformation("Clés d'hôtes SSH", "La vérification des clés d'hôtes n'est pas disponible.", mw.window)
+		return
+	}
+	NewKnownHostsDialog(mw.window, mw.knownHosts).Show()
+}
+
 // onSettings opens the settings dialog.
 func (mw *MainWindow) onSettings() {
-	dlg := NewSettingsDialog(mw.window, mw.configMgr, func() {
+	dlg := NewSettingsDialog(mw.window, mw.configMgr, mw.credentialsMgr, func() {
 		// Apply all settings changes
 		mw.applySettings()
 	})
@@ -632,6 +908,87 @@ func (mw *MainWindow) onAbout() {
 		mw.window)
 }
 
+// selectedRemoteItem returns the selected remote item, or nil after telling
+// the user why there is none.
+func (mw *MainWindow) selectedRemoteItem() *FileItem {
+	if !mw.connected {
+		dialog.ShowInformation("Non connecté", "Veuillez d'abord vous connecter à un serveur.", mw.window)
+		return nil
+	}
+
+	item := mw.remoteBrowser.GetSelectedItem()
+	if item == nil {
+		dialog.ShowInformation("Aucune sélection", "Veuillez sélectionner un fichier ou un dossier distant.", mw.window)
+	}
+	return item
+}
+
+// remoteFileOps returns a file operations handler for the current connection.
+func (mw *MainWindow) remoteFileOps() *FileOperations {
+	fileOps := NewFileOperations(mw.window)
+	fileOps.SetClient(mw.client)
+	return fileOps
+}
+
+// onRemoteProperties shows the properties of the selected remote item.
+func (mw *MainWindow) onRemoteProperties() {
+	if item := mw.selectedRemoteItem(); item != nil {
+		mw.remoteFileOps().ShowPropertiesRemote(item.Path, func() {
+			mw.remoteBrowser.Refresh()
+		})
+	}
+}
+
+// onRemoteFolderSize computes the size of the selected remote directory.
+func (mw *MainWindow) onRemoteFolderSize() {
+	item := mw.selectedRemoteItem()
+	if item == nil {
+		return
+	}
+	if !item.IsDir {
+		mw.remoteFileOps().ShowPropertiesRemote(item.Path, func() {
+			mw.remoteBrowser.Refresh()
+		})
+		return
+	}
+	mw.remoteFileOps().ShowFolderSizeRemote(item.Path)
+}
+
+// onRemoteChmod changes the permissions of the selected remote item.
+func (mw *MainWindow) onRemoteChmod() {
+	if item := mw.selectedRemoteItem(); item != nil {
+		mw.remoteFileOps().ChmodRemote(item.Path, item.IsDir, func() {
+			mw.remoteBrowser.Refresh()
+		})
+	}
+}
+
+// onRemoteChown changes the owner of the selected remote item.
+func (mw *MainWindow) onRemoteChown() {
+	if item := mw.selectedRemoteItem(); item != nil {
+		mw.remoteFileOps().ChownRemote(item.Path, item.IsDir, func() {
+			mw.remoteBrowser.Refresh()
+		})
+	}
+}
+
+// onRemoteSymlink creates a symbolic link in the current remote directory,
+// pointing to the selected item if any.
+func (mw *MainWindow) onRemoteSymlink() {
+	if !mw.connected {
+		dialog.ShowInformation("Non connecté", "Veuillez d'abord vous connecter à un serveur.", mw.window)
+		return
+	}
+
+	var target string
+	if item := mw.remoteBrowser.GetSelectedItem(); item != nil {
+		target = item.Path
+	}
+	mw.remoteFileOps().CreateSymlinkRemote(mw.remoteBrowser.GetCurrentPath(), target, func() {
+		mw.remoteBrowser.Refresh()
+	})
+}
+
 // onTransferUpdate handles transfer progress updates.
 func (mw *MainWindow) onTransferUpdate(item *transfer.TransferItem) {
 	mw.transferView.UpdateTransfer(item)
@@ -641,6 +998,11 @@ func (mw *MainWindow) onTransferUpdate(item *transfer.TransferItem) {
 func (mw *MainWindow) onTransferComplete(item *transfer.TransferItem) {
 	mw.transferView.UpdateTransfer(item)
 
+	// Files of a directory transfer are reported with their job
+	if item.JobID != "" {
+		return
+	}
+
 	// Refresh the appropriate browser
 	if item.Direction == transfer.DirectionUpload {
 		mw.remoteBrowser.Refresh()
@@ -655,12 +1017,125 @@ func (mw *MainWindow) onTransferComplete(item *transfer.TransferItem) {
 	}
 }
 
-// createHostKeyCallback creates a callback for SSH host key verification.
-func (mw *MainWindow) createHostKeyCallback() protocol.HostKeyCallback {
-	callback := mw.knownHosts.GetHostKeyCallback()
-	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		return callback(hostname, remote, key)
+// onJobComplete handles the end of a directory transfer.
+func (mw *MainWindow) onJobComplete(job *transfer.TransferJob) {
+	mw.transferView.list.Refresh()
+
+	if job.Direction == transfer.DirectionUpload {
+		mw.remoteBrowser.Refresh()
+	} else {
+		mw.localBrowser.Refresh()
+	}
+
+	completed, total := job.FileCounts()
+	switch job.Status() {
+	case transfer.StatusCompleted:
+		mw.statusBar.SetText(fmt.Sprintf("Transfert du dossier terminé : %s (%d fichier(s))", job.LocalPath, total))
+	case transfer.StatusFailed:
+		mw.statusBar.SetText(fmt.Sprintf("Échec du transfert du dossier %s : %d/%d fichier(s) transféré(s)", job.LocalPath, completed, total))
+	}
+}
+
+// askKeyPassphrase returns the passphrase of an encrypted private key: the
+// one stored in the credentials, or else the one the user types. A stored
+// passphrase that turned out to be wrong is forgotten.
+func (mw *MainWindow) askKeyPassphrase(keyPath string, retry bool) ([]byte, error) {
+	if mw.credentialsMgr != nil {
+		if retry {
+			mw.credentialsMgr.DeleteKeyPassphrase(keyPath)
+		} else if passphrase, err := mw.credentialsMgr.GetKeyPassphrase(keyPath); err == nil && passphrase != "" {
+			return []byte(passphrase), nil
+		}
+	}
+
+	entry := widget.NewPasswordEntry()
+	remember := widget.NewCheck("Mémoriser la phrase de passe", nil)
+	if mw.credentialsMgr == nil {
+		remember.Hide()
+	}
+
+	message := fmt.Sprintf("Phrase de passe de la clé %s :", keyPath)
+	if retry {
+		message = fmt.Sprintf("Phrase de passe incorrecte, réessayez pour la clé %s :", keyPath)
+	}
+	content := container.NewVBox(widget.NewLabel(message), entry, remember)
+
+	var passphrase string
+	var confirmed bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	mw.window.Canvas().Refresh(mw.statusBar)
+	dlg := dialog.NewCustomConfirm("Clé privée chiffrée", "Déverrouiller", "Annuler", content,
+		func(ok bool) {
+			confirmed = ok
+			passphrase = entry.Text
+			wg.Done()
+		}, mw.window)
+	dlg.Resize(fyne.NewSize(450, 180))
+	dlg.Show()
+	mw.window.Canvas().Focus(entry)
+
+	wg.Wait()
+	if !confirmed {
+		return nil, fmt.Errorf("saisie de la phrase de passe annulée")
+	}
+
+	if remember.Checked && mw.credentialsMgr != nil {
+		mw.credentialsMgr.SetKeyPassphrase(keyPath, passphrase)
+	}
+	return []byte(passphrase), nil
+}
+
+// askChallenge asks the user to answer the questions of the server, such as a
+// one-time code, or for the password when the profile has none.
+func (mw *MainWindow) askChallenge(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	content := container.NewVBox()
+	if instruction != "" {
+		content.Add(widget.NewLabel(instruction))
+	}
+
+	entries := make([]*widget.Entry, len(questions))
+	for i, question := range questions {
+		if echos[i] {
+			entries[i] = widget.NewEntry()
+		} else {
+			entries[i] = widget.NewPasswordEntry()
+		}
+		content.Add(widget.NewLabel(strings.TrimSpace(question)))
+		content.Add(entries[i])
+	}
+
+	title := name
+	if title == "" {
+		title = "Authentification demandée par le serveur"
 	}
+
+	var answers []string
+	var confirmed bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	mw.window.Canvas().Refresh(mw.statusBar)
+	dlg := dialog.NewCustomConfirm(title, "Valider", "Annuler", content,
+		func(ok bool) {
+			confirmed = ok
+			for _, entry := range entries {
+				answers = append(answers, entry.Text)
+			}
+			wg.Done()
+		}, mw.window)
+	dlg.Resize(fyne.NewSize(450, 150+60*float32(len(questions))))
+	dlg.Show()
+	if len(entries) > 0 {
+		mw.window.Canvas().Focus(entries[0])
+	}
+
+	wg.Wait()
+	if !confirmed {
+		return nil, fmt.Errorf("authentification annulée")
+	}
+	return answers, nil
 }
 
 // setupKnownHostsCallbacks sets up the callbacks for host key verification dialogs.
@@ -750,46 +1225,49 @@ func (mw *MainWindow) handleExternalDrop(pos fyne.Position, uris []fyne.URI) {
 		return
 	}
 
-	// Count files to upload
-	fileCount := 0
+	// Collect files and folders to upload
+	var paths []string
+	var dirs []bool
 	for _, uri := range uris {
-		// Check if it's a file (not directory)
 		info, err := os.Stat(uri.Path())
-		if err == nil && !info.IsDir() {
-			fileCount++
+		if err == nil && (info.IsDir() || info.Mode().IsRegular()) {
+			paths = append(paths, uri.Path())
+			dirs = append(dirs, info.IsDir())
 		}
 	}
 
-	if fileCount == 0 {
+	if len(paths) == 0 {
 		dialog.ShowInformation("Glisser-déposer", "Aucun fichier valide détecté.", mw.window)
 		return
 	}
 
 	if mw.connected {
-		// Upload dropped files to remote server
+		// Upload dropped files and folders to remote server
 		remoteDir := mw.remoteBrowser.GetCurrentPath()
-		for _, uri := range uris {
-			info, err := os.Stat(uri.Path())
-			if err == nil && !info.IsDir() {
-				mw.uploadFile(uri.Path())
-			}
+		for i, localPath := range paths {
+			mw.uploadFile(localPath, dirs[i])
 		}
-		mw.statusBar.SetText(fmt.Sprintf("%d fichier(s) déposé(s) - envoi vers %s", fileCount, remoteDir))
+		mw.statusBar.SetText(fmt.Sprintf("%d élément(s) déposé(s) - envoi vers %s", len(paths), remoteDir))
 	} else {
 		// Not connected - show message
 		dialog.ShowInformation("Non connecté",
-			fmt.Sprintf("%d fichier(s) déposé(s).\nConnectez-vous à un serveur pour envoyer les fichiers.", fileCount),
+			fmt.Sprintf("%d élément(s) déposé(s).\nConnectez-vous à un serveur pour envoyer les fichiers.", len(paths)),
 			mw.window)
 	}
 }
 
 // Cleanup performs cleanup before exit.
 func (mw *MainWindow) Cleanup() {
+	if mw.transferMgr != nil {
+		mw.transferMgr.Stop()
+	}
 	if mw.client != nil {
 		mw.client.Disconnect()
 	}
-	if mw.transferMgr != nil {
-		mw.transferMgr.Stop()
+	if mw.resumeMgr != nil {
+		if err := mw.resumeMgr.Save(); err != nil {
+			mw.log.Warnf("Failed to save transfer journal: %v", err)
+		}
 	}
 }
 
@@ -829,12 +1307,26 @@ func (mw *MainWindow) applySettings() {
 	// Apply window size
 	mw.window.Resize(fyne.NewSize(float32(cfg.WindowWidth), float32(cfg.WindowHeight)))
 
-	// Apply show hidden files
+	// Apply show hidden files and columns
 	mw.localBrowser.SetShowHidden(cfg.ShowHiddenFiles)
 	mw.remoteBrowser.SetShowHidden(cfg.ShowHiddenFiles)
+	mw.localBrowser.SetColumns(cfg.BrowserColumns)
+	mw.remoteBrowser.SetColumns(cfg.BrowserColumns)
 
 	// Apply transfer settings
 	if mw.transferMgr != nil {
 		mw.transferMgr.SetMaxParallel(cfg.MaxParallelTransfers)
+		mw.transferMgr.SetVerify(cfg.VerifyTransfers)
+		mw.transferMgr.SetRetryPolicy(transfer.NewRetryPolicy(cfg.TransferRetries))
 	}
+	mw.applyRateLimits(mw.currentProfile)
+}
+
+// applyRateLimits updates the session bandwidth limits for profile.
+// Running transfers pick up the new rates immediately.
+func (mw *MainWindow) applyRateLimits(profile *config.ConnectionProfile) {
+	cfg := mw.configMgr.Get()
+	upload, download := cfg.RateLimits(profile)
+	mw.bandwidth.SetUploadRate(upload)
+	mw.bandwidth.SetDownloadRate(download)
 }
@@ -4,6 +4,7 @@ package ui
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -11,8 +12,13 @@ import (
 	"fyne.io/fyne/v2/widget"
 
 	"secure-ftp/internal/config"
+	"secure-ftp/internal/protocol"
+	"secure-ftp/internal/transfer"
 )
 
+// profileRateGlobal is the rate option that keeps the global bandwidth limit.
+const profileRateGlobal = "Réglage global"
+
 // ProfilesDialog handles profile management.
 type ProfilesDialog struct {
 	window         fyne.Window
@@ -32,8 +38,17 @@ type ProfilesDialog struct {
 	portEntry       *widget.Entry
 	usernameEntry   *widget.Entry
 	privateKeyEntry *widget.Entry
+	identityFilesEntry  *widget.Entry
+	identitiesOnlyCheck *widget.Check
+	authMethodsEntry    *widget.Entry
+	jumpProfilesEntry   *widget.Entry
+	proxyEntry          *widget.Entry
+	proxyPasswordEntry  *widget.Entry
 	remoteDirEntry  *widget.Entry
 	tlsImplicitCheck *widget.Check
+	atomicUploadsCheck *widget.Check
+	uploadRateSelect *widget.Select
+	downloadRateSelect *widget.Select
 }
 
 // NewProfilesDialog creates a new profiles management dialog.
@@ -97,10 +112,36 @@ func (pd *ProfilesDialog) buildDialog() {
 	pd.privateKeyEntry = widget.NewEntry()
 	pd.privateKeyEntry.SetPlaceHolder("~/.ssh/id_rsa")
 
+	// SSH authentication, as in ssh_config
+	pd.identityFilesEntry = widget.NewMultiLineEntry()
+	pd.identityFilesEntry.SetPlaceHolder("~/.ssh/id_ed25519\n(une clé par ligne)")
+	pd.identityFilesEntry.SetMinRowsVisible(2)
+	pd.identitiesOnlyCheck = widget.NewCheck("Uniquement ces clés (IdentitiesOnly)", nil)
+	pd.authMethodsEntry = widget.NewEntry()
+	pd.authMethodsEntry.SetPlaceHolder(strings.Join(protocol.DefaultAuthMethods, ", "))
+	pd.jumpProfilesEntry = widget.NewEntry()
+	pd.jumpProfilesEntry.SetPlaceHolder("bastion, rebond interne")
+
 	pd.remoteDirEntry = widget.NewEntry()
 	pd.remoteDirEntry.SetPlaceHolder("/home/utilisateur")
 
+	// Proxy overriding the global settings
+	pd.proxyEntry = widget.NewEntry()
+	pd.proxyEntry.SetPlaceHolder("Réglage global (« direct » : aucun proxy)")
+	pd.proxyPasswordEntry = newProxyPasswordEntry()
+
 	pd.tlsImplicitCheck = widget.NewCheck("TLS implicite", nil)
+	pd.atomicUploadsCheck = widget.NewCheck("Envois atomiques (nom temporaire puis renommage)", nil)
+
+	// Bandwidth limits overriding the global settings
+	rateOptions := []string{profileRateGlobal}
+	for _, p := range transfer.GetBandwidthPresets() {
+		rateOptions = append(rateOptions, p.Name)
+	}
+	pd.uploadRateSelect = widget.NewSelect(rateOptions, nil)
+	pd.uploadRateSelect.SetSelected(profileRateGlobal)
+	pd.downloadRateSelect = widget.NewSelect(rateOptions, nil)
+	pd.downloadRateSelect.SetSelected(profileRateGlobal)
 
 	// Buttons
 	saveBtn := widget.NewButton("Enregistrer", pd.saveProfile)
@@ -121,9 +162,25 @@ func (pd *ProfilesDialog) buildDialog() {
 		pd.usernameEntry,
 		widget.NewLabel("Clé privée :"),
 		pd.privateKeyEntry,
+		widget.NewLabel("Autres clés privées :"),
+		pd.identityFilesEntry,
+		pd.identitiesOnlyCheck,
+		widget.NewLabel("Ordre d'authentification SSH :"),
+		pd.authMethodsEntry,
+		widget.NewLabel("Rebonds SSH (profils, dans l'ordre) :"),
+		pd.jumpProfilesEntry,
 		widget.NewLabel("Répertoire distant :"),
 		pd.remoteDirEntry,
 		pd.tlsImplicitCheck,
+		widget.NewLabel("Proxy (SOCKS5 ou HTTP) :"),
+		pd.proxyEntry,
+		widget.NewLabel("Mot de passe du proxy :"),
+		pd.proxyPasswordEntry,
+		widget.NewLabel("Limite vitesse envoi :"),
+		pd.uploadRateSelect,
+		widget.NewLabel("Limite vitesse téléchargement :"),
+		pd.downloadRateSelect,
+		pd.atomicUploadsCheck,
 		widget.NewSeparator(),
 		container.NewHBox(saveBtn, deleteBtn, clearPwdBtn),
 	)
@@ -159,8 +216,20 @@ func (pd *ProfilesDialog) loadProfileToForm(index int) {
 	pd.portEntry.SetText(strconv.Itoa(profile.Port))
 	pd.usernameEntry.SetText(profile.Username)
 	pd.privateKeyEntry.SetText(profile.PrivateKeyPath)
+	pd.identityFilesEntry.SetText(strings.Join(profile.IdentityFiles, "\n"))
+	pd.identitiesOnlyCheck.SetChecked(profile.IdentitiesOnly)
+	pd.authMethodsEntry.SetText(strings.Join(profile.AuthMethods, ", "))
+	pd.jumpProfilesEntry.SetText(strings.Join(pd.jumpProfileNames(profile.JumpProfiles), ", "))
 	pd.remoteDirEntry.SetText(profile.RemoteDir)
 	pd.tlsImplicitCheck.SetChecked(profile.TLSImplicit)
+	pd.atomicUploadsCheck.SetChecked(profile.AtomicUploads)
+	pd.proxyEntry.SetText("")
+	if profile.Proxy != nil {
+		pd.proxyEntry.SetText(profile.Proxy.URL())
+	}
+	pd.proxyPasswordEntry.SetText("")
+	pd.uploadRateSelect.SetSelected(profileRateName(profile.UploadRateLimit))
+	pd.downloadRateSelect.SetSelected(profileRateName(profile.DownloadRateLimit))
 
 	switch profile.Protocol {
 	case "sftp":
@@ -185,25 +254,57 @@ func (pd *ProfilesDialog) saveProfile() {
 		return
 	}
 
-	protocol := "sftp"
+	authMethods, err := parseAuthMethods(pd.authMethodsEntry.Text)
+	if err != nil {
+		dialog.ShowError(err, pd.window)
+		return
+	}
+
+	protocolName := "sftp"
 	switch pd.protocolSelect.Selected {
 	case "FTPS":
-		protocol = "ftps"
+		protocolName = "ftps"
 	case "FTP":
-		protocol = "ftp"
+		protocolName = "ftp"
+	}
+
+	jumpProfiles, err := pd.parseJumpProfiles(pd.jumpProfilesEntry.Text, pd.profiles[pd.selectedIndex].ID)
+	if err != nil {
+		dialog.ShowError(err, pd.window)
+		return
+	}
+	if len(jumpProfiles) > 0 && protocolName != "sftp" {
+		dialog.ShowError(fmt.Errorf("Les rebonds SSH ne s'appliquent qu'aux profils SFTP"), pd.window)
+		return
+	}
+
+	proxy, err := parseProxyEntry(pd.proxyEntry.Text, pd.proxyPasswordEntry.Text, pd.credentialsMgr)
+	if err != nil {
+		dialog.ShowError(err, pd.window)
+		return
 	}
 
 	profile := config.ConnectionProfile{
-		ID:             pd.profiles[pd.selectedIndex].ID,
-		Name:           pd.nameEntry.Text,
-		Protocol:       protocol,
-		Host:           pd.hostEntry.Text,
-		Port:           port,
-		Username:       pd.usernameEntry.Text,
-		PrivateKeyPath: pd.privateKeyEntry.Text,
-		RemoteDir:      pd.remoteDirEntry.Text,
-		TLSImplicit:    pd.tlsImplicitCheck.Checked,
-		LastUsed:       pd.profiles[pd.selectedIndex].LastUsed,
+		ID:                pd.profiles[pd.selectedIndex].ID,
+		Name:              pd.nameEntry.Text,
+		Protocol:          protocolName,
+		Host:              pd.hostEntry.Text,
+		Port:              port,
+		Username:          pd.usernameEntry.Text,
+		PrivateKeyPath:    pd.privateKeyEntry.Text,
+		IdentityFiles:     splitLines(pd.identityFilesEntry.Text),
+		IdentitiesOnly:    pd.identitiesOnlyCheck.Checked,
+		AuthMethods:       authMethods,
+		JumpProfiles:      jumpProfiles,
+		RemoteDir:         pd.remoteDirEntry.Text,
+		TLSImplicit:       pd.tlsImplicitCheck.Checked,
+		LastUsed:          pd.profiles[pd.selectedIndex].LastUsed,
+		Timeout:           pd.profiles[pd.selectedIndex].Timeout,
+		LocalDir:          pd.profiles[pd.selectedIndex].LocalDir,
+		UploadRateLimit:   profileRateValue(pd.uploadRateSelect.Selected),
+		DownloadRateLimit: profileRateValue(pd.downloadRateSelect.Selected),
+		Proxy:             proxy,
+		AtomicUploads:     pd.atomicUploadsCheck.Checked,
 	}
 
 	if err := pd.configMgr.UpdateProfile(profile); err != nil {
@@ -276,8 +377,11 @@ func (pd *ProfilesDialog) clearPassword() {
 		dialog.ShowError(err, pd.window)
 		return
 	}
+	for _, keyPath := range profile.KeyFiles() {
+		pd.credentialsMgr.DeleteKeyPassphrase(keyPath)
+	}
 
-	dialog.ShowInformation("Succès", "Mot de passe enregistré effacé", pd.window)
+	dialog.ShowInformation("Succès", "Mot de passe et phrases de passe enregistrés effacés", pd.window)
 }
 
 // clearForm clears the edit form.
@@ -287,7 +391,115 @@ func (pd *ProfilesDialog) clearForm() {
 	pd.portEntry.SetText("")
 	pd.usernameEntry.SetText("")
 	pd.privateKeyEntry.SetText("")
+	pd.identityFilesEntry.SetText("")
+	pd.identitiesOnlyCheck.SetChecked(false)
+	pd.authMethodsEntry.SetText("")
+	pd.jumpProfilesEntry.SetText("")
 	pd.remoteDirEntry.SetText("")
 	pd.tlsImplicitCheck.SetChecked(false)
+	pd.atomicUploadsCheck.SetChecked(false)
+	pd.proxyEntry.SetText("")
+	pd.proxyPasswordEntry.SetText("")
+	pd.uploadRateSelect.SetSelected(profileRateGlobal)
+	pd.downloadRateSelect.SetSelected(profileRateGlobal)
 	pd.protocolSelect.ClearSelected()
 }
+
+// parseAuthMethods parses a comma or space separated list of SSH
+// authentication methods. An empty list selects the default order.
+func parseAuthMethods(text string) ([]string, error) {
+	var methods []string
+	for _, name := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !protocol.IsAuthMethod(name) {
+			return nil, fmt.Errorf("Méthode d'authentification inconnue : %s (valeurs possibles : %s)",
+				name, strings.Join(protocol.DefaultAuthMethods, ", "))
+		}
+		methods = append(methods, name)
+	}
+	return methods, nil
+}
+
+// parseJumpProfiles resolves a comma separated list of profile names to
+// profile IDs, for the profile with ID selfID.
+func (pd *ProfilesDialog) parseJumpProfiles(text, selfID string) ([]string, error) {
+	var ids []string
+	for _, name := range strings.Split(text, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		var jump *config.ConnectionProfile
+		for i := range pd.profiles {
+			if pd.profiles[i].Name == name || pd.profiles[i].ID == name {
+				jump = &pd.profiles[i]
+				break
+			}
+		}
+		switch {
+		case jump == nil:
+			return nil, fmt.Errorf("Profil de rebond inconnu : %s", name)
+		case jump.ID == selfID:
+			return nil, fmt.Errorf("Un profil ne peut pas servir de rebond à lui-même")
+		case jump.Protocol != "sftp":
+			return nil, fmt.Errorf("Le profil de rebond %s n'est pas un profil SFTP", name)
+		}
+		ids = append(ids, jump.ID)
+	}
+	return ids, nil
+}
+
+// jumpProfileNames returns the names of the jump profiles with the given IDs.
+func (pd *ProfilesDialog) jumpProfileNames(ids []string) []string {
+	var names []string
+	for _, id := range ids {
+		name := id
+		for _, p := range pd.profiles {
+			if p.ID == id {
+				name = p.Name
+				break
+			}
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// splitLines returns the non-empty trimmed lines of text.
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// profileRateName converts a profile rate limit to its option name.
+func profileRateName(rate int64) string {
+	if rate == 0 {
+		return profileRateGlobal
+	}
+	if rate == config.RateLimitUnlimited {
+		rate = transfer.BandwidthUnlimited
+	}
+	for _, p := range transfer.GetBandwidthPresets() {
+		if p.BytesPerSecond == rate {
+			return p.Name
+		}
+	}
+	return profileRateGlobal
+}
+
+// profileRateValue converts an option name to a profile rate limit.
+func profileRateValue(name string) int64 {
+	for _, p := range transfer.GetBandwidthPresets() {
+		if p.Name == name {
+			if p.BytesPerSecond == transfer.BandwidthUnlimited {
+				return config.RateLimitUnlimited
+			}
+			return p.BytesPerSecond
+		}
+	}
+	return 0
+}
@@ -2,6 +2,7 @@
 package ui
 
 import (
+	"fmt"
 	"strconv"
 
 	"fyne.io/fyne/v2"
@@ -15,29 +16,38 @@ import (
 
 // SettingsDialog handles application settings.
 type SettingsDialog struct {
-	window    fyne.Window
-	configMgr *config.ConfigManager
-	onSave    func()
+	window         fyne.Window
+	configMgr      *config.ConfigManager
+	credentialsMgr *config.CredentialsManager
+	onSave         func()
 
 	// UI components
 	themeSelect          *widget.Select
 	parallelTransfers    *widget.Entry
 	showHiddenFiles      *widget.Check
+	browserColumns       *widget.CheckGroup
 	defaultLocalDir      *widget.Entry
 	logLevelSelect       *widget.Select
 	windowWidth          *widget.Entry
 	windowHeight         *widget.Entry
 	uploadRateSelect     *widget.Select
 	downloadRateSelect   *widget.Select
+	verifyTransfers      *widget.Check
+	preserveTimestamps   *widget.Check
+	preservePermissions  *widget.Check
+	transferRetries      *widget.Entry
 	enableNotifications  *widget.Check
+	proxyEntry           *widget.Entry
+	proxyPasswordEntry   *widget.Entry
 }
 
 // NewSettingsDialog creates a new settings dialog.
-func NewSettingsDialog(parent fyne.Window, configMgr *config.ConfigManager, onSave func()) *SettingsDialog {
+func NewSettingsDialog(parent fyne.Window, configMgr *config.ConfigManager, credsMgr *config.CredentialsManager, onSave func()) *SettingsDialog {
 	return &SettingsDialog{
-		window:    parent,
-		configMgr: configMgr,
-		onSave:    onSave,
+		window:         parent,
+		configMgr:      configMgr,
+		credentialsMgr: credsMgr,
+		onSave:         onSave,
 	}
 }
 
@@ -77,10 +87,45 @@ func (sd *SettingsDialog) buildDialog() {
 	sd.showHiddenFiles = widget.NewCheck("", nil)
 	sd.showHiddenFiles.SetChecked(cfg.ShowHiddenFiles)
 
+	// Optional file browser columns
+	var columnHeaders, selectedHeaders []string
+	for _, column := range browserColumns {
+		columnHeaders = append(columnHeaders, column.header)
+		for _, id := range cfg.BrowserColumns {
+			if id == column.id {
+				selectedHeaders = append(selectedHeaders, column.header)
+			}
+		}
+	}
+	sd.browserColumns = widget.NewCheckGroup(columnHeaders, nil)
+	sd.browserColumns.SetSelected(selectedHeaders)
+
+	// Verify transfers
+	sd.verifyTransfers = widget.NewCheck("", nil)
+	sd.verifyTransfers.SetChecked(cfg.VerifyTransfers)
+
+	// Preserve attributes
+	sd.preserveTimestamps = widget.NewCheck("", nil)
+	sd.preserveTimestamps.SetChecked(cfg.PreserveTimestamps)
+	sd.preservePermissions = widget.NewCheck("", nil)
+	sd.preservePermissions.SetChecked(cfg.PreservePermissions)
+
+	// Automatic retries
+	sd.transferRetries = widget.NewEntry()
+	sd.transferRetries.SetText(strconv.Itoa(cfg.TransferRetries))
+
 	// Enable notifications
 	sd.enableNotifications = widget.NewCheck("", nil)
 	sd.enableNotifications.SetChecked(cfg.EnableNotifications)
 
+	// Proxy for every connection
+	sd.proxyEntry = widget.NewEntry()
+	sd.proxyEntry.SetPlaceHolder("socks5://utilisateur@proxy:1080")
+	if cfg.Proxy != nil {
+		sd.proxyEntry.SetText(cfg.Proxy.URL())
+	}
+	sd.proxyPasswordEntry = newProxyPasswordEntry()
+
 	// Default local directory
 	sd.defaultLocalDir = widget.NewEntry()
 	sd.defaultLocalDir.SetText(cfg.DefaultLocalDir)
@@ -142,6 +187,34 @@ func (sd *SettingsDialog) buildDialog() {
 			widget.NewLabel("Limite vitesse téléchargement :"),
 			sd.downloadRateSelect,
 		),
+		container.NewGridWithColumns(2,
+			widget.NewLabel("Vérifier l'intégrité (somme de contrôle) :"),
+			sd.verifyTransfers,
+		),
+		container.NewGridWithColumns(2,
+			widget.NewLabel("Conserver les dates de modification :"),
+			sd.preserveTimestamps,
+		),
+		container.NewGridWithColumns(2,
+			widget.NewLabel("Conserver les permissions (envois) :"),
+			sd.preservePermissions,
+		),
+		container.NewGridWithColumns(2,
+			widget.NewLabel("Nouvelles tentatives après une erreur réseau :"),
+			sd.transferRetries,
+		),
+
+		widget.NewLabel(""),
+		widget.NewLabel("Réseau"),
+		widget.NewSeparator(),
+		container.NewGridWithColumns(2,
+			widget.NewLabel("Proxy (SOCKS5 ou HTTP) :"),
+			sd.proxyEntry,
+		),
+		container.NewGridWithColumns(2,
+			widget.NewLabel("Mot de passe du proxy :"),
+			sd.proxyPasswordEntry,
+		),
 
 		widget.NewLabel(""),
 		widget.NewLabel("Navigateur de fichiers"),
@@ -150,6 +223,10 @@ func (sd *SettingsDialog) buildDialog() {
 			widget.NewLabel("Afficher fichiers cachés :"),
 			sd.showHiddenFiles,
 		),
+		container.NewGridWithColumns(2,
+			widget.NewLabel("Colonnes :"),
+			sd.browserColumns,
+		),
 		container.NewGridWithColumns(2,
 			widget.NewLabel("Répertoire local par défaut :"),
 			dirRow,
@@ -219,6 +296,21 @@ func (sd *SettingsDialog) saveSettings() {
 		return
 	}
 
+	transferRetries, err := strconv.Atoi(sd.transferRetries.Text)
+	if err != nil || transferRetries < 0 || transferRetries > 20 {
+		dialog.ShowError(&settingsError{"Les nouvelles tentatives doivent être entre 0 et 20"}, sd.window)
+		return
+	}
+
+	proxy, err := parseProxyEntry(sd.proxyEntry.Text, sd.proxyPasswordEntry.Text, sd.credentialsMgr)
+	if err != nil {
+		dialog.ShowError(err, sd.window)
+		return
+	}
+	if proxy != nil && proxy.Type == config.ProxyDirect {
+		proxy = nil
+	}
+
 	windowWidth, err := strconv.Atoi(sd.windowWidth.Text)
 	if err != nil || windowWidth < 400 {
 		dialog.ShowError(&settingsError{"La largeur de fenêtre doit être au moins 400"}, sd.window)
@@ -235,13 +327,26 @@ func (sd *SettingsDialog) saveSettings() {
 	cfg.Theme = sd.themeSelect.Selected
 	cfg.MaxParallelTransfers = parallelTransfers
 	cfg.ShowHiddenFiles = sd.showHiddenFiles.Checked
+	cfg.BrowserColumns = nil
+	for _, column := range browserColumns {
+		for _, header := range sd.browserColumns.Selected {
+			if header == column.header {
+				cfg.BrowserColumns = append(cfg.BrowserColumns, column.id)
+			}
+		}
+	}
 	cfg.DefaultLocalDir = sd.defaultLocalDir.Text
 	cfg.LogLevel = sd.logLevelSelect.Selected
 	cfg.WindowWidth = windowWidth
 	cfg.WindowHeight = windowHeight
 	cfg.UploadRateLimit = sd.presetNameToRate(sd.uploadRateSelect.Selected)
 	cfg.DownloadRateLimit = sd.presetNameToRate(sd.downloadRateSelect.Selected)
+	cfg.VerifyTransfers = sd.verifyTransfers.Checked
+	cfg.PreserveTimestamps = sd.preserveTimestamps.Checked
+	cfg.PreservePermissions = sd.preservePermissions.Checked
+	cfg.TransferRetries = transferRetries
 	cfg.EnableNotifications = sd.enableNotifications.Checked
+	cfg.Proxy = proxy
 
 	if err := sd.configMgr.Set(&cfg); err != nil {
 		dialog.ShowError(err, sd.window)
@@ -255,6 +360,39 @@ func (sd *SettingsDialog) saveSettings() {
 	dialog.ShowInformation("Paramètres", "Paramètres enregistrés. Certaines modifications nécessitent un redémarrage.", sd.window)
 }
 
+// newProxyPasswordEntry creates the entry of a proxy password, left empty to
+// keep the stored one.
+func newProxyPasswordEntry() *widget.Entry {
+	entry := widget.NewPasswordEntry()
+	entry.SetPlaceHolder("inchangé si vide")
+	return entry
+}
+
+// parseProxyEntry parses the proxy typed by the user and stores its password,
+// taken from password or from the URL itself, in the credentials.
+func parseProxyEntry(text, password string, credsMgr *config.CredentialsManager) (*config.ProxySettings, error) {
+	proxy, urlPassword, err := config.ParseProxyURL(text)
+	if err != nil {
+		return nil, fmt.Errorf("Proxy invalide : %w", err)
+	}
+	if password == "" {
+		password = urlPassword
+	}
+
+	if proxy != nil && password != "" {
+		if proxy.Username == "" {
+			return nil, fmt.Errorf("Proxy invalide : un mot de passe nécessite un nom d'utilisateur (socks5://utilisateur@hôte:port)")
+		}
+		if credsMgr == nil {
+			return nil, fmt.Errorf("Gestionnaire d'identifiants non disponible pour le mot de passe du proxy")
+		}
+		if err := credsMgr.SetProxyPassword(proxy.URL(), password); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
 type settingsError struct {
 	message string
 }
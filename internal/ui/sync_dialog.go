@@ -3,6 +3,7 @@ package ui
 
 import (
 	"fmt"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -17,20 +18,25 @@ type SyncDialog struct {
 	window    fyne.Window
 	localDir  string
 	remoteDir string
-	onSync    func(options ftpsync.SyncOptions, localDir, remoteDir string)
+	onSync    func(options ftpsync.SyncOptions, localDir, remoteDir string, watch bool)
 
 	// UI components
 	modeSelect        *widget.Select
 	comparisonSelect  *widget.Select
+	conflictSelect    *widget.Select
 	deleteExtra       *widget.Check
 	ignoreHidden      *widget.Check
 	dryRun            *widget.Check
+	watch             *widget.Check
+	atomicUploads     *widget.Check
 	excludePatterns   *widget.Entry
 	includePatterns   *widget.Entry
+	maxSize           *widget.Entry
+	maxAge            *widget.Entry
 }
 
 // NewSyncDialog creates a new sync dialog.
-func NewSyncDialog(parent fyne.Window, localDir, remoteDir string, onSync func(options ftpsync.SyncOptions, localDir, remoteDir string)) *SyncDialog {
+func NewSyncDialog(parent fyne.Window, localDir, remoteDir string, onSync func(options ftpsync.SyncOptions, localDir, remoteDir string, watch bool)) *SyncDialog {
 	return &SyncDialog{
 		window:    parent,
 		localDir:  localDir,
@@ -64,21 +70,43 @@ func (sd *SyncDialog) buildDialog() {
 	}, nil)
 	sd.comparisonSelect.SetSelectedIndex(0)
 
+	// Conflict policy (bidirectional mode only)
+	sd.conflictSelect = widget.NewSelect(conflictPolicyLabels, nil)
+	sd.conflictSelect.SetSelectedIndex(0)
+	sd.conflictSelect.Disable()
+	sd.modeSelect.OnChanged = func(string) {
+		if sd.modeSelect.SelectedIndex() == 3 {
+			sd.conflictSelect.Enable()
+		} else {
+			sd.conflictSelect.Disable()
+		}
+	}
+
 	// Options
 	sd.deleteExtra = widget.NewCheck("Supprimer les fichiers supplémentaires à la destination", nil)
 	sd.ignoreHidden = widget.NewCheck("Ignorer les fichiers cachés", nil)
 	sd.ignoreHidden.SetChecked(true)
 	sd.dryRun = widget.NewCheck("Simulation (aperçu uniquement)", nil)
+	sd.watch = widget.NewCheck("Surveillance continue (synchroniser les modifications en direct)", nil)
+	sd.atomicUploads = widget.NewCheck("Envois atomiques (nom temporaire puis renommage)", nil)
 
 	// Patterns
 	sd.excludePatterns = widget.NewEntry()
-	sd.excludePatterns.SetPlaceHolder("*.tmp, *.log, .git/")
+	sd.excludePatterns.SetPlaceHolder("*.tmp, **/node_modules/, !keep.log")
 	sd.excludePatterns.MultiLine = true
 
 	sd.includePatterns = widget.NewEntry()
 	sd.includePatterns.SetPlaceHolder("*.go, *.js, *.py")
 	sd.includePatterns.MultiLine = true
 
+	// Limits
+	sd.maxSize = widget.NewEntry()
+	sd.maxSize.SetPlaceHolder("ex. 2G (vide = sans limite)")
+	sd.maxAge = widget.NewEntry()
+	sd.maxAge.SetPlaceHolder("ex. 90d (vide = sans limite)")
+
+	testBtn := widget.NewButton("Tester un chemin...", sd.showRuleTest)
+
 	// Summary
 	summaryLabel := widget.NewLabel(fmt.Sprintf(
 		"Local : %s\nDistant : %s",
@@ -103,15 +131,22 @@ func (sd *SyncDialog) buildDialog() {
 		widget.NewSeparator(),
 		sd.comparisonSelect,
 
+		widget.NewLabel(""),
+		widget.NewLabel("Conflits (bidirectionnel)"),
+		widget.NewSeparator(),
+		sd.conflictSelect,
+
 		widget.NewLabel(""),
 		widget.NewLabel("Options"),
 		widget.NewSeparator(),
 		sd.deleteExtra,
 		sd.ignoreHidden,
 		sd.dryRun,
+		sd.watch,
+		sd.atomicUploads,
 
 		widget.NewLabel(""),
-		widget.NewLabel("Motifs d'exclusion (séparés par des virgules)"),
+		widget.NewLabel("Motifs d'exclusion, syntaxe .gitignore (séparés par des virgules)"),
 		widget.NewSeparator(),
 		sd.excludePatterns,
 
@@ -119,6 +154,16 @@ func (sd *SyncDialog) buildDialog() {
 		widget.NewLabel("Motifs d'inclusion (séparés par des virgules, optionnel)"),
 		widget.NewSeparator(),
 		sd.includePatterns,
+
+		widget.NewLabel(""),
+		widget.NewLabel("Limites"),
+		widget.NewSeparator(),
+		widget.NewForm(
+			widget.NewFormItem("Taille max.", sd.maxSize),
+			widget.NewFormItem("Ancienneté max.", sd.maxAge),
+		),
+		widget.NewLabel("Les fichiers "+ftpsync.IgnoreFileName+" du dossier local sont aussi appliqués."),
+		testBtn,
 	)
 
 	scroll := container.NewVScroll(form)
@@ -137,6 +182,19 @@ func (sd *SyncDialog) buildDialog() {
 
 // startSync starts the synchronization with the configured options.
 func (sd *SyncDialog) startSync() {
+	options, err := sd.buildOptions()
+	if err != nil {
+		dialog.ShowError(err, sd.window)
+		return
+	}
+
+	if sd.onSync != nil {
+		sd.onSync(options, sd.localDir, sd.remoteDir, sd.watch.Checked && !options.DryRun)
+	}
+}
+
+// buildOptions returns the sync options selected in the dialog.
+func (sd *SyncDialog) buildOptions() (ftpsync.SyncOptions, error) {
 	// Parse sync mode
 	var mode ftpsync.SyncMode
 	switch sd.modeSelect.SelectedIndex() {
@@ -170,13 +228,152 @@ func (sd *SyncDialog) startSync() {
 		DeleteExtra:     sd.deleteExtra.Checked,
 		IgnoreHidden:    sd.ignoreHidden.Checked,
 		DryRun:          sd.dryRun.Checked,
+		AtomicUploads:   sd.atomicUploads.Checked,
 		ExcludePatterns: parsePatterns(sd.excludePatterns.Text),
 		IncludePatterns: parsePatterns(sd.includePatterns.Text),
+		ConflictPolicy:  conflictPolicies[sd.conflictSelect.SelectedIndex()],
 	}
 
-	if sd.onSync != nil {
-		sd.onSync(options, sd.localDir, sd.remoteDir)
+	if text := trimSpace(sd.maxSize.Text); text != "" {
+		size, err := ftpsync.ParseSize(text)
+		if err != nil {
+			return options, err
+		}
+		options.MaxFileSize = size
+	}
+	if text := trimSpace(sd.maxAge.Text); text != "" {
+		age, err := ftpsync.ParseAge(text)
+		if err != nil {
+			return options, err
+		}
+		options.MaxFileAge = age
+	}
+
+	return options, nil
+}
+
+// showRuleTest asks for a path relative to the local folder and shows
+// whether the current rules exclude it, and why.
+func (sd *SyncDialog) showRuleTest() {
+	pathEntry := widget.NewEntry()
+	pathEntry.SetPlaceHolder("sous-dossier/fichier.log")
+
+	dialog.ShowForm("Tester les règles", "Tester", "Fermer",
+		[]*widget.FormItem{widget.NewFormItem("Chemin relatif", pathEntry)},
+		func(confirmed bool) {
+			if !confirmed || trimSpace(pathEntry.Text) == "" {
+				return
+			}
+			options, err := sd.buildOptions()
+			if err != nil {
+				dialog.ShowError(err, sd.window)
+				return
+			}
+
+			syncer := ftpsync.NewSyncer(nil, nil, options)
+			excluded, reason, err := syncer.Explain(sd.localDir, trimSpace(pathEntry.Text))
+			if err != nil {
+				dialog.ShowError(err, sd.window)
+				return
+			}
+
+			msg := "Ce chemin sera synchronisé."
+			if excluded {
+				msg = "Ce chemin est exclu."
+			}
+			if reason != "" {
+				msg += "\n\nRègle : " + reason
+			}
+			dialog.ShowInformation("Tester les règles", msg, sd.window)
+		}, sd.window)
+}
+
+// conflictPolicyLabels lists the conflict policies in the order of conflictPolicies.
+var conflictPolicyLabels = []string{
+	"Demander (vérifier avant de synchroniser)",
+	"Garder les deux versions",
+	"Préférer la version locale",
+	"Préférer la version distante",
+	"Préférer la plus grande",
+}
+
+var conflictPolicies = []ftpsync.ConflictPolicy{
+	ftpsync.ConflictAsk,
+	ftpsync.ConflictKeepBoth,
+	ftpsync.ConflictPreferLocal,
+	ftpsync.ConflictPreferRemote,
+	ftpsync.ConflictPreferLarger,
+}
+
+// ShowConflictReview lets the user resolve each sync conflict individually.
+// onResolve receives the chosen resolutions keyed by relative path; conflicts
+// left on "Demander" are omitted and stay unresolved. It is not called if the
+// review is cancelled.
+func ShowConflictReview(parent fyne.Window, conflicts []ftpsync.Conflict, onResolve func(map[string]ftpsync.ConflictPolicy)) {
+	selects := make([]*widget.Select, len(conflicts))
+	rows := container.NewVBox()
+
+	for i, c := range conflicts {
+		sel := widget.NewSelect(conflictPolicyLabels, nil)
+		sel.SetSelectedIndex(0)
+		selects[i] = sel
+
+		pathLabel := widget.NewLabelWithStyle(c.Path, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		pathLabel.Wrapping = fyne.TextWrapBreak
+		details := widget.NewLabel(fmt.Sprintf("%s\nLocal : %s\nDistant : %s",
+			c.Reason,
+			describeConflictSide(c.LocalExists, c.LocalSize, c.LocalModTime),
+			describeConflictSide(c.RemoteExists, c.RemoteSize, c.RemoteModTime),
+		))
+		details.Wrapping = fyne.TextWrapWord
+
+		rows.Add(container.NewVBox(pathLabel, details, sel, widget.NewSeparator()))
+	}
+
+	// Apply one choice to every conflict
+	all := widget.NewSelect(conflictPolicyLabels, nil)
+	all.PlaceHolder = "Appliquer à tous..."
+	all.OnChanged = func(string) {
+		for _, sel := range selects {
+			sel.SetSelectedIndex(all.SelectedIndex())
+		}
+	}
+
+	scroll := container.NewVScroll(rows)
+	scroll.SetMinSize(fyne.NewSize(450, 350))
+	content := container.NewBorder(
+		container.NewVBox(
+			widget.NewLabel(fmt.Sprintf("%d fichier(s) modifié(s) des deux côtés depuis la dernière synchronisation.", len(conflicts))),
+			all,
+		),
+		nil, nil, nil,
+		scroll,
+	)
+
+	dlg := dialog.NewCustomConfirm("Conflits de synchronisation", "Synchroniser", "Annuler", content,
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			resolutions := make(map[string]ftpsync.ConflictPolicy)
+			for i, sel := range selects {
+				if policy := conflictPolicies[sel.SelectedIndex()]; policy != ftpsync.ConflictAsk {
+					resolutions[conflicts[i].Path] = policy
+				}
+			}
+			onResolve(resolutions)
+		}, parent)
+
+	dlg.Resize(fyne.NewSize(550, 500))
+	dlg.Show()
+}
+
+// describeConflictSide formats one side of a conflict for display.
+func describeConflictSide(exists bool, size int64, modTime time.Time) string {
+	if !exists {
+		return "supprimé"
 	}
+	return fmt.Sprintf("%s, modifié le %s", formatBytes(size), modTime.Format("02/01/2006 15:04:05"))
 }
 
 // parsePatterns parses a comma-separated pattern string.
@@ -14,11 +14,32 @@ import (
 	"secure-ftp/internal/transfer"
 )
 
+// transferRow is a line of the transfer list: a single file transfer or a
+// directory transfer job.
+type transferRow struct {
+	item *transfer.TransferItem
+	job  *transfer.TransferJob
+}
+
+func (r transferRow) id() string {
+	if r.job != nil {
+		return r.job.ID
+	}
+	return r.item.ID
+}
+
+func (r transferRow) status() transfer.TransferStatus {
+	if r.job != nil {
+		return r.job.Status()
+	}
+	return r.item.Status
+}
+
 // TransferView displays the progress of file transfers.
 type TransferView struct {
 	container *fyne.Container
 	list      *widget.List
-	items     []*transfer.TransferItem
+	items     []transferRow
 	mu        sync.RWMutex
 
 	// Callbacks for transfer actions
@@ -26,12 +47,13 @@ type TransferView struct {
 	onResume func(id string)
 	onCancel func(id string)
 	onRetry  func(id string)
+	onClear  func()
 }
 
 // NewTransferView creates a new transfer view.
 func NewTransferView() *TransferView {
 	tv := &TransferView{
-		items: make([]*transfer.TransferItem, 0),
+		items: make([]transferRow, 0),
 	}
 
 	tv.buildUI()
@@ -89,15 +111,36 @@ func (tv *TransferView) buildUI() {
 				return
 			}
 
-			item := tv.items[id]
+			row := tv.items[id]
 			box := obj.(*fyne.Container)
 
+			// Directory jobs show their aggregate progress
+			var direction transfer.TransferDirection
+			var name, remotePath string
+			var progress float64
+			var speed int64
+			if job := row.job; job != nil {
+				completed, total := job.FileCounts()
+				direction = job.Direction
+				name = fmt.Sprintf("%s/ (%d/%d fichiers)", filepath.Base(job.LocalPath), completed, total)
+				remotePath = job.RemotePath
+				progress = job.Progress()
+				speed = job.BytesPerSecond()
+			} else {
+				item := row.item
+				direction = item.Direction
+				name = filepath.Base(item.LocalPath)
+				remotePath = item.RemotePath
+				progress = item.Progress()
+				speed = item.BytesPerSecond
+			}
+
 			// Info row (first row)
 			infoRow := box.Objects[0].(*fyne.Container)
 
 			// Direction icon
 			icon := infoRow.Objects[0].(*widget.Icon)
-			if item.Direction == transfer.DirectionUpload {
+			if direction == transfer.DirectionUpload {
 				icon.SetResource(theme.UploadIcon())
 			} else {
 				icon.SetResource(theme.DownloadIcon())
@@ -105,26 +148,26 @@ func (tv *TransferView) buildUI() {
 
 			// Filename
 			nameLabel := infoRow.Objects[1].(*widget.Label)
-			nameLabel.SetText(filepath.Base(item.LocalPath))
+			nameLabel.SetText(name)
 
 			// Remote path
 			remoteLabel := infoRow.Objects[3].(*widget.Label)
-			remoteLabel.SetText(item.RemotePath)
+			remoteLabel.SetText(remotePath)
 
 			// Progress row (second row)
 			progressRow := box.Objects[1].(*fyne.Container)
 
 			// Progress bar
 			progressBar := progressRow.Objects[0].(*widget.ProgressBar)
-			progressBar.SetValue(item.Progress() / 100)
+			progressBar.SetValue(progress / 100)
 
 			// Progress percentage
 			progressLabel := progressRow.Objects[1].(*widget.Label)
-			progressLabel.SetText(fmt.Sprintf("%.1f%%", item.Progress()))
+			progressLabel.SetText(fmt.Sprintf("%.1f%%", progress))
 
 			// Speed
 			speedLabel := progressRow.Objects[2].(*widget.Label)
-			speedLabel.SetText(formatSpeed(item.BytesPerSecond))
+			speedLabel.SetText(formatSpeed(speed))
 
 			// Action buttons
 			pauseBtn := progressRow.Objects[3].(*widget.Button)
@@ -133,7 +176,7 @@ func (tv *TransferView) buildUI() {
 			retryBtn := progressRow.Objects[6].(*widget.Button)
 
 			// Copy item ID for closure
-			itemID := item.ID
+			itemID := row.id()
 
 			// Set button callbacks
 			pauseBtn.OnTapped = func() {
@@ -163,15 +206,20 @@ func (tv *TransferView) buildUI() {
 			cancelBtn.Hide()
 			retryBtn.Hide()
 
-			switch item.Status {
+			switch row.status() {
 			case transfer.StatusPending:
 				pauseBtn.Show()
 				cancelBtn.Show()
 				progressLabel.SetText("En attente")
 				speedLabel.SetText("")
 			case transfer.StatusInProgress:
+				pauseBtn.Show()
 				cancelBtn.Show()
-				// Note: pause during transfer is complex, would need protocol support
+				if row.item != nil && !row.item.RetryAt.IsZero() {
+					// Waiting after a network error
+					progressLabel.SetText(fmt.Sprintf("Nouvel essai n°%d", row.item.Attempts+1))
+					speedLabel.SetText("à " + row.item.RetryAt.Format("15:04:05"))
+				}
 			case transfer.StatusPaused:
 				resumeBtn.Show()
 				cancelBtn.Show()
@@ -185,6 +233,9 @@ func (tv *TransferView) buildUI() {
 				progressLabel.SetText("Échec")
 				speedLabel.SetText("")
 			case transfer.StatusCancelled:
+				if row.job != nil {
+					retryBtn.Show()
+				}
 				progressLabel.SetText("Annulé")
 				speedLabel.SetText("")
 			}
@@ -215,7 +266,16 @@ func (tv *TransferView) GetContainer() *fyne.Container {
 // AddTransfer adds a transfer to the view.
 func (tv *TransferView) AddTransfer(item *transfer.TransferItem) {
 	tv.mu.Lock()
-	tv.items = append(tv.items, item)
+	tv.items = append(tv.items, transferRow{item: item})
+	tv.mu.Unlock()
+	tv.list.Refresh()
+}
+
+// AddJob adds a directory transfer to the view. Its files are shown as a
+// single line.
+func (tv *TransferView) AddJob(job *transfer.TransferJob) {
+	tv.mu.Lock()
+	tv.items = append(tv.items, transferRow{job: job})
 	tv.mu.Unlock()
 	tv.list.Refresh()
 }
@@ -225,8 +285,8 @@ func (tv *TransferView) UpdateTransfer(item *transfer.TransferItem) {
 	tv.mu.Lock()
 	// Find and update the item
 	for i, existing := range tv.items {
-		if existing.ID == item.ID {
-			tv.items[i] = item
+		if existing.item != nil && existing.item.ID == item.ID {
+			tv.items[i].item = item
 			break
 		}
 	}
@@ -234,11 +294,11 @@ func (tv *TransferView) UpdateTransfer(item *transfer.TransferItem) {
 	tv.list.Refresh()
 }
 
-// RemoveTransfer removes a transfer from the view.
+// RemoveTransfer removes a transfer or directory transfer from the view.
 func (tv *TransferView) RemoveTransfer(id string) {
 	tv.mu.Lock()
-	for i, item := range tv.items {
-		if item.ID == id {
+	for i, row := range tv.items {
+		if row.id() == id {
 			tv.items = append(tv.items[:i], tv.items[i+1:]...)
 			break
 		}
@@ -250,17 +310,22 @@ func (tv *TransferView) RemoveTransfer(id string) {
 // clearCompleted removes completed transfers from the view.
 func (tv *TransferView) clearCompleted() {
 	tv.mu.Lock()
-	var remaining []*transfer.TransferItem
-	for _, item := range tv.items {
-		if item.Status != transfer.StatusCompleted &&
-			item.Status != transfer.StatusFailed &&
-			item.Status != transfer.StatusCancelled {
-			remaining = append(remaining, item)
+	var remaining []transferRow
+	for _, row := range tv.items {
+		status := row.status()
+		if status != transfer.StatusCompleted &&
+			status != transfer.StatusFailed &&
+			status != transfer.StatusCancelled {
+			remaining = append(remaining, row)
 		}
 	}
 	tv.items = remaining
 	tv.mu.Unlock()
 	tv.list.Refresh()
+
+	if tv.onClear != nil {
+		tv.onClear()
+	}
 }
 
 // GetActiveCount returns the number of active transfers.
@@ -269,8 +334,9 @@ func (tv *TransferView) GetActiveCount() int {
 	defer tv.mu.RUnlock()
 
 	count := 0
-	for _, item := range tv.items {
-		if item.Status == transfer.StatusInProgress || item.Status == transfer.StatusPending {
+	for _, row := range tv.items {
+		status := row.status()
+		if status == transfer.StatusInProgress || status == transfer.StatusPending {
 			count++
 		}
 	}
@@ -314,3 +380,9 @@ func (tv *TransferView) SetOnCancel(fn func(id string)) {
 func (tv *TransferView) SetOnRetry(fn func(id string)) {
 	tv.onRetry = fn
 }
+
+// SetOnClearCompleted sets the callback called after ended transfers were
+// removed from the view.
+func (tv *TransferView) SetOnClearCompleted(fn func()) {
+	tv.onClear = fn
+}
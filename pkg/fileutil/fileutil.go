@@ -0,0 +1,48 @@
+// Package fileutil provides helpers for writing state files safely.
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicWriteFile writes data to path through a temporary file in the same
+// directory, synced and then renamed over path, so that a crash leaves either
+// the previous content or the new one, never a truncated file. Missing parent
+// directories are created.
+func AtomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	err = writeSync(tmp, data, perm)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+// writeSync writes data to f, sets its permissions and flushes it to disk.
+func writeSync(f *os.File, data []byte, perm os.FileMode) error {
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	// CreateTemp always creates the file with mode 0600
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,71 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state", "resume.json")
+
+	// The parent directory is created
+	if err := AtomicWriteFile(path, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An existing file is replaced
+	if err := AtomicWriteFile(path, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("content = %q, want %q", data, "second")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions = %o, want %o", perm, 0600)
+	}
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("directory holds %v, want only resume.json", names)
+	}
+}
+
+func TestAtomicWriteFileRemovesTemporaryFileOnError(t *testing.T) {
+	dir := t.TempDir()
+
+	// Renaming a file over a non-empty directory fails
+	target := filepath.Join(dir, "resume.json")
+	if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := AtomicWriteFile(target, []byte("new"), 0644); err == nil {
+		t.Fatal("AtomicWriteFile over a non-empty directory succeeded")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "resume.json" {
+		t.Errorf("directory holds %d entries, want only resume.json", len(entries))
+	}
+}